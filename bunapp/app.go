@@ -4,11 +4,20 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"net/http"
 	"os"
 	"os/signal"
 	"sync"
 	"sync/atomic"
 	"syscall"
+	"time"
+	"todo-app/pkg/clientip"
+	"todo-app/pkg/jwks"
+	"todo-app/pkg/lockout"
+	"todo-app/pkg/mailer"
+	"todo-app/pkg/oidc"
+	"todo-app/pkg/password"
+	"todo-app/pkg/storage"
 
 	"github.com/benbjohnson/clock"
 	"github.com/go-chi/chi"
@@ -52,6 +61,30 @@ type App struct {
 
 	storageOnce sync.Once
 	storage     *storage_go.Client
+
+	objectStorageOnce sync.Once
+	objectStorage     storage.Storage
+
+	mailerOnce sync.Once
+	mailer     mailer.Mailer
+
+	passwordOnce   sync.Once
+	passwordHasher *password.Set
+	passwordPolicy *password.Policy
+	passwordErr    error
+
+	limiterOnce sync.Once
+	limiter     *lockout.Limiter
+
+	keySetOnce sync.Once
+	keySet     *jwks.KeySet
+	keySetErr  error
+
+	oidcOnce      sync.Once
+	oidcProviders map[string]*oidc.Provider
+
+	clientIPOnce sync.Once
+	clientIP     clientip.Resolver
 }
 
 func New(ctx context.Context, cfg *AppConfig) *App {
@@ -79,6 +112,12 @@ func Start(ctx context.Context, service, envName string) (context.Context, *App,
 
 func StartConfig(ctx context.Context, cfg *AppConfig) (context.Context, *App, error) {
 	app := New(ctx, cfg)
+	if _, err := app.KeySet(); err != nil {
+		return nil, nil, err
+	}
+	if _, err := app.PasswordPolicy(); err != nil {
+		return nil, nil, err
+	}
 	if err := onStart.Run(ctx, app); err != nil {
 		return nil, nil, err
 	}
@@ -164,6 +203,270 @@ func (app *App) Storage() *storage_go.Client {
 	return app.storage
 }
 
+// ObjectStorage keeps generated files like data exports. It uses Supabase
+// when it is configured and a local directory otherwise.
+func (app *App) ObjectStorage() storage.Storage {
+	app.objectStorageOnce.Do(func() {
+		cfg := app.cfg.Storage
+		driver := cfg.Driver
+		if driver == "" && app.cfg.Supabase.StorageURI != "" {
+			driver = "supabase"
+		}
+		switch driver {
+		case "supabase":
+			bucket := cfg.Bucket
+			if bucket == "" {
+				bucket = "exports"
+			}
+			app.objectStorage = &storage.SupabaseStorage{Client: app.Storage(), Bucket: bucket}
+		case "memory":
+			app.objectStorage = &storage.MemoryStorage{}
+		default:
+			dir := cfg.Dir
+			if dir == "" {
+				dir = "data/storage"
+			}
+			app.objectStorage = &storage.LocalStorage{Dir: dir}
+		}
+	})
+	return app.objectStorage
+}
+
+// For mocks
+func (app *App) SetObjectStorage(s storage.Storage) {
+	app.objectStorageOnce.Do(func() {})
+	app.objectStorage = s
+}
+
+func (app *App) Mailer() mailer.Mailer {
+	app.mailerOnce.Do(func() {
+		cfg := app.cfg.Mail
+		switch cfg.Driver {
+		case "smtp":
+			app.mailer = &mailer.SMTPMailer{
+				Host:     cfg.SMTPHost,
+				Port:     cfg.SMTPPort,
+				Username: cfg.SMTPUsername,
+				Password: cfg.SMTPPassword,
+				From:     cfg.From,
+			}
+		case "file":
+			app.mailer = &mailer.FileMailer{Dir: cfg.Dir, From: cfg.From}
+		default:
+			app.mailer = &mailer.MemoryMailer{}
+		}
+	})
+	return app.mailer
+}
+
+// For mocks
+func (app *App) SetMailer(m mailer.Mailer) {
+	app.mailerOnce.Do(func() {})
+	app.mailer = m
+}
+
+func (app *App) initPassword() {
+	app.passwordOnce.Do(func() {
+		cfg := app.cfg.Password
+
+		argon := password.DefaultArgon2id
+		if cfg.Argon2id.Memory != 0 {
+			argon.Memory = cfg.Argon2id.Memory
+		}
+		if cfg.Argon2id.Iterations != 0 {
+			argon.Iterations = cfg.Argon2id.Iterations
+		}
+		if cfg.Argon2id.Parallelism != 0 {
+			argon.Parallelism = cfg.Argon2id.Parallelism
+		}
+		bcrypt := &password.Bcrypt{Cost: cfg.BcryptCost}
+
+		if cfg.Algorithm == "bcrypt" {
+			app.passwordHasher = password.NewSet(bcrypt, &argon)
+		} else {
+			app.passwordHasher = password.NewSet(&argon, bcrypt)
+		}
+
+		app.passwordPolicy = password.NewPolicy()
+		if cfg.MinLength != 0 {
+			app.passwordPolicy.MinLength = cfg.MinLength
+		}
+		if cfg.BreachedList != "" {
+			app.passwordErr = app.passwordPolicy.LoadBreached(cfg.BreachedList)
+		}
+	})
+}
+
+// PasswordHasher hashes new passwords with the configured algorithm.
+func (app *App) PasswordHasher() *password.Set {
+	app.initPassword()
+	return app.passwordHasher
+}
+
+// PasswordPolicy is what new passwords are checked against.
+func (app *App) PasswordPolicy() (*password.Policy, error) {
+	app.initPassword()
+	return app.passwordPolicy, app.passwordErr
+}
+
+// LoginLimiter tracks failed logins per account and per client address.
+func (app *App) LoginLimiter() *lockout.Limiter {
+	app.limiterOnce.Do(func() {
+		if app.cfg.Lockout.Store == "memory" {
+			app.limiter = lockout.NewLimiter(lockout.NewMemoryStore())
+			return
+		}
+		app.limiter = lockout.NewLimiter(lockout.NewDBStore(app.DB()))
+	})
+	return app.limiter
+}
+
+// For mocks
+func (app *App) SetLoginLimiter(l *lockout.Limiter) {
+	app.limiterOnce.Do(func() {})
+	app.limiter = l
+}
+
+// ClientIP returns the address of the client of r, read from the proxy
+// headers only when r comes from a trusted proxy.
+func (app *App) ClientIP(r *http.Request) string {
+	app.clientIPOnce.Do(func() {
+		// ReadConfig validated the proxies.
+		app.clientIP.Trusted, _ = clientip.ParseTrusted(app.cfg.Proxy.TrustedProxies)
+	})
+	return app.clientIP.IP(r)
+}
+
+// KeySet returns the keys access tokens are signed and verified with, or nil
+// when no signing key is configured.
+func (app *App) KeySet() (*jwks.KeySet, error) {
+	app.keySetOnce.Do(func() {
+		if app.cfg.Jwt.SigningKey == "" {
+			return
+		}
+
+		keys := make([]*jwks.Key, 0, len(app.cfg.Jwt.Keys))
+		for _, kc := range app.cfg.Jwt.Keys {
+			var privatePEM, publicPEM []byte
+			if kc.PrivateKeyFile != "" {
+				if privatePEM, app.keySetErr = os.ReadFile(kc.PrivateKeyFile); app.keySetErr != nil {
+					return
+				}
+			}
+			if kc.PublicKeyFile != "" {
+				if publicPEM, app.keySetErr = os.ReadFile(kc.PublicKeyFile); app.keySetErr != nil {
+					return
+				}
+			}
+
+			key, err := jwks.NewKey(kc.ID, kc.Algorithm, privatePEM, publicPEM)
+			if err != nil {
+				app.keySetErr = err
+				return
+			}
+			keys = append(keys, key)
+		}
+		app.keySet, app.keySetErr = jwks.NewKeySet(app.cfg.Jwt.SigningKey, keys...)
+	})
+	return app.keySet, app.keySetErr
+}
+
+// OIDCProvider returns the configured OpenID Connect provider called name.
+func (app *App) OIDCProvider(name string) (*oidc.Provider, bool) {
+	app.oidcOnce.Do(func() {
+		app.oidcProviders = make(map[string]*oidc.Provider, len(app.cfg.OIDC.Providers))
+		for _, p := range app.cfg.OIDC.Providers {
+			app.oidcProviders[p.Name] = oidc.NewProvider(oidc.Config{
+				Issuer:       p.Issuer,
+				ClientID:     p.ClientID,
+				ClientSecret: p.ClientSecret,
+				RedirectURL:  p.RedirectURL,
+				Scopes:       p.Scopes,
+			}, nil)
+		}
+	})
+	provider, ok := app.oidcProviders[name]
+	return provider, ok
+}
+
+// OIDCProviderNames returns the names of the configured providers.
+func (app *App) OIDCProviderNames() []string {
+	names := make([]string, 0, len(app.cfg.OIDC.Providers))
+	for _, p := range app.cfg.OIDC.Providers {
+		names = append(names, p.Name)
+	}
+	return names
+}
+
+// DeletionGracePeriod is how long deleted accounts are kept before they
+// are purged.
+func (app *App) DeletionGracePeriod() time.Duration {
+	if app.cfg.Account.DeletionGracePeriod > 0 {
+		return app.cfg.Account.DeletionGracePeriod
+	}
+	return 30 * 24 * time.Hour
+}
+
+// PurgeInterval is how often the purge of deleted accounts runs.
+func (app *App) PurgeInterval() time.Duration {
+	if app.cfg.Account.PurgeInterval > 0 {
+		return app.cfg.Account.PurgeInterval
+	}
+	return time.Hour
+}
+
+// GuestTTL is how long guest accounts are kept after they were last used.
+func (app *App) GuestTTL() time.Duration {
+	if app.cfg.Account.GuestTTL > 0 {
+		return app.cfg.Account.GuestTTL
+	}
+	return 30 * 24 * time.Hour
+}
+
+// ExportRetention is how long a data export can be downloaded.
+func (app *App) ExportRetention() time.Duration {
+	if app.cfg.Export.Retention > 0 {
+		return app.cfg.Export.Retention
+	}
+	return 7 * 24 * time.Hour
+}
+
+// ExportLinkTTL is how long a data export download link is valid.
+func (app *App) ExportLinkTTL() time.Duration {
+	if app.cfg.Export.LinkTTL > 0 {
+		return app.cfg.Export.LinkTTL
+	}
+	return 15 * time.Minute
+}
+
+// ReminderInterval is how often the reminder scheduler runs.
+func (app *App) ReminderInterval() time.Duration {
+	if app.cfg.Reminders.Interval > 0 {
+		return app.cfg.Reminders.Interval
+	}
+	return 15 * time.Second
+}
+
+// ReminderMaxAttempts is how often the delivery of a reminder is tried.
+func (app *App) ReminderMaxAttempts() int {
+	if app.cfg.Reminders.MaxAttempts > 0 {
+		return app.cfg.Reminders.MaxAttempts
+	}
+	return 8
+}
+
+// SubtaskDepthLimit bounds the configurable depth of subtasks and the
+// queries that walk a tree of subtasks.
+const SubtaskDepthLimit = 50
+
+// SubtaskMaxDepth is how many levels subtasks nest below a top-level todo.
+func (app *App) SubtaskMaxDepth() int {
+	if app.cfg.Subtasks.MaxDepth > 0 {
+		return app.cfg.Subtasks.MaxDepth
+	}
+	return 5
+}
+
 func WaitExitSignal() os.Signal {
 	ch := make(chan os.Signal, 3)
 	signal.Notify(
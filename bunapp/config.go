@@ -2,10 +2,13 @@ package bunapp
 
 import (
 	"embed"
+	"errors"
 	"fmt"
 	"io/fs"
 	"path"
 	"sync"
+	"time"
+	"todo-app/pkg/clientip"
 
 	"gopkg.in/yaml.v3"
 )
@@ -41,6 +44,10 @@ type AppConfig	struct {
 	Jwt struct {
 		Secret string
 		RefreshSecret string
+		// SigningKey is the id of the key in Keys that signs access tokens.
+		// When it is empty access tokens are signed with Secret (HS256).
+		SigningKey string
+		Keys []JwtKeyConfig
 	}
 	Supabase struct {
 		StorageURI string
@@ -48,7 +55,118 @@ type AppConfig	struct {
 		JwtSecret string
 		ContractBucket string
 	}
+	Mail struct {
+		// Driver is smtp, file or memory. Defaults to memory.
+		Driver string
+		From string
+		SMTPHost string
+		SMTPPort int
+		SMTPUsername string
+		SMTPPassword string
+		// Dir is where the file driver writes the messages.
+		Dir string
+	}
+	Password struct {
+		// Algorithm is argon2id or bcrypt. Defaults to argon2id. Hashes of
+		// the other algorithm keep working and are upgraded on login.
+		Algorithm string
+		Argon2id struct {
+			Memory uint32 // KiB
+			Iterations uint32
+			Parallelism uint8
+		}
+		BcryptCost int
+		MinLength int
+		// BreachedList is a file of breached passwords, one per line in
+		// clear or as SHA-1 hex.
+		BreachedList string
+	}
+	Lockout struct {
+		// Store is postgres or memory. Defaults to postgres.
+		Store string
+	}
+	Proxy struct {
+		// TrustedProxies are the addresses or CIDR ranges of the reverse
+		// proxies in front of the server. The client address is only read
+		// from X-Forwarded-For and X-Real-IP on requests they forward.
+		TrustedProxies []string
+	}
+	OIDC struct {
+		Providers []OIDCProviderConfig
+	}
+	Account struct {
+		// DeletionGracePeriod is how long a deleted account is kept before
+		// it is purged. Defaults to 30 days.
+		DeletionGracePeriod time.Duration
+		// PurgeInterval is how often the server looks for accounts to
+		// purge. Defaults to an hour.
+		PurgeInterval time.Duration
+		// GuestTTL is how long a guest account is kept after it was last
+		// used. Defaults to 30 days.
+		GuestTTL time.Duration
+	}
+	Storage struct {
+		// Driver is supabase, local or memory. Defaults to supabase when
+		// supabase.storageuri is set and to local otherwise.
+		Driver string
+		// Dir is where the local driver writes the files. Defaults to
+		// data/storage.
+		Dir string
+		// Bucket is the Supabase bucket of the supabase driver.
+		Bucket string
+	}
+	Export struct {
+		// Retention is how long a data export can be downloaded. Defaults
+		// to 7 days.
+		Retention time.Duration
+		// LinkTTL is how long a download link is valid. Defaults to 15
+		// minutes.
+		LinkTTL time.Duration
+	}
+	Reminders struct {
+		// Interval is how often the scheduler looks for due reminders.
+		// Defaults to 15 seconds.
+		Interval time.Duration
+		// MaxAttempts is how often a delivery is tried before it fails.
+		// Defaults to 8.
+		MaxAttempts int
+		// WebhookURL receives the reminders of the webhook channel, signed
+		// with WebhookSecret. The channel is disabled without it.
+		WebhookURL string
+		WebhookSecret string
+	}
+	Subtasks struct {
+		// MaxDepth is how many levels subtasks nest below a top-level todo,
+		// at most SubtaskDepthLimit. Defaults to 5.
+		MaxDepth int
+	}
+	// BaseURL of the web app, used to build the links sent by email.
+	BaseURL string
 	DBURL string
+	// Service is the command the app was started for, api for the server.
+	Service string
+}
+
+// JwtKeyConfig describes an asymmetric access token key. Keys that are only
+// listed with a public key keep verifying tokens signed before a rotation;
+// a key is retired by removing it from the config.
+type JwtKeyConfig struct {
+	ID             string
+	Algorithm      string // RS256, ES256 or EdDSA
+	PrivateKeyFile string
+	PublicKeyFile  string
+}
+
+// OIDCProviderConfig is an OpenID Connect provider users can log in with.
+// Name is used in the URLs, RedirectURL must point to
+// /api/auth/oidc/{name}/callback of this server.
+type OIDCProviderConfig struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
 }
 
 func ReadConfig(fsys fs.FS, service, env string) (*AppConfig, error) {
@@ -64,6 +182,66 @@ func ReadConfig(fsys fs.FS, service, env string) (*AppConfig, error) {
 		return nil, err
 	}
 
+	if cfg.Jwt.RefreshSecret == "" {
+		return nil, errors.New("jwt refresh secret is required")
+	}
+	if cfg.Jwt.Secret == "" && cfg.Jwt.SigningKey == "" {
+		return nil, errors.New("jwt secret or signing key is required")
+	}
+	if cfg.Mail.Driver == "smtp" && cfg.Mail.SMTPHost == "" {
+		return nil, errors.New("mail smtp host is required")
+	}
+	if cfg.Mail.Driver == "file" && cfg.Mail.Dir == "" {
+		return nil, errors.New("mail dir is required")
+	}
+	if cfg.Password.Algorithm != "" && cfg.Password.Algorithm != "argon2id" && cfg.Password.Algorithm != "bcrypt" {
+		return nil, fmt.Errorf("unknown password algorithm %q", cfg.Password.Algorithm)
+	}
+	if cfg.Lockout.Store != "" && cfg.Lockout.Store != "postgres" && cfg.Lockout.Store != "memory" {
+		return nil, fmt.Errorf("unknown lockout store %q", cfg.Lockout.Store)
+	}
+	if _, err := clientip.ParseTrusted(cfg.Proxy.TrustedProxies); err != nil {
+		return nil, err
+	}
+	names := make(map[string]bool, len(cfg.OIDC.Providers))
+	for _, p := range cfg.OIDC.Providers {
+		if p.Name == "" || p.Issuer == "" || p.ClientID == "" || p.RedirectURL == "" {
+			return nil, errors.New("oidc providers need a name, issuer, clientid and redirecturl")
+		}
+		if names[p.Name] {
+			return nil, fmt.Errorf("duplicate oidc provider %q", p.Name)
+		}
+		names[p.Name] = true
+	}
+	if cfg.Account.DeletionGracePeriod < 0 || cfg.Account.PurgeInterval < 0 || cfg.Account.GuestTTL < 0 {
+		return nil, errors.New("account durations cannot be negative")
+	}
+	switch cfg.Storage.Driver {
+	case "", "local", "memory":
+	case "supabase":
+		if cfg.Supabase.StorageURI == "" {
+			return nil, errors.New("supabase storageuri is required by the supabase storage driver")
+		}
+	default:
+		return nil, fmt.Errorf("unknown storage driver %q", cfg.Storage.Driver)
+	}
+	if cfg.Export.Retention < 0 || cfg.Export.LinkTTL < 0 {
+		return nil, errors.New("export durations cannot be negative")
+	}
+	if cfg.Reminders.Interval < 0 || cfg.Reminders.MaxAttempts < 0 {
+		return nil, errors.New("reminder settings cannot be negative")
+	}
+	if cfg.Reminders.WebhookURL != "" && cfg.Reminders.WebhookSecret == "" {
+		return nil, errors.New("reminders webhooksecret is required by the webhook channel")
+	}
+	if cfg.Subtasks.MaxDepth < 0 || cfg.Subtasks.MaxDepth > SubtaskDepthLimit {
+		return nil, fmt.Errorf("subtasks maxdepth must be between 0 and %d", SubtaskDepthLimit)
+	}
+	if cfg.Jwt.Secret == cfg.Jwt.RefreshSecret {
+		return nil, errors.New("jwt refresh secret must differ from the access token secret")
+	}
+
+	cfg.Service = service
 	cfg.DBURL = "postgres://" + cfg.Db.User + ":" + cfg.Db.Password + "@" + cfg.Db.Host + ":" + fmt.Sprint(cfg.Db.Port) + "/" + cfg.Db.Database + "?sslmode=disable"
 	fmt.Printf("DBURL: %s\n", cfg.DBURL)
 	return cfg, nil
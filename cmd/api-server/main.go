@@ -10,8 +10,11 @@ import (
 	"todo-app/bunapp"
 	"todo-app/cmd/api-server/migrations"
 	"todo-app/httputil"
+	"todo-app/internal/db"
+	"todo-app/internal/jobs"
 	"todo-app/internal/routes"
 
+	_ "time/tzdata"
 	_ "todo-app/internal/docs"
 
 	"github.com/uptrace/bun/migrate"
@@ -31,10 +34,12 @@ func main() {
 		Commands: []*cli.Command{
 			serverCommand,
 			newDBCommand(migrations.Migrations),
+			userCommand,
 		},
 	}
 
 	routes.SetupRoutes()
+	jobs.SetupReminders()
 	if err := app.Run(os.Args); err != nil {
 		log.Fatal(err)
 	}
@@ -59,6 +64,9 @@ var serverCommand = &cli.Command{
 		}
 		defer app.Stop()
 
+		jobs.StartAccountPurge(app)
+		jobs.StartDataExports(app)
+
 		var handler http.Handler
 		handler = app.Router()
 		handler = httputil.ExitOnPanicHandler{Next: handler}
@@ -84,6 +92,103 @@ var serverCommand = &cli.Command{
 	},
 }
 
+var userCommand = &cli.Command{
+	Name:  "user",
+	Usage: "manage users",
+	Subcommands: []*cli.Command{
+		{
+			Name:      "unlock",
+			Usage:     "lift the login lockout of a user or a client address",
+			ArgsUsage: "<username>",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:  "ip",
+					Usage: "unlock this client address instead of a user",
+				},
+			},
+			Action: func(c *cli.Context) error {
+				ctx, app, err := bunapp.StartCLI(c)
+				if err != nil {
+					return err
+				}
+				defer app.Stop()
+
+				if ip := c.String("ip"); ip != "" {
+					if err := app.LoginLimiter().UnlockIP(ctx, ip); err != nil {
+						return err
+					}
+					fmt.Printf("unlocked %s\n", ip)
+					return nil
+				}
+
+				username := c.Args().First()
+				if username == "" {
+					return fmt.Errorf("username is required")
+				}
+				if err := app.LoginLimiter().Unlock(ctx, username); err != nil {
+					return err
+				}
+				fmt.Printf("unlocked %s\n", username)
+				return nil
+			},
+		},
+		{
+			Name:      "role",
+			Usage:     "set the role of a user (user or admin)",
+			ArgsUsage: "<username> <role>",
+			Action: func(c *cli.Context) error {
+				ctx, app, err := bunapp.StartCLI(c)
+				if err != nil {
+					return err
+				}
+				defer app.Stop()
+
+				username, role := c.Args().Get(0), c.Args().Get(1)
+				if username == "" || (role != db.RoleUser && role != db.RoleAdmin) {
+					return fmt.Errorf("usage: user role <username> user|admin")
+				}
+
+				res, err := app.DB().NewUpdate().Model((*db.User)(nil)).
+					Set("role = ?", role).
+					Where("username = ?", username).
+					Where("NOT is_anonymous").
+					Exec(ctx)
+				if err != nil {
+					return err
+				}
+				if n, _ := res.RowsAffected(); n == 0 {
+					return fmt.Errorf("user %s not found", username)
+				}
+				fmt.Printf("%s is now %s, new logins carry the role\n", username, role)
+				return nil
+			},
+		},
+		{
+			Name:  "purge",
+			Usage: "remove the deleted accounts whose grace period is over and the stale guest accounts",
+			Action: func(c *cli.Context) error {
+				ctx, app, err := bunapp.StartCLI(c)
+				if err != nil {
+					return err
+				}
+				defer app.Stop()
+
+				n, err := jobs.PurgeDeletedUsers(ctx, app)
+				if err != nil {
+					return err
+				}
+				fmt.Printf("purged %d accounts\n", n)
+				n, err = jobs.PurgeStaleGuests(ctx, app)
+				if err != nil {
+					return err
+				}
+				fmt.Printf("purged %d guest accounts\n", n)
+				return nil
+			},
+		},
+	},
+}
+
 func newDBCommand(migrations *migrate.Migrations) *cli.Command {
 	return &cli.Command{
 		Name:  "db",
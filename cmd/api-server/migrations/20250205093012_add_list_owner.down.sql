@@ -0,0 +1,6 @@
+SET statement_timeout = 0;
+DROP INDEX IF EXISTS public.idx_todos_list_id;
+--bun:split
+DROP INDEX IF EXISTS public.idx_lists_user_id;
+--bun:split
+ALTER TABLE public.lists DROP COLUMN IF EXISTS user_id;
@@ -0,0 +1,34 @@
+SET statement_timeout = 0;
+-- Lists take their owner from their todos. Lists without todos or with the
+-- todos of several users have no clear owner, stop instead of guessing or
+-- dropping them.
+DO $$
+DECLARE
+    empty text;
+    shared text;
+BEGIN
+    SELECT string_agg(l.id::text, ', ' ORDER BY l.id) INTO empty
+    FROM public.lists l
+    WHERE NOT EXISTS (SELECT 1 FROM public.todos t WHERE t.list_id = l.id);
+    IF empty IS NOT NULL THEN
+        RAISE EXCEPTION 'lists % have no todos to take the owner from, add a todo to them or delete them before migrating', empty;
+    END IF;
+
+    SELECT string_agg(s.list_id::text, ', ' ORDER BY s.list_id) INTO shared
+    FROM (SELECT list_id FROM public.todos GROUP BY list_id HAVING COUNT(DISTINCT user_id) > 1) s;
+    IF shared IS NOT NULL THEN
+        RAISE EXCEPTION 'lists % hold the todos of several users, move the todos so that each list belongs to one user before migrating', shared;
+    END IF;
+END $$;
+--bun:split
+ALTER TABLE public.lists ADD COLUMN user_id bigint;
+--bun:split
+UPDATE public.lists l SET user_id = (SELECT MIN(t.user_id) FROM public.todos t WHERE t.list_id = l.id);
+--bun:split
+ALTER TABLE public.lists
+    ALTER COLUMN user_id SET NOT NULL,
+    ADD CONSTRAINT fk_lists_users FOREIGN KEY (user_id) REFERENCES public.users(id) ON DELETE CASCADE;
+--bun:split
+CREATE INDEX idx_lists_user_id ON public.lists(user_id);
+--bun:split
+CREATE INDEX idx_todos_list_id ON public.todos(list_id);
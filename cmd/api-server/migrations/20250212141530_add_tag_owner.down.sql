@@ -0,0 +1,6 @@
+SET statement_timeout = 0;
+DROP INDEX IF EXISTS public.idx_todo_tags_tag_id;
+--bun:split
+ALTER TABLE public.todo_tags DROP CONSTRAINT IF EXISTS uq_todo_tags_todo_id_tag_id;
+--bun:split
+ALTER TABLE public.tags DROP COLUMN IF EXISTS user_id;
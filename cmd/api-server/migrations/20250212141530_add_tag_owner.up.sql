@@ -0,0 +1,53 @@
+SET statement_timeout = 0;
+-- Tags take their owner from the todos they are on. Tags on no todo have
+-- no owner, stop instead of guessing or dropping them.
+DO $$
+DECLARE
+    unused text;
+BEGIN
+    SELECT string_agg(tg.id::text, ', ' ORDER BY tg.id) INTO unused
+    FROM public.tags tg
+    WHERE NOT EXISTS (SELECT 1 FROM public.todo_tags tt WHERE tt.tag_id = tg.id);
+    IF unused IS NOT NULL THEN
+        RAISE EXCEPTION 'tags % are not on any todo and have no owner, attach them to a todo or delete them before migrating', unused;
+    END IF;
+END $$;
+--bun:split
+ALTER TABLE public.tags ADD COLUMN user_id bigint;
+--bun:split
+-- A tag on the todos of several users goes to the one with the lowest id.
+UPDATE public.tags tg SET user_id = (
+    SELECT MIN(t.user_id) FROM public.todo_tags tt JOIN public.todos t ON t.id = tt.todo_id WHERE tt.tag_id = tg.id
+);
+--bun:split
+-- The other users get a tag of the same name of their own.
+INSERT INTO public.tags (name, user_id, created_at, updated_at)
+SELECT tg.name, t.user_id, MIN(tg.created_at), MAX(tg.updated_at)
+FROM public.todo_tags tt
+JOIN public.todos t ON t.id = tt.todo_id
+JOIN public.tags tg ON tg.id = tt.tag_id
+WHERE NOT EXISTS (SELECT 1 FROM public.tags o WHERE o.user_id = t.user_id AND o.name = tg.name)
+GROUP BY tg.name, t.user_id;
+--bun:split
+-- Every todo points at the first tag of its user with the name of its tag,
+-- which also merges tags of the same user and name.
+UPDATE public.todo_tags tt SET tag_id = (
+    SELECT MIN(k.id) FROM public.tags k WHERE k.user_id = t.user_id AND k.name = tg.name
+)
+FROM public.todos t, public.tags tg
+WHERE t.id = tt.todo_id AND tg.id = tt.tag_id;
+--bun:split
+-- Every tag was on a todo above, so the tags left without todos are the
+-- merged duplicates.
+DELETE FROM public.tags tg WHERE NOT EXISTS (SELECT 1 FROM public.todo_tags tt WHERE tt.tag_id = tg.id);
+--bun:split
+ALTER TABLE public.tags
+    ALTER COLUMN user_id SET NOT NULL,
+    ADD CONSTRAINT fk_tags_users FOREIGN KEY (user_id) REFERENCES public.users(id) ON DELETE CASCADE,
+    ADD CONSTRAINT uq_tags_user_id_name UNIQUE (user_id, name);
+--bun:split
+DELETE FROM public.todo_tags a USING public.todo_tags b WHERE a.id > b.id AND a.todo_id = b.todo_id AND a.tag_id = b.tag_id;
+--bun:split
+ALTER TABLE public.todo_tags ADD CONSTRAINT uq_todo_tags_todo_id_tag_id UNIQUE (todo_id, tag_id);
+--bun:split
+CREATE INDEX idx_todo_tags_tag_id ON public.todo_tags(tag_id);
@@ -0,0 +1,8 @@
+SET statement_timeout = 0;
+DROP INDEX IF EXISTS public.idx_todos_user_id_status;
+--bun:split
+DROP INDEX IF EXISTS public.idx_todos_user_id_title;
+--bun:split
+DROP INDEX IF EXISTS public.idx_todos_user_id_updated_at;
+--bun:split
+DROP INDEX IF EXISTS public.idx_todos_user_id_created_at;
@@ -0,0 +1,8 @@
+SET statement_timeout = 0;
+CREATE INDEX idx_todos_user_id_created_at ON public.todos(user_id, created_at, id);
+--bun:split
+CREATE INDEX idx_todos_user_id_updated_at ON public.todos(user_id, updated_at, id);
+--bun:split
+CREATE INDEX idx_todos_user_id_title ON public.todos(user_id, title, id);
+--bun:split
+CREATE INDEX idx_todos_user_id_status ON public.todos(user_id, status);
@@ -0,0 +1,10 @@
+SET statement_timeout = 0;
+DROP INDEX IF EXISTS public.idx_sessions_user_id;
+--bun:split
+ALTER TABLE public.sessions
+    DROP COLUMN IF EXISTS revoked_at,
+    DROP COLUMN IF EXISTS expires_at,
+    DROP COLUMN IF EXISTS last_used_at,
+    DROP COLUMN IF EXISTS user_agent,
+    DROP COLUMN IF EXISTS ip_address,
+    DROP COLUMN IF EXISTS device;
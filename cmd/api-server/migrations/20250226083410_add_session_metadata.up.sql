@@ -0,0 +1,10 @@
+SET statement_timeout = 0;
+ALTER TABLE public.sessions
+    ADD COLUMN device character varying NOT NULL DEFAULT '',
+    ADD COLUMN ip_address character varying NOT NULL DEFAULT '',
+    ADD COLUMN user_agent character varying NOT NULL DEFAULT '',
+    ADD COLUMN last_used_at timestamp with time zone DEFAULT NULL,
+    ADD COLUMN expires_at timestamp with time zone DEFAULT NULL,
+    ADD COLUMN revoked_at timestamp with time zone DEFAULT NULL;
+--bun:split
+CREATE INDEX idx_sessions_user_id ON public.sessions(user_id);
@@ -0,0 +1,4 @@
+SET statement_timeout = 0;
+DROP TABLE IF EXISTS public.refresh_tokens;
+--bun:split
+ALTER TABLE public.sessions DROP COLUMN IF EXISTS family_id;
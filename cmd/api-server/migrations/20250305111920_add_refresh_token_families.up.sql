@@ -0,0 +1,24 @@
+SET statement_timeout = 0;
+ALTER TABLE public.sessions ADD COLUMN family_id character varying;
+--bun:split
+UPDATE public.sessions SET family_id = 'legacy-' || id WHERE family_id IS NULL;
+--bun:split
+ALTER TABLE public.sessions
+    ALTER COLUMN family_id SET NOT NULL,
+    ADD CONSTRAINT uq_sessions_family_id UNIQUE (family_id);
+--bun:split
+CREATE TABLE public.refresh_tokens(
+    id bigint generated by DEFAULT AS identity,
+    jti character varying NOT NULL UNIQUE,
+    family_id character varying NOT NULL,
+    session_id bigint NOT NULL,
+    user_id bigint NOT NULL,
+    expires_at timestamp with time zone NOT NULL,
+    used_at timestamp with time zone DEFAULT NULL,
+    created_at timestamp with time zone NOT NULL DEFAULT now(),
+    PRIMARY KEY (id),
+    CONSTRAINT fk_refresh_tokens_sessions FOREIGN KEY (session_id) REFERENCES public.sessions(id) ON DELETE CASCADE,
+    CONSTRAINT fk_refresh_tokens_users FOREIGN KEY (user_id) REFERENCES public.users(id) ON DELETE CASCADE
+)
+--bun:split
+CREATE INDEX idx_refresh_tokens_family_id ON public.refresh_tokens(family_id);
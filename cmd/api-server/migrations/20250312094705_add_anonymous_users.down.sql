@@ -0,0 +1,4 @@
+SET statement_timeout = 0;
+ALTER TABLE public.users ALTER COLUMN uid DROP DEFAULT;
+--bun:split
+ALTER TABLE public.users DROP COLUMN IF EXISTS is_anonymous;
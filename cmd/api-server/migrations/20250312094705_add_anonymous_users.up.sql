@@ -0,0 +1,4 @@
+SET statement_timeout = 0;
+ALTER TABLE public.users ADD COLUMN is_anonymous boolean NOT NULL DEFAULT false;
+--bun:split
+ALTER TABLE public.users ALTER COLUMN uid SET DEFAULT gen_random_uuid()::text;
@@ -0,0 +1,7 @@
+SET statement_timeout = 0;
+DROP TABLE IF EXISTS public.mfa_recovery_codes;
+--bun:split
+ALTER TABLE public.users
+    DROP COLUMN IF EXISTS totp_last_step,
+    DROP COLUMN IF EXISTS totp_enabled_at,
+    DROP COLUMN IF EXISTS totp_secret;
@@ -0,0 +1,17 @@
+SET statement_timeout = 0;
+ALTER TABLE public.users
+    ADD COLUMN totp_secret character varying DEFAULT NULL,
+    ADD COLUMN totp_enabled_at timestamp with time zone DEFAULT NULL,
+    ADD COLUMN totp_last_step bigint NOT NULL DEFAULT 0;
+--bun:split
+CREATE TABLE public.mfa_recovery_codes(
+    id bigint generated by DEFAULT AS identity,
+    user_id bigint NOT NULL,
+    code_hash character varying NOT NULL,
+    used_at timestamp with time zone DEFAULT NULL,
+    created_at timestamp with time zone NOT NULL DEFAULT now(),
+    PRIMARY KEY (id),
+    CONSTRAINT fk_mfa_recovery_codes_users FOREIGN KEY (user_id) REFERENCES public.users(id) ON DELETE CASCADE
+)
+--bun:split
+CREATE INDEX idx_mfa_recovery_codes_user_id ON public.mfa_recovery_codes(user_id);
@@ -0,0 +1,8 @@
+SET statement_timeout = 0;
+DROP TABLE IF EXISTS public.user_tokens;
+--bun:split
+DROP INDEX IF EXISTS public.uq_users_email;
+--bun:split
+ALTER TABLE public.users
+    DROP COLUMN IF EXISTS email_verified_at,
+    DROP COLUMN IF EXISTS email;
@@ -0,0 +1,20 @@
+SET statement_timeout = 0;
+ALTER TABLE public.users
+    ADD COLUMN email character varying DEFAULT NULL,
+    ADD COLUMN email_verified_at timestamp with time zone DEFAULT NULL;
+--bun:split
+CREATE UNIQUE INDEX uq_users_email ON public.users(lower(email));
+--bun:split
+CREATE TABLE public.user_tokens(
+    id bigint generated by DEFAULT AS identity,
+    jti character varying NOT NULL UNIQUE,
+    user_id bigint NOT NULL,
+    purpose character varying NOT NULL,
+    expires_at timestamp with time zone NOT NULL,
+    used_at timestamp with time zone DEFAULT NULL,
+    created_at timestamp with time zone NOT NULL DEFAULT now(),
+    PRIMARY KEY (id),
+    CONSTRAINT fk_user_tokens_users FOREIGN KEY (user_id) REFERENCES public.users(id) ON DELETE CASCADE
+)
+--bun:split
+CREATE INDEX idx_user_tokens_user_id_purpose ON public.user_tokens(user_id, purpose);
@@ -0,0 +1,8 @@
+SET statement_timeout = 0;
+CREATE TABLE public.login_attempts(
+    key character varying NOT NULL,
+    failures integer NOT NULL DEFAULT 0,
+    last_failure_at timestamp with time zone NOT NULL,
+    locked_until timestamp with time zone DEFAULT NULL,
+    PRIMARY KEY (key)
+)
@@ -0,0 +1,17 @@
+SET statement_timeout = 0;
+CREATE TABLE public.personal_access_tokens(
+    id bigint generated by DEFAULT AS identity,
+    user_id bigint NOT NULL,
+    name character varying NOT NULL,
+    token_hash character varying NOT NULL UNIQUE,
+    token_prefix character varying NOT NULL,
+    scopes character varying[] NOT NULL DEFAULT '{}',
+    expires_at timestamp with time zone DEFAULT NULL,
+    last_used_at timestamp with time zone DEFAULT NULL,
+    revoked_at timestamp with time zone DEFAULT NULL,
+    created_at timestamp with time zone NOT NULL DEFAULT now(),
+    PRIMARY KEY (id),
+    CONSTRAINT fk_personal_access_tokens_users FOREIGN KEY (user_id) REFERENCES public.users(id) ON DELETE CASCADE
+)
+--bun:split
+CREATE INDEX idx_personal_access_tokens_user_id ON public.personal_access_tokens(user_id);
@@ -0,0 +1,4 @@
+SET statement_timeout = 0;
+ALTER TABLE public.users
+    DROP CONSTRAINT IF EXISTS chk_users_role,
+    DROP COLUMN IF EXISTS role;
@@ -0,0 +1,4 @@
+SET statement_timeout = 0;
+ALTER TABLE public.users
+    ADD COLUMN role character varying NOT NULL DEFAULT 'user',
+    ADD CONSTRAINT chk_users_role CHECK (role IN ('user', 'admin'));
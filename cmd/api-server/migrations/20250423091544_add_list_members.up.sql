@@ -0,0 +1,25 @@
+SET statement_timeout = 0;
+CREATE TABLE public.list_members(
+    id bigint generated by DEFAULT AS identity,
+    list_id bigint NOT NULL,
+    user_id bigint NOT NULL,
+    role character varying NOT NULL,
+    status character varying NOT NULL,
+    invited_by bigint DEFAULT NULL,
+    accepted_at timestamp with time zone DEFAULT NULL,
+    created_at timestamp with time zone NOT NULL DEFAULT now(),
+    PRIMARY KEY (id),
+    CONSTRAINT uq_list_members_list_id_user_id UNIQUE (list_id, user_id),
+    CONSTRAINT chk_list_members_role CHECK (role IN ('owner', 'editor', 'viewer')),
+    CONSTRAINT chk_list_members_status CHECK (status IN ('pending', 'accepted')),
+    CONSTRAINT fk_list_members_lists FOREIGN KEY (list_id) REFERENCES public.lists(id) ON DELETE CASCADE,
+    CONSTRAINT fk_list_members_users FOREIGN KEY (user_id) REFERENCES public.users(id) ON DELETE CASCADE
+)
+--bun:split
+CREATE INDEX idx_list_members_user_id ON public.list_members(user_id);
+--bun:split
+-- Every list gets exactly one owner.
+CREATE UNIQUE INDEX uq_list_members_owner ON public.list_members(list_id) WHERE role = 'owner';
+--bun:split
+INSERT INTO public.list_members (list_id, user_id, role, status, accepted_at)
+SELECT id, user_id, 'owner', 'accepted', now() FROM public.lists;
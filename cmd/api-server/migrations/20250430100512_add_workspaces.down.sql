@@ -0,0 +1,23 @@
+SET statement_timeout = 0;
+ALTER TABLE public.personal_access_tokens DROP COLUMN IF EXISTS workspace_id;
+--bun:split
+-- The tags of a user with the same name in several workspaces become one.
+INSERT INTO public.todo_tags (todo_id, tag_id)
+SELECT tt.todo_id, (SELECT MIN(k.id) FROM public.tags k WHERE k.user_id = tg.user_id AND k.name = tg.name)
+FROM public.todo_tags tt
+JOIN public.tags tg ON tg.id = tt.tag_id
+ON CONFLICT (todo_id, tag_id) DO NOTHING;
+--bun:split
+DELETE FROM public.tags tg
+WHERE EXISTS (SELECT 1 FROM public.tags k WHERE k.user_id = tg.user_id AND k.name = tg.name AND k.id < tg.id);
+--bun:split
+ALTER TABLE public.tags
+    DROP CONSTRAINT IF EXISTS uq_tags_workspace_id_name,
+    DROP COLUMN IF EXISTS workspace_id,
+    ADD CONSTRAINT uq_tags_user_id_name UNIQUE (user_id, name);
+--bun:split
+ALTER TABLE public.lists DROP COLUMN IF EXISTS workspace_id;
+--bun:split
+DROP TABLE IF EXISTS public.workspace_members;
+--bun:split
+DROP TABLE IF EXISTS public.workspaces;
@@ -0,0 +1,112 @@
+SET statement_timeout = 0;
+CREATE TABLE public.workspaces(
+    id bigint generated by DEFAULT AS identity,
+    name character varying NOT NULL,
+    personal boolean NOT NULL DEFAULT false,
+    created_by bigint DEFAULT NULL,
+    created_at timestamp with time zone NOT NULL DEFAULT now(),
+    updated_at timestamp with time zone NOT NULL DEFAULT now(),
+    PRIMARY KEY (id),
+    CONSTRAINT fk_workspaces_users FOREIGN KEY (created_by) REFERENCES public.users(id) ON DELETE SET NULL
+)
+--bun:split
+-- Every user has exactly one personal workspace.
+CREATE UNIQUE INDEX uq_workspaces_personal ON public.workspaces(created_by) WHERE personal;
+--bun:split
+CREATE TABLE public.workspace_members(
+    id bigint generated by DEFAULT AS identity,
+    workspace_id bigint NOT NULL,
+    user_id bigint NOT NULL,
+    role character varying NOT NULL,
+    created_at timestamp with time zone NOT NULL DEFAULT now(),
+    PRIMARY KEY (id),
+    CONSTRAINT uq_workspace_members_workspace_id_user_id UNIQUE (workspace_id, user_id),
+    CONSTRAINT chk_workspace_members_role CHECK (role IN ('admin', 'member')),
+    CONSTRAINT fk_workspace_members_workspaces FOREIGN KEY (workspace_id) REFERENCES public.workspaces(id) ON DELETE CASCADE,
+    CONSTRAINT fk_workspace_members_users FOREIGN KEY (user_id) REFERENCES public.users(id) ON DELETE CASCADE
+)
+--bun:split
+CREATE INDEX idx_workspace_members_user_id ON public.workspace_members(user_id);
+--bun:split
+INSERT INTO public.workspaces (name, personal, created_by)
+SELECT 'Personal', true, id FROM public.users;
+--bun:split
+INSERT INTO public.workspace_members (workspace_id, user_id, role)
+SELECT id, created_by, 'admin' FROM public.workspaces WHERE personal;
+--bun:split
+ALTER TABLE public.lists ADD COLUMN workspace_id bigint;
+--bun:split
+UPDATE public.lists l SET workspace_id = w.id FROM public.workspaces w WHERE w.personal AND w.created_by = l.user_id;
+--bun:split
+-- Personal workspaces have no other members, so lists shared with others
+-- move to a workspace of their owner with everyone they are shared with.
+-- Invited users join it too, to be able to accept the invitation there.
+INSERT INTO public.workspaces (name, personal, created_by)
+SELECT 'Shared lists', false, l.user_id
+FROM public.lists l
+WHERE EXISTS (SELECT 1 FROM public.list_members lm WHERE lm.list_id = l.id AND lm.user_id <> l.user_id)
+GROUP BY l.user_id;
+--bun:split
+INSERT INTO public.workspace_members (workspace_id, user_id, role)
+SELECT id, created_by, 'admin' FROM public.workspaces WHERE NOT personal;
+--bun:split
+INSERT INTO public.workspace_members (workspace_id, user_id, role)
+SELECT DISTINCT w.id, lm.user_id, 'member'
+FROM public.workspaces w
+JOIN public.lists l ON l.user_id = w.created_by
+JOIN public.list_members lm ON lm.list_id = l.id
+WHERE NOT w.personal AND lm.user_id <> w.created_by;
+--bun:split
+UPDATE public.lists l SET workspace_id = w.id
+FROM public.workspaces w
+WHERE NOT w.personal AND w.created_by = l.user_id
+    AND EXISTS (SELECT 1 FROM public.list_members lm WHERE lm.list_id = l.id AND lm.user_id <> l.user_id);
+--bun:split
+ALTER TABLE public.lists
+    ALTER COLUMN workspace_id SET NOT NULL,
+    ADD CONSTRAINT fk_lists_workspaces FOREIGN KEY (workspace_id) REFERENCES public.workspaces(id) ON DELETE CASCADE;
+--bun:split
+CREATE INDEX idx_lists_workspace_id ON public.lists(workspace_id);
+--bun:split
+ALTER TABLE public.tags ADD COLUMN workspace_id bigint;
+--bun:split
+UPDATE public.tags t SET workspace_id = w.id FROM public.workspaces w WHERE w.personal AND w.created_by = t.user_id;
+--bun:split
+-- Tag names are unique per workspace now instead of per user.
+ALTER TABLE public.tags
+    ALTER COLUMN workspace_id SET NOT NULL,
+    ADD CONSTRAINT fk_tags_workspaces FOREIGN KEY (workspace_id) REFERENCES public.workspaces(id) ON DELETE CASCADE,
+    DROP CONSTRAINT uq_tags_user_id_name,
+    ADD CONSTRAINT uq_tags_workspace_id_name UNIQUE (workspace_id, name);
+--bun:split
+-- Tags must be in the workspace of their todos. Todos with a tag of another
+-- workspace, those of shared lists and those tagged by other users, get the
+-- tag of the same name of that workspace instead, created for the list
+-- owner when it does not exist yet.
+INSERT INTO public.tags (name, user_id, workspace_id, created_at, updated_at)
+SELECT DISTINCT ON (l.workspace_id, tg.name) tg.name, l.user_id, l.workspace_id, tg.created_at, tg.updated_at
+FROM public.todo_tags tt
+JOIN public.todos t ON t.id = tt.todo_id
+JOIN public.lists l ON l.id = t.list_id
+JOIN public.tags tg ON tg.id = tt.tag_id
+WHERE tg.workspace_id <> l.workspace_id
+ORDER BY l.workspace_id, tg.name, tg.user_id = l.user_id DESC, tg.id
+ON CONFLICT (workspace_id, name) DO NOTHING;
+--bun:split
+INSERT INTO public.todo_tags (todo_id, tag_id)
+SELECT DISTINCT tt.todo_id, k.id
+FROM public.todo_tags tt
+JOIN public.todos t ON t.id = tt.todo_id
+JOIN public.lists l ON l.id = t.list_id
+JOIN public.tags tg ON tg.id = tt.tag_id
+JOIN public.tags k ON k.workspace_id = l.workspace_id AND k.name = tg.name
+WHERE tg.workspace_id <> l.workspace_id
+ON CONFLICT (todo_id, tag_id) DO NOTHING;
+--bun:split
+DELETE FROM public.todo_tags tt
+USING public.todos t, public.lists l, public.tags tg
+WHERE t.id = tt.todo_id AND l.id = t.list_id AND tg.id = tt.tag_id AND tg.workspace_id <> l.workspace_id;
+--bun:split
+ALTER TABLE public.personal_access_tokens
+    ADD COLUMN workspace_id bigint DEFAULT NULL,
+    ADD CONSTRAINT fk_personal_access_tokens_workspaces FOREIGN KEY (workspace_id) REFERENCES public.workspaces(id) ON DELETE CASCADE;
@@ -0,0 +1,4 @@
+SET statement_timeout = 0;
+DROP TABLE IF EXISTS public.oidc_states;
+--bun:split
+DROP TABLE IF EXISTS public.user_identities;
@@ -0,0 +1,30 @@
+SET statement_timeout = 0;
+CREATE TABLE public.user_identities(
+    id bigint generated by DEFAULT AS identity,
+    user_id bigint NOT NULL,
+    provider character varying NOT NULL,
+    subject character varying NOT NULL,
+    email character varying DEFAULT NULL,
+    last_login_at timestamp with time zone DEFAULT NULL,
+    created_at timestamp with time zone NOT NULL DEFAULT now(),
+    PRIMARY KEY (id),
+    CONSTRAINT uq_user_identities_provider_subject UNIQUE (provider, subject),
+    CONSTRAINT uq_user_identities_user_id_provider UNIQUE (user_id, provider),
+    CONSTRAINT fk_user_identities_users FOREIGN KEY (user_id) REFERENCES public.users(id) ON DELETE CASCADE
+)
+--bun:split
+CREATE TABLE public.oidc_states(
+    id bigint generated by DEFAULT AS identity,
+    state character varying NOT NULL,
+    provider character varying NOT NULL,
+    nonce character varying NOT NULL,
+    code_verifier character varying NOT NULL,
+    user_id bigint DEFAULT NULL,
+    expires_at timestamp with time zone NOT NULL,
+    created_at timestamp with time zone NOT NULL DEFAULT now(),
+    PRIMARY KEY (id),
+    CONSTRAINT uq_oidc_states_state UNIQUE (state),
+    CONSTRAINT fk_oidc_states_users FOREIGN KEY (user_id) REFERENCES public.users(id) ON DELETE CASCADE
+)
+--bun:split
+CREATE INDEX idx_oidc_states_expires_at ON public.oidc_states(expires_at);
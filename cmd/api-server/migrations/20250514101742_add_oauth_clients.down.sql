@@ -0,0 +1,10 @@
+SET statement_timeout = 0;
+ALTER TABLE public.sessions
+    DROP COLUMN IF EXISTS scopes,
+    DROP COLUMN IF EXISTS oauth_client_id;
+--bun:split
+DROP TABLE IF EXISTS public.oauth_consents;
+--bun:split
+DROP TABLE IF EXISTS public.oauth_authorization_codes;
+--bun:split
+DROP TABLE IF EXISTS public.oauth_clients;
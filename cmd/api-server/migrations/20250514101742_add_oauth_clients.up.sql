@@ -0,0 +1,58 @@
+SET statement_timeout = 0;
+CREATE TABLE public.oauth_clients(
+    id bigint generated by DEFAULT AS identity,
+    client_id character varying NOT NULL,
+    secret_hash character varying DEFAULT NULL,
+    name character varying NOT NULL,
+    redirect_uris character varying[] NOT NULL DEFAULT '{}',
+    grant_types character varying[] NOT NULL DEFAULT '{}',
+    scopes character varying[] NOT NULL DEFAULT '{}',
+    confidential boolean NOT NULL DEFAULT false,
+    owner_id bigint DEFAULT NULL,
+    created_by bigint DEFAULT NULL,
+    revoked_at timestamp with time zone DEFAULT NULL,
+    created_at timestamp with time zone NOT NULL DEFAULT now(),
+    PRIMARY KEY (id),
+    CONSTRAINT uq_oauth_clients_client_id UNIQUE (client_id),
+    CONSTRAINT chk_oauth_clients_secret CHECK (confidential = (secret_hash IS NOT NULL)),
+    CONSTRAINT fk_oauth_clients_owner FOREIGN KEY (owner_id) REFERENCES public.users(id) ON DELETE CASCADE,
+    CONSTRAINT fk_oauth_clients_created_by FOREIGN KEY (created_by) REFERENCES public.users(id) ON DELETE SET NULL
+)
+--bun:split
+CREATE TABLE public.oauth_authorization_codes(
+    id bigint generated by DEFAULT AS identity,
+    code_hash character varying NOT NULL,
+    client_id bigint NOT NULL,
+    user_id bigint NOT NULL,
+    redirect_uri character varying NOT NULL,
+    scopes character varying[] NOT NULL DEFAULT '{}',
+    code_challenge character varying NOT NULL,
+    expires_at timestamp with time zone NOT NULL,
+    created_at timestamp with time zone NOT NULL DEFAULT now(),
+    PRIMARY KEY (id),
+    CONSTRAINT uq_oauth_authorization_codes_code_hash UNIQUE (code_hash),
+    CONSTRAINT fk_oauth_authorization_codes_clients FOREIGN KEY (client_id) REFERENCES public.oauth_clients(id) ON DELETE CASCADE,
+    CONSTRAINT fk_oauth_authorization_codes_users FOREIGN KEY (user_id) REFERENCES public.users(id) ON DELETE CASCADE
+)
+--bun:split
+CREATE INDEX idx_oauth_authorization_codes_expires_at ON public.oauth_authorization_codes(expires_at);
+--bun:split
+CREATE TABLE public.oauth_consents(
+    id bigint generated by DEFAULT AS identity,
+    user_id bigint NOT NULL,
+    client_id bigint NOT NULL,
+    scopes character varying[] NOT NULL DEFAULT '{}',
+    created_at timestamp with time zone NOT NULL DEFAULT now(),
+    updated_at timestamp with time zone NOT NULL DEFAULT now(),
+    PRIMARY KEY (id),
+    CONSTRAINT uq_oauth_consents_user_id_client_id UNIQUE (user_id, client_id),
+    CONSTRAINT fk_oauth_consents_users FOREIGN KEY (user_id) REFERENCES public.users(id) ON DELETE CASCADE,
+    CONSTRAINT fk_oauth_consents_clients FOREIGN KEY (client_id) REFERENCES public.oauth_clients(id) ON DELETE CASCADE
+)
+--bun:split
+ALTER TABLE public.sessions
+    ADD COLUMN oauth_client_id bigint DEFAULT NULL,
+    ADD COLUMN scopes character varying[] DEFAULT NULL,
+    ADD CONSTRAINT fk_sessions_oauth_clients FOREIGN KEY (oauth_client_id) REFERENCES public.oauth_clients(id) ON DELETE CASCADE;
+--bun:split
+CREATE INDEX idx_sessions_oauth_client_id ON public.sessions(oauth_client_id);
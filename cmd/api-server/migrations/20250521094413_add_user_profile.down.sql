@@ -0,0 +1,8 @@
+SET statement_timeout = 0;
+DROP INDEX IF EXISTS public.idx_users_deleted_at;
+--bun:split
+ALTER TABLE public.users
+    DROP COLUMN IF EXISTS avatar_url,
+    DROP COLUMN IF EXISTS locale,
+    DROP COLUMN IF EXISTS timezone,
+    DROP COLUMN IF EXISTS display_name;
@@ -0,0 +1,10 @@
+SET statement_timeout = 0;
+ALTER TABLE public.users
+    ADD COLUMN display_name character varying DEFAULT NULL,
+    ADD COLUMN timezone character varying NOT NULL DEFAULT 'UTC',
+    ADD COLUMN locale character varying NOT NULL DEFAULT 'en',
+    ADD COLUMN avatar_url character varying DEFAULT NULL;
+--bun:split
+-- The purge job looks for accounts whose deletion is older than the grace period.
+-- Live accounts store the zero time in deleted_at.
+CREATE INDEX idx_users_deleted_at ON public.users(deleted_at) WHERE deleted_at > '0001-01-01 00:00:00+00';
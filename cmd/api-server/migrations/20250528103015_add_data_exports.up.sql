@@ -0,0 +1,24 @@
+SET statement_timeout = 0;
+CREATE TABLE public.data_exports(
+    id bigint generated by DEFAULT AS identity,
+    user_id bigint NOT NULL,
+    status character varying NOT NULL,
+    storage_key character varying DEFAULT NULL,
+    size bigint NOT NULL DEFAULT 0,
+    error character varying DEFAULT NULL,
+    attempts integer NOT NULL DEFAULT 0,
+    started_at timestamp with time zone DEFAULT NULL,
+    completed_at timestamp with time zone DEFAULT NULL,
+    expires_at timestamp with time zone DEFAULT NULL,
+    created_at timestamp with time zone NOT NULL DEFAULT now(),
+    PRIMARY KEY (id),
+    CONSTRAINT chk_data_exports_status CHECK (status IN ('pending', 'running', 'ready', 'failed', 'expired')),
+    CONSTRAINT fk_data_exports_users FOREIGN KEY (user_id) REFERENCES public.users(id) ON DELETE CASCADE
+)
+--bun:split
+CREATE INDEX idx_data_exports_user_id ON public.data_exports(user_id);
+--bun:split
+-- A user has at most one export in progress.
+CREATE UNIQUE INDEX uq_data_exports_active ON public.data_exports(user_id) WHERE status IN ('pending', 'running');
+--bun:split
+CREATE INDEX idx_data_exports_status ON public.data_exports(status) WHERE status IN ('pending', 'running', 'ready');
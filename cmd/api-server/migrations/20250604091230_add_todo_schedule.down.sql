@@ -0,0 +1,12 @@
+SET statement_timeout = 0;
+DROP INDEX IF EXISTS public.idx_todos_due_date;
+--bun:split
+DROP INDEX IF EXISTS public.idx_todos_due_at;
+--bun:split
+ALTER TABLE public.todos
+    DROP CONSTRAINT IF EXISTS chk_todos_schedule,
+    DROP COLUMN IF EXISTS all_day,
+    DROP COLUMN IF EXISTS start_date,
+    DROP COLUMN IF EXISTS start_at,
+    DROP COLUMN IF EXISTS due_date,
+    DROP COLUMN IF EXISTS due_at;
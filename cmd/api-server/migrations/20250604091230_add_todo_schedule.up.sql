@@ -0,0 +1,16 @@
+SET statement_timeout = 0;
+ALTER TABLE public.todos
+    ADD COLUMN due_at timestamp with time zone DEFAULT NULL,
+    ADD COLUMN due_date date DEFAULT NULL,
+    ADD COLUMN start_at timestamp with time zone DEFAULT NULL,
+    ADD COLUMN start_date date DEFAULT NULL,
+    ADD COLUMN all_day boolean NOT NULL DEFAULT false,
+    -- All-day todos only have dates, the others only timestamps.
+    ADD CONSTRAINT chk_todos_schedule CHECK (
+        (all_day AND due_at IS NULL AND start_at IS NULL)
+        OR (NOT all_day AND due_date IS NULL AND start_date IS NULL)
+    );
+--bun:split
+CREATE INDEX idx_todos_due_at ON public.todos(due_at) WHERE due_at IS NOT NULL;
+--bun:split
+CREATE INDEX idx_todos_due_date ON public.todos(due_date) WHERE due_date IS NOT NULL;
@@ -0,0 +1,9 @@
+SET statement_timeout = 0;
+DROP INDEX IF EXISTS public.uq_todos_series_occurrence;
+--bun:split
+ALTER TABLE public.todos
+    DROP CONSTRAINT IF EXISTS fk_todos_todo_series,
+    DROP COLUMN IF EXISTS occurrence_at,
+    DROP COLUMN IF EXISTS series_id;
+--bun:split
+DROP TABLE IF EXISTS public.todo_series;
@@ -0,0 +1,30 @@
+SET statement_timeout = 0;
+CREATE TABLE public.todo_series(
+    id bigint generated by DEFAULT AS identity,
+    rule character varying NOT NULL,
+    repeat_from character varying NOT NULL DEFAULT 'due',
+    timezone character varying NOT NULL DEFAULT 'UTC',
+    dtstart timestamp with time zone NOT NULL,
+    all_day boolean NOT NULL DEFAULT false,
+    start_offset bigint DEFAULT NULL,
+    occurrences integer NOT NULL DEFAULT 0,
+    title character varying NOT NULL,
+    description character varying NOT NULL DEFAULT '',
+    list_id bigint NOT NULL,
+    user_id bigint NOT NULL,
+    created_at timestamp with time zone NOT NULL DEFAULT now(),
+    updated_at timestamp with time zone NOT NULL DEFAULT now(),
+    PRIMARY KEY (id),
+    CONSTRAINT chk_todo_series_repeat_from CHECK (repeat_from IN ('due', 'completion')),
+    CONSTRAINT fk_todo_series_lists FOREIGN KEY (list_id) REFERENCES public.lists(id) ON DELETE CASCADE
+)
+--bun:split
+ALTER TABLE public.todos
+    ADD COLUMN series_id bigint DEFAULT NULL,
+    ADD COLUMN occurrence_at timestamp with time zone DEFAULT NULL,
+    ADD CONSTRAINT fk_todos_todo_series FOREIGN KEY (series_id) REFERENCES public.todo_series(id) ON DELETE SET NULL;
+--bun:split
+-- Completing the same occurrence twice must not create the next one twice.
+CREATE UNIQUE INDEX uq_todos_series_occurrence ON public.todos(series_id, occurrence_at) WHERE series_id IS NOT NULL;
+--bun:split
+CREATE INDEX idx_todo_series_list_id ON public.todo_series(list_id);
@@ -0,0 +1,6 @@
+SET statement_timeout = 0;
+DROP TABLE IF EXISTS public.inbox_items;
+--bun:split
+DROP TABLE IF EXISTS public.reminder_deliveries;
+--bun:split
+DROP TABLE IF EXISTS public.reminders;
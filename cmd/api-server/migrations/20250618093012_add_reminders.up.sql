@@ -0,0 +1,64 @@
+SET statement_timeout = 0;
+CREATE TABLE public.reminders(
+    id bigint generated by DEFAULT AS identity,
+    todo_id bigint NOT NULL,
+    user_id bigint NOT NULL,
+    remind_at timestamp with time zone DEFAULT NULL,
+    offset_seconds bigint DEFAULT NULL,
+    channels character varying[] NOT NULL,
+    fire_at timestamp with time zone DEFAULT NULL,
+    fired_at timestamp with time zone DEFAULT NULL,
+    created_at timestamp with time zone NOT NULL DEFAULT now(),
+    PRIMARY KEY (id),
+    -- A reminder is either at a time or some time before the todo is due.
+    CONSTRAINT chk_reminders_time CHECK ((remind_at IS NULL) <> (offset_seconds IS NULL) AND offset_seconds >= 0),
+    CONSTRAINT chk_reminders_channels CHECK (
+        cardinality(channels) > 0
+        AND channels <@ ARRAY['webhook', 'email', 'inbox']::character varying[]
+    ),
+    CONSTRAINT fk_reminders_todos FOREIGN KEY (todo_id) REFERENCES public.todos(id) ON DELETE CASCADE,
+    CONSTRAINT fk_reminders_users FOREIGN KEY (user_id) REFERENCES public.users(id) ON DELETE CASCADE
+)
+--bun:split
+CREATE INDEX idx_reminders_todo_id ON public.reminders(todo_id);
+--bun:split
+CREATE INDEX idx_reminders_fire_at ON public.reminders(fire_at) WHERE fired_at IS NULL AND fire_at IS NOT NULL;
+--bun:split
+CREATE TABLE public.reminder_deliveries(
+    id bigint generated by DEFAULT AS identity,
+    reminder_id bigint NOT NULL,
+    channel character varying NOT NULL,
+    status character varying NOT NULL DEFAULT 'pending',
+    attempts integer NOT NULL DEFAULT 0,
+    next_attempt_at timestamp with time zone NOT NULL,
+    locked_until timestamp with time zone DEFAULT NULL,
+    error character varying DEFAULT NULL,
+    delivered_at timestamp with time zone DEFAULT NULL,
+    created_at timestamp with time zone NOT NULL DEFAULT now(),
+    PRIMARY KEY (id),
+    CONSTRAINT chk_reminder_deliveries_status CHECK (status IN ('pending', 'delivered', 'failed')),
+    CONSTRAINT fk_reminder_deliveries_reminders FOREIGN KEY (reminder_id) REFERENCES public.reminders(id) ON DELETE CASCADE,
+    -- Firing a reminder again must not deliver it twice.
+    CONSTRAINT uq_reminder_deliveries_channel UNIQUE (reminder_id, channel)
+)
+--bun:split
+CREATE INDEX idx_reminder_deliveries_next_attempt_at ON public.reminder_deliveries(next_attempt_at) WHERE status = 'pending';
+--bun:split
+CREATE TABLE public.inbox_items(
+    id bigint generated by DEFAULT AS identity,
+    user_id bigint NOT NULL,
+    delivery_id bigint DEFAULT NULL,
+    todo_id bigint DEFAULT NULL,
+    title character varying NOT NULL,
+    body character varying NOT NULL DEFAULT '',
+    read_at timestamp with time zone DEFAULT NULL,
+    created_at timestamp with time zone NOT NULL DEFAULT now(),
+    PRIMARY KEY (id),
+    CONSTRAINT fk_inbox_items_users FOREIGN KEY (user_id) REFERENCES public.users(id) ON DELETE CASCADE,
+    CONSTRAINT fk_inbox_items_reminder_deliveries FOREIGN KEY (delivery_id) REFERENCES public.reminder_deliveries(id) ON DELETE SET NULL,
+    CONSTRAINT fk_inbox_items_todos FOREIGN KEY (todo_id) REFERENCES public.todos(id) ON DELETE SET NULL,
+    -- A delivery that is retried after a crash adds the item only once.
+    CONSTRAINT uq_inbox_items_delivery_id UNIQUE (delivery_id)
+)
+--bun:split
+CREATE INDEX idx_inbox_items_user_id ON public.inbox_items(user_id, id);
@@ -0,0 +1,10 @@
+SET statement_timeout = 0;
+DROP TABLE IF EXISTS public.checklist_items;
+--bun:split
+DROP INDEX IF EXISTS public.idx_todos_parent_id;
+--bun:split
+ALTER TABLE public.todos
+    DROP CONSTRAINT IF EXISTS fk_todos_parent,
+    DROP CONSTRAINT IF EXISTS chk_todos_parent,
+    DROP CONSTRAINT IF EXISTS uq_todos_id_list_id,
+    DROP COLUMN IF EXISTS parent_id;
@@ -0,0 +1,25 @@
+SET statement_timeout = 0;
+-- Subtasks reference their parent together with its list, so a subtask is
+-- always in the list of its parent and moving a todo to another list moves
+-- its subtasks with it.
+ALTER TABLE public.todos
+    ADD COLUMN parent_id bigint DEFAULT NULL,
+    ADD CONSTRAINT uq_todos_id_list_id UNIQUE (id, list_id),
+    ADD CONSTRAINT chk_todos_parent CHECK (parent_id <> id),
+    ADD CONSTRAINT fk_todos_parent FOREIGN KEY (parent_id, list_id) REFERENCES public.todos(id, list_id) ON UPDATE CASCADE ON DELETE CASCADE;
+--bun:split
+CREATE INDEX idx_todos_parent_id ON public.todos(parent_id) WHERE parent_id IS NOT NULL;
+--bun:split
+CREATE TABLE public.checklist_items(
+    id bigint generated by DEFAULT AS identity,
+    todo_id bigint NOT NULL,
+    title character varying NOT NULL,
+    done boolean NOT NULL DEFAULT false,
+    position integer NOT NULL DEFAULT 0,
+    created_at timestamp with time zone NOT NULL DEFAULT now(),
+    updated_at timestamp with time zone NOT NULL DEFAULT now(),
+    PRIMARY KEY (id),
+    CONSTRAINT fk_checklist_items_todos FOREIGN KEY (todo_id) REFERENCES public.todos(id) ON DELETE CASCADE
+)
+--bun:split
+CREATE INDEX idx_checklist_items_todo_id ON public.checklist_items(todo_id, position);
@@ -0,0 +1,2 @@
+SET statement_timeout = 0;
+DROP TABLE IF EXISTS public.todo_dependencies;
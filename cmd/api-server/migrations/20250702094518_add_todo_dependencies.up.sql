@@ -0,0 +1,13 @@
+SET statement_timeout = 0;
+-- todo_id is blocked by blocker_id, both are in the same list.
+CREATE TABLE public.todo_dependencies(
+    todo_id bigint NOT NULL,
+    blocker_id bigint NOT NULL,
+    created_at timestamp with time zone NOT NULL DEFAULT now(),
+    PRIMARY KEY (todo_id, blocker_id),
+    CONSTRAINT chk_todo_dependencies_self CHECK (todo_id <> blocker_id),
+    CONSTRAINT fk_todo_dependencies_todos FOREIGN KEY (todo_id) REFERENCES public.todos(id) ON DELETE CASCADE,
+    CONSTRAINT fk_todo_dependencies_blockers FOREIGN KEY (blocker_id) REFERENCES public.todos(id) ON DELETE CASCADE
+)
+--bun:split
+CREATE INDEX idx_todo_dependencies_blocker_id ON public.todo_dependencies(blocker_id);
@@ -39,11 +39,25 @@ func ErrUnAuthorized(err error) render.Renderer {
 	}
 }
 
+// Application codes of forbidden responses. Clients match on them, so they
+// must never change.
+const (
+	CodeForbidden         int64 = 40300
+	CodeInsufficientScope int64 = 40301
+	CodeInsufficientRole  int64 = 40302
+)
+
 func ErrForbidden(err error) render.Renderer {
+	return ErrForbiddenCode(err, CodeForbidden)
+}
+
+// ErrForbiddenCode is ErrForbidden with a more specific AppCode.
+func ErrForbiddenCode(err error, code int64) render.Renderer {
 	return &ErrResponse{
 		Err:            err,
 		HTTPStatusCode: http.StatusForbidden,
 		StatusText:     "Forbidden.",
+		AppCode:        code,
 		ErrorText:      err.Error(),
 	}
 }
@@ -13,10 +13,11 @@ type SingleResponse struct {
 }
 
 type CollectionResponse struct {
-	Message string      `json:"message"`
-	Data    interface{} `json:"data"`
-	Status  int         `json:"status"`
-	Total   int         `json:"total"`
+	Message    string      `json:"message"`
+	Data       interface{} `json:"data"`
+	Status     int         `json:"status"`
+	Total      int         `json:"total"`
+	NextCursor string      `json:"next_cursor,omitempty"`
 }
 
 func (resp *SingleResponse) Render(w http.ResponseWriter, r *http.Request) error {
@@ -48,3 +49,14 @@ func WriteCollectionResponse(w http.ResponseWriter, status int, message string,
 		Total:   total,
 	}
 }
+
+// Write a collection response with the cursor of the next page
+func WriteCursorCollectionResponse(w http.ResponseWriter, status int, message string, data interface{}, total int, nextCursor string) render.Renderer {
+	return &CollectionResponse{
+		Message:    message,
+		Data:       data,
+		Status:     status,
+		Total:      total,
+		NextCursor: nextCursor,
+	}
+}
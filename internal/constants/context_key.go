@@ -3,3 +3,9 @@ package constants
 type ContextKey string
 
 const CurrentUser ContextKey = "current_user"
+
+const CurrentSession ContextKey = "current_session"
+
+const CurrentAccessToken ContextKey = "current_access_token"
+
+const CurrentWorkspace ContextKey = "current_workspace"
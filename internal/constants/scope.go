@@ -0,0 +1,10 @@
+package constants
+
+// Scopes a personal access token can be granted.
+const (
+	ScopeTodosRead  = "todos:read"
+	ScopeTodosWrite = "todos:write"
+	ScopeAdmin      = "admin"
+)
+
+var Scopes = []string{ScopeTodosRead, ScopeTodosWrite, ScopeAdmin}
@@ -7,42 +7,380 @@ import (
 )
 
 type User struct {
-	bun.BaseModel `bun:"table:users,alias:u"`
+	bun.BaseModel   `bun:"table:users,alias:u"`
+	ID              int64     `bun:"id,pk,autoincrement"`
+	Username        string    `bun:"username,unique,notnull"`
+	PasswordHash    string    `bun:"password,notnull"`
+	Email           string    `bun:"email,nullzero"`
+	EmailVerifiedAt time.Time `bun:"email_verified_at,nullzero"`
+	IsAnonymous     bool      `bun:"is_anonymous,notnull"`
+	Role            string    `bun:"role,notnull,default:'user'"`
+	TOTPSecret      string    `bun:"totp_secret,nullzero"`
+	TOTPEnabledAt   time.Time `bun:"totp_enabled_at,nullzero"`
+	TOTPLastStep    int64     `bun:"totp_last_step,notnull"`
+	DisplayName     string    `bun:"display_name,nullzero"`
+	Timezone        string    `bun:"timezone,notnull,default:'UTC'"`
+	Locale          string    `bun:"locale,notnull,default:'en'"`
+	AvatarURL       string    `bun:"avatar_url,nullzero"`
+	CreatedAt       time.Time `bun:"created_at,nullzero,default:current_timestamp"`
+	UpdatedAt       time.Time `bun:"updated_at,nullzero,default:current_timestamp"`
+	// DeletedAt is set when the user deletes the account, it is purged
+	// after a grace period.
+	DeletedAt time.Time `bun:"deleted_at,soft_delete"`
+}
+
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+// HasRole reports whether the user has role. Admins have every role.
+func (u *User) HasRole(role string) bool {
+	return u.Role == role || u.Role == RoleAdmin
+}
+
+const (
+	UserTokenResetPassword = "reset_password"
+	UserTokenVerifyEmail   = "verify_email"
+)
+
+// HasPassword reports whether the user can log in with a password. Accounts
+// created through an OpenID provider have none.
+func (u *User) HasPassword() bool {
+	return u.PasswordHash != ""
+}
+
+// UserIdentity links an account at an OpenID provider, identified by the
+// sub claim, to a user.
+type UserIdentity struct {
+	bun.BaseModel `bun:"table:user_identities,alias:ui" swaggerignore:"true"`
+	ID            int64     `bun:"id,pk,autoincrement" json:"id"`
+	UserID        int64     `bun:"user_id,notnull" json:"user_id"`
+	Provider      string    `bun:"provider,notnull" json:"provider"`
+	Subject       string    `bun:"subject,notnull" json:"subject"`
+	Email         string    `bun:"email,nullzero" json:"email,omitempty"`
+	LastLoginAt   time.Time `bun:"last_login_at,nullzero" json:"last_login_at"`
+	CreatedAt     time.Time `bun:"created_at,nullzero,default:current_timestamp" json:"created_at"`
+}
+
+// OIDCState remembers an authorization request until the provider redirects
+// back. UserID is set when an identity is linked to a logged in user.
+type OIDCState struct {
+	bun.BaseModel `bun:"table:oidc_states,alias:os"`
 	ID            int64     `bun:"id,pk,autoincrement"`
-	Username      string    `bun:"username,unique,notnull"`
-	PasswordHash  string    `bun:"password,notnull"`
+	State         string    `bun:"state,unique,notnull"`
+	Provider      string    `bun:"provider,notnull"`
+	Nonce         string    `bun:"nonce,notnull"`
+	CodeVerifier  string    `bun:"code_verifier,notnull"`
+	UserID        int64     `bun:"user_id,nullzero"`
+	ExpiresAt     time.Time `bun:"expires_at,notnull"`
 	CreatedAt     time.Time `bun:"created_at,nullzero,default:current_timestamp"`
-	UpdatedAt     time.Time `bun:"updated_at,nullzero,default:current_timestamp"`
-	DeletedAt     time.Time `bun:"deleted_at,soft_delete"`
+}
+
+// UserToken records the jti of the signed password reset and email
+// verification tokens so that each of them can only be used once.
+type UserToken struct {
+	bun.BaseModel `bun:"table:user_tokens,alias:ut"`
+	ID            int64     `bun:"id,pk,autoincrement"`
+	JTI           string    `bun:"jti,unique,notnull"`
+	UserID        int64     `bun:"user_id,notnull"`
+	Purpose       string    `bun:"purpose,notnull"`
+	ExpiresAt     time.Time `bun:"expires_at,notnull"`
+	UsedAt        time.Time `bun:"used_at,nullzero"`
+	CreatedAt     time.Time `bun:"created_at,nullzero,default:current_timestamp"`
+}
+
+// MFARecoveryCode is a hashed single-use code to log in without the TOTP
+// device.
+type MFARecoveryCode struct {
+	bun.BaseModel `bun:"table:mfa_recovery_codes,alias:rc"`
+	ID            int64     `bun:"id,pk,autoincrement"`
+	UserID        int64     `bun:"user_id,notnull"`
+	CodeHash      string    `bun:"code_hash,notnull"`
+	UsedAt        time.Time `bun:"used_at,nullzero"`
+	CreatedAt     time.Time `bun:"created_at,nullzero,default:current_timestamp"`
+}
+
+// PersonalAccessToken lets scripts call the API without a password. Only
+// the hash of the token is stored; TokenPrefix is kept to tell tokens apart.
+type PersonalAccessToken struct {
+	bun.BaseModel `bun:"table:personal_access_tokens,alias:pat" swaggerignore:"true"`
+	ID            int64     `bun:"id,pk,autoincrement" json:"id"`
+	UserID        int64     `bun:"user_id,notnull" json:"user_id"`
+	Name          string    `bun:"name,notnull" json:"name"`
+	TokenHash     string    `bun:"token_hash,unique,notnull" json:"-"`
+	TokenPrefix   string    `bun:"token_prefix,notnull" json:"token_prefix"`
+	Scopes        []string  `bun:"scopes,array" json:"scopes"`
+	WorkspaceID   int64     `bun:"workspace_id,nullzero" json:"workspace_id,omitempty"`
+	ExpiresAt     time.Time `bun:"expires_at,nullzero" json:"expires_at"`
+	LastUsedAt    time.Time `bun:"last_used_at,nullzero" json:"last_used_at"`
+	RevokedAt     time.Time `bun:"revoked_at,nullzero" json:"-"`
+	CreatedAt     time.Time `bun:"created_at,nullzero,default:current_timestamp" json:"created_at"`
 }
 
 type Session struct {
-	bun.BaseModel `bun:"table:sessions,alias:s"`
+	bun.BaseModel `bun:"table:sessions,alias:s" swaggerignore:"true"`
+	ID            int64     `bun:"id,pk,autoincrement" json:"id"`
+	AccessToken   string    `bun:"access_token,unique,notnull" json:"-"`
+	RefreshToken  string    `bun:"refresh_token,unique,notnull" json:"-"`
+	UserID        int64     `bun:"user_id,notnull" json:"user_id"`
+	FamilyID      string    `bun:"family_id,unique,notnull" json:"-"`
+	Device        string    `bun:"device,notnull" json:"device"`
+	IPAddress     string    `bun:"ip_address,notnull" json:"ip_address"`
+	UserAgent     string    `bun:"user_agent,notnull" json:"user_agent"`
+	LastUsedAt    time.Time `bun:"last_used_at,nullzero" json:"last_used_at"`
+	ExpiresAt     time.Time `bun:"expires_at,nullzero" json:"expires_at"`
+	RevokedAt     time.Time `bun:"revoked_at,nullzero" json:"-"`
+	CreatedAt     time.Time `bun:"created_at,nullzero,default:current_timestamp" json:"created_at"`
+	UpdatedAt     time.Time `bun:"updated_at,nullzero,default:current_timestamp" json:"updated_at"`
+	// OAuthClientID and Scopes are set on sessions issued to an OAuth
+	// client on behalf of the user.
+	OAuthClientID int64    `bun:"oauth_client_id,nullzero" json:"oauth_client_id,omitempty"`
+	Scopes        []string `bun:"scopes,array" json:"scopes,omitempty"`
+
+	// Current marks the session the request was authenticated with.
+	Current bool `bun:"-" json:"current"`
+}
+
+// RefreshToken records every refresh token issued for a session so that a
+// token which has already been rotated can be detected when it is replayed.
+type RefreshToken struct {
+	bun.BaseModel `bun:"table:refresh_tokens,alias:rt"`
 	ID            int64     `bun:"id,pk,autoincrement"`
-	AccessToken   string    `bun:"access_token,unique,notnull"`
-	RefreshToken  string    `bun:"refresh_token,unique,notnull"`
+	JTI           string    `bun:"jti,unique,notnull"`
+	FamilyID      string    `bun:"family_id,notnull"`
+	SessionID     int64     `bun:"session_id,notnull"`
 	UserID        int64     `bun:"user_id,notnull"`
+	ExpiresAt     time.Time `bun:"expires_at,notnull"`
+	UsedAt        time.Time `bun:"used_at,nullzero"`
 	CreatedAt     time.Time `bun:"created_at,nullzero,default:current_timestamp"`
-	UpdatedAt     time.Time `bun:"updated_at,nullzero,default:current_timestamp"`
 }
 
-type List struct {
-	bun.BaseModel `bun:"table:todos,alias:l"`
+// OAuthClient is a third-party application that acts on behalf of users.
+// Public clients have no secret. OwnerID is the user the client_credentials
+// grant acts as.
+type OAuthClient struct {
+	bun.BaseModel `bun:"table:oauth_clients,alias:oc" swaggerignore:"true"`
+	ID            int64     `bun:"id,pk,autoincrement" json:"id"`
+	ClientID      string    `bun:"client_id,unique,notnull" json:"client_id"`
+	SecretHash    string    `bun:"secret_hash,nullzero" json:"-"`
+	Name          string    `bun:"name,notnull" json:"name"`
+	RedirectURIs  []string  `bun:"redirect_uris,array" json:"redirect_uris"`
+	GrantTypes    []string  `bun:"grant_types,array" json:"grant_types"`
+	Scopes        []string  `bun:"scopes,array" json:"scopes"`
+	Confidential  bool      `bun:"confidential,notnull" json:"confidential"`
+	OwnerID       int64     `bun:"owner_id,nullzero" json:"owner_id,omitempty"`
+	CreatedBy     int64     `bun:"created_by,nullzero" json:"created_by,omitempty"`
+	RevokedAt     time.Time `bun:"revoked_at,nullzero" json:"-"`
+	CreatedAt     time.Time `bun:"created_at,nullzero,default:current_timestamp" json:"created_at"`
+}
+
+const (
+	GrantAuthorizationCode = "authorization_code"
+	GrantRefreshToken      = "refresh_token"
+	GrantClientCredentials = "client_credentials"
+)
+
+// OAuthAuthorizationCode is a hashed single-use code issued when the user
+// approves an authorization request.
+type OAuthAuthorizationCode struct {
+	bun.BaseModel `bun:"table:oauth_authorization_codes,alias:oac"`
 	ID            int64     `bun:"id,pk,autoincrement"`
-	Name          string    `bun:"name,notnull"`
-	Users         []*User   `bun:"rel:has-many:join:id=list_id"`
+	CodeHash      string    `bun:"code_hash,unique,notnull"`
+	ClientID      int64     `bun:"client_id,notnull"`
+	UserID        int64     `bun:"user_id,notnull"`
+	RedirectURI   string    `bun:"redirect_uri,notnull"`
+	Scopes        []string  `bun:"scopes,array"`
+	CodeChallenge string    `bun:"code_challenge,notnull"`
+	ExpiresAt     time.Time `bun:"expires_at,notnull"`
 	CreatedAt     time.Time `bun:"created_at,nullzero,default:current_timestamp"`
-	UpdatedAt     time.Time `bun:"updated_at,nullzero,default:current_timestamp"`
 }
 
-type Tag struct {
-	bun.BaseModel `bun:"table:tags,alias:t"`
+// OAuthConsent remembers the scopes a user approved for a client, so the
+// consent screen is only shown again for new scopes.
+type OAuthConsent struct {
+	bun.BaseModel `bun:"table:oauth_consents,alias:ocs"`
 	ID            int64     `bun:"id,pk,autoincrement"`
-	Name          string    `bun:"name,notnull"`
+	UserID        int64     `bun:"user_id,notnull"`
+	ClientID      int64     `bun:"client_id,notnull"`
+	Scopes        []string  `bun:"scopes,array"`
 	CreatedAt     time.Time `bun:"created_at,nullzero,default:current_timestamp"`
 	UpdatedAt     time.Time `bun:"updated_at,nullzero,default:current_timestamp"`
 }
 
+// DataExport is an archive of the data of a user. It is built in the
+// background and can be downloaded until ExpiresAt.
+type DataExport struct {
+	bun.BaseModel `bun:"table:data_exports,alias:de" swaggerignore:"true"`
+	ID            int64     `bun:"id,pk,autoincrement" json:"id"`
+	UserID        int64     `bun:"user_id,notnull" json:"user_id"`
+	Status        string    `bun:"status,notnull" json:"status"`
+	StorageKey    string    `bun:"storage_key,nullzero" json:"-"`
+	Size          int64     `bun:"size,notnull" json:"size"`
+	Error         string    `bun:"error,nullzero" json:"error,omitempty"`
+	Attempts      int       `bun:"attempts,notnull" json:"-"`
+	StartedAt     time.Time `bun:"started_at,nullzero" json:"-"`
+	CompletedAt   time.Time `bun:"completed_at,nullzero" json:"completed_at"`
+	ExpiresAt     time.Time `bun:"expires_at,nullzero" json:"expires_at"`
+	CreatedAt     time.Time `bun:"created_at,nullzero,default:current_timestamp" json:"created_at"`
+}
+
+const (
+	ExportPending = "pending"
+	ExportRunning = "running"
+	ExportReady   = "ready"
+	ExportFailed  = "failed"
+	ExportExpired = "expired"
+)
+
+// Reminder notifies its user about a todo at RemindAt or OffsetSeconds
+// before the todo is due. FireAt is when the reminder fires, FiredAt when it
+// did.
+type Reminder struct {
+	bun.BaseModel `bun:"table:reminders,alias:rm" swaggerignore:"true"`
+	ID            int64               `bun:"id,pk,autoincrement" json:"id"`
+	TodoID        int64               `bun:"todo_id,notnull" json:"todo_id"`
+	UserID        int64               `bun:"user_id,notnull" json:"-"`
+	RemindAt      time.Time           `bun:"remind_at,nullzero" json:"remind_at"`
+	OffsetSeconds *int64              `bun:"offset_seconds" json:"offset_seconds,omitempty"`
+	Channels      []string            `bun:"channels,array" json:"channels"`
+	FireAt        time.Time           `bun:"fire_at,nullzero" json:"fire_at"`
+	FiredAt       time.Time           `bun:"fired_at,nullzero" json:"fired_at"`
+	CreatedAt     time.Time           `bun:"created_at,nullzero,default:current_timestamp" json:"created_at"`
+	Deliveries    []*ReminderDelivery `bun:"rel:has-many,join:id=reminder_id" json:"deliveries,omitempty"`
+}
+
+const (
+	ReminderChannelWebhook = "webhook"
+	ReminderChannelEmail   = "email"
+	ReminderChannelInbox   = "inbox"
+)
+
+// ReminderDelivery is a fired reminder to be sent through one channel. It
+// stays pending until the notifier succeeded, so deliveries survive
+// restarts.
+type ReminderDelivery struct {
+	bun.BaseModel `bun:"table:reminder_deliveries,alias:rd" swaggerignore:"true"`
+	ID            int64     `bun:"id,pk,autoincrement" json:"id"`
+	ReminderID    int64     `bun:"reminder_id,notnull" json:"-"`
+	Channel       string    `bun:"channel,notnull" json:"channel"`
+	Status        string    `bun:"status,notnull" json:"status"`
+	Attempts      int       `bun:"attempts,notnull" json:"attempts"`
+	NextAttemptAt time.Time `bun:"next_attempt_at,notnull" json:"-"`
+	LockedUntil   time.Time `bun:"locked_until,nullzero" json:"-"`
+	Error         string    `bun:"error,nullzero" json:"error,omitempty"`
+	DeliveredAt   time.Time `bun:"delivered_at,nullzero" json:"delivered_at"`
+	CreatedAt     time.Time `bun:"created_at,nullzero,default:current_timestamp" json:"created_at"`
+}
+
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+// InboxItem is a notification shown in the app.
+type InboxItem struct {
+	bun.BaseModel `bun:"table:inbox_items,alias:ib" swaggerignore:"true"`
+	ID            int64     `bun:"id,pk,autoincrement" json:"id"`
+	UserID        int64     `bun:"user_id,notnull" json:"-"`
+	DeliveryID    int64     `bun:"delivery_id,nullzero" json:"-"`
+	TodoID        int64     `bun:"todo_id,nullzero" json:"todo_id,omitempty"`
+	Title         string    `bun:"title,notnull" json:"title"`
+	Body          string    `bun:"body,notnull" json:"body"`
+	ReadAt        time.Time `bun:"read_at,nullzero" json:"read_at"`
+	CreatedAt     time.Time `bun:"created_at,nullzero,default:current_timestamp" json:"created_at"`
+}
+
+// Workspace is the tenant lists and tags live in. Every user has a personal
+// workspace, which is used when a request does not select another one.
+type Workspace struct {
+	bun.BaseModel `bun:"table:workspaces,alias:w" swaggerignore:"true"`
+	ID            int64     `bun:"id,pk,autoincrement" json:"id"`
+	Name          string    `bun:"name,notnull" json:"name"`
+	Personal      bool      `bun:"personal,notnull" json:"personal"`
+	CreatedBy     int64     `bun:"created_by,nullzero" json:"created_by,omitempty"`
+	CreatedAt     time.Time `bun:"created_at,nullzero,default:current_timestamp" json:"created_at"`
+	UpdatedAt     time.Time `bun:"updated_at,nullzero,default:current_timestamp" json:"updated_at"`
+
+	// Role is the role of the current user in the workspace.
+	Role string `bun:"role,scanonly" json:"role,omitempty"`
+}
+
+const (
+	WorkspaceRoleAdmin  = "admin"
+	WorkspaceRoleMember = "member"
+)
+
+const PersonalWorkspaceName = "Personal"
+
+// WorkspaceMember gives a user access to a workspace. Admins manage the
+// members, every member can create lists and tags in it.
+type WorkspaceMember struct {
+	bun.BaseModel `bun:"table:workspace_members,alias:wm" swaggerignore:"true"`
+	ID            int64     `bun:"id,pk,autoincrement" json:"id"`
+	WorkspaceID   int64     `bun:"workspace_id,notnull" json:"workspace_id"`
+	UserID        int64     `bun:"user_id,notnull" json:"user_id"`
+	Role          string    `bun:"role,notnull" json:"role"`
+	CreatedAt     time.Time `bun:"created_at,nullzero,default:current_timestamp" json:"created_at"`
+
+	Username string `bun:"username,scanonly" json:"username,omitempty"`
+}
+
+// List belongs to its owner UserID and is shared through ListMember.
+type List struct {
+	bun.BaseModel `bun:"table:lists,alias:l" swaggerignore:"true"`
+	ID            int64     `bun:"id,pk,autoincrement" json:"id"`
+	Name          string    `bun:"name,notnull" json:"name"`
+	UserID        int64     `bun:"user_id,notnull" json:"user_id"`
+	WorkspaceID   int64     `bun:"workspace_id,notnull" json:"workspace_id"`
+	Todos         []*Todo   `bun:"rel:has-many,join:id=list_id" json:"todos,omitempty"`
+	CreatedAt     time.Time `bun:"created_at,nullzero,default:current_timestamp" json:"created_at"`
+	UpdatedAt     time.Time `bun:"updated_at,nullzero,default:current_timestamp" json:"updated_at"`
+
+	// Role is the role of the current user in the list.
+	Role string `bun:"role,scanonly" json:"role,omitempty"`
+}
+
+const (
+	ListRoleOwner  = "owner"
+	ListRoleEditor = "editor"
+	ListRoleViewer = "viewer"
+)
+
+const (
+	ListMemberPending  = "pending"
+	ListMemberAccepted = "accepted"
+)
+
+// ListMember gives a user access to a list. Invitations are members in the
+// pending status until the user accepts them.
+type ListMember struct {
+	bun.BaseModel `bun:"table:list_members,alias:lm" swaggerignore:"true"`
+	ID            int64     `bun:"id,pk,autoincrement" json:"id"`
+	ListID        int64     `bun:"list_id,notnull" json:"list_id"`
+	UserID        int64     `bun:"user_id,notnull" json:"user_id"`
+	Role          string    `bun:"role,notnull" json:"role"`
+	Status        string    `bun:"status,notnull" json:"status"`
+	InvitedBy     int64     `bun:"invited_by,nullzero" json:"invited_by,omitempty"`
+	AcceptedAt    time.Time `bun:"accepted_at,nullzero" json:"accepted_at"`
+	CreatedAt     time.Time `bun:"created_at,nullzero,default:current_timestamp" json:"created_at"`
+
+	Username string `bun:"username,scanonly" json:"username,omitempty"`
+	ListName string `bun:"list_name,scanonly" json:"list_name,omitempty"`
+}
+
+// Tag is shared by the members of its workspace, UserID is who created it.
+type Tag struct {
+	bun.BaseModel `bun:"table:tags,alias:t" swaggerignore:"true"`
+	ID            int64     `bun:"id,pk,autoincrement" json:"id"`
+	Name          string    `bun:"name,notnull" json:"name"`
+	UserID        int64     `bun:"user_id,notnull" json:"user_id"`
+	WorkspaceID   int64     `bun:"workspace_id,notnull" json:"workspace_id"`
+	CreatedAt     time.Time `bun:"created_at,nullzero,default:current_timestamp" json:"created_at"`
+	UpdatedAt     time.Time `bun:"updated_at,nullzero,default:current_timestamp" json:"updated_at"`
+}
+
 type ToDoStatus string
 
 const (
@@ -51,29 +389,137 @@ const (
 	DONE  ToDoStatus = "done"
 )
 
+func (s ToDoStatus) IsValid() bool {
+	switch s {
+	case TODO, DOING, DONE:
+		return true
+	}
+	return false
+}
+
 type Todo struct {
-	bun.BaseModel `bun:"table:todo_items,alias:i"`
-	ID            int64      `bun:"id,pk,autoincrement"`
-	Title         string     `bun:"title,notnull"`
-	Description   string     `bun:"description,notnull"`
-	Status        ToDoStatus `bun:"status,notnull"`
-	CreatedAt     time.Time  `bun:"created_at,nullzero,default:current_timestamp"`
-	UpdatedAt     time.Time  `bun:"updated_at,nullzero,default:current_timestamp"`
+	bun.BaseModel `bun:"table:todos,alias:i" swaggerignore:"true"`
+	ID            int64      `bun:"id,pk,autoincrement" json:"id"`
+	Title         string     `bun:"title,notnull" json:"title"`
+	Description   string     `bun:"description,notnull" json:"description"`
+	Status        ToDoStatus `bun:"status,notnull" json:"status"`
+	CreatedAt     time.Time  `bun:"created_at,nullzero,default:current_timestamp" json:"created_at"`
+	UpdatedAt     time.Time  `bun:"updated_at,nullzero,default:current_timestamp" json:"updated_at"`
+
+	// All-day todos are due and start on a DueDate and StartDate, the others
+	// at a DueAt and StartAt timestamp.
+	DueAt     time.Time `bun:"due_at,nullzero" json:"due_at"`
+	DueDate   Date      `bun:"due_date,type:date,nullzero" json:"due_date" swaggertype:"string" format:"date"`
+	StartAt   time.Time `bun:"start_at,nullzero" json:"start_at"`
+	StartDate Date      `bun:"start_date,type:date,nullzero" json:"start_date" swaggertype:"string" format:"date"`
+	AllDay    bool      `bun:"all_day,notnull" json:"all_day"`
+
+	// Occurrences of a recurring todo belong to a series. OccurrenceAt is
+	// the due time the rule scheduled, edits of this occurrence only do not
+	// change it.
+	SeriesID     int64       `bun:"series_id,nullzero" json:"series_id,omitempty"`
+	OccurrenceAt time.Time   `bun:"occurrence_at,nullzero" json:"occurrence_at"`
+	Series       *TodoSeries `bun:"rel:belongs-to,join:series_id=id" json:"series,omitempty"`
 
-	ListID int64 `bun:"list_id,notnull"`
-	Tags   []Tag `bun:"m2m:todo_tags,join:Todo=Tag"`
+	// Subtasks have the todo they belong to as parent, always in the same
+	// list. Subtasks, Checklist and Progress are only loaded by GetTodo.
+	ParentID  int64            `bun:"parent_id,nullzero" json:"parent_id,omitempty"`
+	Subtasks  []*Todo          `bun:"-" json:"subtasks,omitempty"`
+	Checklist []*ChecklistItem `bun:"rel:has-many,join:id=todo_id" json:"checklist,omitempty"`
+	Progress  *TodoProgress    `bun:"-" json:"progress,omitempty"`
+
+	// BlockedBy are the todos this one waits for, Blocking the todos that
+	// wait for it. Blocked is set while one of BlockedBy is not done.
+	BlockedBy []int64 `bun:"-" json:"blocked_by,omitempty"`
+	Blocking  []int64 `bun:"-" json:"blocking,omitempty"`
+	Blocked   bool    `bun:"-" json:"blocked,omitempty"`
+
+	ListID int64 `bun:"list_id,notnull" json:"list_id"`
+	UserID int64 `bun:"user_id,notnull" json:"user_id"`
+	Tags   []Tag `bun:"m2m:todo_tags,join:Todo=Tag" json:"tags,omitempty"`
 }
 
-type TodoTag struct {
-	bun.BaseModel `bun:"table:todo_tags,alias:i"`
-	ID            int64     `bun:"id,pk,autoincrement"`
-	Todo          *Todo     `bun:"rel:belongs-to,join:id=todo_id"`
-	TodoID        int64     `bun:"todo_id,notnull"`
-	List          string    `bun:"list_id,notnull"`
-	Tag           *Tag      `bun:"rel:belongs-to,join:id=tag_id"`
-	TagID         int64     `bun:"tag_id,notnull"`
+// TodoDependency is an edge of the dependency graph of a list: TodoID is
+// blocked by BlockerID.
+type TodoDependency struct {
+	bun.BaseModel `bun:"table:todo_dependencies,alias:td"`
+	TodoID        int64     `bun:"todo_id,pk"`
+	BlockerID     int64     `bun:"blocker_id,pk"`
 	CreatedAt     time.Time `bun:"created_at,nullzero,default:current_timestamp"`
-	UpdatedAt     time.Time `bun:"updated_at,nullzero,default:current_timestamp"`
+}
+
+// TodoProgress counts the done subtasks at any depth below a todo and its
+// done checklist items.
+type TodoProgress struct {
+	Subtasks       int `json:"subtasks"`
+	SubtasksDone   int `json:"subtasks_done"`
+	ChecklistItems int `json:"checklist_items"`
+	ChecklistDone  int `json:"checklist_done"`
+	// Percent of the subtasks and checklist items that are done. Todos
+	// without either are 0 or, when done, 100 percent complete.
+	Percent int `json:"percent"`
+}
+
+// ChecklistItem is a step of a todo that is too small to be a subtask.
+type ChecklistItem struct {
+	bun.BaseModel `bun:"table:checklist_items,alias:ci" swaggerignore:"true"`
+	ID            int64     `bun:"id,pk,autoincrement" json:"id"`
+	TodoID        int64     `bun:"todo_id,notnull" json:"todo_id"`
+	Title         string    `bun:"title,notnull" json:"title"`
+	Done          bool      `bun:"done,notnull" json:"done"`
+	Position      int       `bun:"position,notnull" json:"position"`
+	CreatedAt     time.Time `bun:"created_at,nullzero,default:current_timestamp" json:"created_at"`
+	UpdatedAt     time.Time `bun:"updated_at,nullzero,default:current_timestamp" json:"updated_at"`
+}
+
+// Due returns when the todo is due, zero when it has no due date. All-day
+// todos are due at the start of their due date in loc.
+func (t *Todo) Due(loc *time.Location) time.Time {
+	if t.AllDay {
+		if t.DueDate.IsZero() {
+			return time.Time{}
+		}
+		return t.DueDate.In(loc)
+	}
+	return t.DueAt
+}
+
+// TodoSeries is a recurring todo. It holds the rule and the fields every
+// new occurrence starts with.
+type TodoSeries struct {
+	bun.BaseModel `bun:"table:todo_series,alias:ts" swaggerignore:"true"`
+	ID            int64  `bun:"id,pk,autoincrement" json:"id"`
+	Rule          string `bun:"rule,notnull" json:"rule"`
+	RepeatFrom    string `bun:"repeat_from,notnull" json:"repeat_from"`
+	Timezone      string `bun:"timezone,notnull" json:"timezone"`
+	// DTStart is the due time of the first occurrence, midnight UTC of the
+	// due date for all-day todos.
+	DTStart time.Time `bun:"dtstart,notnull" json:"dtstart"`
+	AllDay  bool      `bun:"all_day,notnull" json:"all_day"`
+	// StartOffset is the number of seconds an occurrence starts before it
+	// is due, nil when occurrences have no start.
+	StartOffset *int64    `bun:"start_offset" json:"start_offset,omitempty"`
+	Occurrences int       `bun:"occurrences,notnull" json:"occurrences"`
+	Title       string    `bun:"title,notnull" json:"-"`
+	Description string    `bun:"description,notnull" json:"-"`
+	ListID      int64     `bun:"list_id,notnull" json:"-"`
+	UserID      int64     `bun:"user_id,notnull" json:"-"`
+	CreatedAt   time.Time `bun:"created_at,nullzero,default:current_timestamp" json:"created_at"`
+	UpdatedAt   time.Time `bun:"updated_at,nullzero,default:current_timestamp" json:"updated_at"`
+}
+
+const (
+	RepeatFromDue        = "due"
+	RepeatFromCompletion = "completion"
+)
+
+type TodoTag struct {
+	bun.BaseModel `bun:"table:todo_tags,alias:tt"`
+	ID            int64 `bun:"id,pk,autoincrement"`
+	Todo          *Todo `bun:"rel:belongs-to,join:todo_id=id"`
+	TodoID        int64 `bun:"todo_id,notnull"`
+	Tag           *Tag  `bun:"rel:belongs-to,join:tag_id=id"`
+	TagID         int64 `bun:"tag_id,notnull"`
 }
 
 type DB struct {
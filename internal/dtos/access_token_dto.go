@@ -0,0 +1,12 @@
+package dtos
+
+import "time"
+
+type CreateAccessTokenDTO struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+	// ExpiresAt is optional, tokens without it stay valid until revoked.
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	// WorkspaceID is optional and restricts the token to one workspace.
+	WorkspaceID int64 `json:"workspace_id,omitempty"`
+}
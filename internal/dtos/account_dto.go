@@ -0,0 +1,29 @@
+package dtos
+
+// UpdateProfileDTO only changes the fields that are set. An empty
+// display_name or avatar_url clears it.
+type UpdateProfileDTO struct {
+	DisplayName *string `json:"display_name,omitempty"`
+	// Timezone is an IANA name like Europe/Berlin.
+	Timezone *string `json:"timezone,omitempty"`
+	// Locale is a language tag like en or pt-BR.
+	Locale    *string `json:"locale,omitempty"`
+	AvatarURL *string `json:"avatar_url,omitempty"`
+}
+
+type ChangePasswordDTO struct {
+	// CurrentPassword is not needed by accounts that have no password yet.
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+type ChangeUsernameDTO struct {
+	Username string `json:"username"`
+	// Password confirms the change, accounts without one leave it empty.
+	Password string `json:"password"`
+}
+
+type DeleteAccountDTO struct {
+	// Password confirms the deletion, accounts without one leave it empty.
+	Password string `json:"password"`
+}
@@ -0,0 +1,5 @@
+package dtos
+
+type SetRoleDTO struct {
+	Role string `json:"role"`
+}
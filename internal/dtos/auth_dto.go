@@ -3,4 +3,6 @@ package dtos
 type AuthDTO struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
-}
\ No newline at end of file
+	Email    string `json:"email,omitempty"`
+	Device   string `json:"device,omitempty"`
+}
@@ -0,0 +1,15 @@
+package dtos
+
+type CreateChecklistItemDTO struct {
+	Title string `json:"title"`
+	Done  bool   `json:"done"`
+}
+
+// UpdateChecklistItemDTO only changes the fields that are present in the
+// request body.
+type UpdateChecklistItemDTO struct {
+	Title *string `json:"title"`
+	Done  *bool   `json:"done"`
+	// Position orders the items of a todo, ascending.
+	Position *int `json:"position"`
+}
@@ -0,0 +1,14 @@
+package dtos
+
+type ForgotPasswordDTO struct {
+	Email string `json:"email"`
+}
+
+type ResetPasswordDTO struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+type VerifyEmailDTO struct {
+	Token string `json:"token"`
+}
@@ -0,0 +1,5 @@
+package dtos
+
+type ListDTO struct {
+	Name string `json:"name"`
+}
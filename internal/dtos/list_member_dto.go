@@ -0,0 +1,15 @@
+package dtos
+
+type InviteListMemberDTO struct {
+	Username string `json:"username"`
+	// Role is editor or viewer.
+	Role string `json:"role"`
+}
+
+type UpdateListMemberDTO struct {
+	Role string `json:"role"`
+}
+
+type TransferListDTO struct {
+	UserID int64 `json:"user_id"`
+}
@@ -0,0 +1,18 @@
+package dtos
+
+type MFACodeDTO struct {
+	Code string `json:"code"`
+}
+
+type MFALoginDTO struct {
+	MFAToken     string `json:"mfa_token"`
+	Code         string `json:"code,omitempty"`
+	RecoveryCode string `json:"recovery_code,omitempty"`
+	Device       string `json:"device,omitempty"`
+}
+
+type MFADisableDTO struct {
+	Password     string `json:"password"`
+	Code         string `json:"code,omitempty"`
+	RecoveryCode string `json:"recovery_code,omitempty"`
+}
@@ -0,0 +1,29 @@
+package dtos
+
+type CreateOAuthClientDTO struct {
+	Name         string   `json:"name"`
+	RedirectURIs []string `json:"redirect_uris"`
+	// GrantTypes default to authorization_code and refresh_token.
+	GrantTypes []string `json:"grant_types"`
+	// Scopes default to todos:read and todos:write.
+	Scopes []string `json:"scopes"`
+	// Confidential clients get a secret, public ones (mobile and single
+	// page apps) rely on PKCE alone.
+	Confidential bool `json:"confidential"`
+	// OwnerID is the user the client_credentials grant acts as.
+	OwnerID int64 `json:"owner_id,omitempty"`
+}
+
+// OAuthAuthorizeDTO is the authorization request of RFC 6749 section 4.1.1
+// with the PKCE parameters, plus the decision of the user.
+type OAuthAuthorizeDTO struct {
+	ResponseType        string `json:"response_type"`
+	ClientID            string `json:"client_id"`
+	RedirectURI         string `json:"redirect_uri"`
+	Scope               string `json:"scope"`
+	State               string `json:"state"`
+	CodeChallenge       string `json:"code_challenge"`
+	CodeChallengeMethod string `json:"code_challenge_method"`
+	// Approve is only read when the user answers the consent screen.
+	Approve bool `json:"approve"`
+}
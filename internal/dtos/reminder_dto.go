@@ -0,0 +1,11 @@
+package dtos
+
+// CreateReminderDTO sets a reminder at RemindAt or MinutesBefore the todo
+// is due.
+type CreateReminderDTO struct {
+	// RemindAt is an RFC3339 timestamp.
+	RemindAt      *string `json:"remind_at"`
+	MinutesBefore *int    `json:"minutes_before"`
+	// Channels are webhook, email and inbox. Defaults to inbox.
+	Channels []string `json:"channels"`
+}
@@ -0,0 +1,5 @@
+package dtos
+
+type TagDTO struct {
+	Name string `json:"name"`
+}
@@ -0,0 +1,63 @@
+package dtos
+
+import "todo-app/internal/db"
+
+type CreateTodoDTO struct {
+	Title       string        `json:"title"`
+	Description string        `json:"description"`
+	Status      db.ToDoStatus `json:"status"`
+	ListID      int64         `json:"list_id"`
+	// ParentID makes the todo a subtask, it is created in the list of its
+	// parent and list_id may be omitted.
+	ParentID int64 `json:"parent_id"`
+	TodoScheduleDTO
+	TodoRecurrenceDTO
+}
+
+// UpdateTodoDTO only changes the fields that are present in the request body.
+type UpdateTodoDTO struct {
+	Title       *string        `json:"title"`
+	Description *string        `json:"description"`
+	Status      *db.ToDoStatus `json:"status"`
+	ListID      *int64         `json:"list_id"`
+	// ParentID moves the todo with its subtasks below another todo, into
+	// its list. 0 makes a subtask top-level. A subtask moved to another
+	// list without a new parent becomes top-level there.
+	ParentID *int64 `json:"parent_id"`
+	// Cascade completes the open subtasks and checklist items when the
+	// status is set to done, which fails while they are open otherwise.
+	Cascade bool `json:"cascade"`
+	// IgnoreBlockers sets the status to done although todos that block
+	// this one are open.
+	IgnoreBlockers bool `json:"ignore_blockers"`
+	TodoScheduleDTO
+	TodoRecurrenceDTO
+	// Scope of the edit of a recurring todo, "this" occurrence (default) or
+	// all "future" ones. Changes of the recurrence always apply to the
+	// future.
+	Scope string `json:"scope" enums:"this,future"`
+}
+
+// TodoScheduleDTO sets when a todo starts and is due. Dates (YYYY-MM-DD)
+// make the todo all-day, timestamps (RFC3339) give it a time. An empty
+// string clears a field.
+type TodoScheduleDTO struct {
+	DueAt     *string `json:"due_at"`
+	DueDate   *string `json:"due_date"`
+	StartAt   *string `json:"start_at"`
+	StartDate *string `json:"start_date"`
+	// AllDay true turns timestamps into dates in the timezone of the user,
+	// false needs due_at and start_at for the dates the todo has.
+	AllDay *bool `json:"all_day"`
+}
+
+// TodoRecurrenceDTO makes a todo repeat. Recurring todos need a due date or
+// time, completing an occurrence creates the next one.
+type TodoRecurrenceDTO struct {
+	// Recurrence is an iCalendar RRULE like FREQ=WEEKLY;BYDAY=MO,WE,FR, an
+	// empty string stops the todo from repeating.
+	Recurrence *string `json:"recurrence" example:"FREQ=WEEKLY;BYDAY=MO,TU,WE,TH,FR"`
+	// RepeatFrom counts the rule from the "due" date (default) or from the
+	// "completion" of the previous occurrence.
+	RepeatFrom *string `json:"repeat_from" enums:"due,completion"`
+}
@@ -0,0 +1,39 @@
+package dtos
+
+import (
+	"time"
+	"todo-app/internal/db"
+)
+
+// TodoFilterDTO holds the query parameters accepted by GET /api/todo.
+type TodoFilterDTO struct {
+	Statuses []db.ToDoStatus
+	ListID   int64
+	TagID    int64
+	// ParentID lists the direct subtasks of a todo, 0 the top-level todos.
+	// Nil lists todos at any depth.
+	ParentID      *int64
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	UpdatedAfter  time.Time
+	UpdatedBefore time.Time
+	Query         string
+
+	// Due is today, overdue or this_week. The bounds are resolved from it
+	// in the timezone of the user: timed todos match when they are due in
+	// [DueFrom, DueTo), all-day todos when they are due on a date in
+	// [DueFromDate, DueToDate). Zero bounds are open.
+	Due         string
+	DueFrom     time.Time
+	DueTo       time.Time
+	DueFromDate db.Date
+	DueToDate   db.Date
+
+	Sort  string
+	Desc  bool
+	Limit int
+
+	// Offset and Cursor are mutually exclusive.
+	Offset int
+	Cursor string
+}
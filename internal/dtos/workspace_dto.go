@@ -0,0 +1,15 @@
+package dtos
+
+type WorkspaceDTO struct {
+	Name string `json:"name"`
+}
+
+type AddWorkspaceMemberDTO struct {
+	Username string `json:"username"`
+	// Role is admin or member, member when empty.
+	Role string `json:"role"`
+}
+
+type UpdateWorkspaceMemberDTO struct {
+	Role string `json:"role"`
+}
@@ -0,0 +1,264 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"todo-app/httputil/httperror"
+	"todo-app/httputil/httpresponse"
+	"todo-app/internal/constants"
+	"todo-app/internal/db"
+	"todo-app/internal/dtos"
+	"todo-app/pkg/utils"
+
+	"github.com/go-chi/render"
+)
+
+// accessTokenDisplayLength is how much of a token is kept in clear to
+// recognize it in the list.
+const accessTokenDisplayLength = len(utils.AccessTokenPrefix) + 8
+
+var errInvalidAccessToken = errors.New("invalid or expired access token")
+
+type CreateAccessTokenResponse struct {
+	// Token is only returned once.
+	Token       string                  `json:"token"`
+	AccessToken *db.PersonalAccessToken `json:"access_token"`
+}
+
+// CreateAccessToken implements handlers.AuthHandlerService.
+// @Summary Create personal access token
+// @Description Create a token for scripts and CI. The token is only shown in this response. Scopes are todos:read, todos:write and admin (admins only). A token with a workspace_id can only access that workspace
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Param request body dtos.CreateAccessTokenDTO true "Name, scopes and optional expiry"
+// @Success 201 {object} httpresponse.SingleResponse{data=CreateAccessTokenResponse}
+// @Failure 400 {object} httperror.ErrResponse
+// @Failure 403 {object} httperror.ErrResponse
+// @Router /api/auth/tokens [post]
+func (a *AuthHandler) CreateAccessToken(w http.ResponseWriter, r *http.Request) {
+	claims, ok := currentUser(r)
+	if !ok {
+		render.Render(w, r, httperror.ErrUnAuthorized(errors.New("unauthorized")))
+		return
+	}
+	if claims.IsAnonymous {
+		render.Render(w, r, httperror.ErrForbidden(errors.New("guests cannot create access tokens")))
+		return
+	}
+
+	var req dtos.CreateAccessTokenDTO
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		render.Render(w, r, httperror.ErrInvalidRequest(err))
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		render.Render(w, r, httperror.ErrInvalidRequest(errors.New("name is required")))
+		return
+	}
+	if len(req.Scopes) == 0 {
+		render.Render(w, r, httperror.ErrInvalidRequest(errors.New("at least one scope is required")))
+		return
+	}
+	for _, scope := range req.Scopes {
+		if !slices.Contains(constants.Scopes, scope) {
+			render.Render(w, r, httperror.ErrInvalidRequest(errors.New("unknown scope "+scope)))
+			return
+		}
+	}
+	if slices.Contains(req.Scopes, constants.ScopeAdmin) && !claims.HasRole(db.RoleAdmin) {
+		render.Render(w, r, httperror.ErrForbiddenCode(errors.New("only admins can grant the admin scope"), httperror.CodeInsufficientRole))
+		return
+	}
+	now := a.app.Clock().Now()
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(now) {
+		render.Render(w, r, httperror.ErrInvalidRequest(errors.New("expires_at must be in the future")))
+		return
+	}
+	if req.WorkspaceID != 0 {
+		_, err := selectWorkspace(r.Context(), a.app.DB(), claims.Sub, req.WorkspaceID)
+		if errors.Is(err, sql.ErrNoRows) {
+			render.Render(w, r, httperror.ErrInvalidRequest(errNotWorkspaceMember))
+			return
+		}
+		if err != nil {
+			render.Render(w, r, httperror.ErrInternalError(err))
+			return
+		}
+	}
+
+	token, err := utils.GenerateAccessToken()
+	if err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+
+	pat := &db.PersonalAccessToken{
+		UserID:      claims.Sub,
+		Name:        req.Name,
+		TokenHash:   utils.HashAccessToken(token),
+		TokenPrefix: token[:accessTokenDisplayLength],
+		Scopes:      slices.Compact(slices.Sorted(slices.Values(req.Scopes))),
+		WorkspaceID: req.WorkspaceID,
+		CreatedAt:   now,
+	}
+	if req.ExpiresAt != nil {
+		pat.ExpiresAt = *req.ExpiresAt
+	}
+	if _, err := a.app.DB().NewInsert().Model(pat).Exec(r.Context()); err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+
+	render.Render(w, r, httpresponse.WriteResponse(w, http.StatusCreated, "success", CreateAccessTokenResponse{
+		Token:       token,
+		AccessToken: pat,
+	}))
+}
+
+// GetAccessTokens implements handlers.AuthHandlerService.
+// @Summary List personal access tokens
+// @Description List the personal access tokens of the current user that are not revoked
+// @Tags Auth
+// @Produce json
+// @Success 200 {object} httpresponse.CollectionResponse{data=[]db.PersonalAccessToken}
+// @Failure 401 {object} httperror.ErrResponse
+// @Router /api/auth/tokens [get]
+func (a *AuthHandler) GetAccessTokens(w http.ResponseWriter, r *http.Request) {
+	claims, ok := currentUser(r)
+	if !ok {
+		render.Render(w, r, httperror.ErrUnAuthorized(errors.New("unauthorized")))
+		return
+	}
+
+	tokens := make([]*db.PersonalAccessToken, 0)
+	total, err := a.app.DB().NewSelect().Model(&tokens).
+		Where("pat.user_id = ?", claims.Sub).
+		Where("pat.revoked_at IS NULL").
+		Order("pat.created_at DESC").
+		ScanAndCount(r.Context())
+	if err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+
+	render.Render(w, r, httpresponse.WriteCollectionResponse(w, http.StatusOK, "success", tokens, total))
+}
+
+// RevokeAccessToken implements handlers.AuthHandlerService.
+// @Summary Revoke personal access token
+// @Description Revoke a personal access token of the current user
+// @Tags Auth
+// @Produce json
+// @Param id path int true "Token ID"
+// @Success 200 {object} httpresponse.SingleResponse
+// @Failure 404 {object} httperror.ErrResponse
+// @Router /api/auth/tokens/{id} [delete]
+func (a *AuthHandler) RevokeAccessToken(w http.ResponseWriter, r *http.Request) {
+	claims, ok := currentUser(r)
+	if !ok {
+		render.Render(w, r, httperror.ErrUnAuthorized(errors.New("unauthorized")))
+		return
+	}
+
+	id, err := parseIDParam(r, "id")
+	if err != nil {
+		render.Render(w, r, httperror.ErrInvalidRequest(err))
+		return
+	}
+
+	res, err := a.app.DB().NewUpdate().Model((*db.PersonalAccessToken)(nil)).
+		Set("revoked_at = ?", a.app.Clock().Now()).
+		Where("id = ?", id).
+		Where("user_id = ?", claims.Sub).
+		Where("revoked_at IS NULL").
+		Exec(r.Context())
+	if err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		render.Render(w, r, httperror.ErrNotFound())
+		return
+	}
+
+	render.Render(w, r, httpresponse.WriteResponse(w, http.StatusOK, "success", nil))
+}
+
+// RequireSession rejects requests made with a personal access token or a
+// token issued to an OAuth client, for endpoints that manage the account
+// itself.
+func (a *AuthHandler) RequireSession(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		session, ok := currentSession(r)
+		if claims, _ := currentUser(r); !ok || session.OAuthClientID != 0 || (claims != nil && claims.ClientID != "") {
+			render.Render(w, r, httperror.ErrForbidden(errors.New("this endpoint requires a login session")))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// authenticateAccessToken resolves a personal access token to the claims of
+// its user.
+func (a *AuthHandler) authenticateAccessToken(ctx context.Context, token string) (*JwtPayload, *db.PersonalAccessToken, error) {
+	pat := new(db.PersonalAccessToken)
+	err := a.app.DB().NewSelect().Model(pat).
+		Where("pat.token_hash = ?", utils.HashAccessToken(token)).
+		Where("pat.revoked_at IS NULL").
+		Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil, errInvalidAccessToken
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := a.app.Clock().Now()
+	if !pat.ExpiresAt.IsZero() && !now.Before(pat.ExpiresAt) {
+		return nil, nil, errInvalidAccessToken
+	}
+
+	user := new(db.User)
+	err = a.app.DB().NewSelect().Model(user).Where("id = ?", pat.UserID).Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil, errInvalidAccessToken
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if now.Sub(pat.LastUsedAt) > sessionTouchInterval {
+		_, err = a.app.DB().NewUpdate().Model(pat).Set("last_used_at = ?", now).WherePK().Exec(ctx)
+		if err != nil {
+			return nil, nil, err
+		}
+		pat.LastUsedAt = now
+	}
+
+	// A token never grants more than the role of its user allows today.
+	sub := NewTokenSubject(user)
+	scopes := make([]string, 0, len(pat.Scopes))
+	for _, scope := range pat.Scopes {
+		if slices.Contains(sub.Scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+
+	claims := &JwtPayload{
+		Username:    user.Username,
+		Sub:         user.ID,
+		IsAnonymous: user.IsAnonymous,
+		Type:        TokenTypePersonal,
+		Role:        sub.Role,
+		Scopes:      scopes,
+		WorkspaceID: pat.WorkspaceID,
+	}
+	return claims, pat, nil
+}
@@ -0,0 +1,462 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+	"todo-app/httputil/httperror"
+	"todo-app/httputil/httpresponse"
+	"todo-app/internal/db"
+	"todo-app/internal/dtos"
+
+	"github.com/go-chi/render"
+	"github.com/uptrace/bun"
+)
+
+const (
+	maxDisplayNameLength = 100
+	maxAvatarURLLength   = 2048
+)
+
+var (
+	usernamePattern = regexp.MustCompile(`^[a-zA-Z0-9._-]{3,32}$`)
+	localePattern   = regexp.MustCompile(`^[a-zA-Z]{2,3}(-[a-zA-Z0-9]{2,8})*$`)
+)
+
+var (
+	errInvalidPassword = errors.New("invalid password")
+	errUsernameTaken   = errors.New("username is already taken")
+	errOwnsSharedLists = errors.New("you still own lists shared with others, transfer them first")
+	errSoleAdmin       = errors.New("you are the only admin of a workspace with other members, promote another admin first")
+)
+
+// Profile is the account of the current user.
+type Profile struct {
+	ID            int64     `json:"id"`
+	Username      string    `json:"username"`
+	DisplayName   string    `json:"display_name,omitempty"`
+	Email         string    `json:"email,omitempty"`
+	EmailVerified bool      `json:"email_verified"`
+	Timezone      string    `json:"timezone"`
+	Locale        string    `json:"locale"`
+	AvatarURL     string    `json:"avatar_url,omitempty"`
+	Role          string    `json:"role"`
+	IsAnonymous   bool      `json:"is_anonymous"`
+	HasPassword   bool      `json:"has_password"`
+	MFAEnabled    bool      `json:"mfa_enabled"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+func newProfile(user *db.User) Profile {
+	return Profile{
+		ID:            user.ID,
+		Username:      user.Username,
+		DisplayName:   user.DisplayName,
+		Email:         user.Email,
+		EmailVerified: !user.EmailVerifiedAt.IsZero(),
+		Timezone:      user.Timezone,
+		Locale:        user.Locale,
+		AvatarURL:     user.AvatarURL,
+		Role:          user.Role,
+		IsAnonymous:   user.IsAnonymous,
+		HasPassword:   user.HasPassword(),
+		MFAEnabled:    !user.TOTPEnabledAt.IsZero(),
+		CreatedAt:     user.CreatedAt,
+	}
+}
+
+type DeleteAccountResponse struct {
+	// PurgeAt is when the account and its data are removed for good.
+	PurgeAt time.Time `json:"purge_at"`
+}
+
+// GetMe implements handlers.AuthHandlerService.
+// @Summary Get profile
+// @Description Get the account of the current user
+// @Tags Account
+// @Produce json
+// @Success 200 {object} httpresponse.SingleResponse{data=Profile}
+// @Failure 401 {object} httperror.ErrResponse
+// @Router /api/me [get]
+func (a *AuthHandler) GetMe(w http.ResponseWriter, r *http.Request) {
+	user, ok := a.findCurrentUser(w, r)
+	if !ok {
+		return
+	}
+
+	render.Render(w, r, httpresponse.WriteResponse(w, http.StatusOK, "success", newProfile(user)))
+}
+
+// UpdateMe implements handlers.AuthHandlerService.
+// @Summary Update profile
+// @Description Change the display name, timezone, locale or avatar of the current user. Only the fields that are sent change
+// @Tags Account
+// @Accept json
+// @Produce json
+// @Param request body dtos.UpdateProfileDTO true "Profile fields"
+// @Success 200 {object} httpresponse.SingleResponse{data=Profile}
+// @Failure 400 {object} httperror.ErrResponse
+// @Router /api/me [patch]
+func (a *AuthHandler) UpdateMe(w http.ResponseWriter, r *http.Request) {
+	var req dtos.UpdateProfileDTO
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		render.Render(w, r, httperror.ErrInvalidRequest(err))
+		return
+	}
+	if err := validateProfile(&req); err != nil {
+		render.Render(w, r, httperror.ErrInvalidRequest(err))
+		return
+	}
+
+	user, ok := a.findCurrentUser(w, r)
+	if !ok {
+		return
+	}
+
+	q := a.app.DB().NewUpdate().Model(user).
+		Set("updated_at = ?", a.app.Clock().Now()).
+		WherePK().
+		Returning("*")
+	if req.DisplayName != nil {
+		q = q.Set("display_name = NULLIF(?, '')", *req.DisplayName)
+	}
+	if req.Timezone != nil {
+		q = q.Set("timezone = ?", *req.Timezone)
+	}
+	if req.Locale != nil {
+		q = q.Set("locale = ?", *req.Locale)
+	}
+	if req.AvatarURL != nil {
+		q = q.Set("avatar_url = NULLIF(?, '')", *req.AvatarURL)
+	}
+	if _, err := q.Exec(r.Context()); err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+
+	render.Render(w, r, httpresponse.WriteResponse(w, http.StatusOK, "success", newProfile(user)))
+}
+
+// validateProfile checks and normalizes the fields of a profile update.
+func validateProfile(req *dtos.UpdateProfileDTO) error {
+	if req.DisplayName != nil {
+		name := strings.TrimSpace(*req.DisplayName)
+		if len([]rune(name)) > maxDisplayNameLength {
+			return errors.New("display_name is too long")
+		}
+		req.DisplayName = &name
+	}
+	if req.Timezone != nil {
+		// Local would be the timezone of the server.
+		if *req.Timezone == "" || *req.Timezone == "Local" {
+			return errors.New("invalid timezone")
+		}
+		if _, err := time.LoadLocation(*req.Timezone); err != nil {
+			return errors.New("invalid timezone")
+		}
+	}
+	if req.Locale != nil && !localePattern.MatchString(*req.Locale) {
+		return errors.New("invalid locale")
+	}
+	if req.AvatarURL != nil && *req.AvatarURL != "" {
+		u, err := url.Parse(*req.AvatarURL)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" || len(*req.AvatarURL) > maxAvatarURLLength {
+			return errors.New("avatar_url must be an http or https URL")
+		}
+	}
+	return nil
+}
+
+// ChangePassword implements handlers.AuthHandlerService.
+// @Summary Change password
+// @Description Change the password of the current user, which requires the current one. Accounts created through an OpenID provider set their first password without it. Every other session is logged out
+// @Tags Account
+// @Accept json
+// @Produce json
+// @Param request body dtos.ChangePasswordDTO true "Current and new password"
+// @Success 200 {object} httpresponse.SingleResponse
+// @Failure 400 {object} httperror.ErrResponse
+// @Failure 403 {object} httperror.ErrResponse
+// @Failure 429 {object} httperror.ErrResponse
+// @Router /api/me/password [put]
+func (a *AuthHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	var req dtos.ChangePasswordDTO
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		render.Render(w, r, httperror.ErrInvalidRequest(err))
+		return
+	}
+	if req.NewPassword == "" {
+		render.Render(w, r, httperror.ErrInvalidRequest(errors.New("new_password is required")))
+		return
+	}
+
+	user, ok := a.findCurrentUser(w, r)
+	if !ok {
+		return
+	}
+	if user.IsAnonymous {
+		render.Render(w, r, httperror.ErrForbidden(errors.New("guests have no password, register first")))
+		return
+	}
+	if !a.confirmPassword(w, r, user, req.CurrentPassword) {
+		return
+	}
+
+	passwordHash, ok := a.hashNewPassword(w, r, user.Username, req.NewPassword)
+	if !ok {
+		return
+	}
+
+	// Leave the hash alone if the password changed meanwhile.
+	res, err := a.app.DB().NewUpdate().Model(user).
+		Set("password = ?", passwordHash).
+		Set("updated_at = ?", a.app.Clock().Now()).
+		WherePK().
+		Where("password = ?", user.PasswordHash).
+		Exec(r.Context())
+	if err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		render.Render(w, r, httperror.ErrForbidden(errInvalidPassword))
+		return
+	}
+
+	// Whoever knew the old password must not stay logged in.
+	var keep int64
+	if session, ok := currentSession(r); ok {
+		keep = session.ID
+	}
+	if err := a.revokeOtherSessions(r.Context(), user.ID, keep); err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+
+	render.Render(w, r, httpresponse.WriteResponse(w, http.StatusOK, "success", nil))
+}
+
+// ChangeUsername implements handlers.AuthHandlerService.
+// @Summary Change username
+// @Description Change the username of the current user. Usernames are 3 to 32 letters, digits, dots, dashes or underscores and must be free. Requires the password when the account has one
+// @Tags Account
+// @Accept json
+// @Produce json
+// @Param request body dtos.ChangeUsernameDTO true "New username and password"
+// @Success 200 {object} httpresponse.SingleResponse{data=Profile}
+// @Failure 400 {object} httperror.ErrResponse
+// @Failure 403 {object} httperror.ErrResponse
+// @Router /api/me/username [put]
+func (a *AuthHandler) ChangeUsername(w http.ResponseWriter, r *http.Request) {
+	var req dtos.ChangeUsernameDTO
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		render.Render(w, r, httperror.ErrInvalidRequest(err))
+		return
+	}
+	req.Username = strings.TrimSpace(req.Username)
+	if !usernamePattern.MatchString(req.Username) || strings.HasPrefix(req.Username, "guest_") {
+		render.Render(w, r, httperror.ErrInvalidRequest(errors.New("invalid username")))
+		return
+	}
+
+	user, ok := a.findCurrentUser(w, r)
+	if !ok {
+		return
+	}
+	if user.IsAnonymous {
+		render.Render(w, r, httperror.ErrForbidden(errors.New("guests choose a username when they register")))
+		return
+	}
+	if req.Username == user.Username {
+		render.Render(w, r, httpresponse.WriteResponse(w, http.StatusOK, "success", newProfile(user)))
+		return
+	}
+	if !a.confirmPassword(w, r, user, req.Password) {
+		return
+	}
+
+	// Usernames of deleted accounts stay reserved until they are purged.
+	exists, err := a.app.DB().NewSelect().Model((*db.User)(nil)).
+		WhereAllWithDeleted().
+		Where("username = ?", req.Username).
+		Exists(r.Context())
+	if err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+	if exists {
+		render.Render(w, r, httperror.ErrBadRequest(errUsernameTaken))
+		return
+	}
+
+	_, err = a.app.DB().NewUpdate().Model(user).
+		Set("username = ?", req.Username).
+		Set("updated_at = ?", a.app.Clock().Now()).
+		WherePK().
+		Returning("*").
+		Exec(r.Context())
+	if isUniqueViolation(err) {
+		render.Render(w, r, httperror.ErrBadRequest(errUsernameTaken))
+		return
+	}
+	if err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+
+	render.Render(w, r, httpresponse.WriteResponse(w, http.StatusOK, "success", newProfile(user)))
+}
+
+// DeleteAccount implements handlers.AuthHandlerService.
+// @Summary Delete account
+// @Description Delete the account of the current user. Every session and personal access token is revoked at once, the data is purged after the grace period. Lists shared with others must be transferred first. Requires the password when the account has one
+// @Tags Account
+// @Accept json
+// @Produce json
+// @Param request body dtos.DeleteAccountDTO false "Password"
+// @Success 200 {object} httpresponse.SingleResponse{data=DeleteAccountResponse}
+// @Failure 400 {object} httperror.ErrResponse
+// @Failure 403 {object} httperror.ErrResponse
+// @Router /api/me [delete]
+func (a *AuthHandler) DeleteAccount(w http.ResponseWriter, r *http.Request) {
+	var req dtos.DeleteAccountDTO
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		render.Render(w, r, httperror.ErrInvalidRequest(err))
+		return
+	}
+
+	user, ok := a.findCurrentUser(w, r)
+	if !ok {
+		return
+	}
+	if !a.confirmPassword(w, r, user, req.Password) {
+		return
+	}
+
+	now := a.app.Clock().Now()
+	err := a.app.DB().RunInTx(r.Context(), nil, func(ctx context.Context, tx bun.Tx) error {
+		shared, err := tx.NewSelect().Model((*db.ListMember)(nil)).
+			Join("JOIN lists AS l ON l.id = lm.list_id").
+			Where("l.user_id = ?", user.ID).
+			Where("lm.user_id <> ?", user.ID).
+			Exists(ctx)
+		if err != nil {
+			return err
+		}
+		if shared {
+			return errOwnsSharedLists
+		}
+
+		// Workspaces where the user is the only admin but not the only
+		// member would be left without anyone to manage them.
+		soleAdmin, err := tx.NewSelect().Model((*db.WorkspaceMember)(nil)).
+			Where("wm.user_id = ?", user.ID).
+			Where("wm.role = ?", db.WorkspaceRoleAdmin).
+			Where("EXISTS (SELECT 1 FROM workspace_members AS o WHERE o.workspace_id = wm.workspace_id AND o.user_id <> wm.user_id)").
+			Where("NOT EXISTS (SELECT 1 FROM workspace_members AS o WHERE o.workspace_id = wm.workspace_id AND o.user_id <> wm.user_id AND o.role = ?)", db.WorkspaceRoleAdmin).
+			Exists(ctx)
+		if err != nil {
+			return err
+		}
+		if soleAdmin {
+			return errSoleAdmin
+		}
+
+		_, err = tx.NewUpdate().Model(user).
+			Set("deleted_at = ?", now).
+			Set("updated_at = ?", now).
+			WherePK().
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.NewUpdate().Model((*db.Session)(nil)).
+			Set("revoked_at = ?", now).
+			Set("updated_at = ?", now).
+			Where("user_id = ?", user.ID).
+			Where("revoked_at IS NULL").
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+		_, err = tx.NewUpdate().Model((*db.PersonalAccessToken)(nil)).
+			Set("revoked_at = ?", now).
+			Where("user_id = ?", user.ID).
+			Where("revoked_at IS NULL").
+			Exec(ctx)
+		return err
+	})
+	if errors.Is(err, errOwnsSharedLists) || errors.Is(err, errSoleAdmin) {
+		render.Render(w, r, httperror.ErrBadRequest(err))
+		return
+	}
+	if err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+
+	render.Render(w, r, httpresponse.WriteResponse(w, http.StatusOK, "success", DeleteAccountResponse{
+		PurgeAt: now.Add(a.app.DeletionGracePeriod()),
+	}))
+}
+
+// confirmPassword checks the current password of user before a sensitive
+// change. Accounts without a password have nothing to confirm. Failures
+// count towards the login lockout, so a stolen session cannot be used to
+// guess the password.
+func (a *AuthHandler) confirmPassword(w http.ResponseWriter, r *http.Request, user *db.User, password string) bool {
+	if !user.HasPassword() {
+		return true
+	}
+	if !a.checkLoginAllowed(w, r, user.Username) {
+		return false
+	}
+	if match, _ := a.app.PasswordHasher().Verify(user.PasswordHash, password); !match {
+		a.recordLoginFailure(r, user.Username)
+		render.Render(w, r, httperror.ErrForbidden(errInvalidPassword))
+		return false
+	}
+	return true
+}
+
+// RestoreUser implements handlers.AuthHandlerService.
+// @Summary Restore deleted user
+// @Description Undo the deletion of an account that is not purged yet. The user logs in again, revoked sessions and tokens stay revoked. Requires the admin role and scope
+// @Tags Admin
+// @Produce json
+// @Param id path int true "User ID"
+// @Success 200 {object} httpresponse.SingleResponse
+// @Failure 403 {object} httperror.ErrResponse
+// @Failure 404 {object} httperror.ErrResponse
+// @Router /api/admin/users/{id}/restore [post]
+func (a *AuthHandler) RestoreUser(w http.ResponseWriter, r *http.Request) {
+	id, err := parseIDParam(r, "id")
+	if err != nil {
+		render.Render(w, r, httperror.ErrInvalidRequest(err))
+		return
+	}
+
+	res, err := a.app.DB().NewUpdate().Model((*db.User)(nil)).
+		Set("deleted_at = ?", time.Time{}).
+		Set("updated_at = ?", a.app.Clock().Now()).
+		WhereDeleted().
+		Where("id = ?", id).
+		Exec(r.Context())
+	if err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		render.Render(w, r, httperror.ErrNotFound())
+		return
+	}
+
+	render.Render(w, r, httpresponse.WriteResponse(w, http.StatusOK, "success", nil))
+}
@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"todo-app/httputil/httperror"
+	"todo-app/httputil/httpresponse"
+	"todo-app/internal/db"
+	"todo-app/internal/dtos"
+
+	"github.com/go-chi/render"
+)
+
+// UnlockUser implements handlers.AuthHandlerService.
+// @Summary Unlock user
+// @Description Lift the login lockout of a user. Requires the admin role and scope
+// @Tags Admin
+// @Produce json
+// @Param id path int true "User ID"
+// @Success 200 {object} httpresponse.SingleResponse
+// @Failure 403 {object} httperror.ErrResponse
+// @Failure 404 {object} httperror.ErrResponse
+// @Router /api/admin/users/{id}/unlock [post]
+func (a *AuthHandler) UnlockUser(w http.ResponseWriter, r *http.Request) {
+	user, ok := a.findUser(w, r)
+	if !ok {
+		return
+	}
+
+	if err := a.app.LoginLimiter().Unlock(r.Context(), user.Username); err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+
+	render.Render(w, r, httpresponse.WriteResponse(w, http.StatusOK, "success", nil))
+}
+
+// SetUserRole implements handlers.AuthHandlerService.
+// @Summary Set user role
+// @Description Make a user an admin or a regular user. The sessions of the user are revoked so that new tokens carry the role. Requires the admin role and scope
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param id path int true "User ID"
+// @Param request body dtos.SetRoleDTO true "user or admin"
+// @Success 200 {object} httpresponse.SingleResponse
+// @Failure 400 {object} httperror.ErrResponse
+// @Failure 403 {object} httperror.ErrResponse
+// @Failure 404 {object} httperror.ErrResponse
+// @Router /api/admin/users/{id}/role [put]
+func (a *AuthHandler) SetUserRole(w http.ResponseWriter, r *http.Request) {
+	claims, ok := currentUser(r)
+	if !ok {
+		render.Render(w, r, httperror.ErrUnAuthorized(errors.New("unauthorized")))
+		return
+	}
+
+	var req dtos.SetRoleDTO
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		render.Render(w, r, httperror.ErrInvalidRequest(err))
+		return
+	}
+	if req.Role != db.RoleUser && req.Role != db.RoleAdmin {
+		render.Render(w, r, httperror.ErrInvalidRequest(errors.New("role must be user or admin")))
+		return
+	}
+
+	user, ok := a.findUser(w, r)
+	if !ok {
+		return
+	}
+	if user.ID == claims.Sub {
+		render.Render(w, r, httperror.ErrBadRequest(errors.New("cannot change your own role")))
+		return
+	}
+	if user.IsAnonymous {
+		render.Render(w, r, httperror.ErrBadRequest(errors.New("guests cannot have a role")))
+		return
+	}
+	if user.Role == req.Role {
+		render.Render(w, r, httpresponse.WriteResponse(w, http.StatusOK, "success", nil))
+		return
+	}
+
+	_, err := a.app.DB().NewUpdate().Model(user).
+		Set("role = ?", req.Role).
+		Set("updated_at = ?", a.app.Clock().Now()).
+		WherePK().
+		Exec(r.Context())
+	if err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+
+	if _, err := a.revokeSessions(r.Context(), user.ID); err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+
+	render.Render(w, r, httpresponse.WriteResponse(w, http.StatusOK, "success", nil))
+}
+
+// findUser loads the user of the id URL parameter.
+func (a *AuthHandler) findUser(w http.ResponseWriter, r *http.Request) (*db.User, bool) {
+	id, err := parseIDParam(r, "id")
+	if err != nil {
+		render.Render(w, r, httperror.ErrInvalidRequest(err))
+		return nil, false
+	}
+
+	user := new(db.User)
+	err = a.app.DB().NewSelect().Model(user).Where("id = ?", id).Scan(r.Context())
+	if errors.Is(err, sql.ErrNoRows) {
+		render.Render(w, r, httperror.ErrNotFound())
+		return nil, false
+	}
+	if err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return nil, false
+	}
+	return user, true
+}
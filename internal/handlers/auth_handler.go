@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"context"
+	"database/sql"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -15,11 +16,10 @@ import (
 	"todo-app/internal/db"
 	"todo-app/internal/dtos"
 	handlers "todo-app/internal/services"
+	"todo-app/pkg/jwks"
 	"todo-app/pkg/utils"
 
 	"github.com/go-chi/render"
-	"github.com/golang-jwt/jwt/v5"
-	"github.com/twinj/uuid"
 )
 
 type AuthHandler struct {
@@ -38,7 +38,7 @@ type RefreshTokenRequest struct {
 // CheckToken implements handlers.AuthHandlerService.
 func (a *AuthHandler) CheckToken(w http.ResponseWriter, r *http.Request) {
 
-	claims, ok := r.Context().Value("current_user").(*JwtPayload)
+	claims, ok := currentUser(r)
 	if !ok {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
@@ -65,11 +65,12 @@ func NewAuthHandler(app *bunapp.App) *AuthHandler {
 // @Param request body dtos.AuthDTO true "Login request body"
 // @Success 200
 // @Failure 400 {object} httperror.ErrResponse
+// @Failure 403 {object} httperror.ErrResponse
+// @Failure 429 {object} httperror.ErrResponse
 // @Router /api/auth/login [post]
 func (a *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 	var authDTO dtos.AuthDTO
 	err := json.NewDecoder(r.Body).Decode(&authDTO)
-	fmt.Println(authDTO)
 	if err != nil {
 		render.Render(w, r, httperror.ErrInvalidRequest(err))
 		return
@@ -80,39 +81,78 @@ func (a *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !a.checkLoginAllowed(w, r, authDTO.Username) {
+		return
+	}
+
 	var user db.User
 	err = a.app.DB().NewSelect().Model(&user).Where("username = ?", authDTO.Username).Scan(r.Context())
-	if err != nil {
-		render.Render(w, r, httperror.ErrForbidden(errors.New(err.Error())))
+	if errors.Is(err, sql.ErrNoRows) {
+		// Spend the same time as for a wrong password.
+		a.app.PasswordHasher().Spend(authDTO.Password)
+		a.loginFailed(w, r, authDTO.Username)
 		return
 	}
-
-	IsMatch, err := utils.ComparePassword(user.PasswordHash, authDTO.Password)
 	if err != nil {
-		render.Render(w, r, httperror.ErrForbidden(errors.New("invalid password")))
+		render.Render(w, r, httperror.ErrInternalError(err))
 		return
 	}
 
+	IsMatch, _ := a.app.PasswordHasher().Verify(user.PasswordHash, authDTO.Password)
 	if !IsMatch {
-		render.Render(w, r, httperror.ErrForbidden(errors.New("invalid password")))
+		a.loginFailed(w, r, authDTO.Username)
 		return
 	}
+	a.rehashPassword(r.Context(), &user, authDTO.Password)
+
+	a.completeLogin(w, r, &user, authDTO.Device)
+}
 
-	Token, RefreshToken, err := a.NewJWT().GenerateTokenPair(authDTO.Username, user.ID, false)
+// completeLogin issues the tokens of a user that passed the first factor, or
+// the MFA challenge when the second factor is still missing.
+func (a *AuthHandler) completeLogin(w http.ResponseWriter, r *http.Request, user *db.User, device string) {
+	if !user.TOTPEnabledAt.IsZero() {
+		mfaToken, err := a.NewJWT().GenerateMFAToken(user.Username, user.ID)
+		if err != nil {
+			render.Render(w, r, httperror.ErrInternalError(err))
+			return
+		}
+		render.JSON(w, r, httpresponse.SingleResponse{
+			Message: "mfa_required",
+			Data: MFAChallengeResponse{
+				MFARequired: true,
+				MFAToken:    mfaToken,
+			},
+			Status: http.StatusOK,
+		})
+		return
+	}
+
+	a.issueLoginTokens(w, r, user, device)
+}
+
+// issueLoginTokens starts a new session for a user that completed the login.
+func (a *AuthHandler) issueLoginTokens(w http.ResponseWriter, r *http.Request, user *db.User, device string) {
+	pair, err := a.NewJWT().GenerateTokenPair(NewTokenSubject(user), "")
 	if err != nil {
 		render.Render(w, r, httperror.ErrInternalError(err))
 		return
 	}
 
+	if _, err := a.createSession(r, user.ID, device, pair); err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+	a.loginSucceeded(r, user.Username)
+
 	render.JSON(w, r, httpresponse.SingleResponse{
 		Message: "success",
 		Data: TokenResponse{
-			AccessToken:  Token,
-			RefreshToken: RefreshToken,
+			AccessToken:  pair.AccessToken,
+			RefreshToken: pair.RefreshToken,
 		},
 		Status: http.StatusOK,
 	})
-
 }
 
 // RefreshToken implements handlers.AuthHandlerService.
@@ -152,24 +192,58 @@ func (a *AuthHandler) RefreshToken(w http.ResponseWriter, r *http.Request) {
 		render.Render(w, r, httperror.ErrUnAuthorized(fmt.Errorf("invalid user ID in refresh token")))
 		return
 	}
+	// OAuth clients refresh at the token endpoint, which keeps the scopes
+	// the user granted them.
+	if claims.ClientID != "" {
+		render.Render(w, r, httperror.ErrUnAuthorized(errors.New("refresh token is not valid")))
+		return
+	}
+
+	// Kiểm tra Refresh Token từ database
+	var stored db.RefreshToken
+	err = a.app.DB().NewSelect().Model(&stored).Where("rt.jti = ?", claims.ID).Scan(r.Context())
+	if err != nil {
+		render.Render(w, r, httperror.ErrUnAuthorized(errors.New("refresh token is not valid")))
+		return
+	}
+
+	// A refresh token can only be used once. Seeing a rotated token again
+	// means it has leaked, so the whole family is revoked.
+	if !stored.UsedAt.IsZero() {
+		a.rejectRefreshReuse(w, r, stored.FamilyID)
+		return
+	}
 
-	// Kiểm tra Refresh Token từ database (nếu bạn lưu refresh token)
 	var sessions db.Session
-	err = a.app.DB().NewSelect().Model(&sessions).Where("refresh_token = ?", req.RefreshToken).Scan(r.Context())
+	err = a.app.DB().NewSelect().Model(&sessions).
+		Where("s.id = ?", stored.SessionID).
+		Where("s.revoked_at IS NULL").
+		Scan(r.Context())
 	if err != nil {
-		render.Render(w, r, httperror.ErrInternalError(errors.New("refresh token is not valid")))
+		render.Render(w, r, httperror.ErrUnAuthorized(errors.New("refresh token is not valid")))
+		return
+	}
+
+	// The role may have changed since the login.
+	user := new(db.User)
+	if err := a.app.DB().NewSelect().Model(user).Where("id = ?", userId).Scan(r.Context()); err != nil {
+		render.Render(w, r, httperror.ErrUnAuthorized(errors.New("refresh token is not valid")))
 		return
 	}
 
 	// Tạo Access Token mới
-	AccessToken, RefreshToken, err := a.NewJWT().GenerateTokenPair(claims.Username, userId, false)
+	pair, err := a.NewJWT().GenerateTokenPair(NewTokenSubject(user), stored.FamilyID)
 	if err != nil {
 		render.Render(w, r, httperror.ErrInternalError(err))
 		return
 	}
 
 	// Cập nhật db token mới
-	_, err = a.app.DB().NewUpdate().Model(&sessions).Where("refresh_token = ?", req.RefreshToken).Set("access_token = ?", AccessToken).Set("refresh_token = ?", RefreshToken).Exec(r.Context())
+	err = a.rotateSession(r.Context(), &stored, &sessions, pair)
+	if errors.Is(err, errRefreshTokenReused) {
+		a.rejectRefreshReuse(w, r, stored.FamilyID)
+		return
+	}
 	if err != nil {
 		render.Render(w, r, httperror.ErrInternalError(err))
 		return
@@ -177,12 +251,22 @@ func (a *AuthHandler) RefreshToken(w http.ResponseWriter, r *http.Request) {
 
 	// Trả về token mới
 	response := map[string]string{
-		"access_token":  AccessToken,
-		"refresh_token": RefreshToken,
+		"access_token":  pair.AccessToken,
+		"refresh_token": pair.RefreshToken,
 	}
 	render.JSON(w, r, response)
 }
 
+var errRefreshTokenReused = errors.New("refresh token reuse detected")
+
+func (a *AuthHandler) rejectRefreshReuse(w http.ResponseWriter, r *http.Request, familyID string) {
+	if err := a.revokeFamily(r.Context(), familyID); err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+	render.Render(w, r, httperror.ErrUnAuthorized(errRefreshTokenReused))
+}
+
 // Register implements handlers.AuthHandlerService.
 // @Summary User register
 // @Description User register todo app
@@ -201,7 +285,7 @@ func (a *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	exists, err := a.app.DB().NewSelect().Model((*db.User)(nil)).Where("username = ?", authDTO.Username).Exists(r.Context())
+	exists, err := a.app.DB().NewSelect().Model((*db.User)(nil)).WhereAllWithDeleted().Where("username = ?", authDTO.Username).Exists(r.Context())
 	if err != nil {
 		render.Render(w, r, httperror.ErrInternalError(err))
 		return
@@ -212,15 +296,33 @@ func (a *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	passwordHash, err := utils.HashPassword(authDTO.Password)
-	if err != nil {
-		render.Render(w, r, httperror.ErrInternalError(err))
+	var email string
+	if authDTO.Email != "" {
+		email, err = normalizeEmail(authDTO.Email)
+		if err != nil {
+			render.Render(w, r, httperror.ErrInvalidRequest(err))
+			return
+		}
+		exists, err = a.app.DB().NewSelect().Model((*db.User)(nil)).WhereAllWithDeleted().Where("lower(email) = ?", email).Exists(r.Context())
+		if err != nil {
+			render.Render(w, r, httperror.ErrInternalError(err))
+			return
+		}
+		if exists {
+			render.Render(w, r, httperror.ErrBadRequest(fmt.Errorf("email already in use")))
+			return
+		}
+	}
+
+	passwordHash, ok := a.hashNewPassword(w, r, authDTO.Username, authDTO.Password)
+	if !ok {
 		return
 	}
 
 	user := &db.User{
 		Username:     authDTO.Username,
 		PasswordHash: passwordHash,
+		Email:        email,
 	}
 	_, err = a.app.DB().NewInsert().Model(user).Returning("*").Exec(r.Context())
 
@@ -228,19 +330,15 @@ func (a *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 		render.Render(w, r, httperror.ErrInternalError(err))
 		return
 	}
+	a.sendVerification(r.Context(), user)
 
-	Token, RefreshToken, err := a.NewJWT().GenerateTokenPair(authDTO.Username, user.ID, false)
+	pair, err := a.NewJWT().GenerateTokenPair(NewTokenSubject(user), "")
 	if err != nil {
 		render.Render(w, r, httperror.ErrInternalError(err))
 		return
 	}
 	// save db
-	_, err = a.app.DB().NewInsert().Model(&db.Session{
-		AccessToken:  Token,
-		RefreshToken: RefreshToken,
-		UserID:       user.ID,
-	}).Exec(r.Context())
-
+	_, err = a.createSession(r, user.ID, authDTO.Device, pair)
 	if err != nil {
 		render.Render(w, r, httperror.ErrInternalError(err))
 		return
@@ -248,120 +346,14 @@ func (a *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 
 	render.JSON(w, r, httpresponse.SingleResponse{
 		Data: TokenResponse{
-			AccessToken:  Token,
-			RefreshToken: RefreshToken,
-		},
-	})
-}
-
-type JwtPayload struct {
-	Username    string `json:"username"`
-	Sub         int64  `json:"sub"`
-	Exp         int64  `json:"exp"`
-	Iat         int64  `json:"iat"`
-	IsAnonymous bool   `json:"is_anonymous"`
-	jwt.RegisteredClaims
-}
-
-type JWT struct {
-	secretKey        string
-	refreshSecretKey string
-	accessDuration   time.Duration
-	refreshDuration  time.Duration
-}
-
-func (a *AuthHandler) NewJWT() *JWT {
-	return &JWT{
-		secretKey:        a.app.Config().Jwt.Secret,
-		refreshSecretKey: a.app.Config().Jwt.Secret,
-		accessDuration:   time.Hour * 24,
-		refreshDuration:  time.Hour * 24 * 7,
-	}
-}
-
-func (j *JWT) GenerateTokenPair(username string, uid int64, isAnonymous bool) (accessToken string, refreshToken string, err error) {
-	now := time.Now()
-	// Create access token
-	accessClaims := JwtPayload{
-		Username:    username,
-		Sub:         uid,
-		Exp:         now.Add(time.Duration(j.accessDuration)).Unix(),
-		Iat:         now.Unix(),
-		IsAnonymous: isAnonymous,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Duration(j.accessDuration))),
+			AccessToken:  pair.AccessToken,
+			RefreshToken: pair.RefreshToken,
 		},
-	}
-
-	accessTokenObject := jwt.NewWithClaims(jwt.SigningMethodHS256, accessClaims)
-	accessToken, err = accessTokenObject.SignedString([]byte(j.secretKey))
-	if err != nil {
-		return "", "", fmt.Errorf("failed to sign access token: %w", err)
-	}
-
-	// Create refresh token
-	refreshClaims := JwtPayload{
-		Username:    username,
-		Sub:         uid,
-		Exp:         now.Add(time.Duration(j.refreshDuration)).Unix(),
-		Iat:         now.Unix(),
-		IsAnonymous: isAnonymous,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Duration(j.refreshDuration))),
-			ID:        uuid.NewV4().String(),
-		},
-	}
-
-	refreshTokenObject := jwt.NewWithClaims(jwt.SigningMethodHS256, refreshClaims)
-	refreshToken, err = refreshTokenObject.SignedString([]byte(j.refreshSecretKey))
-	// save to db
-	if err != nil {
-		return "", "", fmt.Errorf("failed to sign refresh token: %w", err)
-	}
-	return accessToken, refreshToken, nil
-}
-
-// VerifyAccessToken verify access token
-func (j *JWT) VerifyAccessToken(tokenString string) (*JwtPayload, error) {
-	claims := &JwtPayload{}
-
-	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("invalid signing method")
-		}
-		return []byte(j.secretKey), nil
 	})
-	if err != nil {
-		return nil, err
-	}
-
-	if !token.Valid {
-		return nil, fmt.Errorf("invalid token")
-	}
-
-	return claims, nil
 }
 
-// VerifyRefreshToken verify refresh token
-func (j *JWT) VerifyRefreshToken(tokenString string) (*JwtPayload, error) {
-	claims := &JwtPayload{}
-
-	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("invalid signing method")
-		}
-		return []byte(j.refreshSecretKey), nil
-	})
-	if err != nil {
-		return nil, err
-	}
-
-	if !token.Valid {
-		return nil, fmt.Errorf("invalid token")
-	}
-
-	return claims, nil
-}
+// sessionTouchInterval limits how often last_used_at is written.
+const sessionTouchInterval = 5 * time.Minute
 
 func (a *AuthHandler) Authorization(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -375,15 +367,79 @@ func (a *AuthHandler) Authorization(next http.Handler) http.Handler {
 
 		tokenString = strings.TrimPrefix(tokenString, "Bearer ")
 
+		if utils.IsAccessToken(tokenString) {
+			claims, pat, err := a.authenticateAccessToken(r.Context(), tokenString)
+			if errors.Is(err, errInvalidAccessToken) {
+				render.Render(w, r, httperror.ErrUnAuthorized(err))
+				return
+			}
+			if err != nil {
+				render.Render(w, r, httperror.ErrInternalError(err))
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), constants.CurrentUser, claims)
+			ctx = context.WithValue(ctx, constants.CurrentAccessToken, pat)
+			next.ServeHTTP(w, r.WithContext(ctx))
+			return
+		}
+
 		claims, err := a.NewJWT().VerifyAccessToken(tokenString)
 		if err != nil {
 			render.Render(w, r, httperror.ErrUnAuthorized(err))
 			return
 		}
+		// Tokens issued before roles existed carry no scopes.
+		if claims.Scopes == nil {
+			claims.Role = db.RoleUser
+			claims.Scopes = ScopesForRole(db.RoleUser)
+		}
+
+		// A valid signature is not enough, the session must not be revoked.
+		session, err := a.findActiveSession(r.Context(), tokenString)
+		if errors.Is(err, errSessionRevoked) {
+			render.Render(w, r, httperror.ErrUnAuthorized(err))
+			return
+		}
+		if err != nil {
+			render.Render(w, r, httperror.ErrInternalError(err))
+			return
+		}
+		if now := a.app.Clock().Now(); now.Sub(session.LastUsedAt) > sessionTouchInterval {
+			_, err = a.app.DB().NewUpdate().Model(session).Set("last_used_at = ?", now).WherePK().Exec(r.Context())
+			if err != nil {
+				render.Render(w, r, httperror.ErrInternalError(err))
+				return
+			}
+			session.LastUsedAt = now
+		}
 
 		ctx := context.WithValue(r.Context(), constants.CurrentUser, claims)
+		ctx = context.WithValue(ctx, constants.CurrentSession, session)
 		r = r.WithContext(ctx)
 
 		next.ServeHTTP(w, r)
 	})
 }
+
+// JWKS implements handlers.AuthHandlerService.
+// @Summary JSON Web Key Set
+// @Description Public keys access tokens are signed with, for offline verification
+// @Tags Auth
+// @Produce json
+// @Success 200 {object} jwks.JSONWebKeySet
+// @Router /.well-known/jwks.json [get]
+func (a *AuthHandler) JWKS(w http.ResponseWriter, r *http.Request) {
+	keys, err := a.app.KeySet()
+	if err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+
+	set := jwks.JSONWebKeySet{Keys: []jwks.JSONWebKey{}}
+	if keys != nil {
+		set = keys.JWKS()
+	}
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	render.JSON(w, r, set)
+}
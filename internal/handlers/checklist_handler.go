@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"todo-app/httputil/httperror"
+	"todo-app/httputil/httpresponse"
+	"todo-app/internal/db"
+	"todo-app/internal/dtos"
+
+	"github.com/go-chi/render"
+)
+
+// maxChecklistItems bounds the checklist of one todo, bigger steps are
+// subtasks.
+const maxChecklistItems = 100
+
+// CreateChecklistItem implements handlers.TodoHandlerService.
+// @Summary Create checklist item
+// @Description Add an item to the end of the checklist of a todo. Requires the editor role in its list
+// @Tags Todo
+// @Accept json
+// @Produce json
+// @Param id path int true "Todo ID"
+// @Param request body dtos.CreateChecklistItemDTO true "Create checklist item request body"
+// @Success 201 {object} httpresponse.SingleResponse{data=db.ChecklistItem}
+// @Failure 400 {object} httperror.ErrResponse
+// @Failure 403 {object} httperror.ErrResponse
+// @Failure 404 {object} httperror.ErrResponse
+// @Router /api/todo/{id}/checklist [post]
+func (t *TodoHandler) CreateChecklistItem(w http.ResponseWriter, r *http.Request) {
+	var req dtos.CreateChecklistItemDTO
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		render.Render(w, r, httperror.ErrInvalidRequest(err))
+		return
+	}
+	if req.Title == "" {
+		render.Render(w, r, httperror.ErrInvalidRequest(errors.New("title is required")))
+		return
+	}
+
+	todo, ok := t.findTodo(w, r, db.ListRoleEditor)
+	if !ok {
+		return
+	}
+
+	var count, position int
+	err := t.app.DB().NewSelect().Model((*db.ChecklistItem)(nil)).
+		ColumnExpr("COUNT(*), COALESCE(MAX(ci.position) + 1, 0)").
+		Where("ci.todo_id = ?", todo.ID).
+		Scan(r.Context(), &count, &position)
+	if err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+	if count >= maxChecklistItems {
+		render.Render(w, r, httperror.ErrInvalidRequest(errors.New("too many checklist items on this todo")))
+		return
+	}
+
+	item := &db.ChecklistItem{
+		TodoID:   todo.ID,
+		Title:    req.Title,
+		Done:     req.Done,
+		Position: position,
+	}
+	_, err = t.app.DB().NewInsert().Model(item).Returning("*").Exec(r.Context())
+	if err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+
+	render.Render(w, r, httpresponse.WriteResponse(w, http.StatusCreated, "success", item))
+}
+
+// UpdateChecklistItem implements handlers.TodoHandlerService.
+// @Summary Update checklist item
+// @Description Rename, check or reorder an item of the checklist of a todo. Requires the editor role in its list
+// @Tags Todo
+// @Accept json
+// @Produce json
+// @Param id path int true "Todo ID"
+// @Param itemID path int true "Checklist item ID"
+// @Param request body dtos.UpdateChecklistItemDTO true "Update checklist item request body"
+// @Success 200 {object} httpresponse.SingleResponse{data=db.ChecklistItem}
+// @Failure 400 {object} httperror.ErrResponse
+// @Failure 403 {object} httperror.ErrResponse
+// @Failure 404 {object} httperror.ErrResponse
+// @Router /api/todo/{id}/checklist/{itemID} [put]
+func (t *TodoHandler) UpdateChecklistItem(w http.ResponseWriter, r *http.Request) {
+	var req dtos.UpdateChecklistItemDTO
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		render.Render(w, r, httperror.ErrInvalidRequest(err))
+		return
+	}
+	if req.Title != nil && *req.Title == "" {
+		render.Render(w, r, httperror.ErrInvalidRequest(errors.New("title must not be empty")))
+		return
+	}
+	if req.Position != nil && *req.Position < 0 {
+		render.Render(w, r, httperror.ErrInvalidRequest(errors.New("position must not be negative")))
+		return
+	}
+
+	item, ok := t.findChecklistItem(w, r)
+	if !ok {
+		return
+	}
+	if req.Title != nil {
+		item.Title = *req.Title
+	}
+	if req.Done != nil {
+		item.Done = *req.Done
+	}
+	if req.Position != nil {
+		item.Position = *req.Position
+	}
+	item.UpdatedAt = t.app.Clock().Now()
+
+	_, err := t.app.DB().NewUpdate().Model(item).
+		Column("title", "done", "position", "updated_at").
+		WherePK().
+		Exec(r.Context())
+	if err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+
+	render.Render(w, r, httpresponse.WriteResponse(w, http.StatusOK, "success", item))
+}
+
+// DeleteChecklistItem implements handlers.TodoHandlerService.
+// @Summary Delete checklist item
+// @Description Delete an item of the checklist of a todo. Requires the editor role in its list
+// @Tags Todo
+// @Produce json
+// @Param id path int true "Todo ID"
+// @Param itemID path int true "Checklist item ID"
+// @Success 200 {object} httpresponse.SingleResponse
+// @Failure 403 {object} httperror.ErrResponse
+// @Failure 404 {object} httperror.ErrResponse
+// @Router /api/todo/{id}/checklist/{itemID} [delete]
+func (t *TodoHandler) DeleteChecklistItem(w http.ResponseWriter, r *http.Request) {
+	item, ok := t.findChecklistItem(w, r)
+	if !ok {
+		return
+	}
+
+	_, err := t.app.DB().NewDelete().Model(item).WherePK().Exec(r.Context())
+	if err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+
+	render.Render(w, r, httpresponse.WriteResponse(w, http.StatusOK, "success", nil))
+}
+
+// findChecklistItem loads the item referenced by the {itemID} URL param of
+// the todo referenced by {id}, which the current user must be able to
+// edit. It renders the error response itself and returns false when the
+// request should stop.
+func (t *TodoHandler) findChecklistItem(w http.ResponseWriter, r *http.Request) (*db.ChecklistItem, bool) {
+	todo, ok := t.findTodo(w, r, db.ListRoleEditor)
+	if !ok {
+		return nil, false
+	}
+	id, err := parseIDParam(r, "itemID")
+	if err != nil {
+		render.Render(w, r, httperror.ErrInvalidRequest(err))
+		return nil, false
+	}
+
+	item := new(db.ChecklistItem)
+	err = t.app.DB().NewSelect().Model(item).
+		Where("ci.id = ?", id).
+		Where("ci.todo_id = ?", todo.ID).
+		Scan(r.Context())
+	if errors.Is(err, sql.ErrNoRows) {
+		render.Render(w, r, httperror.ErrNotFound())
+		return nil, false
+	}
+	if err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return nil, false
+	}
+	return item, true
+}
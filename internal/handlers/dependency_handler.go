@@ -0,0 +1,367 @@
+package handlers
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"net/http"
+	"todo-app/httputil/httperror"
+	"todo-app/httputil/httpresponse"
+	"todo-app/internal/db"
+
+	"github.com/go-chi/render"
+	"github.com/uptrace/bun"
+)
+
+var (
+	errBlocked          = errors.New("the todo is blocked by open todos, complete them first or set ignore_blockers")
+	errDependencyCycle  = errors.New("the dependency would create a cycle")
+	errDependencyList   = errors.New("a todo can only be blocked by a todo of its list")
+	errDependencyOnSelf = errors.New("a todo cannot block itself")
+	errListCycle        = errors.New("the dependencies of the list contain a cycle")
+)
+
+// AddDependency implements handlers.TodoHandlerService.
+// @Summary Add dependency
+// @Description Mark a todo as blocked by another todo of its list. Requires the editor role in the list. Dependencies that would create a cycle are rejected
+// @Tags Todo
+// @Produce json
+// @Param id path int true "Todo ID"
+// @Param blockerID path int true "ID of the todo that blocks it"
+// @Success 200 {object} httpresponse.SingleResponse{data=db.Todo}
+// @Failure 400 {object} httperror.ErrResponse
+// @Failure 403 {object} httperror.ErrResponse
+// @Failure 404 {object} httperror.ErrResponse
+// @Router /api/todo/{id}/dependencies/{blockerID} [put]
+func (t *TodoHandler) AddDependency(w http.ResponseWriter, r *http.Request) {
+	todo, ok := t.findTodo(w, r, db.ListRoleEditor)
+	if !ok {
+		return
+	}
+	blockerID, err := parseIDParam(r, "blockerID")
+	if err != nil {
+		render.Render(w, r, httperror.ErrInvalidRequest(err))
+		return
+	}
+	if blockerID == todo.ID {
+		render.Render(w, r, httperror.ErrInvalidRequest(errDependencyOnSelf))
+		return
+	}
+
+	err = t.app.DB().RunInTx(r.Context(), nil, func(ctx context.Context, tx bun.Tx) error {
+		if err := lockLists(ctx, tx, todo.ListID); err != nil {
+			return err
+		}
+		// Either todo could have moved to another list in the meantime.
+		n, err := tx.NewSelect().Model((*db.Todo)(nil)).
+			Where("i.id IN (?)", bun.In([]int64{todo.ID, blockerID})).
+			Where("i.list_id = ?", todo.ListID).
+			Count(ctx)
+		if err != nil {
+			return err
+		}
+		if n != 2 {
+			return errDependencyList
+		}
+
+		cycle, err := dependsOn(ctx, tx, blockerID, todo.ID)
+		if err != nil {
+			return err
+		}
+		if cycle {
+			return errDependencyCycle
+		}
+
+		_, err = tx.NewInsert().
+			Model(&db.TodoDependency{TodoID: todo.ID, BlockerID: blockerID}).
+			On("CONFLICT (todo_id, blocker_id) DO NOTHING").
+			Returning("NULL").
+			Exec(ctx)
+		return err
+	})
+	if errors.Is(err, errDependencyList) || errors.Is(err, errDependencyCycle) {
+		render.Render(w, r, httperror.ErrInvalidRequest(err))
+		return
+	}
+	if err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+
+	if err := t.loadDependencies(r.Context(), todo); err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+
+	render.Render(w, r, httpresponse.WriteResponse(w, http.StatusOK, "success", todo))
+}
+
+// RemoveDependency implements handlers.TodoHandlerService.
+// @Summary Remove dependency
+// @Description Remove a todo from the blockers of another todo. Requires the editor role in the list
+// @Tags Todo
+// @Produce json
+// @Param id path int true "Todo ID"
+// @Param blockerID path int true "ID of the todo that blocks it"
+// @Success 200 {object} httpresponse.SingleResponse{data=db.Todo}
+// @Failure 403 {object} httperror.ErrResponse
+// @Failure 404 {object} httperror.ErrResponse
+// @Router /api/todo/{id}/dependencies/{blockerID} [delete]
+func (t *TodoHandler) RemoveDependency(w http.ResponseWriter, r *http.Request) {
+	todo, ok := t.findTodo(w, r, db.ListRoleEditor)
+	if !ok {
+		return
+	}
+	blockerID, err := parseIDParam(r, "blockerID")
+	if err != nil {
+		render.Render(w, r, httperror.ErrInvalidRequest(err))
+		return
+	}
+
+	res, err := t.app.DB().NewDelete().Model((*db.TodoDependency)(nil)).
+		Where("todo_id = ?", todo.ID).
+		Where("blocker_id = ?", blockerID).
+		Exec(r.Context())
+	if err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		render.Render(w, r, httperror.ErrNotFound())
+		return
+	}
+
+	if err := t.loadDependencies(r.Context(), todo); err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+
+	render.Render(w, r, httpresponse.WriteResponse(w, http.StatusOK, "success", todo))
+}
+
+// GetListOrder implements handlers.TodoHandlerService.
+// @Summary Get list order
+// @Description List the todos of a list in an order in which every todo comes after the todos that block it. Todos that do not depend on each other keep the order of their ids
+// @Tags List
+// @Produce json
+// @Param id path int true "List ID"
+// @Success 200 {object} httpresponse.CollectionResponse{data=[]db.Todo}
+// @Failure 403 {object} httperror.ErrResponse
+// @Failure 404 {object} httperror.ErrResponse
+// @Router /api/lists/{id}/order [get]
+func (t *TodoHandler) GetListOrder(w http.ResponseWriter, r *http.Request) {
+	list, ok := t.findList(w, r, db.ListRoleViewer)
+	if !ok {
+		return
+	}
+
+	todos := make([]*db.Todo, 0)
+	err := t.app.DB().NewSelect().Model(&todos).
+		Where("i.list_id = ?", list.ID).
+		Order("i.id").
+		Scan(r.Context())
+	if err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+	var deps []*db.TodoDependency
+	err = t.app.DB().NewSelect().Model(&deps).
+		Join("JOIN todos AS i ON i.id = td.todo_id").
+		Where("i.list_id = ?", list.ID).
+		Order("td.todo_id", "td.blocker_id").
+		Scan(r.Context())
+	if err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+
+	ordered, err := TopologicalOrder(todos, deps)
+	if err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+	SetDependencies(todos, deps)
+
+	render.Render(w, r, httpresponse.WriteCollectionResponse(w, http.StatusOK, "success", ordered, len(ordered)))
+}
+
+// TopologicalOrder orders todos so that every todo comes after the todos
+// that block it according to deps. Todos that do not depend on each other
+// keep their order. Dependencies on todos that are not in todos are
+// ignored.
+func TopologicalOrder(todos []*db.Todo, deps []*db.TodoDependency) ([]*db.Todo, error) {
+	index := make(map[int64]int, len(todos))
+	for i, todo := range todos {
+		index[todo.ID] = i
+	}
+	blocking := make([][]int, len(todos))
+	blockers := make([]int, len(todos))
+	for _, dep := range deps {
+		i, ok := index[dep.TodoID]
+		j, ok2 := index[dep.BlockerID]
+		if !ok || !ok2 {
+			continue
+		}
+		blocking[j] = append(blocking[j], i)
+		blockers[i]++
+	}
+
+	// Kahn's algorithm, taking the first of the unblocked todos each time.
+	ready := &indexHeap{}
+	for i := range todos {
+		if blockers[i] == 0 {
+			*ready = append(*ready, i)
+		}
+	}
+	heap.Init(ready)
+	ordered := make([]*db.Todo, 0, len(todos))
+	for ready.Len() > 0 {
+		i := heap.Pop(ready).(int)
+		ordered = append(ordered, todos[i])
+		for _, j := range blocking[i] {
+			if blockers[j]--; blockers[j] == 0 {
+				heap.Push(ready, j)
+			}
+		}
+	}
+	if len(ordered) != len(todos) {
+		return nil, errListCycle
+	}
+	return ordered, nil
+}
+
+// SetDependencies sets BlockedBy, Blocking and Blocked of todos from deps,
+// which hold every dependency of todos. The todos that block todos must be
+// among them.
+func SetDependencies(todos []*db.Todo, deps []*db.TodoDependency) {
+	done := make(map[int64]bool, len(todos))
+	for _, todo := range todos {
+		done[todo.ID] = todo.Status == db.DONE
+	}
+	rows := make([]dependencyRow, len(deps))
+	for i, dep := range deps {
+		rows[i] = dependencyRow{TodoID: dep.TodoID, BlockerID: dep.BlockerID, BlockerDone: done[dep.BlockerID]}
+	}
+	setDependencies(todos, rows)
+}
+
+// dependencyRow is a dependency with the status of the blocker.
+type dependencyRow struct {
+	TodoID      int64 `bun:"todo_id"`
+	BlockerID   int64 `bun:"blocker_id"`
+	BlockerDone bool  `bun:"blocker_done"`
+}
+
+func setDependencies(todos []*db.Todo, rows []dependencyRow) {
+	byID := make(map[int64]*db.Todo, len(todos))
+	for _, todo := range todos {
+		todo.BlockedBy, todo.Blocking, todo.Blocked = nil, nil, false
+		byID[todo.ID] = todo
+	}
+	for _, row := range rows {
+		if todo, ok := byID[row.TodoID]; ok {
+			todo.BlockedBy = append(todo.BlockedBy, row.BlockerID)
+			todo.Blocked = todo.Blocked || !row.BlockerDone
+		}
+		if blocker, ok := byID[row.BlockerID]; ok {
+			blocker.Blocking = append(blocker.Blocking, row.TodoID)
+		}
+	}
+}
+
+// loadDependencies loads the dependencies of todos.
+func (t *TodoHandler) loadDependencies(ctx context.Context, todos ...*db.Todo) error {
+	if len(todos) == 0 {
+		return nil
+	}
+	ids := make([]int64, len(todos))
+	for i, todo := range todos {
+		ids[i] = todo.ID
+	}
+
+	var rows []dependencyRow
+	err := t.app.DB().NewSelect().Model((*db.TodoDependency)(nil)).
+		Column("td.todo_id", "td.blocker_id").
+		ColumnExpr("b.status = ? AS blocker_done", db.DONE).
+		Join("JOIN todos AS b ON b.id = td.blocker_id").
+		WhereGroup(" AND ", func(q *bun.SelectQuery) *bun.SelectQuery {
+			return q.Where("td.todo_id IN (?)", bun.In(ids)).WhereOr("td.blocker_id IN (?)", bun.In(ids))
+		}).
+		Order("td.todo_id", "td.blocker_id").
+		Scan(ctx, &rows)
+	if err != nil {
+		return err
+	}
+	setDependencies(todos, rows)
+	return nil
+}
+
+// dependsOn reports whether todoID waits for blockerID, directly or through
+// other todos. It only walks the todos todoID waits for.
+func dependsOn(ctx context.Context, idb bun.IDB, todoID, blockerID int64) (bool, error) {
+	var found bool
+	err := idb.NewRaw(`WITH RECURSIVE blockers AS (
+			SELECT blocker_id FROM todo_dependencies WHERE todo_id = ?
+			UNION
+			SELECT td.blocker_id FROM todo_dependencies AS td JOIN blockers AS b ON td.todo_id = b.blocker_id
+		)
+		SELECT EXISTS (SELECT 1 FROM blockers WHERE blocker_id = ?)`,
+		todoID, blockerID,
+	).Scan(ctx, &found)
+	return found, err
+}
+
+// checkBlockers fails with errBlocked while a todo that blocks todo is
+// open. With subtasks, the blockers of its subtasks count too, unless they
+// are completed along.
+func checkBlockers(ctx context.Context, tx bun.Tx, todo *db.Todo, subtasks bool) error {
+	ids := []int64{todo.ID}
+	if subtasks {
+		subIDs, err := subtaskIDs(ctx, tx, todo.ID)
+		if err != nil {
+			return err
+		}
+		ids = append(ids, subIDs...)
+	}
+
+	blocked, err := tx.NewSelect().Model((*db.TodoDependency)(nil)).
+		Join("JOIN todos AS b ON b.id = td.blocker_id").
+		Where("td.todo_id IN (?)", bun.In(ids)).
+		Where("td.blocker_id NOT IN (?)", bun.In(ids)).
+		Where("b.status <> ?", db.DONE).
+		Exists(ctx)
+	if err != nil {
+		return err
+	}
+	if blocked {
+		return errBlocked
+	}
+	return nil
+}
+
+// dropCrossListDependencies deletes the dependencies between listID and
+// other lists, which todos moved into listID take along.
+func dropCrossListDependencies(ctx context.Context, tx bun.Tx, listID int64) error {
+	_, err := tx.NewRaw(`DELETE FROM todo_dependencies AS td
+		USING todos AS a, todos AS b
+		WHERE a.id = td.todo_id AND b.id = td.blocker_id
+		AND a.list_id <> b.list_id AND (a.list_id = ? OR b.list_id = ?)`,
+		listID, listID,
+	).Exec(ctx)
+	return err
+}
+
+// indexHeap is a min-heap of indexes.
+type indexHeap []int
+
+func (h indexHeap) Len() int           { return len(h) }
+func (h indexHeap) Less(i, j int) bool { return h[i] < h[j] }
+func (h indexHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *indexHeap) Push(x any)        { *h = append(*h, x.(int)) }
+
+func (h *indexHeap) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
@@ -0,0 +1,307 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
+	"todo-app/httputil/httperror"
+	"todo-app/httputil/httpresponse"
+	"todo-app/internal/db"
+	"todo-app/internal/dtos"
+	"todo-app/pkg/mailer"
+
+	"github.com/go-chi/render"
+	log "github.com/sirupsen/logrus"
+	"github.com/uptrace/bun"
+)
+
+const (
+	resetPasswordTokenDuration = time.Hour
+	verifyEmailTokenDuration   = 48 * time.Hour
+)
+
+var errInvalidEmailToken = errors.New("invalid or expired token")
+
+// normalizeEmail validates an email address and returns it in lower case.
+func normalizeEmail(email string) (string, error) {
+	addr, err := mail.ParseAddress(strings.TrimSpace(email))
+	if err != nil || addr.Name != "" {
+		return "", errors.New("invalid email")
+	}
+	return strings.ToLower(addr.Address), nil
+}
+
+// ForgotPassword implements handlers.AuthHandlerService.
+// @Summary Forgot password
+// @Description Send a password reset link. The response is the same whether the email is known or not
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Param request body dtos.ForgotPasswordDTO true "Email of the account"
+// @Success 200 {object} httpresponse.SingleResponse
+// @Failure 400 {object} httperror.ErrResponse
+// @Router /api/auth/forgot-password [post]
+func (a *AuthHandler) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var req dtos.ForgotPasswordDTO
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		render.Render(w, r, httperror.ErrInvalidRequest(err))
+		return
+	}
+
+	email, err := normalizeEmail(req.Email)
+	if err != nil {
+		render.Render(w, r, httperror.ErrInvalidRequest(err))
+		return
+	}
+
+	user := new(db.User)
+	err = a.app.DB().NewSelect().Model(user).Where("lower(email) = ?", email).Scan(r.Context())
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+
+	if err == nil {
+		if err := a.sendEmailToken(r.Context(), user, db.UserTokenResetPassword); err != nil {
+			render.Render(w, r, httperror.ErrInternalError(err))
+			return
+		}
+	}
+
+	render.Render(w, r, httpresponse.WriteResponse(w, http.StatusOK, "if the email belongs to an account, a reset link has been sent", nil))
+}
+
+// ResetPassword implements handlers.AuthHandlerService.
+// @Summary Reset password
+// @Description Set a new password with a reset token. All sessions of the user are revoked
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Param request body dtos.ResetPasswordDTO true "Reset token and new password"
+// @Success 200 {object} httpresponse.SingleResponse
+// @Failure 400 {object} httperror.ErrResponse
+// @Router /api/auth/reset-password [post]
+func (a *AuthHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var req dtos.ResetPasswordDTO
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		render.Render(w, r, httperror.ErrInvalidRequest(err))
+		return
+	}
+	if req.Password == "" {
+		render.Render(w, r, httperror.ErrInvalidRequest(errors.New("password is required")))
+		return
+	}
+
+	// The policy needs the username, the token is only consumed below.
+	claims, err := a.NewJWT().VerifyEmailToken(req.Token, db.UserTokenResetPassword)
+	if err != nil {
+		render.Render(w, r, httperror.ErrBadRequest(errInvalidEmailToken))
+		return
+	}
+	user := new(db.User)
+	if err := a.app.DB().NewSelect().Model(user).Where("id = ?", claims.Sub).Scan(r.Context()); err != nil {
+		render.Render(w, r, httperror.ErrBadRequest(errInvalidEmailToken))
+		return
+	}
+
+	passwordHash, ok := a.hashNewPassword(w, r, user.Username, req.Password)
+	if !ok {
+		return
+	}
+
+	userID := user.ID
+	err = a.app.DB().RunInTx(r.Context(), nil, func(ctx context.Context, tx bun.Tx) error {
+		if _, err := a.consumeEmailToken(ctx, tx, req.Token, db.UserTokenResetPassword); err != nil {
+			return err
+		}
+
+		_, err := tx.NewUpdate().Model((*db.User)(nil)).
+			Set("password = ?", passwordHash).
+			Set("updated_at = ?", a.app.Clock().Now()).
+			Where("id = ?", userID).
+			Exec(ctx)
+		return err
+	})
+	if errors.Is(err, errInvalidEmailToken) {
+		render.Render(w, r, httperror.ErrBadRequest(err))
+		return
+	}
+	if err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+
+	// Whoever knew the old password must not stay logged in.
+	if _, err := a.revokeSessions(r.Context(), userID); err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+
+	render.Render(w, r, httpresponse.WriteResponse(w, http.StatusOK, "success", nil))
+}
+
+// VerifyEmail implements handlers.AuthHandlerService.
+// @Summary Verify email
+// @Description Confirm the email address of an account with the token sent to it
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Param request body dtos.VerifyEmailDTO true "Verification token"
+// @Success 200 {object} httpresponse.SingleResponse
+// @Failure 400 {object} httperror.ErrResponse
+// @Router /api/auth/verify-email [post]
+func (a *AuthHandler) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	var req dtos.VerifyEmailDTO
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		render.Render(w, r, httperror.ErrInvalidRequest(err))
+		return
+	}
+
+	err := a.app.DB().RunInTx(r.Context(), nil, func(ctx context.Context, tx bun.Tx) error {
+		claims, err := a.consumeEmailToken(ctx, tx, req.Token, db.UserTokenVerifyEmail)
+		if err != nil {
+			return err
+		}
+
+		// The token is bound to the address it was sent to.
+		res, err := tx.NewUpdate().Model((*db.User)(nil)).
+			Set("email_verified_at = ?", a.app.Clock().Now()).
+			Where("id = ?", claims.Sub).
+			Where("lower(email) = ?", claims.Email).
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return errInvalidEmailToken
+		}
+		return nil
+	})
+	if errors.Is(err, errInvalidEmailToken) {
+		render.Render(w, r, httperror.ErrBadRequest(err))
+		return
+	}
+	if err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+
+	render.Render(w, r, httpresponse.WriteResponse(w, http.StatusOK, "success", nil))
+}
+
+// ResendVerification implements handlers.AuthHandlerService.
+// @Summary Resend verification email
+// @Description Send a new verification link to the email of the current user
+// @Tags Auth
+// @Produce json
+// @Success 200 {object} httpresponse.SingleResponse
+// @Failure 400 {object} httperror.ErrResponse
+// @Router /api/auth/verify-email/resend [post]
+func (a *AuthHandler) ResendVerification(w http.ResponseWriter, r *http.Request) {
+	user, ok := a.findCurrentUser(w, r)
+	if !ok {
+		return
+	}
+	if user.Email == "" {
+		render.Render(w, r, httperror.ErrBadRequest(errors.New("account has no email")))
+		return
+	}
+	if !user.EmailVerifiedAt.IsZero() {
+		render.Render(w, r, httperror.ErrBadRequest(errors.New("email is already verified")))
+		return
+	}
+
+	if err := a.sendEmailToken(r.Context(), user, db.UserTokenVerifyEmail); err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+
+	render.Render(w, r, httpresponse.WriteResponse(w, http.StatusOK, "success", nil))
+}
+
+// sendEmailToken issues a single-use token of the given purpose and mails
+// the link to the user. Older unused tokens of the same purpose stop working.
+func (a *AuthHandler) sendEmailToken(ctx context.Context, user *db.User, purpose string) error {
+	duration, subject, path, body := resetPasswordTokenDuration, "Reset your password", "/reset-password",
+		"Someone asked to reset the password of your account %s.\nOpen the link below within an hour to choose a new one:\n\n%s\n\nIf it wasn't you, you can ignore this email."
+	if purpose == db.UserTokenVerifyEmail {
+		duration, subject, path, body = verifyEmailTokenDuration, "Verify your email", "/verify-email",
+			"Please confirm that this email belongs to your account %s:\n\n%s\n"
+	}
+
+	token, claims, err := a.NewJWT().GenerateEmailToken(purpose, user.ID, strings.ToLower(user.Email), duration)
+	if err != nil {
+		return err
+	}
+
+	err = a.app.DB().RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		now := a.app.Clock().Now()
+		_, err := tx.NewUpdate().Model((*db.UserToken)(nil)).
+			Set("used_at = ?", now).
+			Where("user_id = ?", user.ID).
+			Where("purpose = ?", purpose).
+			Where("used_at IS NULL").
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+		_, err = tx.NewInsert().Model(&db.UserToken{
+			JTI:       claims.ID,
+			UserID:    user.ID,
+			Purpose:   purpose,
+			ExpiresAt: time.Unix(claims.Exp, 0),
+		}).Exec(ctx)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	link := strings.TrimRight(a.app.Config().BaseURL, "/") + path + "?token=" + url.QueryEscape(token)
+	return a.app.Mailer().Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: subject,
+		Body:    fmt.Sprintf(body, user.Username, link),
+	})
+}
+
+// consumeEmailToken verifies a token sent by email and marks it as used.
+func (a *AuthHandler) consumeEmailToken(ctx context.Context, tx bun.Tx, token, purpose string) (*JwtPayload, error) {
+	claims, err := a.NewJWT().VerifyEmailToken(token, purpose)
+	if err != nil {
+		return nil, errInvalidEmailToken
+	}
+
+	res, err := tx.NewUpdate().Model((*db.UserToken)(nil)).
+		Set("used_at = ?", a.app.Clock().Now()).
+		Where("jti = ?", claims.ID).
+		Where("user_id = ?", claims.Sub).
+		Where("purpose = ?", purpose).
+		Where("used_at IS NULL").
+		Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, errInvalidEmailToken
+	}
+	return claims, nil
+}
+
+// sendVerification mails the verification link after the email of a user
+// has been set. Failing to send it must not fail the request.
+func (a *AuthHandler) sendVerification(ctx context.Context, user *db.User) {
+	if user.Email == "" {
+		return
+	}
+	if err := a.sendEmailToken(ctx, user, db.UserTokenVerifyEmail); err != nil {
+		log.WithError(err).WithField("user_id", user.ID).Error("failed to send verification email")
+	}
+}
@@ -0,0 +1,216 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+	"todo-app/httputil/httperror"
+	"todo-app/httputil/httpresponse"
+	"todo-app/internal/db"
+	"todo-app/pkg/storage"
+
+	"github.com/go-chi/render"
+	log "github.com/sirupsen/logrus"
+	"github.com/uptrace/bun"
+)
+
+// DataExportResponse adds the download link to ready exports.
+type DataExportResponse struct {
+	*db.DataExport
+	// DownloadURL is relative to the API and needs no authorization, it is
+	// valid until LinkExpiresAt.
+	DownloadURL   string    `json:"download_url,omitempty"`
+	LinkExpiresAt time.Time `json:"link_expires_at"`
+}
+
+// RequestExport implements handlers.AuthHandlerService.
+// @Summary Request data export
+// @Description Start building a ZIP archive of everything stored about the current user: profile, lists, todos, tags, memberships, sessions, tokens and account events as JSON and CSV. Poll the export until its status is ready. While an export is in progress it is returned instead of starting another one
+// @Tags Account
+// @Produce json
+// @Success 202 {object} httpresponse.SingleResponse{data=DataExportResponse}
+// @Failure 401 {object} httperror.ErrResponse
+// @Router /api/me/export [post]
+func (a *AuthHandler) RequestExport(w http.ResponseWriter, r *http.Request) {
+	claims, ok := currentUser(r)
+	if !ok {
+		render.Render(w, r, httperror.ErrUnAuthorized(errors.New("unauthorized")))
+		return
+	}
+
+	export, err := a.activeExport(r, claims.Sub)
+	if errors.Is(err, sql.ErrNoRows) {
+		export = &db.DataExport{
+			UserID:    claims.Sub,
+			Status:    db.ExportPending,
+			CreatedAt: a.app.Clock().Now(),
+		}
+		_, err = a.app.DB().NewInsert().Model(export).Returning("*").Exec(r.Context())
+		if isUniqueViolation(err) {
+			// Another request started one meanwhile.
+			export, err = a.activeExport(r, claims.Sub)
+		}
+	}
+	if err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+
+	render.Render(w, r, httpresponse.WriteResponse(w, http.StatusAccepted, "success", DataExportResponse{DataExport: export}))
+}
+
+// activeExport returns the export of the user that is still being built.
+func (a *AuthHandler) activeExport(r *http.Request, userID int64) (*db.DataExport, error) {
+	export := new(db.DataExport)
+	err := a.app.DB().NewSelect().Model(export).
+		Where("de.user_id = ?", userID).
+		Where("de.status IN (?)", bun.In([]string{db.ExportPending, db.ExportRunning})).
+		Scan(r.Context())
+	return export, err
+}
+
+// GetExports implements handlers.AuthHandlerService.
+// @Summary List data exports
+// @Description List the data exports of the current user, newest first
+// @Tags Account
+// @Produce json
+// @Success 200 {object} httpresponse.CollectionResponse{data=[]db.DataExport}
+// @Failure 401 {object} httperror.ErrResponse
+// @Router /api/me/export [get]
+func (a *AuthHandler) GetExports(w http.ResponseWriter, r *http.Request) {
+	claims, ok := currentUser(r)
+	if !ok {
+		render.Render(w, r, httperror.ErrUnAuthorized(errors.New("unauthorized")))
+		return
+	}
+
+	exports := make([]*db.DataExport, 0)
+	total, err := a.app.DB().NewSelect().Model(&exports).
+		Where("de.user_id = ?", claims.Sub).
+		Order("de.created_at DESC").
+		ScanAndCount(r.Context())
+	if err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+
+	render.Render(w, r, httpresponse.WriteCollectionResponse(w, http.StatusOK, "success", exports, total))
+}
+
+// GetExport implements handlers.AuthHandlerService.
+// @Summary Get data export
+// @Description Get the status of a data export. Ready exports come with a short-lived download link, request the export again for a fresh one
+// @Tags Account
+// @Produce json
+// @Param id path int true "Export ID"
+// @Success 200 {object} httpresponse.SingleResponse{data=DataExportResponse}
+// @Failure 401 {object} httperror.ErrResponse
+// @Failure 404 {object} httperror.ErrResponse
+// @Router /api/me/export/{id} [get]
+func (a *AuthHandler) GetExport(w http.ResponseWriter, r *http.Request) {
+	claims, ok := currentUser(r)
+	if !ok {
+		render.Render(w, r, httperror.ErrUnAuthorized(errors.New("unauthorized")))
+		return
+	}
+	id, err := parseIDParam(r, "id")
+	if err != nil {
+		render.Render(w, r, httperror.ErrInvalidRequest(err))
+		return
+	}
+
+	export := new(db.DataExport)
+	err = a.app.DB().NewSelect().Model(export).
+		Where("de.id = ?", id).
+		Where("de.user_id = ?", claims.Sub).
+		Scan(r.Context())
+	if errors.Is(err, sql.ErrNoRows) {
+		render.Render(w, r, httperror.ErrNotFound())
+		return
+	}
+	if err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+
+	resp := DataExportResponse{DataExport: export}
+	now := a.app.Clock().Now()
+	if export.Status == db.ExportReady && now.Before(export.ExpiresAt) {
+		// The link never outlives the export.
+		ttl := min(a.app.ExportLinkTTL(), export.ExpiresAt.Sub(now))
+		token, expiresAt, err := a.NewJWT().GenerateExportToken(claims.Sub, export.ID, ttl)
+		if err != nil {
+			render.Render(w, r, httperror.ErrInternalError(err))
+			return
+		}
+		resp.DownloadURL = fmt.Sprintf("/api/exports/%d/download?token=%s", export.ID, url.QueryEscape(token))
+		resp.LinkExpiresAt = expiresAt
+	}
+
+	render.Render(w, r, httpresponse.WriteResponse(w, http.StatusOK, "success", resp))
+}
+
+// DownloadExport implements handlers.AuthHandlerService.
+// @Summary Download data export
+// @Description Download the ZIP archive of a data export. The token of the download link authorizes the request
+// @Tags Account
+// @Produce application/zip
+// @Param id path int true "Export ID"
+// @Param token query string true "Download token"
+// @Success 200 {file} file
+// @Failure 401 {object} httperror.ErrResponse
+// @Failure 404 {object} httperror.ErrResponse
+// @Router /api/exports/{id}/download [get]
+func (a *AuthHandler) DownloadExport(w http.ResponseWriter, r *http.Request) {
+	id, err := parseIDParam(r, "id")
+	if err != nil {
+		render.Render(w, r, httperror.ErrInvalidRequest(err))
+		return
+	}
+	claims, err := a.NewJWT().VerifyExportToken(r.URL.Query().Get("token"))
+	if err != nil || claims.ExportID != id {
+		render.Render(w, r, httperror.ErrUnAuthorized(errors.New("invalid or expired download link")))
+		return
+	}
+
+	export := new(db.DataExport)
+	err = a.app.DB().NewSelect().Model(export).
+		Where("de.id = ?", id).
+		Where("de.user_id = ?", claims.Sub).
+		Where("de.status = ?", db.ExportReady).
+		Where("de.expires_at > ?", a.app.Clock().Now()).
+		Scan(r.Context())
+	if errors.Is(err, sql.ErrNoRows) {
+		render.Render(w, r, httperror.ErrNotFound())
+		return
+	}
+	if err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+
+	f, err := a.app.ObjectStorage().Get(r.Context(), export.StorageKey)
+	if errors.Is(err, storage.ErrNotFound) {
+		render.Render(w, r, httperror.ErrNotFound())
+		return
+	}
+	if err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+	defer f.Close()
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="todo-export-%d.zip"`, export.ID))
+	w.Header().Set("Content-Length", strconv.FormatInt(export.Size, 10))
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	if _, err := io.Copy(w, f); err != nil {
+		log.WithError(err).WithField("export_id", export.ID).Error("failed to send data export")
+	}
+}
@@ -0,0 +1,197 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"todo-app/httputil/httperror"
+	"todo-app/httputil/httpresponse"
+	"todo-app/internal/db"
+	"todo-app/internal/dtos"
+
+	"github.com/go-chi/render"
+)
+
+// Guest accounts only get a small quota of each resource until they upgrade.
+const (
+	guestMaxLists = 3
+	guestMaxTodos = 100
+	guestMaxTags  = 10
+)
+
+// Guest implements handlers.AuthHandlerService.
+// @Summary Guest login
+// @Description Create a throwaway guest account and issue anonymous tokens. Each client address can only create a few guest accounts per hour, and guest accounts that are not used for account.guestttl are purged
+// @Tags Auth
+// @Produce json
+// @Success 201 {object} httpresponse.SingleResponse{data=TokenResponse}
+// @Failure 429 {object} httperror.ErrResponse
+// @Failure 500 {object} httperror.ErrResponse
+// @Router /api/auth/guest [post]
+func (a *AuthHandler) Guest(w http.ResponseWriter, r *http.Request) {
+	if !a.checkGuestAllowed(w, r) {
+		return
+	}
+
+	suffix, err := randomHex(8)
+	if err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+	// Nobody knows this password, guests can only come back with their
+	// refresh token.
+	password, err := randomHex(32)
+	if err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+	passwordHash, err := a.app.PasswordHasher().Hash(password)
+	if err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+
+	user := &db.User{
+		Username:     "guest_" + suffix,
+		PasswordHash: passwordHash,
+		IsAnonymous:  true,
+	}
+	if _, err := a.app.DB().NewInsert().Model(user).Returning("*").Exec(r.Context()); err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+	a.recordGuestCreated(r)
+
+	pair, err := a.NewJWT().GenerateTokenPair(NewTokenSubject(user), "")
+	if err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+	if _, err := a.createSession(r, user.ID, "", pair); err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+
+	render.Render(w, r, httpresponse.WriteResponse(w, http.StatusCreated, "success", TokenResponse{
+		AccessToken:  pair.AccessToken,
+		RefreshToken: pair.RefreshToken,
+	}))
+}
+
+// Upgrade implements handlers.AuthHandlerService.
+// @Summary Upgrade guest account
+// @Description Turn the current guest account into a registered account, keeping all of its lists and todos
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Param request body dtos.AuthDTO true "Username and password of the registered account"
+// @Success 200 {object} httpresponse.SingleResponse{data=TokenResponse}
+// @Failure 400 {object} httperror.ErrResponse
+// @Router /api/auth/upgrade [post]
+func (a *AuthHandler) Upgrade(w http.ResponseWriter, r *http.Request) {
+	claims, ok := currentUser(r)
+	if !ok {
+		render.Render(w, r, httperror.ErrUnAuthorized(errors.New("unauthorized")))
+		return
+	}
+	if !claims.IsAnonymous {
+		render.Render(w, r, httperror.ErrBadRequest(errors.New("account is already registered")))
+		return
+	}
+
+	var authDTO dtos.AuthDTO
+	if err := json.NewDecoder(r.Body).Decode(&authDTO); err != nil {
+		render.Render(w, r, httperror.ErrInvalidRequest(err))
+		return
+	}
+	if authDTO.Username == "" || authDTO.Password == "" {
+		render.Render(w, r, httperror.ErrInvalidRequest(errors.New("username and password are required")))
+		return
+	}
+
+	exists, err := a.app.DB().NewSelect().Model((*db.User)(nil)).WhereAllWithDeleted().Where("username = ?", authDTO.Username).Exists(r.Context())
+	if err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+	if exists {
+		render.Render(w, r, httperror.ErrBadRequest(fmt.Errorf("user already exists")))
+		return
+	}
+
+	passwordHash, ok := a.hashNewPassword(w, r, authDTO.Username, authDTO.Password)
+	if !ok {
+		return
+	}
+
+	// The user keeps its id, so everything the guest created stays with it.
+	user := new(db.User)
+	res, err := a.app.DB().NewUpdate().Model(user).
+		Set("username = ?", authDTO.Username).
+		Set("password = ?", passwordHash).
+		Set("is_anonymous = ?", false).
+		Set("updated_at = ?", a.app.Clock().Now()).
+		Where("id = ?", claims.Sub).
+		Where("is_anonymous").
+		Returning("*").
+		Exec(r.Context())
+	if err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		render.Render(w, r, httperror.ErrBadRequest(errors.New("account is already registered")))
+		return
+	}
+
+	// The anonymous tokens must not outlive the upgrade.
+	if _, err := a.revokeSessions(r.Context(), claims.Sub); err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+
+	pair, err := a.NewJWT().GenerateTokenPair(NewTokenSubject(user), "")
+	if err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+	if _, err := a.createSession(r, claims.Sub, authDTO.Device, pair); err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+
+	render.Render(w, r, httpresponse.WriteResponse(w, http.StatusOK, "success", TokenResponse{
+		AccessToken:  pair.AccessToken,
+		RefreshToken: pair.RefreshToken,
+	}))
+}
+
+// checkGuestQuota rejects the creation of a resource once a guest account has
+// reached its limit. model is a nil pointer to the model to count.
+func (t *TodoHandler) checkGuestQuota(w http.ResponseWriter, r *http.Request, claims *JwtPayload, model interface{}, limit int, resource string) bool {
+	if !claims.IsAnonymous {
+		return true
+	}
+
+	count, err := t.app.DB().NewSelect().Model(model).Where("user_id = ?", claims.Sub).Count(r.Context())
+	if err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return false
+	}
+	if count >= limit {
+		render.Render(w, r, httperror.ErrForbidden(fmt.Errorf("guest accounts can have at most %d %s, register to create more", limit, resource)))
+		return false
+	}
+	return true
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
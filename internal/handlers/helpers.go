@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"todo-app/internal/constants"
+	"todo-app/internal/db"
+
+	"github.com/go-chi/chi"
+	"github.com/uptrace/bun/driver/pgdriver"
+)
+
+// currentUser returns the claims stored in the request context by the
+// Authorization middleware.
+func currentUser(r *http.Request) (*JwtPayload, bool) {
+	claims, ok := r.Context().Value(constants.CurrentUser).(*JwtPayload)
+	return claims, ok
+}
+
+// currentSession returns the session the request was authenticated with.
+func currentSession(r *http.Request) (*db.Session, bool) {
+	session, ok := r.Context().Value(constants.CurrentSession).(*db.Session)
+	return session, ok
+}
+
+// currentAccessToken returns the personal access token the request was
+// authenticated with.
+func currentAccessToken(r *http.Request) (*db.PersonalAccessToken, bool) {
+	token, ok := r.Context().Value(constants.CurrentAccessToken).(*db.PersonalAccessToken)
+	return token, ok
+}
+
+// currentWorkspace returns the active workspace stored in the request
+// context by the Workspace middleware.
+func currentWorkspace(r *http.Request) (*db.Workspace, bool) {
+	workspace, ok := r.Context().Value(constants.CurrentWorkspace).(*db.Workspace)
+	return workspace, ok
+}
+
+// currentWorkspaceID returns the id of the active workspace, or 0 without
+// the Workspace middleware so that scoped queries match nothing.
+func currentWorkspaceID(r *http.Request) int64 {
+	if workspace, ok := currentWorkspace(r); ok {
+		return workspace.ID
+	}
+	return 0
+}
+
+func parseIDParam(r *http.Request, name string) (int64, error) {
+	id, err := strconv.ParseInt(chi.URLParam(r, name), 10, 64)
+	if err != nil || id <= 0 {
+		return 0, errors.New("invalid " + name)
+	}
+	return id, nil
+}
+
+// isUniqueViolation reports whether err is a postgres unique_violation.
+func isUniqueViolation(err error) bool {
+	var pgErr pgdriver.Error
+	return errors.As(err, &pgErr) && pgErr.Field('C') == "23505"
+}
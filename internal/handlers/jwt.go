@@ -0,0 +1,366 @@
+package handlers
+
+import (
+	"fmt"
+	"slices"
+	"time"
+	"todo-app/internal/constants"
+	"todo-app/internal/db"
+	"todo-app/pkg/jwks"
+
+	"github.com/benbjohnson/clock"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/twinj/uuid"
+)
+
+const (
+	TokenTypeAccess  = "access"
+	TokenTypeRefresh = "refresh"
+	// TokenTypeMFA is the short-lived challenge token returned by Login when
+	// the second factor is still missing.
+	TokenTypeMFA = "mfa"
+	// Single-use tokens sent by email, their type is the db.UserToken purpose.
+	TokenTypeResetPassword = db.UserTokenResetPassword
+	TokenTypeVerifyEmail   = db.UserTokenVerifyEmail
+	// TokenTypePersonal marks the claims of a request authenticated with a
+	// personal access token. These claims are never signed.
+	TokenTypePersonal = "pat"
+	// TokenTypeExport authorizes the download of a data export.
+	TokenTypeExport = "export"
+)
+
+const mfaTokenDuration = 5 * time.Minute
+
+type JwtPayload struct {
+	Username    string `json:"username"`
+	Sub         int64  `json:"sub"`
+	Exp         int64  `json:"exp"`
+	Iat         int64  `json:"iat"`
+	IsAnonymous bool   `json:"is_anonymous"`
+	Type        string `json:"typ"`
+	FamilyID    string `json:"fid,omitempty"`
+	Email       string `json:"email,omitempty"`
+	// Role and Scopes are only set on access tokens.
+	Role   string   `json:"role,omitempty"`
+	Scopes []string `json:"scopes,omitempty"`
+	// WorkspaceID restricts the token to one workspace.
+	WorkspaceID int64 `json:"wid,omitempty"`
+	// ClientID is the OAuth client the token was issued to (RFC 9068).
+	ClientID string `json:"client_id,omitempty"`
+	// ExportID is the data export a download token is for.
+	ExportID int64 `json:"eid,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// Exp and Iat shadow the fields of jwt.RegisteredClaims in JSON, so the
+// validator has to read them from the payload itself.
+func (p JwtPayload) GetExpirationTime() (*jwt.NumericDate, error) {
+	return jwt.NewNumericDate(time.Unix(p.Exp, 0)), nil
+}
+
+func (p JwtPayload) GetIssuedAt() (*jwt.NumericDate, error) {
+	return jwt.NewNumericDate(time.Unix(p.Iat, 0)), nil
+}
+
+// HasScope reports whether the token grants scope. todos:write includes
+// todos:read.
+func (p JwtPayload) HasScope(scope string) bool {
+	if slices.Contains(p.Scopes, scope) {
+		return true
+	}
+	return scope == constants.ScopeTodosRead && slices.Contains(p.Scopes, constants.ScopeTodosWrite)
+}
+
+// HasRole reports whether the token was issued to a user with role.
+// Admins have every role.
+func (p JwtPayload) HasRole(role string) bool {
+	return p.Role == role || p.Role == db.RoleAdmin
+}
+
+// TokenSubject is who a token pair is issued to.
+type TokenSubject struct {
+	Username    string
+	UserID      int64
+	IsAnonymous bool
+	Role        string
+	Scopes      []string
+	// WorkspaceID is optional, see JwtPayload.WorkspaceID.
+	WorkspaceID int64
+	// ClientID is set for tokens issued by the OAuth token endpoint.
+	ClientID string
+}
+
+// NewTokenSubject returns the subject for a user login, with every scope
+// the role of the user allows.
+func NewTokenSubject(user *db.User) TokenSubject {
+	role := user.Role
+	if role == "" {
+		role = db.RoleUser
+	}
+	return TokenSubject{
+		Username:    user.Username,
+		UserID:      user.ID,
+		IsAnonymous: user.IsAnonymous,
+		Role:        role,
+		Scopes:      ScopesForRole(role),
+	}
+}
+
+// ScopesForRole returns the scopes a login of role is granted.
+func ScopesForRole(role string) []string {
+	if role == db.RoleAdmin {
+		return []string{constants.ScopeTodosRead, constants.ScopeTodosWrite, constants.ScopeAdmin}
+	}
+	return []string{constants.ScopeTodosRead, constants.ScopeTodosWrite}
+}
+
+// TokenPair is the result of GenerateTokenPair.
+type TokenPair struct {
+	AccessToken  string
+	RefreshToken string
+	// RefreshID is the jti of the refresh token.
+	RefreshID string
+	// FamilyID groups every refresh token rotated from the same login.
+	FamilyID         string
+	RefreshExpiresAt time.Time
+}
+
+type JWT struct {
+	secretKey        string
+	refreshSecretKey string
+	accessDuration   time.Duration
+	refreshDuration  time.Duration
+	clock            clock.Clock
+
+	// keys signs access tokens asymmetrically when configured, refresh
+	// tokens are only read by us and stay HS256.
+	keys    *jwks.KeySet
+	keysErr error
+}
+
+func (a *AuthHandler) NewJWT() *JWT {
+	keys, keysErr := a.app.KeySet()
+	return &JWT{
+		secretKey:        a.app.Config().Jwt.Secret,
+		refreshSecretKey: a.app.Config().Jwt.RefreshSecret,
+		accessDuration:   time.Hour * 24,
+		refreshDuration:  time.Hour * 24 * 7,
+		clock:            a.app.Clock(),
+		keys:             keys,
+		keysErr:          keysErr,
+	}
+}
+
+// GenerateTokenPair issues an access and a refresh token. An empty familyID
+// starts a new refresh token family, rotated tokens keep the family of the
+// token they replace.
+func (j *JWT) GenerateTokenPair(sub TokenSubject, familyID string) (*TokenPair, error) {
+	now := j.clock.Now()
+	refreshID := uuid.NewV4().String()
+	if familyID == "" {
+		familyID = refreshID
+	}
+
+	// Create access token
+	accessClaims := JwtPayload{
+		Username:    sub.Username,
+		Sub:         sub.UserID,
+		Exp:         now.Add(j.accessDuration).Unix(),
+		Iat:         now.Unix(),
+		IsAnonymous: sub.IsAnonymous,
+		Type:        TokenTypeAccess,
+		Role:        sub.Role,
+		Scopes:      sub.Scopes,
+		WorkspaceID: sub.WorkspaceID,
+		ClientID:    sub.ClientID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID: uuid.NewV4().String(),
+		},
+	}
+
+	accessToken, err := j.signAccessToken(accessClaims)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign access token: %w", err)
+	}
+
+	// Create refresh token
+	refreshExpiresAt := now.Add(j.refreshDuration)
+	refreshClaims := JwtPayload{
+		Username:    sub.Username,
+		Sub:         sub.UserID,
+		Exp:         refreshExpiresAt.Unix(),
+		Iat:         now.Unix(),
+		IsAnonymous: sub.IsAnonymous,
+		Type:        TokenTypeRefresh,
+		FamilyID:    familyID,
+		ClientID:    sub.ClientID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID: refreshID,
+		},
+	}
+
+	refreshTokenObject := jwt.NewWithClaims(jwt.SigningMethodHS256, refreshClaims)
+	refreshToken, err := refreshTokenObject.SignedString([]byte(j.refreshSecretKey))
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign refresh token: %w", err)
+	}
+
+	return &TokenPair{
+		AccessToken:      accessToken,
+		RefreshToken:     refreshToken,
+		RefreshID:        refreshID,
+		FamilyID:         familyID,
+		RefreshExpiresAt: refreshExpiresAt,
+	}, nil
+}
+
+// AccessTokenDuration is how long the access tokens of GenerateTokenPair
+// are valid.
+func (j *JWT) AccessTokenDuration() time.Duration {
+	return j.accessDuration
+}
+
+// GenerateMFAToken issues the challenge token that proves the password step
+// of the login succeeded.
+func (j *JWT) GenerateMFAToken(username string, uid int64) (string, error) {
+	now := j.clock.Now()
+	claims := JwtPayload{
+		Username: username,
+		Sub:      uid,
+		Exp:      now.Add(mfaTokenDuration).Unix(),
+		Iat:      now.Unix(),
+		Type:     TokenTypeMFA,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID: uuid.NewV4().String(),
+		},
+	}
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(j.refreshSecretKey))
+	if err != nil {
+		return "", fmt.Errorf("failed to sign mfa token: %w", err)
+	}
+	return token, nil
+}
+
+// VerifyMFAToken verify mfa challenge token
+func (j *JWT) VerifyMFAToken(tokenString string) (*JwtPayload, error) {
+	return j.verify(tokenString, TokenTypeMFA, func(token *jwt.Token) (interface{}, error) {
+		return hmacKey(token, j.refreshSecretKey)
+	})
+}
+
+// GenerateEmailToken issues a signed password reset or email verification
+// token. The caller records the returned claims to make the token single-use.
+func (j *JWT) GenerateEmailToken(tokenType string, uid int64, email string, duration time.Duration) (string, *JwtPayload, error) {
+	now := j.clock.Now()
+	claims := JwtPayload{
+		Sub:   uid,
+		Exp:   now.Add(duration).Unix(),
+		Iat:   now.Unix(),
+		Type:  tokenType,
+		Email: email,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID: uuid.NewV4().String(),
+		},
+	}
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(j.refreshSecretKey))
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to sign %s token: %w", tokenType, err)
+	}
+	return token, &claims, nil
+}
+
+// VerifyEmailToken verify password reset or email verification token
+func (j *JWT) VerifyEmailToken(tokenString, tokenType string) (*JwtPayload, error) {
+	return j.verify(tokenString, tokenType, func(token *jwt.Token) (interface{}, error) {
+		return hmacKey(token, j.refreshSecretKey)
+	})
+}
+
+// GenerateExportToken issues the token of a data export download link.
+func (j *JWT) GenerateExportToken(uid, exportID int64, duration time.Duration) (string, time.Time, error) {
+	now := j.clock.Now()
+	expiresAt := now.Add(duration)
+	claims := JwtPayload{
+		Sub:      uid,
+		Exp:      expiresAt.Unix(),
+		Iat:      now.Unix(),
+		Type:     TokenTypeExport,
+		ExportID: exportID,
+	}
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(j.refreshSecretKey))
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to sign export token: %w", err)
+	}
+	return token, time.Unix(claims.Exp, 0), nil
+}
+
+// VerifyExportToken verify data export download token
+func (j *JWT) VerifyExportToken(tokenString string) (*JwtPayload, error) {
+	return j.verify(tokenString, TokenTypeExport, func(token *jwt.Token) (interface{}, error) {
+		return hmacKey(token, j.refreshSecretKey)
+	})
+}
+
+func (j *JWT) signAccessToken(claims JwtPayload) (string, error) {
+	if j.keysErr != nil {
+		return "", j.keysErr
+	}
+	if j.keys != nil {
+		return j.keys.Sign(claims)
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(j.secretKey))
+}
+
+// VerifyAccessToken verify access token
+func (j *JWT) VerifyAccessToken(tokenString string) (*JwtPayload, error) {
+	return j.verify(tokenString, TokenTypeAccess, func(token *jwt.Token) (interface{}, error) {
+		// Tokens with a kid are signed by one of the asymmetric keys, tokens
+		// without one by the shared secret.
+		if _, ok := token.Header["kid"]; ok && j.keys != nil {
+			return j.keys.Keyfunc(token)
+		}
+		return hmacKey(token, j.secretKey)
+	})
+}
+
+// VerifyRefreshToken verify refresh token
+func (j *JWT) VerifyRefreshToken(tokenString string) (*JwtPayload, error) {
+	return j.verify(tokenString, TokenTypeRefresh, func(token *jwt.Token) (interface{}, error) {
+		return hmacKey(token, j.refreshSecretKey)
+	})
+}
+
+func hmacKey(token *jwt.Token, secretKey string) (interface{}, error) {
+	if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+		return nil, fmt.Errorf("invalid signing method")
+	}
+	if secretKey == "" {
+		return nil, fmt.Errorf("invalid signing method")
+	}
+	return []byte(secretKey), nil
+}
+
+func (j *JWT) verify(tokenString, tokenType string, keyFunc jwt.Keyfunc) (*JwtPayload, error) {
+	claims := &JwtPayload{}
+
+	token, err := jwt.ParseWithClaims(tokenString, claims, keyFunc,
+		jwt.WithExpirationRequired(), jwt.WithTimeFunc(j.clock.Now))
+	if err != nil {
+		return nil, err
+	}
+
+	if !token.Valid {
+		return nil, fmt.Errorf("invalid token")
+	}
+
+	// An access token must never be accepted as a refresh token and the
+	// other way around.
+	if claims.Type != tokenType {
+		return nil, fmt.Errorf("invalid token type")
+	}
+
+	return claims, nil
+}
@@ -0,0 +1,295 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"todo-app/httputil/httperror"
+	"todo-app/httputil/httpresponse"
+	"todo-app/internal/db"
+	"todo-app/internal/dtos"
+
+	"github.com/go-chi/render"
+	"github.com/uptrace/bun"
+)
+
+// CreateList implements handlers.TodoHandlerService.
+// @Summary Create list
+// @Description Create a todo list for the current user in the active workspace
+// @Tags List
+// @Accept json
+// @Produce json
+// @Param request body dtos.ListDTO true "Create list request body"
+// @Success 201 {object} httpresponse.SingleResponse{data=db.List}
+// @Failure 400 {object} httperror.ErrResponse
+// @Router /api/lists [post]
+func (t *TodoHandler) CreateList(w http.ResponseWriter, r *http.Request) {
+	claims, ok := currentUser(r)
+	if !ok {
+		render.Render(w, r, httperror.ErrUnAuthorized(errors.New("unauthorized")))
+		return
+	}
+
+	var req dtos.ListDTO
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		render.Render(w, r, httperror.ErrInvalidRequest(err))
+		return
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		render.Render(w, r, httperror.ErrInvalidRequest(errors.New("name is required")))
+		return
+	}
+
+	if !t.checkGuestQuota(w, r, claims, (*db.List)(nil), guestMaxLists, "lists") {
+		return
+	}
+
+	list := &db.List{
+		Name:        req.Name,
+		UserID:      claims.Sub,
+		WorkspaceID: currentWorkspaceID(r),
+		Role:        db.ListRoleOwner,
+	}
+	err := t.app.DB().RunInTx(r.Context(), nil, func(ctx context.Context, tx bun.Tx) error {
+		if _, err := tx.NewInsert().Model(list).Returning("*").Exec(ctx); err != nil {
+			return err
+		}
+		_, err := tx.NewInsert().Model(&db.ListMember{
+			ListID:     list.ID,
+			UserID:     claims.Sub,
+			Role:       db.ListRoleOwner,
+			Status:     db.ListMemberAccepted,
+			AcceptedAt: t.app.Clock().Now(),
+		}).Exec(ctx)
+		return err
+	})
+	if err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+
+	render.Render(w, r, httpresponse.WriteResponse(w, http.StatusCreated, "success", list))
+}
+
+// GetLists implements handlers.TodoHandlerService.
+// @Summary Get lists
+// @Description Get the todo lists of the active workspace the current user owns or is a member of, with the role of the user in each
+// @Tags List
+// @Produce json
+// @Success 200 {object} httpresponse.CollectionResponse{data=[]db.List}
+// @Router /api/lists [get]
+func (t *TodoHandler) GetLists(w http.ResponseWriter, r *http.Request) {
+	claims, ok := currentUser(r)
+	if !ok {
+		render.Render(w, r, httperror.ErrUnAuthorized(errors.New("unauthorized")))
+		return
+	}
+
+	lists := make([]*db.List, 0)
+	total, err := t.app.DB().NewSelect().Model(&lists).
+		ColumnExpr("l.*").
+		ColumnExpr("lm.role").
+		Join("JOIN list_members AS lm ON lm.list_id = l.id").
+		Where("lm.user_id = ?", claims.Sub).
+		Where("lm.status = ?", db.ListMemberAccepted).
+		Where("l.workspace_id = ?", currentWorkspaceID(r)).
+		Order("l.id ASC").
+		ScanAndCount(r.Context())
+	if err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+
+	render.Render(w, r, httpresponse.WriteCollectionResponse(w, http.StatusOK, "success", lists, total))
+}
+
+// GetList implements handlers.TodoHandlerService.
+// @Summary Get list
+// @Description Get a todo list with its todos. Any member can read it
+// @Tags List
+// @Produce json
+// @Param id path int true "List ID"
+// @Success 200 {object} httpresponse.SingleResponse{data=db.List}
+// @Failure 403 {object} httperror.ErrResponse
+// @Failure 404 {object} httperror.ErrResponse
+// @Router /api/lists/{id} [get]
+func (t *TodoHandler) GetList(w http.ResponseWriter, r *http.Request) {
+	list, ok := t.findList(w, r, db.ListRoleViewer)
+	if !ok {
+		return
+	}
+
+	err := t.app.DB().NewSelect().Model(&list.Todos).
+		Where("i.list_id = ?", list.ID).
+		Order("i.id ASC").
+		Scan(r.Context())
+	if err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+
+	render.Render(w, r, httpresponse.WriteResponse(w, http.StatusOK, "success", list))
+}
+
+// UpdateList implements handlers.TodoHandlerService.
+// @Summary Rename list
+// @Description Rename a todo list. Requires the editor role
+// @Tags List
+// @Accept json
+// @Produce json
+// @Param id path int true "List ID"
+// @Param request body dtos.ListDTO true "Rename list request body"
+// @Success 200 {object} httpresponse.SingleResponse{data=db.List}
+// @Failure 400 {object} httperror.ErrResponse
+// @Failure 403 {object} httperror.ErrResponse
+// @Failure 404 {object} httperror.ErrResponse
+// @Router /api/lists/{id} [put]
+func (t *TodoHandler) UpdateList(w http.ResponseWriter, r *http.Request) {
+	list, ok := t.findList(w, r, db.ListRoleEditor)
+	if !ok {
+		return
+	}
+
+	var req dtos.ListDTO
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		render.Render(w, r, httperror.ErrInvalidRequest(err))
+		return
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		render.Render(w, r, httperror.ErrInvalidRequest(errors.New("name is required")))
+		return
+	}
+
+	list.Name = req.Name
+	list.UpdatedAt = t.app.Clock().Now()
+	_, err := t.app.DB().NewUpdate().Model(list).
+		Column("name", "updated_at").
+		WherePK().
+		Exec(r.Context())
+	if err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+
+	render.Render(w, r, httpresponse.WriteResponse(w, http.StatusOK, "success", list))
+}
+
+// DeleteList implements handlers.TodoHandlerService.
+// @Summary Delete list
+// @Description Delete a todo list together with all of its todos. Only the owner can delete it
+// @Tags List
+// @Produce json
+// @Param id path int true "List ID"
+// @Success 200 {object} httpresponse.SingleResponse
+// @Failure 403 {object} httperror.ErrResponse
+// @Failure 404 {object} httperror.ErrResponse
+// @Router /api/lists/{id} [delete]
+func (t *TodoHandler) DeleteList(w http.ResponseWriter, r *http.Request) {
+	list, ok := t.findList(w, r, db.ListRoleOwner)
+	if !ok {
+		return
+	}
+
+	// todos.list_id is declared ON DELETE CASCADE, so postgres removes the
+	// list's todos (and their todo_tags rows) together with the list.
+	_, err := t.app.DB().NewDelete().Model(list).WherePK().Exec(r.Context())
+	if err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+
+	render.Render(w, r, httpresponse.WriteResponse(w, http.StatusOK, "success", nil))
+}
+
+// listRoleRank orders the list roles, each role can do everything the
+// lower ones can.
+var listRoleRank = map[string]int{
+	db.ListRoleViewer: 1,
+	db.ListRoleEditor: 2,
+	db.ListRoleOwner:  3,
+}
+
+// hasListRole reports whether role is at least minRole.
+func hasListRole(role, minRole string) bool {
+	return listRoleRank[role] > 0 && listRoleRank[role] >= listRoleRank[minRole]
+}
+
+// selectListWithRole selects the lists of the active workspace together with
+// the role of the current user in them. Role is empty when the user is not
+// an accepted member.
+func (t *TodoHandler) selectListWithRole(r *http.Request, list *db.List, userID int64) *bun.SelectQuery {
+	return t.app.DB().NewSelect().Model(list).
+		ColumnExpr("l.*").
+		ColumnExpr("lm.role").
+		Join("LEFT JOIN list_members AS lm ON lm.list_id = l.id AND lm.user_id = ? AND lm.status = ?", userID, db.ListMemberAccepted).
+		Where("l.workspace_id = ?", currentWorkspaceID(r))
+}
+
+// checkListRole renders 403 unless role is at least minRole.
+func checkListRole(w http.ResponseWriter, r *http.Request, role, minRole string) bool {
+	if role == "" {
+		render.Render(w, r, httperror.ErrForbidden(errors.New("you do not have access to this list")))
+		return false
+	}
+	if !hasListRole(role, minRole) {
+		render.Render(w, r, httperror.ErrForbidden(errors.New("this requires the "+minRole+" role in the list")))
+		return false
+	}
+	return true
+}
+
+// findList loads the list referenced by the {id} URL param and checks that
+// the current user has at least minRole in it.
+func (t *TodoHandler) findList(w http.ResponseWriter, r *http.Request, minRole string) (*db.List, bool) {
+	claims, ok := currentUser(r)
+	if !ok {
+		render.Render(w, r, httperror.ErrUnAuthorized(errors.New("unauthorized")))
+		return nil, false
+	}
+
+	id, err := parseIDParam(r, "id")
+	if err != nil {
+		render.Render(w, r, httperror.ErrInvalidRequest(err))
+		return nil, false
+	}
+
+	list := new(db.List)
+	err = t.selectListWithRole(r, list, claims.Sub).Where("l.id = ?", id).Scan(r.Context())
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			render.Render(w, r, httperror.ErrNotFound())
+			return nil, false
+		}
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return nil, false
+	}
+
+	if !checkListRole(w, r, list.Role, minRole) {
+		return nil, false
+	}
+	return list, true
+}
+
+// checkListAccess makes sure that the user has at least minRole in the list
+// a todo is read from or written to.
+func (t *TodoHandler) checkListAccess(w http.ResponseWriter, r *http.Request, userID, listID int64, minRole string) bool {
+	list := new(db.List)
+	err := t.selectListWithRole(r, list, userID).Where("l.id = ?", listID).Scan(r.Context())
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			render.Render(w, r, httperror.ErrBadRequest(errors.New("list does not exist")))
+			return false
+		}
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return false
+	}
+
+	return checkListRole(w, r, list.Role, minRole)
+}
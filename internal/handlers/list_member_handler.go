@@ -0,0 +1,452 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"todo-app/httputil/httperror"
+	"todo-app/httputil/httpresponse"
+	"todo-app/internal/db"
+	"todo-app/internal/dtos"
+
+	"github.com/go-chi/render"
+	"github.com/uptrace/bun"
+)
+
+var errNotListMember = errors.New("user is not a member of the list")
+
+// GetListMembers implements handlers.TodoHandlerService.
+// @Summary Get list members
+// @Description Get the members and pending invitations of a list. Any member can read them
+// @Tags List
+// @Produce json
+// @Param id path int true "List ID"
+// @Success 200 {object} httpresponse.CollectionResponse{data=[]db.ListMember}
+// @Failure 403 {object} httperror.ErrResponse
+// @Failure 404 {object} httperror.ErrResponse
+// @Router /api/lists/{id}/members [get]
+func (t *TodoHandler) GetListMembers(w http.ResponseWriter, r *http.Request) {
+	list, ok := t.findList(w, r, db.ListRoleViewer)
+	if !ok {
+		return
+	}
+
+	members := make([]*db.ListMember, 0)
+	total, err := t.app.DB().NewSelect().Model(&members).
+		ColumnExpr("lm.*").
+		ColumnExpr("u.username").
+		Join("JOIN users AS u ON u.id = lm.user_id").
+		Where("lm.list_id = ?", list.ID).
+		Order("lm.id ASC").
+		ScanAndCount(r.Context())
+	if err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+
+	render.Render(w, r, httpresponse.WriteCollectionResponse(w, http.StatusOK, "success", members, total))
+}
+
+// InviteListMember implements handlers.TodoHandlerService.
+// @Summary Invite list member
+// @Description Invite a member of the workspace by username as editor or viewer. The user becomes a member after accepting. Only the owner can invite
+// @Tags List
+// @Accept json
+// @Produce json
+// @Param id path int true "List ID"
+// @Param request body dtos.InviteListMemberDTO true "Username and role"
+// @Success 201 {object} httpresponse.SingleResponse{data=db.ListMember}
+// @Failure 400 {object} httperror.ErrResponse
+// @Failure 403 {object} httperror.ErrResponse
+// @Router /api/lists/{id}/members [post]
+func (t *TodoHandler) InviteListMember(w http.ResponseWriter, r *http.Request) {
+	list, ok := t.findList(w, r, db.ListRoleOwner)
+	if !ok {
+		return
+	}
+
+	var req dtos.InviteListMemberDTO
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		render.Render(w, r, httperror.ErrInvalidRequest(err))
+		return
+	}
+	req.Username = strings.TrimSpace(req.Username)
+	if req.Username == "" {
+		render.Render(w, r, httperror.ErrInvalidRequest(errors.New("username is required")))
+		return
+	}
+	if req.Role != db.ListRoleEditor && req.Role != db.ListRoleViewer {
+		render.Render(w, r, httperror.ErrInvalidRequest(errors.New("role must be editor or viewer")))
+		return
+	}
+
+	user := new(db.User)
+	err := t.app.DB().NewSelect().Model(user).
+		Where("username = ?", req.Username).
+		Where("NOT is_anonymous").
+		Scan(r.Context())
+	if errors.Is(err, sql.ErrNoRows) {
+		render.Render(w, r, httperror.ErrBadRequest(errors.New("user does not exist")))
+		return
+	}
+	if err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+	// Lists can only be shared inside their workspace.
+	inWorkspace, err := t.app.DB().NewSelect().Model((*db.WorkspaceMember)(nil)).
+		Where("workspace_id = ?", list.WorkspaceID).
+		Where("user_id = ?", user.ID).
+		Exists(r.Context())
+	if err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+	if !inWorkspace {
+		render.Render(w, r, httperror.ErrBadRequest(errors.New("user is not a member of the workspace of the list")))
+		return
+	}
+
+	member := &db.ListMember{
+		ListID:    list.ID,
+		UserID:    user.ID,
+		Role:      req.Role,
+		Status:    db.ListMemberPending,
+		InvitedBy: list.UserID,
+		CreatedAt: t.app.Clock().Now(),
+		Username:  user.Username,
+	}
+	_, err = t.app.DB().NewInsert().Model(member).Exec(r.Context())
+	if isUniqueViolation(err) {
+		render.Render(w, r, httperror.ErrBadRequest(errors.New("user is already a member or invited")))
+		return
+	}
+	if err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+
+	render.Render(w, r, httpresponse.WriteResponse(w, http.StatusCreated, "success", member))
+}
+
+// UpdateListMember implements handlers.TodoHandlerService.
+// @Summary Change member role
+// @Description Change the role of a member to editor or viewer. Only the owner can change roles
+// @Tags List
+// @Accept json
+// @Produce json
+// @Param id path int true "List ID"
+// @Param userID path int true "User ID of the member"
+// @Param request body dtos.UpdateListMemberDTO true "New role"
+// @Success 200 {object} httpresponse.SingleResponse
+// @Failure 400 {object} httperror.ErrResponse
+// @Failure 403 {object} httperror.ErrResponse
+// @Failure 404 {object} httperror.ErrResponse
+// @Router /api/lists/{id}/members/{userID} [put]
+func (t *TodoHandler) UpdateListMember(w http.ResponseWriter, r *http.Request) {
+	list, ok := t.findList(w, r, db.ListRoleOwner)
+	if !ok {
+		return
+	}
+	userID, err := parseIDParam(r, "userID")
+	if err != nil {
+		render.Render(w, r, httperror.ErrInvalidRequest(err))
+		return
+	}
+
+	var req dtos.UpdateListMemberDTO
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		render.Render(w, r, httperror.ErrInvalidRequest(err))
+		return
+	}
+	if req.Role != db.ListRoleEditor && req.Role != db.ListRoleViewer {
+		render.Render(w, r, httperror.ErrInvalidRequest(errors.New("role must be editor or viewer, use transfer to change the owner")))
+		return
+	}
+
+	res, err := t.app.DB().NewUpdate().Model((*db.ListMember)(nil)).
+		Set("role = ?", req.Role).
+		Where("list_id = ?", list.ID).
+		Where("user_id = ?", userID).
+		Where("role <> ?", db.ListRoleOwner).
+		Exec(r.Context())
+	if err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		render.Render(w, r, httperror.ErrNotFound())
+		return
+	}
+
+	render.Render(w, r, httpresponse.WriteResponse(w, http.StatusOK, "success", nil))
+}
+
+// RemoveListMember implements handlers.TodoHandlerService.
+// @Summary Remove list member
+// @Description Remove a member or withdraw an invitation. Only the owner can remove members
+// @Tags List
+// @Produce json
+// @Param id path int true "List ID"
+// @Param userID path int true "User ID of the member"
+// @Success 200 {object} httpresponse.SingleResponse
+// @Failure 403 {object} httperror.ErrResponse
+// @Failure 404 {object} httperror.ErrResponse
+// @Router /api/lists/{id}/members/{userID} [delete]
+func (t *TodoHandler) RemoveListMember(w http.ResponseWriter, r *http.Request) {
+	list, ok := t.findList(w, r, db.ListRoleOwner)
+	if !ok {
+		return
+	}
+	userID, err := parseIDParam(r, "userID")
+	if err != nil {
+		render.Render(w, r, httperror.ErrInvalidRequest(err))
+		return
+	}
+
+	res, err := t.app.DB().NewDelete().Model((*db.ListMember)(nil)).
+		Where("list_id = ?", list.ID).
+		Where("user_id = ?", userID).
+		Where("role <> ?", db.ListRoleOwner).
+		Exec(r.Context())
+	if err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		render.Render(w, r, httperror.ErrNotFound())
+		return
+	}
+
+	render.Render(w, r, httpresponse.WriteResponse(w, http.StatusOK, "success", nil))
+}
+
+// LeaveList implements handlers.TodoHandlerService.
+// @Summary Leave list
+// @Description Stop being a member of a list. The owner has to transfer the list first
+// @Tags List
+// @Produce json
+// @Param id path int true "List ID"
+// @Success 200 {object} httpresponse.SingleResponse
+// @Failure 400 {object} httperror.ErrResponse
+// @Failure 403 {object} httperror.ErrResponse
+// @Router /api/lists/{id}/leave [post]
+func (t *TodoHandler) LeaveList(w http.ResponseWriter, r *http.Request) {
+	list, ok := t.findList(w, r, db.ListRoleViewer)
+	if !ok {
+		return
+	}
+	if list.Role == db.ListRoleOwner {
+		render.Render(w, r, httperror.ErrBadRequest(errors.New("the owner cannot leave, transfer the list or delete it")))
+		return
+	}
+
+	claims, _ := currentUser(r)
+	_, err := t.app.DB().NewDelete().Model((*db.ListMember)(nil)).
+		Where("list_id = ?", list.ID).
+		Where("user_id = ?", claims.Sub).
+		Exec(r.Context())
+	if err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+
+	render.Render(w, r, httpresponse.WriteResponse(w, http.StatusOK, "success", nil))
+}
+
+// TransferList implements handlers.TodoHandlerService.
+// @Summary Transfer list ownership
+// @Description Make another member the owner of the list. The previous owner stays as editor
+// @Tags List
+// @Accept json
+// @Produce json
+// @Param id path int true "List ID"
+// @Param request body dtos.TransferListDTO true "User ID of the new owner"
+// @Success 200 {object} httpresponse.SingleResponse{data=db.List}
+// @Failure 400 {object} httperror.ErrResponse
+// @Failure 403 {object} httperror.ErrResponse
+// @Router /api/lists/{id}/transfer [post]
+func (t *TodoHandler) TransferList(w http.ResponseWriter, r *http.Request) {
+	list, ok := t.findList(w, r, db.ListRoleOwner)
+	if !ok {
+		return
+	}
+
+	var req dtos.TransferListDTO
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		render.Render(w, r, httperror.ErrInvalidRequest(err))
+		return
+	}
+	if req.UserID == 0 || req.UserID == list.UserID {
+		render.Render(w, r, httperror.ErrInvalidRequest(errors.New("user_id must be another member of the list")))
+		return
+	}
+
+	now := t.app.Clock().Now()
+	err := t.app.DB().RunInTx(r.Context(), nil, func(ctx context.Context, tx bun.Tx) error {
+		// Demote first, there can only be one owner at a time.
+		_, err := tx.NewUpdate().Model((*db.ListMember)(nil)).
+			Set("role = ?", db.ListRoleEditor).
+			Where("list_id = ?", list.ID).
+			Where("user_id = ?", list.UserID).
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+
+		res, err := tx.NewUpdate().Model((*db.ListMember)(nil)).
+			Set("role = ?", db.ListRoleOwner).
+			Where("list_id = ?", list.ID).
+			Where("user_id = ?", req.UserID).
+			Where("status = ?", db.ListMemberAccepted).
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return errNotListMember
+		}
+
+		_, err = tx.NewUpdate().Model(list).
+			Set("user_id = ?", req.UserID).
+			Set("updated_at = ?", now).
+			WherePK().
+			Exec(ctx)
+		return err
+	})
+	if errors.Is(err, errNotListMember) {
+		render.Render(w, r, httperror.ErrBadRequest(err))
+		return
+	}
+	if err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+
+	list.UserID = req.UserID
+	list.UpdatedAt = now
+	list.Role = db.ListRoleEditor
+	render.Render(w, r, httpresponse.WriteResponse(w, http.StatusOK, "success", list))
+}
+
+// GetInvitations implements handlers.TodoHandlerService.
+// @Summary Get invitations
+// @Description Get the pending list invitations of the current user in the active workspace
+// @Tags List
+// @Produce json
+// @Success 200 {object} httpresponse.CollectionResponse{data=[]db.ListMember}
+// @Router /api/invitations [get]
+func (t *TodoHandler) GetInvitations(w http.ResponseWriter, r *http.Request) {
+	claims, ok := currentUser(r)
+	if !ok {
+		render.Render(w, r, httperror.ErrUnAuthorized(errors.New("unauthorized")))
+		return
+	}
+
+	invitations := make([]*db.ListMember, 0)
+	total, err := t.app.DB().NewSelect().Model(&invitations).
+		ColumnExpr("lm.*").
+		ColumnExpr("l.name AS list_name").
+		Join("JOIN lists AS l ON l.id = lm.list_id").
+		Where("lm.user_id = ?", claims.Sub).
+		Where("lm.status = ?", db.ListMemberPending).
+		Where("l.workspace_id = ?", currentWorkspaceID(r)).
+		Order("lm.id ASC").
+		ScanAndCount(r.Context())
+	if err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+
+	render.Render(w, r, httpresponse.WriteCollectionResponse(w, http.StatusOK, "success", invitations, total))
+}
+
+// AcceptInvitation implements handlers.TodoHandlerService.
+// @Summary Accept invitation
+// @Description Accept a list invitation and become a member
+// @Tags List
+// @Produce json
+// @Param id path int true "Invitation ID"
+// @Success 200 {object} httpresponse.SingleResponse
+// @Failure 404 {object} httperror.ErrResponse
+// @Router /api/invitations/{id}/accept [post]
+func (t *TodoHandler) AcceptInvitation(w http.ResponseWriter, r *http.Request) {
+	claims, ok := currentUser(r)
+	if !ok {
+		render.Render(w, r, httperror.ErrUnAuthorized(errors.New("unauthorized")))
+		return
+	}
+	id, err := parseIDParam(r, "id")
+	if err != nil {
+		render.Render(w, r, httperror.ErrInvalidRequest(err))
+		return
+	}
+
+	res, err := t.app.DB().NewUpdate().Model((*db.ListMember)(nil)).
+		Set("status = ?", db.ListMemberAccepted).
+		Set("accepted_at = ?", t.app.Clock().Now()).
+		Where("id = ?", id).
+		Where("user_id = ?", claims.Sub).
+		Where("status = ?", db.ListMemberPending).
+		Where("list_id IN (?)", t.workspaceListIDs(r)).
+		Exec(r.Context())
+	if err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		render.Render(w, r, httperror.ErrNotFound())
+		return
+	}
+
+	render.Render(w, r, httpresponse.WriteResponse(w, http.StatusOK, "success", nil))
+}
+
+// DeclineInvitation implements handlers.TodoHandlerService.
+// @Summary Decline invitation
+// @Description Decline a list invitation
+// @Tags List
+// @Produce json
+// @Param id path int true "Invitation ID"
+// @Success 200 {object} httpresponse.SingleResponse
+// @Failure 404 {object} httperror.ErrResponse
+// @Router /api/invitations/{id}/decline [post]
+func (t *TodoHandler) DeclineInvitation(w http.ResponseWriter, r *http.Request) {
+	claims, ok := currentUser(r)
+	if !ok {
+		render.Render(w, r, httperror.ErrUnAuthorized(errors.New("unauthorized")))
+		return
+	}
+	id, err := parseIDParam(r, "id")
+	if err != nil {
+		render.Render(w, r, httperror.ErrInvalidRequest(err))
+		return
+	}
+
+	res, err := t.app.DB().NewDelete().Model((*db.ListMember)(nil)).
+		Where("id = ?", id).
+		Where("user_id = ?", claims.Sub).
+		Where("status = ?", db.ListMemberPending).
+		Where("list_id IN (?)", t.workspaceListIDs(r)).
+		Exec(r.Context())
+	if err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		render.Render(w, r, httperror.ErrNotFound())
+		return
+	}
+
+	render.Render(w, r, httpresponse.WriteResponse(w, http.StatusOK, "success", nil))
+}
+
+// workspaceListIDs selects the ids of the lists of the active workspace.
+func (t *TodoHandler) workspaceListIDs(r *http.Request) *bun.SelectQuery {
+	return t.app.DB().NewSelect().Model((*db.List)(nil)).
+		Column("l.id").
+		Where("l.workspace_id = ?", currentWorkspaceID(r))
+}
@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+	"todo-app/httputil/httperror"
+
+	"github.com/go-chi/render"
+	log "github.com/sirupsen/logrus"
+)
+
+// errInvalidCredentials is the only answer to a failed login, whether the
+// username exists or not.
+var errInvalidCredentials = errors.New("invalid username or password")
+
+// checkLoginAllowed renders 429 with a Retry-After header when the account
+// or the client address are backing off after failed attempts.
+func (a *AuthHandler) checkLoginAllowed(w http.ResponseWriter, r *http.Request, username string) bool {
+	wait, err := a.app.LoginLimiter().Check(r.Context(), a.app.Clock().Now(), username, a.app.ClientIP(r))
+	if err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return false
+	}
+	if wait > 0 {
+		renderRetryAfter(w, r, wait, errors.New("too many failed attempts, try again later"))
+		return false
+	}
+	return true
+}
+
+// checkGuestAllowed renders 429 with a Retry-After header when the client
+// address created too many guest accounts lately.
+func (a *AuthHandler) checkGuestAllowed(w http.ResponseWriter, r *http.Request) bool {
+	wait, err := a.app.LoginLimiter().CheckGuest(r.Context(), a.app.Clock().Now(), a.app.ClientIP(r))
+	if err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return false
+	}
+	if wait > 0 {
+		renderRetryAfter(w, r, wait, errors.New("too many guest accounts from this address, try again later"))
+		return false
+	}
+	return true
+}
+
+func (a *AuthHandler) recordGuestCreated(r *http.Request) {
+	if err := a.app.LoginLimiter().GuestCreated(r.Context(), a.app.Clock().Now(), a.app.ClientIP(r)); err != nil {
+		log.WithError(err).Error("failed to record guest account")
+	}
+}
+
+func renderRetryAfter(w http.ResponseWriter, r *http.Request, wait time.Duration, err error) {
+	w.Header().Set("Retry-After", fmt.Sprint(int64(math.Ceil(wait.Seconds()))))
+	render.Render(w, r, httperror.ErrTooManyRequests(err))
+}
+
+// loginFailed records the failure and renders the uniform error.
+func (a *AuthHandler) loginFailed(w http.ResponseWriter, r *http.Request, username string) {
+	a.recordLoginFailure(r, username)
+	render.Render(w, r, httperror.ErrForbidden(errInvalidCredentials))
+}
+
+func (a *AuthHandler) recordLoginFailure(r *http.Request, username string) {
+	if err := a.app.LoginLimiter().Fail(r.Context(), a.app.Clock().Now(), username, a.app.ClientIP(r)); err != nil {
+		log.WithError(err).Error("failed to record login failure")
+	}
+}
+
+// loginSucceeded clears the failures of the account.
+func (a *AuthHandler) loginSucceeded(r *http.Request, username string) {
+	if err := a.app.LoginLimiter().Succeed(r.Context(), username); err != nil {
+		log.WithError(err).Error("failed to reset login failures")
+	}
+}
@@ -0,0 +1,399 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"todo-app/httputil/httperror"
+	"todo-app/httputil/httpresponse"
+	"todo-app/internal/db"
+	"todo-app/internal/dtos"
+	"todo-app/pkg/totp"
+	"todo-app/pkg/utils"
+
+	"github.com/go-chi/render"
+	"github.com/uptrace/bun"
+)
+
+const (
+	totpIssuer        = "Todo App"
+	recoveryCodeCount = 10
+)
+
+type TOTPEnrollResponse struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+type MFAChallengeResponse struct {
+	MFARequired bool   `json:"mfa_required"`
+	MFAToken    string `json:"mfa_token"`
+}
+
+// EnrollTOTP implements handlers.AuthHandlerService.
+// @Summary Start TOTP enrollment
+// @Description Generate a TOTP secret for the current user. It is only enabled once confirmed with a code
+// @Tags MFA
+// @Produce json
+// @Success 200 {object} httpresponse.SingleResponse{data=TOTPEnrollResponse}
+// @Failure 400 {object} httperror.ErrResponse
+// @Router /api/auth/mfa/totp/enroll [post]
+func (a *AuthHandler) EnrollTOTP(w http.ResponseWriter, r *http.Request) {
+	user, ok := a.findCurrentUser(w, r)
+	if !ok {
+		return
+	}
+	if user.IsAnonymous {
+		render.Render(w, r, httperror.ErrForbidden(errors.New("register before enabling two-factor authentication")))
+		return
+	}
+	if !user.TOTPEnabledAt.IsZero() {
+		render.Render(w, r, httperror.ErrBadRequest(errors.New("two-factor authentication is already enabled")))
+		return
+	}
+
+	secret, err := totp.NewSecret()
+	if err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+
+	_, err = a.app.DB().NewUpdate().Model(user).
+		Set("totp_secret = ?", secret).
+		Set("totp_last_step = 0").
+		Set("updated_at = ?", a.app.Clock().Now()).
+		WherePK().
+		Exec(r.Context())
+	if err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+
+	render.Render(w, r, httpresponse.WriteResponse(w, http.StatusOK, "success", TOTPEnrollResponse{
+		Secret:          secret,
+		ProvisioningURI: totp.ProvisioningURI(totpIssuer, user.Username, secret),
+	}))
+}
+
+// ConfirmTOTP implements handlers.AuthHandlerService.
+// @Summary Confirm TOTP enrollment
+// @Description Enable two-factor authentication with a code of the enrolled secret and return the recovery codes
+// @Tags MFA
+// @Accept json
+// @Produce json
+// @Param request body dtos.MFACodeDTO true "Current TOTP code"
+// @Success 200 {object} httpresponse.SingleResponse{data=RecoveryCodesResponse}
+// @Failure 400 {object} httperror.ErrResponse
+// @Failure 429 {object} httperror.ErrResponse
+// @Router /api/auth/mfa/totp/confirm [post]
+func (a *AuthHandler) ConfirmTOTP(w http.ResponseWriter, r *http.Request) {
+	user, ok := a.findCurrentUser(w, r)
+	if !ok {
+		return
+	}
+
+	var req dtos.MFACodeDTO
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		render.Render(w, r, httperror.ErrInvalidRequest(err))
+		return
+	}
+
+	if user.TOTPSecret == "" || !user.TOTPEnabledAt.IsZero() {
+		render.Render(w, r, httperror.ErrBadRequest(errors.New("no pending two-factor enrollment")))
+		return
+	}
+	if !a.checkLoginAllowed(w, r, user.Username) {
+		return
+	}
+	step, ok := totp.Validate(user.TOTPSecret, req.Code, a.app.Clock().Now(), user.TOTPLastStep)
+	if !ok {
+		a.recordLoginFailure(r, user.Username)
+		render.Render(w, r, httperror.ErrBadRequest(errors.New("invalid code")))
+		return
+	}
+
+	var codes []string
+	err := a.app.DB().RunInTx(r.Context(), nil, func(ctx context.Context, tx bun.Tx) error {
+		now := a.app.Clock().Now()
+		_, err := tx.NewUpdate().Model(user).
+			Set("totp_enabled_at = ?", now).
+			Set("totp_last_step = ?", step).
+			Set("updated_at = ?", now).
+			WherePK().
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+		codes, err = a.replaceRecoveryCodes(ctx, tx, user.ID)
+		return err
+	})
+	if err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+
+	render.Render(w, r, httpresponse.WriteResponse(w, http.StatusOK, "success", RecoveryCodesResponse{RecoveryCodes: codes}))
+}
+
+// DisableTOTP implements handlers.AuthHandlerService.
+// @Summary Disable TOTP
+// @Description Disable two-factor authentication, requires the password and a TOTP or recovery code
+// @Tags MFA
+// @Accept json
+// @Produce json
+// @Param request body dtos.MFADisableDTO true "Password and second factor"
+// @Success 200 {object} httpresponse.SingleResponse
+// @Failure 400 {object} httperror.ErrResponse
+// @Failure 403 {object} httperror.ErrResponse
+// @Failure 429 {object} httperror.ErrResponse
+// @Router /api/auth/mfa/totp/disable [post]
+func (a *AuthHandler) DisableTOTP(w http.ResponseWriter, r *http.Request) {
+	user, ok := a.findCurrentUser(w, r)
+	if !ok {
+		return
+	}
+
+	var req dtos.MFADisableDTO
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		render.Render(w, r, httperror.ErrInvalidRequest(err))
+		return
+	}
+
+	if user.TOTPEnabledAt.IsZero() {
+		render.Render(w, r, httperror.ErrBadRequest(errors.New("two-factor authentication is not enabled")))
+		return
+	}
+	// A stolen access token must not allow to guess the factors.
+	if !a.checkLoginAllowed(w, r, user.Username) {
+		return
+	}
+	if match, _ := a.app.PasswordHasher().Verify(user.PasswordHash, req.Password); !match {
+		a.recordLoginFailure(r, user.Username)
+		render.Render(w, r, httperror.ErrForbidden(errors.New("invalid password")))
+		return
+	}
+	ok, err := a.verifySecondFactor(r.Context(), user, req.Code, req.RecoveryCode)
+	if err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+	if !ok {
+		a.recordLoginFailure(r, user.Username)
+		render.Render(w, r, httperror.ErrForbidden(errors.New("invalid code")))
+		return
+	}
+
+	err = a.app.DB().RunInTx(r.Context(), nil, func(ctx context.Context, tx bun.Tx) error {
+		_, err := tx.NewUpdate().Model(user).
+			Set("totp_secret = NULL").
+			Set("totp_enabled_at = NULL").
+			Set("totp_last_step = 0").
+			Set("updated_at = ?", a.app.Clock().Now()).
+			WherePK().
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+		_, err = tx.NewDelete().Model((*db.MFARecoveryCode)(nil)).Where("user_id = ?", user.ID).Exec(ctx)
+		return err
+	})
+	if err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+
+	render.Render(w, r, httpresponse.WriteResponse(w, http.StatusOK, "success", nil))
+}
+
+// RegenerateRecoveryCodes implements handlers.AuthHandlerService.
+// @Summary Regenerate recovery codes
+// @Description Replace all recovery codes, requires a current TOTP code
+// @Tags MFA
+// @Accept json
+// @Produce json
+// @Param request body dtos.MFACodeDTO true "Current TOTP code"
+// @Success 200 {object} httpresponse.SingleResponse{data=RecoveryCodesResponse}
+// @Failure 400 {object} httperror.ErrResponse
+// @Failure 403 {object} httperror.ErrResponse
+// @Failure 429 {object} httperror.ErrResponse
+// @Router /api/auth/mfa/recovery-codes [post]
+func (a *AuthHandler) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	user, ok := a.findCurrentUser(w, r)
+	if !ok {
+		return
+	}
+
+	var req dtos.MFACodeDTO
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		render.Render(w, r, httperror.ErrInvalidRequest(err))
+		return
+	}
+
+	if user.TOTPEnabledAt.IsZero() {
+		render.Render(w, r, httperror.ErrBadRequest(errors.New("two-factor authentication is not enabled")))
+		return
+	}
+	if !a.checkLoginAllowed(w, r, user.Username) {
+		return
+	}
+	ok, err := a.verifySecondFactor(r.Context(), user, req.Code, "")
+	if err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+	if !ok {
+		a.recordLoginFailure(r, user.Username)
+		render.Render(w, r, httperror.ErrForbidden(errors.New("invalid code")))
+		return
+	}
+
+	var codes []string
+	err = a.app.DB().RunInTx(r.Context(), nil, func(ctx context.Context, tx bun.Tx) error {
+		var err error
+		codes, err = a.replaceRecoveryCodes(ctx, tx, user.ID)
+		return err
+	})
+	if err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+
+	render.Render(w, r, httpresponse.WriteResponse(w, http.StatusOK, "success", RecoveryCodesResponse{RecoveryCodes: codes}))
+}
+
+// LoginMFA implements handlers.AuthHandlerService.
+// @Summary Complete login with second factor
+// @Description Exchange the mfa_token returned by login and a TOTP or recovery code for a token pair
+// @Tags MFA
+// @Accept json
+// @Produce json
+// @Param request body dtos.MFALoginDTO true "MFA login request body"
+// @Success 200 {object} httpresponse.SingleResponse{data=TokenResponse}
+// @Failure 401 {object} httperror.ErrResponse
+// @Failure 403 {object} httperror.ErrResponse
+// @Failure 429 {object} httperror.ErrResponse
+// @Router /api/auth/login/mfa [post]
+func (a *AuthHandler) LoginMFA(w http.ResponseWriter, r *http.Request) {
+	var req dtos.MFALoginDTO
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		render.Render(w, r, httperror.ErrInvalidRequest(err))
+		return
+	}
+
+	claims, err := a.NewJWT().VerifyMFAToken(req.MFAToken)
+	if err != nil {
+		render.Render(w, r, httperror.ErrUnAuthorized(errors.New("invalid or expired mfa token")))
+		return
+	}
+
+	user := new(db.User)
+	err = a.app.DB().NewSelect().Model(user).Where("id = ?", claims.Sub).Scan(r.Context())
+	if err != nil || user.TOTPEnabledAt.IsZero() {
+		render.Render(w, r, httperror.ErrUnAuthorized(errors.New("invalid or expired mfa token")))
+		return
+	}
+
+	// Codes are guessed against the same budget as passwords.
+	if !a.checkLoginAllowed(w, r, user.Username) {
+		return
+	}
+
+	ok, err := a.verifySecondFactor(r.Context(), user, req.Code, req.RecoveryCode)
+	if err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+	if !ok {
+		a.recordLoginFailure(r, user.Username)
+		render.Render(w, r, httperror.ErrForbidden(errors.New("invalid code")))
+		return
+	}
+
+	a.issueLoginTokens(w, r, user, req.Device)
+}
+
+// verifySecondFactor checks a TOTP code or, when no code is given, a recovery
+// code. Both are consumed so they can not be used twice.
+func (a *AuthHandler) verifySecondFactor(ctx context.Context, user *db.User, code, recoveryCode string) (bool, error) {
+	if code != "" {
+		step, ok := totp.Validate(user.TOTPSecret, code, a.app.Clock().Now(), user.TOTPLastStep)
+		if !ok {
+			return false, nil
+		}
+		res, err := a.app.DB().NewUpdate().Model(user).
+			Set("totp_last_step = ?", step).
+			WherePK().
+			Where("totp_last_step < ?", step).
+			Exec(ctx)
+		if err != nil {
+			return false, err
+		}
+		n, err := res.RowsAffected()
+		return n == 1, err
+	}
+
+	if recoveryCode != "" {
+		res, err := a.app.DB().NewUpdate().Model((*db.MFARecoveryCode)(nil)).
+			Set("used_at = ?", a.app.Clock().Now()).
+			Where("user_id = ?", user.ID).
+			Where("code_hash = ?", utils.HashRecoveryCode(recoveryCode)).
+			Where("used_at IS NULL").
+			Exec(ctx)
+		if err != nil {
+			return false, err
+		}
+		n, err := res.RowsAffected()
+		return n == 1, err
+	}
+
+	return false, nil
+}
+
+// replaceRecoveryCodes deletes the recovery codes of a user and stores new
+// ones. The plain codes are only returned here.
+func (a *AuthHandler) replaceRecoveryCodes(ctx context.Context, tx bun.Tx, userID int64) ([]string, error) {
+	codes, err := utils.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.NewDelete().Model((*db.MFARecoveryCode)(nil)).Where("user_id = ?", userID).Exec(ctx); err != nil {
+		return nil, err
+	}
+
+	rows := make([]db.MFARecoveryCode, len(codes))
+	for i, code := range codes {
+		rows[i] = db.MFARecoveryCode{UserID: userID, CodeHash: utils.HashRecoveryCode(code)}
+	}
+	if _, err := tx.NewInsert().Model(&rows).Exec(ctx); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// findCurrentUser loads the user of the access token.
+func (a *AuthHandler) findCurrentUser(w http.ResponseWriter, r *http.Request) (*db.User, bool) {
+	claims, ok := currentUser(r)
+	if !ok {
+		render.Render(w, r, httperror.ErrUnAuthorized(errors.New("unauthorized")))
+		return nil, false
+	}
+
+	user := new(db.User)
+	err := a.app.DB().NewSelect().Model(user).Where("id = ?", claims.Sub).Scan(r.Context())
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			render.Render(w, r, httperror.ErrUnAuthorized(errors.New("user no longer exists")))
+			return nil, false
+		}
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return nil, false
+	}
+	return user, true
+}
@@ -0,0 +1,231 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"todo-app/httputil/httperror"
+	"todo-app/httputil/httpresponse"
+	"todo-app/internal/db"
+	"todo-app/internal/dtos"
+	"todo-app/pkg/utils"
+
+	"github.com/go-chi/render"
+	"github.com/uptrace/bun"
+)
+
+type CreateOAuthClientResponse struct {
+	// ClientSecret is only returned once, and only for confidential clients.
+	ClientSecret string          `json:"client_secret,omitempty"`
+	Client       *db.OAuthClient `json:"client"`
+}
+
+// CreateOAuthClient implements handlers.AuthHandlerService.
+// @Summary Register OAuth client
+// @Description Register a third-party application. Requires the admin role and scope. The client secret is only shown in this response. The client_credentials grant needs a confidential client with an owner_id
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param request body dtos.CreateOAuthClientDTO true "Client metadata"
+// @Success 201 {object} httpresponse.SingleResponse{data=CreateOAuthClientResponse}
+// @Failure 400 {object} httperror.ErrResponse
+// @Failure 403 {object} httperror.ErrResponse
+// @Router /api/admin/oauth/clients [post]
+func (a *AuthHandler) CreateOAuthClient(w http.ResponseWriter, r *http.Request) {
+	claims, ok := currentUser(r)
+	if !ok {
+		render.Render(w, r, httperror.ErrUnAuthorized(errors.New("unauthorized")))
+		return
+	}
+
+	var req dtos.CreateOAuthClientDTO
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		render.Render(w, r, httperror.ErrInvalidRequest(err))
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if len(req.GrantTypes) == 0 {
+		req.GrantTypes = []string{db.GrantAuthorizationCode, db.GrantRefreshToken}
+	}
+	if len(req.Scopes) == 0 {
+		req.Scopes = oauthScopes
+	}
+	if err := validateOAuthClient(req); err != nil {
+		render.Render(w, r, httperror.ErrInvalidRequest(err))
+		return
+	}
+
+	if req.OwnerID != 0 {
+		owner := new(db.User)
+		err := a.app.DB().NewSelect().Model(owner).Where("id = ?", req.OwnerID).Scan(r.Context())
+		if errors.Is(err, sql.ErrNoRows) || (err == nil && owner.IsAnonymous) {
+			render.Render(w, r, httperror.ErrInvalidRequest(errors.New("owner not found")))
+			return
+		}
+		if err != nil {
+			render.Render(w, r, httperror.ErrInternalError(err))
+			return
+		}
+	}
+
+	clientID, err := utils.GenerateOAuthClientID()
+	if err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+	client := &db.OAuthClient{
+		ClientID:     clientID,
+		Name:         req.Name,
+		RedirectURIs: req.RedirectURIs,
+		GrantTypes:   slices.Compact(slices.Sorted(slices.Values(req.GrantTypes))),
+		Scopes:       slices.Compact(slices.Sorted(slices.Values(req.Scopes))),
+		Confidential: req.Confidential,
+		OwnerID:      req.OwnerID,
+		CreatedBy:    claims.Sub,
+		CreatedAt:    a.app.Clock().Now(),
+	}
+	if client.RedirectURIs == nil {
+		client.RedirectURIs = []string{}
+	}
+
+	var secret string
+	if req.Confidential {
+		if secret, err = utils.GenerateOAuthClientSecret(); err != nil {
+			render.Render(w, r, httperror.ErrInternalError(err))
+			return
+		}
+		client.SecretHash = utils.HashSecret(secret)
+	}
+
+	if _, err := a.app.DB().NewInsert().Model(client).Exec(r.Context()); err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+
+	render.Render(w, r, httpresponse.WriteResponse(w, http.StatusCreated, "success", CreateOAuthClientResponse{
+		ClientSecret: secret,
+		Client:       client,
+	}))
+}
+
+// validateOAuthClient checks the metadata of a new client.
+func validateOAuthClient(req dtos.CreateOAuthClientDTO) error {
+	if req.Name == "" {
+		return errors.New("name is required")
+	}
+	for _, grant := range req.GrantTypes {
+		if !slices.Contains(oauthGrantTypes, grant) {
+			return errors.New("unknown grant type " + grant)
+		}
+	}
+	for _, scope := range req.Scopes {
+		if !slices.Contains(oauthScopes, scope) {
+			return errors.New("scope " + scope + " cannot be granted to clients")
+		}
+	}
+
+	if slices.Contains(req.GrantTypes, db.GrantAuthorizationCode) && len(req.RedirectURIs) == 0 {
+		return errors.New("the authorization code grant needs at least one redirect URI")
+	}
+	for _, raw := range req.RedirectURIs {
+		// Redirect URIs are compared exactly, RFC 6749 section 3.1.2.
+		u, err := url.Parse(raw)
+		if err != nil || !u.IsAbs() || u.Fragment != "" || (u.Host == "" && u.Opaque == "") {
+			return errors.New("invalid redirect URI " + raw)
+		}
+	}
+
+	if slices.Contains(req.GrantTypes, db.GrantClientCredentials) {
+		if !req.Confidential {
+			return errors.New("public clients cannot use the client credentials grant")
+		}
+		if req.OwnerID == 0 {
+			return errors.New("the client credentials grant needs an owner_id")
+		}
+	}
+	return nil
+}
+
+// GetOAuthClients implements handlers.AuthHandlerService.
+// @Summary List OAuth clients
+// @Description List the registered clients that are not revoked. Requires the admin role and scope
+// @Tags Admin
+// @Produce json
+// @Success 200 {object} httpresponse.CollectionResponse{data=[]db.OAuthClient}
+// @Failure 403 {object} httperror.ErrResponse
+// @Router /api/admin/oauth/clients [get]
+func (a *AuthHandler) GetOAuthClients(w http.ResponseWriter, r *http.Request) {
+	clients := make([]*db.OAuthClient, 0)
+	total, err := a.app.DB().NewSelect().Model(&clients).
+		Where("oc.revoked_at IS NULL").
+		Order("oc.created_at DESC").
+		ScanAndCount(r.Context())
+	if err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+
+	render.Render(w, r, httpresponse.WriteCollectionResponse(w, http.StatusOK, "success", clients, total))
+}
+
+// RevokeOAuthClient implements handlers.AuthHandlerService.
+// @Summary Revoke OAuth client
+// @Description Revoke a client together with every session and pending code issued to it. Requires the admin role and scope
+// @Tags Admin
+// @Produce json
+// @Param id path int true "Client ID"
+// @Success 200 {object} httpresponse.SingleResponse
+// @Failure 403 {object} httperror.ErrResponse
+// @Failure 404 {object} httperror.ErrResponse
+// @Router /api/admin/oauth/clients/{id} [delete]
+func (a *AuthHandler) RevokeOAuthClient(w http.ResponseWriter, r *http.Request) {
+	id, err := parseIDParam(r, "id")
+	if err != nil {
+		render.Render(w, r, httperror.ErrInvalidRequest(err))
+		return
+	}
+
+	now := a.app.Clock().Now()
+	err = a.app.DB().RunInTx(r.Context(), nil, func(ctx context.Context, tx bun.Tx) error {
+		res, err := tx.NewUpdate().Model((*db.OAuthClient)(nil)).
+			Set("revoked_at = ?", now).
+			Where("id = ?", id).
+			Where("revoked_at IS NULL").
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return sql.ErrNoRows
+		}
+
+		_, err = tx.NewUpdate().Model((*db.Session)(nil)).
+			Set("revoked_at = ?", now).
+			Set("updated_at = ?", now).
+			Where("oauth_client_id = ?", id).
+			Where("revoked_at IS NULL").
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+		_, err = tx.NewDelete().Model((*db.OAuthAuthorizationCode)(nil)).
+			Where("client_id = ?", id).
+			Exec(ctx)
+		return err
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		render.Render(w, r, httperror.ErrNotFound())
+		return
+	}
+	if err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+
+	render.Render(w, r, httpresponse.WriteResponse(w, http.StatusOK, "success", nil))
+}
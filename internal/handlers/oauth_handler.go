@@ -0,0 +1,790 @@
+package handlers
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"todo-app/httputil/httperror"
+	"todo-app/httputil/httpresponse"
+	"todo-app/internal/constants"
+	"todo-app/internal/db"
+	"todo-app/internal/dtos"
+	"todo-app/pkg/oidc"
+	"todo-app/pkg/utils"
+
+	"github.com/go-chi/render"
+)
+
+// authorizationCodeDuration is how long a client has to exchange a code.
+const authorizationCodeDuration = 5 * time.Minute
+
+// oauthScopes are the scopes OAuth clients can be granted. The admin scope
+// is never handed to third parties.
+var oauthScopes = []string{constants.ScopeTodosRead, constants.ScopeTodosWrite}
+
+var oauthGrantTypes = []string{db.GrantAuthorizationCode, db.GrantRefreshToken, db.GrantClientCredentials}
+
+var (
+	errInvalidClient      = errors.New("client authentication failed")
+	errUnknownOAuthClient = errors.New("unknown client_id")
+	errInvalidRedirectURI = errors.New("redirect_uri is not registered for the client")
+	errInvalidGrant       = errors.New("invalid, expired or revoked grant")
+)
+
+// OAuthError is the error response of the token, introspection and
+// revocation endpoints (RFC 6749 section 5.2).
+type OAuthError struct {
+	Error       string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+// OAuthTokenResponse is the successful response of the token endpoint
+// (RFC 6749 section 5.1).
+type OAuthTokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	Scope        string `json:"scope"`
+}
+
+// OAuthIntrospection is the response of the introspection endpoint
+// (RFC 7662 section 2.2). Inactive tokens only have Active set.
+type OAuthIntrospection struct {
+	Active   bool   `json:"active"`
+	Scope    string `json:"scope,omitempty"`
+	ClientID string `json:"client_id,omitempty"`
+	Username string `json:"username,omitempty"`
+	Sub      string `json:"sub,omitempty"`
+	Exp      int64  `json:"exp,omitempty"`
+	Iat      int64  `json:"iat,omitempty"`
+}
+
+// OAuthConsentResponse is what the consent screen shows the user.
+type OAuthConsentResponse struct {
+	ClientID    string   `json:"client_id"`
+	ClientName  string   `json:"client_name"`
+	RedirectURI string   `json:"redirect_uri"`
+	Scopes      []string `json:"scopes"`
+	State       string   `json:"state,omitempty"`
+	// Granted is true when the user already approved these scopes, the
+	// screen can then be skipped.
+	Granted bool `json:"granted"`
+}
+
+type OAuthRedirectResponse struct {
+	// RedirectURL is where to send the browser of the user, with the code
+	// or the error for the client.
+	RedirectURL string `json:"redirect_url"`
+}
+
+// authorizeRequest is an authorization request that passed validation.
+type authorizeRequest struct {
+	client        *db.OAuthClient
+	redirectURI   string
+	scopes        []string
+	state         string
+	codeChallenge string
+}
+
+// GetOAuthConsent implements handlers.AuthHandlerService.
+// @Summary OAuth consent screen
+// @Description Validate an authorization request (authorization code with PKCE S256) and describe the client and scopes to approve
+// @Tags OAuth
+// @Produce json
+// @Param response_type query string true "code"
+// @Param client_id query string true "Client ID"
+// @Param redirect_uri query string true "Registered redirect URI"
+// @Param scope query string false "Space separated scopes, the client scopes when empty"
+// @Param state query string false "Opaque value returned to the client"
+// @Param code_challenge query string true "PKCE code challenge"
+// @Param code_challenge_method query string true "S256"
+// @Success 200 {object} httpresponse.SingleResponse{data=OAuthConsentResponse}
+// @Failure 400 {object} httperror.ErrResponse
+// @Failure 403 {object} httperror.ErrResponse
+// @Router /api/oauth/authorize [get]
+func (a *AuthHandler) GetOAuthConsent(w http.ResponseWriter, r *http.Request) {
+	claims, ok := a.oauthResourceOwner(w, r)
+	if !ok {
+		return
+	}
+
+	q := r.URL.Query()
+	req, ok := a.validateAuthorize(w, r, dtos.OAuthAuthorizeDTO{
+		ResponseType:        q.Get("response_type"),
+		ClientID:            q.Get("client_id"),
+		RedirectURI:         q.Get("redirect_uri"),
+		Scope:               q.Get("scope"),
+		State:               q.Get("state"),
+		CodeChallenge:       q.Get("code_challenge"),
+		CodeChallengeMethod: q.Get("code_challenge_method"),
+	})
+	if !ok {
+		return
+	}
+
+	consent := new(db.OAuthConsent)
+	err := a.app.DB().NewSelect().Model(consent).
+		Where("ocs.user_id = ?", claims.Sub).
+		Where("ocs.client_id = ?", req.client.ID).
+		Scan(r.Context())
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+
+	render.Render(w, r, httpresponse.WriteResponse(w, http.StatusOK, "success", OAuthConsentResponse{
+		ClientID:    req.client.ClientID,
+		ClientName:  req.client.Name,
+		RedirectURI: req.redirectURI,
+		Scopes:      req.scopes,
+		State:       req.state,
+		Granted:     err == nil && containsAll(consent.Scopes, req.scopes),
+	}))
+}
+
+// OAuthAuthorize implements handlers.AuthHandlerService.
+// @Summary Answer OAuth consent
+// @Description Approve or deny an authorization request. Answers with the redirect URL carrying the authorization code, or the access_denied error
+// @Tags OAuth
+// @Accept json
+// @Produce json
+// @Param request body dtos.OAuthAuthorizeDTO true "Authorization request and decision"
+// @Success 200 {object} httpresponse.SingleResponse{data=OAuthRedirectResponse}
+// @Failure 400 {object} httperror.ErrResponse
+// @Failure 403 {object} httperror.ErrResponse
+// @Router /api/oauth/authorize [post]
+func (a *AuthHandler) OAuthAuthorize(w http.ResponseWriter, r *http.Request) {
+	claims, ok := a.oauthResourceOwner(w, r)
+	if !ok {
+		return
+	}
+
+	var body dtos.OAuthAuthorizeDTO
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		render.Render(w, r, httperror.ErrInvalidRequest(err))
+		return
+	}
+	req, ok := a.validateAuthorize(w, r, body)
+	if !ok {
+		return
+	}
+
+	params := url.Values{}
+	if req.state != "" {
+		params.Set("state", req.state)
+	}
+	if !body.Approve {
+		params.Set("error", "access_denied")
+		render.Render(w, r, httpresponse.WriteResponse(w, http.StatusOK, "success", OAuthRedirectResponse{
+			RedirectURL: withQuery(req.redirectURI, params),
+		}))
+		return
+	}
+
+	code, err := utils.GenerateAuthorizationCode()
+	if err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+
+	now := a.app.Clock().Now()
+	_, err = a.app.DB().NewInsert().Model(&db.OAuthConsent{
+		UserID:    claims.Sub,
+		ClientID:  req.client.ID,
+		Scopes:    req.scopes,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}).
+		On("CONFLICT (user_id, client_id) DO UPDATE").
+		Set("scopes = EXCLUDED.scopes").
+		Set("updated_at = EXCLUDED.updated_at").
+		Exec(r.Context())
+	if err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+
+	_, err = a.app.DB().NewDelete().Model((*db.OAuthAuthorizationCode)(nil)).
+		Where("expires_at < ?", now).
+		Exec(r.Context())
+	if err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+	_, err = a.app.DB().NewInsert().Model(&db.OAuthAuthorizationCode{
+		CodeHash:      utils.HashSecret(code),
+		ClientID:      req.client.ID,
+		UserID:        claims.Sub,
+		RedirectURI:   req.redirectURI,
+		Scopes:        req.scopes,
+		CodeChallenge: req.codeChallenge,
+		ExpiresAt:     now.Add(authorizationCodeDuration),
+		CreatedAt:     now,
+	}).Exec(r.Context())
+	if err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+
+	params.Set("code", code)
+	render.Render(w, r, httpresponse.WriteResponse(w, http.StatusOK, "success", OAuthRedirectResponse{
+		RedirectURL: withQuery(req.redirectURI, params),
+	}))
+}
+
+// oauthResourceOwner returns the user answering an authorization request.
+// Guests cannot grant access to third parties.
+func (a *AuthHandler) oauthResourceOwner(w http.ResponseWriter, r *http.Request) (*JwtPayload, bool) {
+	claims, ok := currentUser(r)
+	if !ok {
+		render.Render(w, r, httperror.ErrUnAuthorized(errors.New("unauthorized")))
+		return nil, false
+	}
+	if claims.IsAnonymous {
+		render.Render(w, r, httperror.ErrForbidden(errors.New("guests cannot authorize applications, register first")))
+		return nil, false
+	}
+	return claims, true
+}
+
+// validateAuthorize checks the client, the redirect URI, the PKCE challenge
+// and the scopes of an authorization request.
+func (a *AuthHandler) validateAuthorize(w http.ResponseWriter, r *http.Request, req dtos.OAuthAuthorizeDTO) (*authorizeRequest, bool) {
+	client, err := a.findOAuthClient(r.Context(), req.ClientID)
+	if errors.Is(err, sql.ErrNoRows) {
+		render.Render(w, r, httperror.ErrInvalidRequest(errUnknownOAuthClient))
+		return nil, false
+	}
+	if err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return nil, false
+	}
+	if !slices.Contains(client.RedirectURIs, req.RedirectURI) {
+		render.Render(w, r, httperror.ErrInvalidRequest(errInvalidRedirectURI))
+		return nil, false
+	}
+
+	switch {
+	case req.ResponseType != "code":
+		err = errors.New("response_type must be code")
+	case !slices.Contains(client.GrantTypes, db.GrantAuthorizationCode):
+		err = errors.New("the client may not use the authorization code grant")
+	case req.CodeChallenge == "" || req.CodeChallengeMethod != "S256":
+		err = errors.New("a code_challenge with the S256 method is required")
+	}
+	if err != nil {
+		render.Render(w, r, httperror.ErrInvalidRequest(err))
+		return nil, false
+	}
+
+	scopes, err := requestedScopes(req.Scope, client.Scopes)
+	if err != nil {
+		render.Render(w, r, httperror.ErrInvalidRequest(err))
+		return nil, false
+	}
+	return &authorizeRequest{
+		client:        client,
+		redirectURI:   req.RedirectURI,
+		scopes:        scopes,
+		state:         req.State,
+		codeChallenge: req.CodeChallenge,
+	}, true
+}
+
+// OAuthToken implements handlers.AuthHandlerService.
+// @Summary OAuth token endpoint
+// @Description Exchange an authorization code (with the PKCE code_verifier), a refresh token or the client credentials for tokens. Clients authenticate with HTTP Basic or client_id and client_secret form fields; public clients only send client_id
+// @Tags OAuth
+// @Accept x-www-form-urlencoded
+// @Produce json
+// @Param grant_type formData string true "authorization_code, refresh_token or client_credentials"
+// @Param code formData string false "Authorization code"
+// @Param redirect_uri formData string false "Redirect URI of the authorization request"
+// @Param code_verifier formData string false "PKCE code verifier"
+// @Param refresh_token formData string false "Refresh token"
+// @Param scope formData string false "Space separated scopes"
+// @Success 200 {object} OAuthTokenResponse
+// @Failure 400 {object} OAuthError
+// @Failure 401 {object} OAuthError
+// @Router /api/oauth/token [post]
+func (a *AuthHandler) OAuthToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		oauthError(w, r, http.StatusBadRequest, "invalid_request", err)
+		return
+	}
+	grantType := r.PostForm.Get("grant_type")
+	if !slices.Contains(oauthGrantTypes, grantType) {
+		oauthError(w, r, http.StatusBadRequest, "unsupported_grant_type", nil)
+		return
+	}
+
+	client, ok := a.authenticateClient(w, r)
+	if !ok {
+		return
+	}
+	if !slices.Contains(client.GrantTypes, grantType) {
+		oauthError(w, r, http.StatusBadRequest, "unauthorized_client", errors.New("the client may not use this grant type"))
+		return
+	}
+
+	switch grantType {
+	case db.GrantAuthorizationCode:
+		a.authorizationCodeGrant(w, r, client)
+	case db.GrantRefreshToken:
+		a.refreshTokenGrant(w, r, client)
+	case db.GrantClientCredentials:
+		a.clientCredentialsGrant(w, r, client)
+	}
+}
+
+func (a *AuthHandler) authorizationCodeGrant(w http.ResponseWriter, r *http.Request, client *db.OAuthClient) {
+	code := r.PostForm.Get("code")
+	if code == "" {
+		oauthError(w, r, http.StatusBadRequest, "invalid_request", errors.New("code is required"))
+		return
+	}
+
+	// Codes are single-use, even when the exchange fails.
+	now := a.app.Clock().Now()
+	stored := new(db.OAuthAuthorizationCode)
+	err := a.app.DB().NewDelete().Model(stored).
+		Where("code_hash = ?", utils.HashSecret(code)).
+		Returning("*").
+		Scan(r.Context())
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && (stored.ClientID != client.ID || !now.Before(stored.ExpiresAt))) {
+		oauthError(w, r, http.StatusBadRequest, "invalid_grant", errInvalidGrant)
+		return
+	}
+	if err != nil {
+		oauthError(w, r, http.StatusInternalServerError, "server_error", err)
+		return
+	}
+	if stored.RedirectURI != r.PostForm.Get("redirect_uri") {
+		oauthError(w, r, http.StatusBadRequest, "invalid_grant", errors.New("redirect_uri does not match"))
+		return
+	}
+	challenge := oidc.CodeChallengeS256(r.PostForm.Get("code_verifier"))
+	if subtle.ConstantTimeCompare([]byte(challenge), []byte(stored.CodeChallenge)) != 1 {
+		oauthError(w, r, http.StatusBadRequest, "invalid_grant", errors.New("code_verifier does not match"))
+		return
+	}
+
+	user, ok := a.findGrantUser(w, r, stored.UserID)
+	if !ok {
+		return
+	}
+	a.issueClientTokens(w, r, client, user, stored.Scopes, true)
+}
+
+func (a *AuthHandler) refreshTokenGrant(w http.ResponseWriter, r *http.Request, client *db.OAuthClient) {
+	j := a.NewJWT()
+	claims, err := j.VerifyRefreshToken(r.PostForm.Get("refresh_token"))
+	if err != nil || claims.ClientID != client.ClientID {
+		oauthError(w, r, http.StatusBadRequest, "invalid_grant", errInvalidGrant)
+		return
+	}
+
+	stored := new(db.RefreshToken)
+	err = a.app.DB().NewSelect().Model(stored).Where("rt.jti = ?", claims.ID).Scan(r.Context())
+	if errors.Is(err, sql.ErrNoRows) {
+		oauthError(w, r, http.StatusBadRequest, "invalid_grant", errInvalidGrant)
+		return
+	}
+	if err != nil {
+		oauthError(w, r, http.StatusInternalServerError, "server_error", err)
+		return
+	}
+	if !stored.UsedAt.IsZero() {
+		a.rejectClientRefreshReuse(w, r, stored.FamilyID)
+		return
+	}
+
+	session := new(db.Session)
+	err = a.app.DB().NewSelect().Model(session).
+		Where("s.id = ?", stored.SessionID).
+		Where("s.oauth_client_id = ?", client.ID).
+		Where("s.revoked_at IS NULL").
+		Scan(r.Context())
+	if errors.Is(err, sql.ErrNoRows) {
+		oauthError(w, r, http.StatusBadRequest, "invalid_grant", errInvalidGrant)
+		return
+	}
+	if err != nil {
+		oauthError(w, r, http.StatusInternalServerError, "server_error", err)
+		return
+	}
+
+	user, ok := a.findGrantUser(w, r, session.UserID)
+	if !ok {
+		return
+	}
+
+	// The role of the user may have changed since the consent.
+	scopes := intersectScopes(session.Scopes, ScopesForRole(user.Role))
+	if scope := r.PostForm.Get("scope"); scope != "" {
+		requested, err := requestedScopes(scope, scopes)
+		if err != nil {
+			oauthError(w, r, http.StatusBadRequest, "invalid_scope", err)
+			return
+		}
+		scopes = requested
+	}
+	if len(scopes) == 0 {
+		oauthError(w, r, http.StatusBadRequest, "invalid_scope", errors.New("no scope left to grant"))
+		return
+	}
+
+	sub := NewTokenSubject(user)
+	sub.Scopes = scopes
+	sub.ClientID = client.ClientID
+	pair, err := j.GenerateTokenPair(sub, stored.FamilyID)
+	if err != nil {
+		oauthError(w, r, http.StatusInternalServerError, "server_error", err)
+		return
+	}
+
+	err = a.rotateSession(r.Context(), stored, session, pair)
+	if errors.Is(err, errRefreshTokenReused) {
+		a.rejectClientRefreshReuse(w, r, stored.FamilyID)
+		return
+	}
+	if err != nil {
+		oauthError(w, r, http.StatusInternalServerError, "server_error", err)
+		return
+	}
+
+	writeOAuthTokens(w, r, j, pair, scopes, true)
+}
+
+// rejectClientRefreshReuse revokes the session of a replayed refresh token,
+// like rejectRefreshReuse does for logins.
+func (a *AuthHandler) rejectClientRefreshReuse(w http.ResponseWriter, r *http.Request, familyID string) {
+	if err := a.revokeFamily(r.Context(), familyID); err != nil {
+		oauthError(w, r, http.StatusInternalServerError, "server_error", err)
+		return
+	}
+	oauthError(w, r, http.StatusBadRequest, "invalid_grant", errRefreshTokenReused)
+}
+
+// clientCredentialsGrant issues tokens acting as the owner of the client.
+// No refresh token is returned (RFC 6749 section 4.4.3), the client simply
+// asks again.
+func (a *AuthHandler) clientCredentialsGrant(w http.ResponseWriter, r *http.Request, client *db.OAuthClient) {
+	if !client.Confidential || client.OwnerID == 0 {
+		oauthError(w, r, http.StatusBadRequest, "unauthorized_client", errors.New("the client has no owner to act as"))
+		return
+	}
+	scopes, err := requestedScopes(r.PostForm.Get("scope"), client.Scopes)
+	if err != nil {
+		oauthError(w, r, http.StatusBadRequest, "invalid_scope", err)
+		return
+	}
+
+	owner, ok := a.findGrantUser(w, r, client.OwnerID)
+	if !ok {
+		return
+	}
+	a.issueClientTokens(w, r, client, owner, scopes, false)
+}
+
+// findGrantUser loads the user a grant acts for. Deleted users fail the
+// grant.
+func (a *AuthHandler) findGrantUser(w http.ResponseWriter, r *http.Request, userID int64) (*db.User, bool) {
+	user := new(db.User)
+	err := a.app.DB().NewSelect().Model(user).Where("id = ?", userID).Scan(r.Context())
+	if errors.Is(err, sql.ErrNoRows) {
+		oauthError(w, r, http.StatusBadRequest, "invalid_grant", errInvalidGrant)
+		return nil, false
+	}
+	if err != nil {
+		oauthError(w, r, http.StatusInternalServerError, "server_error", err)
+		return nil, false
+	}
+	return user, true
+}
+
+// issueClientTokens starts a session of client on behalf of user. The token
+// never grants more than the role of the user allows.
+func (a *AuthHandler) issueClientTokens(w http.ResponseWriter, r *http.Request, client *db.OAuthClient, user *db.User, scopes []string, withRefresh bool) {
+	sub := NewTokenSubject(user)
+	sub.Scopes = intersectScopes(scopes, sub.Scopes)
+	sub.ClientID = client.ClientID
+	if len(sub.Scopes) == 0 {
+		oauthError(w, r, http.StatusBadRequest, "invalid_scope", errors.New("no scope left to grant"))
+		return
+	}
+
+	j := a.NewJWT()
+	pair, err := j.GenerateTokenPair(sub, "")
+	if err != nil {
+		oauthError(w, r, http.StatusInternalServerError, "server_error", err)
+		return
+	}
+	session := &db.Session{
+		UserID:        user.ID,
+		Device:        client.Name,
+		IPAddress:     a.app.ClientIP(r),
+		UserAgent:     r.UserAgent(),
+		OAuthClientID: client.ID,
+		Scopes:        sub.Scopes,
+	}
+	if err := a.storeSession(r.Context(), session, pair); err != nil {
+		oauthError(w, r, http.StatusInternalServerError, "server_error", err)
+		return
+	}
+
+	writeOAuthTokens(w, r, j, pair, sub.Scopes, withRefresh)
+}
+
+func writeOAuthTokens(w http.ResponseWriter, r *http.Request, j *JWT, pair *TokenPair, scopes []string, withRefresh bool) {
+	resp := OAuthTokenResponse{
+		AccessToken: pair.AccessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(j.AccessTokenDuration() / time.Second),
+		Scope:       strings.Join(scopes, " "),
+	}
+	if withRefresh {
+		resp.RefreshToken = pair.RefreshToken
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	render.JSON(w, r, resp)
+}
+
+// IntrospectToken implements handlers.AuthHandlerService.
+// @Summary OAuth token introspection
+// @Description Tell whether an access or refresh token is active (RFC 7662). Clients can only introspect the tokens issued to them
+// @Tags OAuth
+// @Accept x-www-form-urlencoded
+// @Produce json
+// @Param token formData string true "Access or refresh token"
+// @Param token_type_hint formData string false "access_token or refresh_token"
+// @Success 200 {object} OAuthIntrospection
+// @Failure 400 {object} OAuthError
+// @Failure 401 {object} OAuthError
+// @Router /api/oauth/introspect [post]
+func (a *AuthHandler) IntrospectToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		oauthError(w, r, http.StatusBadRequest, "invalid_request", err)
+		return
+	}
+	client, ok := a.authenticateClient(w, r)
+	if !ok {
+		return
+	}
+	token := r.PostForm.Get("token")
+	if token == "" {
+		oauthError(w, r, http.StatusBadRequest, "invalid_request", errors.New("token is required"))
+		return
+	}
+
+	resp := OAuthIntrospection{}
+	claims, session, err := a.findClientSession(r.Context(), client, token)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		oauthError(w, r, http.StatusInternalServerError, "server_error", err)
+		return
+	}
+	if err == nil {
+		scopes := claims.Scopes
+		if claims.Type == TokenTypeRefresh {
+			scopes = session.Scopes
+		}
+		resp = OAuthIntrospection{
+			Active:   true,
+			Scope:    strings.Join(scopes, " "),
+			ClientID: client.ClientID,
+			Username: claims.Username,
+			Sub:      strconv.FormatInt(claims.Sub, 10),
+			Exp:      claims.Exp,
+			Iat:      claims.Iat,
+		}
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	render.JSON(w, r, resp)
+}
+
+// RevokeToken implements handlers.AuthHandlerService.
+// @Summary OAuth token revocation
+// @Description Revoke the session of an access or refresh token (RFC 7009). Unknown tokens are answered with 200 as well
+// @Tags OAuth
+// @Accept x-www-form-urlencoded
+// @Param token formData string true "Access or refresh token"
+// @Param token_type_hint formData string false "access_token or refresh_token"
+// @Success 200
+// @Failure 400 {object} OAuthError
+// @Failure 401 {object} OAuthError
+// @Router /api/oauth/revoke [post]
+func (a *AuthHandler) RevokeToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		oauthError(w, r, http.StatusBadRequest, "invalid_request", err)
+		return
+	}
+	client, ok := a.authenticateClient(w, r)
+	if !ok {
+		return
+	}
+	token := r.PostForm.Get("token")
+	if token == "" {
+		oauthError(w, r, http.StatusBadRequest, "invalid_request", errors.New("token is required"))
+		return
+	}
+
+	_, session, err := a.findClientSession(r.Context(), client, token)
+	if err == nil {
+		_, err = a.revokeSessions(r.Context(), session.UserID, session.ID)
+	}
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		oauthError(w, r, http.StatusInternalServerError, "server_error", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// findClientSession resolves an access or refresh token issued to client to
+// its active session. Tokens that are invalid, expired, rotated, revoked or
+// issued to another client return sql.ErrNoRows.
+func (a *AuthHandler) findClientSession(ctx context.Context, client *db.OAuthClient, token string) (*JwtPayload, *db.Session, error) {
+	j := a.NewJWT()
+	column := "s.access_token"
+	claims, err := j.VerifyAccessToken(token)
+	if err != nil {
+		column = "s.refresh_token"
+		claims, err = j.VerifyRefreshToken(token)
+	}
+	if err != nil || claims.ClientID != client.ClientID {
+		return nil, nil, sql.ErrNoRows
+	}
+
+	session := new(db.Session)
+	err = a.app.DB().NewSelect().Model(session).
+		Where(column+" = ?", token).
+		Where("s.oauth_client_id = ?", client.ID).
+		Where("s.revoked_at IS NULL").
+		Scan(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	return claims, session, nil
+}
+
+// authenticateClient authenticates the client of a token, introspection or
+// revocation request with HTTP Basic or the client_id and client_secret
+// form fields. Public clients only send their client_id.
+func (a *AuthHandler) authenticateClient(w http.ResponseWriter, r *http.Request) (*db.OAuthClient, bool) {
+	clientID, secret, basic := r.BasicAuth()
+	if basic {
+		// RFC 6749 section 2.3.1 form-encodes the credentials first.
+		clientID, _ = url.QueryUnescape(clientID)
+		secret, _ = url.QueryUnescape(secret)
+	} else {
+		clientID, secret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+
+	client, err := a.findOAuthClient(r.Context(), clientID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		oauthError(w, r, http.StatusInternalServerError, "server_error", err)
+		return nil, false
+	}
+	if err == nil && client.Confidential {
+		if subtle.ConstantTimeCompare([]byte(utils.HashSecret(secret)), []byte(client.SecretHash)) != 1 {
+			err = errInvalidClient
+		}
+	} else if err == nil && secret != "" {
+		err = errInvalidClient
+	}
+	if err != nil {
+		if basic {
+			w.Header().Set("WWW-Authenticate", `Basic realm="oauth"`)
+		}
+		oauthError(w, r, http.StatusUnauthorized, "invalid_client", errInvalidClient)
+		return nil, false
+	}
+	return client, true
+}
+
+// findOAuthClient loads a client that is not revoked by its client_id.
+func (a *AuthHandler) findOAuthClient(ctx context.Context, clientID string) (*db.OAuthClient, error) {
+	if clientID == "" {
+		return nil, sql.ErrNoRows
+	}
+	client := new(db.OAuthClient)
+	err := a.app.DB().NewSelect().Model(client).
+		Where("oc.client_id = ?", clientID).
+		Where("oc.revoked_at IS NULL").
+		Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+func oauthError(w http.ResponseWriter, r *http.Request, status int, code string, err error) {
+	resp := OAuthError{Error: code}
+	if err != nil {
+		resp.Description = err.Error()
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	render.Status(r, status)
+	render.JSON(w, r, resp)
+}
+
+// requestedScopes parses a space separated scope parameter. Every scope must
+// be in allowed, an empty parameter requests all of them.
+func requestedScopes(scope string, allowed []string) ([]string, error) {
+	scopes := strings.Fields(scope)
+	if len(scopes) == 0 {
+		return slices.Clone(allowed), nil
+	}
+	for _, s := range scopes {
+		if !slices.Contains(allowed, s) {
+			return nil, errors.New("scope " + s + " is not allowed")
+		}
+	}
+	return slices.Compact(slices.Sorted(slices.Values(scopes))), nil
+}
+
+// intersectScopes returns the scopes that are in both lists, in the order
+// of scopes.
+func intersectScopes(scopes, allowed []string) []string {
+	out := make([]string, 0, len(scopes))
+	for _, s := range scopes {
+		if slices.Contains(allowed, s) {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+func containsAll(granted, scopes []string) bool {
+	for _, s := range scopes {
+		if !slices.Contains(granted, s) {
+			return false
+		}
+	}
+	return true
+}
+
+// withQuery adds params to the query of a registered redirect URI.
+func withQuery(redirectURI string, params url.Values) string {
+	u, err := url.Parse(redirectURI)
+	if err != nil {
+		return redirectURI
+	}
+	q := u.Query()
+	for k, v := range params {
+		q[k] = v
+	}
+	u.RawQuery = q.Encode()
+	return u.String()
+}
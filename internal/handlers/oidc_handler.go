@@ -0,0 +1,481 @@
+package handlers
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	"todo-app/httputil/httperror"
+	"todo-app/httputil/httpresponse"
+	"todo-app/internal/db"
+	"todo-app/pkg/oidc"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+	"github.com/uptrace/bun"
+)
+
+// oidcStateDuration is how long the user has to complete the login at the
+// provider.
+const oidcStateDuration = 10 * time.Minute
+
+// oidcLinkCookie binds a link flow to the browser that started it. Without
+// it anyone could send their own authorization URL to a victim and get the
+// identity of the victim linked to their account.
+const oidcLinkCookie = "oidc_link"
+
+var (
+	errInvalidOIDCState = errors.New("invalid or expired login state, start the login again")
+	errUnboundOIDCLink  = errors.New("the link was started in another browser, start it again")
+	errLastLoginMethod  = errors.New("this is the only way to log in, set a password or link another identity first")
+)
+
+type OIDCAuthorizationResponse struct {
+	// AuthorizationURL is where to send the browser of the user.
+	AuthorizationURL string `json:"authorization_url"`
+}
+
+// GetOIDCProviders implements handlers.AuthHandlerService.
+// @Summary OpenID Connect providers
+// @Description Names of the configured OpenID Connect providers users can log in with
+// @Tags Auth
+// @Produce json
+// @Success 200 {object} httpresponse.SingleResponse{data=[]string}
+// @Router /api/auth/oidc/providers [get]
+func (a *AuthHandler) GetOIDCProviders(w http.ResponseWriter, r *http.Request) {
+	render.Render(w, r, httpresponse.WriteResponse(w, http.StatusOK, "success", a.app.OIDCProviderNames()))
+}
+
+// OIDCAuthorize implements handlers.AuthHandlerService.
+// @Summary Start OpenID Connect login
+// @Description Start the authorization code flow with PKCE. Send the user to the returned URL, the provider redirects back to the callback
+// @Tags Auth
+// @Produce json
+// @Param provider path string true "Provider name"
+// @Success 200 {object} httpresponse.SingleResponse{data=OIDCAuthorizationResponse}
+// @Failure 404 {object} httperror.ErrResponse
+// @Failure 503 {object} httperror.ErrResponse
+// @Router /api/auth/oidc/{provider}/authorize [get]
+func (a *AuthHandler) OIDCAuthorize(w http.ResponseWriter, r *http.Request) {
+	a.startOIDC(w, r, 0)
+}
+
+// LinkIdentity implements handlers.AuthHandlerService.
+// @Summary Link identity
+// @Description Start the authorization code flow to link an account at the provider to the current user. The callback answers with the linked identity. The flow is bound to the browser with a cookie, open the URL in the browser that sent this request
+// @Tags Auth
+// @Produce json
+// @Param provider path string true "Provider name"
+// @Success 200 {object} httpresponse.SingleResponse{data=OIDCAuthorizationResponse}
+// @Failure 403 {object} httperror.ErrResponse
+// @Failure 404 {object} httperror.ErrResponse
+// @Router /api/auth/identities/{provider} [post]
+func (a *AuthHandler) LinkIdentity(w http.ResponseWriter, r *http.Request) {
+	claims, ok := currentUser(r)
+	if !ok {
+		render.Render(w, r, httperror.ErrUnAuthorized(errors.New("unauthorized")))
+		return
+	}
+	if claims.IsAnonymous {
+		render.Render(w, r, httperror.ErrForbidden(errors.New("guests cannot link identities, register first")))
+		return
+	}
+
+	a.startOIDC(w, r, claims.Sub)
+}
+
+// startOIDC remembers a new authorization request and answers with the URL
+// of the provider. userID is set when linking an identity.
+func (a *AuthHandler) startOIDC(w http.ResponseWriter, r *http.Request, userID int64) {
+	name := chi.URLParam(r, "provider")
+	provider, ok := a.app.OIDCProvider(name)
+	if !ok {
+		render.Render(w, r, httperror.ErrNotFound())
+		return
+	}
+
+	state, err := oidc.RandomString(24)
+	if err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+	nonce, err := oidc.RandomString(24)
+	if err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+	verifier, err := oidc.NewCodeVerifier()
+	if err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+
+	authURL, err := provider.AuthCodeURL(r.Context(), state, nonce, oidc.CodeChallengeS256(verifier))
+	if err != nil {
+		render.Render(w, r, httperror.ErrServiceUnavailable(err))
+		return
+	}
+
+	now := a.app.Clock().Now()
+	// Abandoned logins are cleaned up as new ones start.
+	_, err = a.app.DB().NewDelete().Model((*db.OIDCState)(nil)).
+		Where("expires_at < ?", now).
+		Exec(r.Context())
+	if err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+	_, err = a.app.DB().NewInsert().Model(&db.OIDCState{
+		State:        state,
+		Provider:     name,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		UserID:       userID,
+		ExpiresAt:    now.Add(oidcStateDuration),
+		CreatedAt:    now,
+	}).Exec(r.Context())
+	if err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+
+	if userID != 0 {
+		http.SetCookie(w, &http.Cookie{
+			Name:     oidcLinkCookie,
+			Value:    state,
+			Path:     "/api/auth/oidc",
+			MaxAge:   int(oidcStateDuration.Seconds()),
+			HttpOnly: true,
+			Secure:   true,
+			SameSite: http.SameSiteLaxMode,
+		})
+	}
+	render.Render(w, r, httpresponse.WriteResponse(w, http.StatusOK, "success", OIDCAuthorizationResponse{
+		AuthorizationURL: authURL,
+	}))
+}
+
+// OIDCCallback implements handlers.AuthHandlerService.
+// @Summary OpenID Connect callback
+// @Description The provider redirects here with the code. Logs the user in, creating an account on the first login, or links the identity when the flow was started by LinkIdentity. Users with MFA get the mfa challenge like with the password login
+// @Tags Auth
+// @Produce json
+// @Param provider path string true "Provider name"
+// @Param code query string true "Authorization code"
+// @Param state query string true "State of the authorization request"
+// @Success 200 {object} httpresponse.SingleResponse{data=TokenResponse}
+// @Success 201 {object} httpresponse.SingleResponse{data=db.UserIdentity}
+// @Failure 400 {object} httperror.ErrResponse
+// @Failure 401 {object} httperror.ErrResponse
+// @Router /api/auth/oidc/{provider}/callback [get]
+func (a *AuthHandler) OIDCCallback(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "provider")
+	provider, ok := a.app.OIDCProvider(name)
+	if !ok {
+		render.Render(w, r, httperror.ErrNotFound())
+		return
+	}
+
+	q := r.URL.Query()
+	if e := q.Get("error"); e != "" {
+		render.Render(w, r, httperror.ErrBadRequest(fmt.Errorf("login was refused by the provider: %s %s", e, q.Get("error_description"))))
+		return
+	}
+	code, state := q.Get("code"), q.Get("state")
+	if code == "" || state == "" {
+		render.Render(w, r, httperror.ErrInvalidRequest(errors.New("code and state are required")))
+		return
+	}
+
+	// The state is single-use.
+	now := a.app.Clock().Now()
+	stored := new(db.OIDCState)
+	err := a.app.DB().NewDelete().Model(stored).
+		Where("state = ?", state).
+		Where("provider = ?", name).
+		Returning("*").
+		Scan(r.Context())
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && !now.Before(stored.ExpiresAt)) {
+		render.Render(w, r, httperror.ErrBadRequest(errInvalidOIDCState))
+		return
+	}
+	if err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+	if stored.UserID != 0 {
+		if !linkStartedHere(r, stored.State) {
+			render.Render(w, r, httperror.ErrBadRequest(errUnboundOIDCLink))
+			return
+		}
+		http.SetCookie(w, &http.Cookie{Name: oidcLinkCookie, Path: "/api/auth/oidc", MaxAge: -1})
+	}
+
+	tokens, err := provider.Exchange(r.Context(), code, stored.CodeVerifier)
+	if err != nil {
+		render.Render(w, r, httperror.ErrUnAuthorized(err))
+		return
+	}
+	claims, err := provider.VerifyIDToken(r.Context(), tokens.IDToken, stored.Nonce, now)
+	if err != nil {
+		render.Render(w, r, httperror.ErrUnAuthorized(err))
+		return
+	}
+
+	if stored.UserID != 0 {
+		a.linkIdentity(w, r, stored.UserID, name, claims)
+		return
+	}
+
+	identity := new(db.UserIdentity)
+	err = a.app.DB().NewSelect().Model(identity).
+		Where("ui.provider = ?", name).
+		Where("ui.subject = ?", claims.Subject).
+		Scan(r.Context())
+	if errors.Is(err, sql.ErrNoRows) {
+		a.registerIdentity(w, r, name, claims)
+		return
+	}
+	if err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+
+	user := new(db.User)
+	err = a.app.DB().NewSelect().Model(user).Where("id = ?", identity.UserID).Scan(r.Context())
+	if errors.Is(err, sql.ErrNoRows) {
+		render.Render(w, r, httperror.ErrUnAuthorized(errors.New("the account of this identity no longer exists")))
+		return
+	}
+	if err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+
+	_, err = a.app.DB().NewUpdate().Model(identity).
+		Set("last_login_at = ?", now).
+		Set("email = ?", claims.Email).
+		WherePK().
+		Exec(r.Context())
+	if err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+
+	a.completeLogin(w, r, user, "")
+}
+
+// linkStartedHere reports whether the browser of the callback request is
+// the one that started the link flow with state.
+func linkStartedHere(r *http.Request, state string) bool {
+	cookie, err := r.Cookie(oidcLinkCookie)
+	return err == nil && subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(state)) == 1
+}
+
+// linkIdentity links the identity to the user that started the flow.
+func (a *AuthHandler) linkIdentity(w http.ResponseWriter, r *http.Request, userID int64, provider string, claims *oidc.Claims) {
+	identity := &db.UserIdentity{
+		UserID:    userID,
+		Provider:  provider,
+		Subject:   claims.Subject,
+		Email:     claims.Email,
+		CreatedAt: a.app.Clock().Now(),
+	}
+	_, err := a.app.DB().NewInsert().Model(identity).Exec(r.Context())
+	if isUniqueViolation(err) {
+		render.Render(w, r, httperror.ErrBadRequest(errors.New("this identity or another one of the same provider is already linked")))
+		return
+	}
+	if err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+
+	render.Render(w, r, httpresponse.WriteResponse(w, http.StatusCreated, "success", identity))
+}
+
+// registerIdentity creates an account without password for the first login
+// with an identity. An existing account is never taken over by email, users
+// link identities to it themselves.
+func (a *AuthHandler) registerIdentity(w http.ResponseWriter, r *http.Request, provider string, claims *oidc.Claims) {
+	now := a.app.Clock().Now()
+	username, err := a.availableUsername(r.Context(), claims)
+	if err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+
+	user := &db.User{Username: username}
+	if claims.EmailVerified && claims.Email != "" {
+		if email, err := normalizeEmail(claims.Email); err == nil {
+			taken, err := a.app.DB().NewSelect().Model((*db.User)(nil)).WhereAllWithDeleted().Where("lower(email) = ?", email).Exists(r.Context())
+			if err != nil {
+				render.Render(w, r, httperror.ErrInternalError(err))
+				return
+			}
+			if !taken {
+				user.Email = email
+				user.EmailVerifiedAt = now
+			}
+		}
+	}
+
+	err = a.app.DB().RunInTx(r.Context(), nil, func(ctx context.Context, tx bun.Tx) error {
+		if _, err := tx.NewInsert().Model(user).Returning("*").Exec(ctx); err != nil {
+			return err
+		}
+		_, err := tx.NewInsert().Model(&db.UserIdentity{
+			UserID:      user.ID,
+			Provider:    provider,
+			Subject:     claims.Subject,
+			Email:       claims.Email,
+			LastLoginAt: now,
+			CreatedAt:   now,
+		}).Exec(ctx)
+		return err
+	})
+	if err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+
+	a.issueLoginTokens(w, r, user, "")
+}
+
+// availableUsername derives a username from the claims, adding a random
+// suffix when it is taken.
+func (a *AuthHandler) availableUsername(ctx context.Context, claims *oidc.Claims) (string, error) {
+	base := claims.PreferredUsername
+	if base == "" {
+		base, _, _ = strings.Cut(claims.Email, "@")
+	}
+	base = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '.', r == '_', r == '-':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r + 'a' - 'A'
+		}
+		return -1
+	}, base)
+	if len(base) > 32 {
+		base = base[:32]
+	}
+	if base == "" || strings.HasPrefix(base, "guest_") {
+		base = "user"
+	}
+
+	username := base
+	for i := 0; ; i++ {
+		exists, err := a.app.DB().NewSelect().Model((*db.User)(nil)).
+			WhereAllWithDeleted().
+			Where("username = ?", username).
+			Exists(ctx)
+		if err != nil {
+			return "", err
+		}
+		if !exists {
+			return username, nil
+		}
+		if i == 5 {
+			return "", errors.New("could not find a free username")
+		}
+		suffix, err := randomHex(3)
+		if err != nil {
+			return "", err
+		}
+		username = base + "_" + suffix
+	}
+}
+
+// GetIdentities implements handlers.AuthHandlerService.
+// @Summary List linked identities
+// @Description List the OpenID Connect identities linked to the current user
+// @Tags Auth
+// @Produce json
+// @Success 200 {object} httpresponse.CollectionResponse{data=[]db.UserIdentity}
+// @Failure 401 {object} httperror.ErrResponse
+// @Router /api/auth/identities [get]
+func (a *AuthHandler) GetIdentities(w http.ResponseWriter, r *http.Request) {
+	claims, ok := currentUser(r)
+	if !ok {
+		render.Render(w, r, httperror.ErrUnAuthorized(errors.New("unauthorized")))
+		return
+	}
+
+	identities := make([]*db.UserIdentity, 0)
+	total, err := a.app.DB().NewSelect().Model(&identities).
+		Where("ui.user_id = ?", claims.Sub).
+		Order("ui.id ASC").
+		ScanAndCount(r.Context())
+	if err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+
+	render.Render(w, r, httpresponse.WriteCollectionResponse(w, http.StatusOK, "success", identities, total))
+}
+
+// UnlinkIdentity implements handlers.AuthHandlerService.
+// @Summary Unlink identity
+// @Description Unlink an identity from the current user. The last way to log in cannot be removed, accounts without password keep at least one identity
+// @Tags Auth
+// @Produce json
+// @Param id path int true "Identity ID"
+// @Success 200 {object} httpresponse.SingleResponse
+// @Failure 400 {object} httperror.ErrResponse
+// @Failure 404 {object} httperror.ErrResponse
+// @Router /api/auth/identities/{id} [delete]
+func (a *AuthHandler) UnlinkIdentity(w http.ResponseWriter, r *http.Request) {
+	user, ok := a.findCurrentUser(w, r)
+	if !ok {
+		return
+	}
+	id, err := parseIDParam(r, "id")
+	if err != nil {
+		render.Render(w, r, httperror.ErrInvalidRequest(err))
+		return
+	}
+
+	err = a.app.DB().RunInTx(r.Context(), nil, func(ctx context.Context, tx bun.Tx) error {
+		res, err := tx.NewDelete().Model((*db.UserIdentity)(nil)).
+			Where("id = ?", id).
+			Where("user_id = ?", user.ID).
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return sql.ErrNoRows
+		}
+		if user.HasPassword() {
+			return nil
+		}
+		left, err := tx.NewSelect().Model((*db.UserIdentity)(nil)).Where("user_id = ?", user.ID).Count(ctx)
+		if err != nil {
+			return err
+		}
+		if left == 0 {
+			return errLastLoginMethod
+		}
+		return nil
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		render.Render(w, r, httperror.ErrNotFound())
+		return
+	}
+	if errors.Is(err, errLastLoginMethod) {
+		render.Render(w, r, httperror.ErrBadRequest(err))
+		return
+	}
+	if err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+
+	render.Render(w, r, httpresponse.WriteResponse(w, http.StatusOK, "success", nil))
+}
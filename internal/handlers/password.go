@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"todo-app/httputil/httperror"
+	"todo-app/internal/db"
+
+	"github.com/go-chi/render"
+	log "github.com/sirupsen/logrus"
+)
+
+// hashNewPassword checks a password chosen by the user against the policy
+// and hashes it. It renders the error itself.
+func (a *AuthHandler) hashNewPassword(w http.ResponseWriter, r *http.Request, username, password string) (string, bool) {
+	policy, err := a.app.PasswordPolicy()
+	if err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return "", false
+	}
+	if err := policy.Validate(username, password); err != nil {
+		render.Render(w, r, httperror.ErrInvalidRequest(err))
+		return "", false
+	}
+
+	passwordHash, err := a.app.PasswordHasher().Hash(password)
+	if err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return "", false
+	}
+	return passwordHash, true
+}
+
+// rehashPassword upgrades the stored hash after a successful login when it
+// was made with another algorithm or other parameters than configured.
+func (a *AuthHandler) rehashPassword(ctx context.Context, user *db.User, password string) {
+	hasher := a.app.PasswordHasher()
+	if !hasher.NeedsRehash(user.PasswordHash) {
+		return
+	}
+
+	passwordHash, err := hasher.Hash(password)
+	if err == nil {
+		// Leave the hash alone if the password changed meanwhile.
+		_, err = a.app.DB().NewUpdate().Model((*db.User)(nil)).
+			Set("password = ?", passwordHash).
+			Where("id = ?", user.ID).
+			Where("password = ?", user.PasswordHash).
+			Exec(ctx)
+	}
+	if err != nil {
+		log.WithError(err).WithField("user_id", user.ID).Error("failed to rehash password")
+		return
+	}
+	user.PasswordHash = passwordHash
+}
@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"todo-app/httputil/httperror"
+
+	"github.com/go-chi/render"
+)
+
+// RequireScope only lets requests through whose token grants scope. It has
+// to run after the Authorization middleware.
+func RequireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := currentUser(r)
+			if !ok {
+				render.Render(w, r, httperror.ErrUnAuthorized(errors.New("unauthorized")))
+				return
+			}
+			if !claims.HasScope(scope) {
+				render.Render(w, r, httperror.ErrForbiddenCode(errors.New("missing scope "+scope), httperror.CodeInsufficientScope))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireRole only lets requests through from users with role. It has to
+// run after the Authorization middleware.
+func RequireRole(role string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := currentUser(r)
+			if !ok {
+				render.Render(w, r, httperror.ErrUnAuthorized(errors.New("unauthorized")))
+				return
+			}
+			if !claims.HasRole(role) {
+				render.Render(w, r, httperror.ErrForbiddenCode(errors.New("requires role "+role), httperror.CodeInsufficientRole))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
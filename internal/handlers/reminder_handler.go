@@ -0,0 +1,412 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+	"todo-app/httputil/httperror"
+	"todo-app/httputil/httpresponse"
+	"todo-app/internal/db"
+	"todo-app/internal/dtos"
+
+	"github.com/go-chi/render"
+	"github.com/uptrace/bun"
+)
+
+// maxRemindersPerTodo bounds the reminders a user sets on one todo.
+const maxRemindersPerTodo = 10
+
+// CreateReminder implements handlers.TodoHandlerService.
+// @Summary Create reminder
+// @Description Remind the current user of a todo at remind_at or minutes_before it is due, through the webhook, email or inbox channel. Reminders before the due date follow the todo when it is rescheduled and are copied to the next occurrence of a recurring todo
+// @Tags Todo
+// @Accept json
+// @Produce json
+// @Param id path int true "Todo ID"
+// @Param request body dtos.CreateReminderDTO true "Create reminder request body"
+// @Success 201 {object} httpresponse.SingleResponse{data=db.Reminder}
+// @Failure 400 {object} httperror.ErrResponse
+// @Failure 403 {object} httperror.ErrResponse
+// @Failure 404 {object} httperror.ErrResponse
+// @Router /api/todo/{id}/reminders [post]
+func (t *TodoHandler) CreateReminder(w http.ResponseWriter, r *http.Request) {
+	var req dtos.CreateReminderDTO
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		render.Render(w, r, httperror.ErrInvalidRequest(err))
+		return
+	}
+	reminder, err := t.parseReminder(req)
+	if err != nil {
+		render.Render(w, r, httperror.ErrInvalidRequest(err))
+		return
+	}
+
+	todo, ok := t.findTodo(w, r, db.ListRoleViewer)
+	if !ok {
+		return
+	}
+	claims, _ := currentUser(r)
+
+	count, err := t.app.DB().NewSelect().Model((*db.Reminder)(nil)).
+		Where("todo_id = ?", todo.ID).
+		Where("user_id = ?", claims.Sub).
+		Count(r.Context())
+	if err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+	if count >= maxRemindersPerTodo {
+		render.Render(w, r, httperror.ErrInvalidRequest(errors.New("too many reminders on this todo")))
+		return
+	}
+
+	loc, err := t.userLocation(r.Context(), claims.Sub)
+	if err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+	reminder.TodoID = todo.ID
+	reminder.UserID = claims.Sub
+	reminder.FireAt = ReminderFireAt(todo, reminder, loc)
+
+	_, err = t.app.DB().NewInsert().Model(reminder).Returning("*").Exec(r.Context())
+	if err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+
+	render.Render(w, r, httpresponse.WriteResponse(w, http.StatusCreated, "success", reminder))
+}
+
+// parseReminder validates req. The time of absolute reminders must be in
+// the future.
+func (t *TodoHandler) parseReminder(req dtos.CreateReminderDTO) (*db.Reminder, error) {
+	reminder := &db.Reminder{Channels: req.Channels}
+	switch {
+	case (req.RemindAt == nil) == (req.MinutesBefore == nil):
+		return nil, errors.New("either remind_at or minutes_before is required")
+	case req.RemindAt != nil:
+		at, err := time.Parse(time.RFC3339, *req.RemindAt)
+		if err != nil {
+			return nil, errors.New("invalid remind_at, expected RFC3339 timestamp")
+		}
+		if !at.After(t.app.Clock().Now()) {
+			return nil, errors.New("remind_at must be in the future")
+		}
+		reminder.RemindAt = at
+	default:
+		// A week covers reminders for todos that are due next week.
+		if *req.MinutesBefore < 0 || *req.MinutesBefore > 7*24*60 {
+			return nil, errors.New("minutes_before must be between 0 and 10080")
+		}
+		offset := int64(*req.MinutesBefore) * 60
+		reminder.OffsetSeconds = &offset
+	}
+
+	if len(reminder.Channels) == 0 {
+		reminder.Channels = []string{db.ReminderChannelInbox}
+	}
+	seen := make(map[string]bool, len(reminder.Channels))
+	for _, channel := range reminder.Channels {
+		switch channel {
+		case db.ReminderChannelEmail, db.ReminderChannelInbox:
+		case db.ReminderChannelWebhook:
+			if t.app.Config().Reminders.WebhookURL == "" {
+				return nil, errors.New("the webhook channel is not configured")
+			}
+		default:
+			return nil, errors.New("channels must be webhook, email or inbox")
+		}
+		if seen[channel] {
+			return nil, errors.New("channels must not repeat")
+		}
+		seen[channel] = true
+	}
+	return reminder, nil
+}
+
+// GetReminders implements handlers.TodoHandlerService.
+// @Summary List reminders
+// @Description List the reminders the current user set on a todo, with the state of their deliveries
+// @Tags Todo
+// @Produce json
+// @Param id path int true "Todo ID"
+// @Success 200 {object} httpresponse.CollectionResponse{data=[]db.Reminder}
+// @Failure 403 {object} httperror.ErrResponse
+// @Failure 404 {object} httperror.ErrResponse
+// @Router /api/todo/{id}/reminders [get]
+func (t *TodoHandler) GetReminders(w http.ResponseWriter, r *http.Request) {
+	todo, ok := t.findTodo(w, r, db.ListRoleViewer)
+	if !ok {
+		return
+	}
+	claims, _ := currentUser(r)
+
+	reminders := make([]*db.Reminder, 0)
+	total, err := t.app.DB().NewSelect().Model(&reminders).
+		Relation("Deliveries").
+		Where("rm.todo_id = ?", todo.ID).
+		Where("rm.user_id = ?", claims.Sub).
+		Order("rm.id").
+		ScanAndCount(r.Context())
+	if err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+
+	render.Render(w, r, httpresponse.WriteCollectionResponse(w, http.StatusOK, "success", reminders, total))
+}
+
+// DeleteReminder implements handlers.TodoHandlerService.
+// @Summary Delete reminder
+// @Description Delete a reminder of the current user, deliveries that are still pending are dropped
+// @Tags Todo
+// @Produce json
+// @Param id path int true "Todo ID"
+// @Param reminderID path int true "Reminder ID"
+// @Success 200 {object} httpresponse.SingleResponse
+// @Failure 403 {object} httperror.ErrResponse
+// @Failure 404 {object} httperror.ErrResponse
+// @Router /api/todo/{id}/reminders/{reminderID} [delete]
+func (t *TodoHandler) DeleteReminder(w http.ResponseWriter, r *http.Request) {
+	todo, ok := t.findTodo(w, r, db.ListRoleViewer)
+	if !ok {
+		return
+	}
+	claims, _ := currentUser(r)
+	id, err := parseIDParam(r, "reminderID")
+	if err != nil {
+		render.Render(w, r, httperror.ErrInvalidRequest(err))
+		return
+	}
+
+	res, err := t.app.DB().NewDelete().Model((*db.Reminder)(nil)).
+		Where("id = ?", id).
+		Where("todo_id = ?", todo.ID).
+		Where("user_id = ?", claims.Sub).
+		Exec(r.Context())
+	if err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		render.Render(w, r, httperror.ErrNotFound())
+		return
+	}
+
+	render.Render(w, r, httpresponse.WriteResponse(w, http.StatusOK, "success", nil))
+}
+
+// ReminderFireAt returns when reminder fires for todo, zero when it is
+// relative to a due date the todo does not have. loc is the timezone of
+// the user, all-day todos are due at the start of the day there.
+func ReminderFireAt(todo *db.Todo, reminder *db.Reminder, loc *time.Location) time.Time {
+	if reminder.OffsetSeconds == nil {
+		return reminder.RemindAt
+	}
+	due := todo.Due(loc)
+	if due.IsZero() {
+		return time.Time{}
+	}
+	return due.Add(-time.Duration(*reminder.OffsetSeconds) * time.Second)
+}
+
+// rescheduleReminders moves the reminders before the due date of todo with
+// it. A reminder that fired already fires again when it moves to the
+// future.
+func (t *TodoHandler) rescheduleReminders(ctx context.Context, tx bun.Tx, todo *db.Todo) error {
+	reminders, err := t.offsetReminders(ctx, tx, todo)
+	if err != nil {
+		return err
+	}
+
+	now := t.app.Clock().Now()
+	locations := map[int64]*time.Location{}
+	for _, reminder := range reminders {
+		loc, err := t.reminderLocation(ctx, locations, reminder.UserID)
+		if err != nil {
+			return err
+		}
+		fireAt := ReminderFireAt(todo, reminder, loc)
+		if fireAt.Equal(reminder.FireAt) {
+			continue
+		}
+
+		reminder.FireAt = fireAt
+		columns := []string{"fire_at"}
+		if !reminder.FiredAt.IsZero() && fireAt.After(now) {
+			_, err := tx.NewDelete().Model((*db.ReminderDelivery)(nil)).
+				Where("reminder_id = ?", reminder.ID).
+				Where("status <> ?", db.DeliveryPending).
+				Exec(ctx)
+			if err != nil {
+				return err
+			}
+			reminder.FiredAt = time.Time{}
+			columns = append(columns, "fired_at")
+		}
+		if _, err := tx.NewUpdate().Model(reminder).Column(columns...).WherePK().Exec(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyReminders sets the reminders before the due date of todo on next, the
+// occurrence of a recurring todo that follows it.
+func (t *TodoHandler) copyReminders(ctx context.Context, tx bun.Tx, todo, next *db.Todo) error {
+	reminders, err := t.offsetReminders(ctx, tx, todo)
+	if err != nil || len(reminders) == 0 {
+		return err
+	}
+
+	locations := map[int64]*time.Location{}
+	copies := make([]*db.Reminder, len(reminders))
+	for i, reminder := range reminders {
+		loc, err := t.reminderLocation(ctx, locations, reminder.UserID)
+		if err != nil {
+			return err
+		}
+		copies[i] = &db.Reminder{
+			TodoID:        next.ID,
+			UserID:        reminder.UserID,
+			OffsetSeconds: reminder.OffsetSeconds,
+			Channels:      reminder.Channels,
+		}
+		copies[i].FireAt = ReminderFireAt(next, copies[i], loc)
+	}
+	_, err = tx.NewInsert().Model(&copies).Exec(ctx)
+	return err
+}
+
+// offsetReminders returns the reminders of all users before the due date of
+// todo.
+func (t *TodoHandler) offsetReminders(ctx context.Context, tx bun.Tx, todo *db.Todo) ([]*db.Reminder, error) {
+	var reminders []*db.Reminder
+	err := tx.NewSelect().Model(&reminders).
+		Where("rm.todo_id = ?", todo.ID).
+		Where("rm.offset_seconds IS NOT NULL").
+		Order("rm.id").
+		Scan(ctx)
+	return reminders, err
+}
+
+// reminderLocation returns the timezone of the user, looked up once per
+// user in locations.
+func (t *TodoHandler) reminderLocation(ctx context.Context, locations map[int64]*time.Location, userID int64) (*time.Location, error) {
+	if loc, ok := locations[userID]; ok {
+		return loc, nil
+	}
+	loc, err := t.userLocation(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	locations[userID] = loc
+	return loc, nil
+}
+
+// GetInbox implements handlers.AuthHandlerService.
+// @Summary List inbox
+// @Description List the in-app notifications of the current user, newest first
+// @Tags Account
+// @Produce json
+// @Param unread query bool false "Only unread notifications"
+// @Param limit query int false "Page size, at most 100"
+// @Param offset query int false "Offset pagination"
+// @Success 200 {object} httpresponse.CollectionResponse{data=[]db.InboxItem}
+// @Failure 401 {object} httperror.ErrResponse
+// @Router /api/me/inbox [get]
+func (a *AuthHandler) GetInbox(w http.ResponseWriter, r *http.Request) {
+	claims, ok := currentUser(r)
+	if !ok {
+		render.Render(w, r, httperror.ErrUnAuthorized(errors.New("unauthorized")))
+		return
+	}
+	limit, offset, err := parsePage(r)
+	if err != nil {
+		render.Render(w, r, httperror.ErrInvalidRequest(err))
+		return
+	}
+
+	items := make([]*db.InboxItem, 0)
+	q := a.app.DB().NewSelect().Model(&items).
+		Where("ib.user_id = ?", claims.Sub).
+		Order("ib.id DESC").
+		Limit(limit).
+		Offset(offset)
+	if r.URL.Query().Get("unread") == "true" {
+		q = q.Where("ib.read_at IS NULL")
+	}
+	total, err := q.ScanAndCount(r.Context())
+	if err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+
+	render.Render(w, r, httpresponse.WriteCollectionResponse(w, http.StatusOK, "success", items, total))
+}
+
+// ReadInboxItem implements handlers.AuthHandlerService.
+// @Summary Mark inbox item read
+// @Description Mark an in-app notification of the current user as read
+// @Tags Account
+// @Produce json
+// @Param id path int true "Inbox item ID"
+// @Success 200 {object} httpresponse.SingleResponse{data=db.InboxItem}
+// @Failure 401 {object} httperror.ErrResponse
+// @Failure 404 {object} httperror.ErrResponse
+// @Router /api/me/inbox/{id}/read [post]
+func (a *AuthHandler) ReadInboxItem(w http.ResponseWriter, r *http.Request) {
+	claims, ok := currentUser(r)
+	if !ok {
+		render.Render(w, r, httperror.ErrUnAuthorized(errors.New("unauthorized")))
+		return
+	}
+	id, err := parseIDParam(r, "id")
+	if err != nil {
+		render.Render(w, r, httperror.ErrInvalidRequest(err))
+		return
+	}
+
+	item := new(db.InboxItem)
+	err = a.app.DB().NewUpdate().Model(item).
+		Set("read_at = COALESCE(read_at, ?)", a.app.Clock().Now()).
+		Where("id = ?", id).
+		Where("user_id = ?", claims.Sub).
+		Returning("*").
+		Scan(r.Context())
+	if errors.Is(err, sql.ErrNoRows) {
+		render.Render(w, r, httperror.ErrNotFound())
+		return
+	}
+	if err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+
+	render.Render(w, r, httpresponse.WriteResponse(w, http.StatusOK, "success", item))
+}
+
+// parsePage parses the limit and offset query params of a page.
+func parsePage(r *http.Request) (limit, offset int, err error) {
+	query := r.URL.Query()
+	limit = defaultTodoPageSize
+	if v := query.Get("limit"); v != "" {
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit <= 0 {
+			return 0, 0, errors.New("invalid limit")
+		}
+		limit = min(limit, maxTodoPageSize)
+	}
+	if v := query.Get("offset"); v != "" {
+		offset, err = strconv.Atoi(v)
+		if err != nil || offset < 0 {
+			return 0, 0, errors.New("invalid offset")
+		}
+	}
+	return limit, offset, nil
+}
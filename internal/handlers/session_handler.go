@@ -0,0 +1,277 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"todo-app/httputil/httperror"
+	"todo-app/httputil/httpresponse"
+	"todo-app/internal/db"
+
+	"github.com/go-chi/render"
+	"github.com/uptrace/bun"
+)
+
+// createSession stores a new session for a freshly issued token pair. The
+// session is the refresh token family of the pair.
+func (a *AuthHandler) createSession(r *http.Request, userID int64, device string, pair *TokenPair) (*db.Session, error) {
+	session := &db.Session{
+		UserID:    userID,
+		Device:    device,
+		IPAddress: a.app.ClientIP(r),
+		UserAgent: r.UserAgent(),
+	}
+	if err := a.storeSession(r.Context(), session, pair); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// storeSession inserts session for pair together with the first refresh
+// token of its family.
+func (a *AuthHandler) storeSession(ctx context.Context, session *db.Session, pair *TokenPair) error {
+	session.AccessToken = pair.AccessToken
+	session.RefreshToken = pair.RefreshToken
+	session.FamilyID = pair.FamilyID
+	session.LastUsedAt = a.app.Clock().Now()
+	session.ExpiresAt = pair.RefreshExpiresAt
+
+	return a.app.DB().RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		if _, err := tx.NewInsert().Model(session).Returning("*").Exec(ctx); err != nil {
+			return err
+		}
+		_, err := tx.NewInsert().Model(&db.RefreshToken{
+			JTI:       pair.RefreshID,
+			FamilyID:  pair.FamilyID,
+			SessionID: session.ID,
+			UserID:    session.UserID,
+			ExpiresAt: pair.RefreshExpiresAt,
+		}).Exec(ctx)
+		return err
+	})
+}
+
+// rotateSession marks the refresh token stored as used and moves session
+// to pair. It returns errRefreshTokenReused when stored was used in the
+// meantime.
+func (a *AuthHandler) rotateSession(ctx context.Context, stored *db.RefreshToken, session *db.Session, pair *TokenPair) error {
+	now := a.app.Clock().Now()
+	return a.app.DB().RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		res, err := tx.NewUpdate().Model(stored).
+			Set("used_at = ?", now).
+			WherePK().
+			Where("used_at IS NULL").
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return errRefreshTokenReused
+		}
+
+		_, err = tx.NewInsert().Model(&db.RefreshToken{
+			JTI:       pair.RefreshID,
+			FamilyID:  pair.FamilyID,
+			SessionID: session.ID,
+			UserID:    session.UserID,
+			ExpiresAt: pair.RefreshExpiresAt,
+		}).Exec(ctx)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.NewUpdate().Model(session).
+			Set("access_token = ?", pair.AccessToken).
+			Set("refresh_token = ?", pair.RefreshToken).
+			Set("last_used_at = ?", now).
+			Set("expires_at = ?", pair.RefreshExpiresAt).
+			Set("updated_at = ?", now).
+			WherePK().
+			Exec(ctx)
+		return err
+	})
+}
+
+// revokeFamily revokes the session a refresh token family belongs to. It is
+// used when a refresh token that has already been rotated is presented again.
+func (a *AuthHandler) revokeFamily(ctx context.Context, familyID string) error {
+	now := a.app.Clock().Now()
+	_, err := a.app.DB().NewUpdate().Model((*db.Session)(nil)).
+		Set("revoked_at = ?", now).
+		Set("updated_at = ?", now).
+		Where("family_id = ?", familyID).
+		Where("revoked_at IS NULL").
+		Exec(ctx)
+	return err
+}
+
+// revokeSessions revokes the active sessions of a user. When sessionIDs are
+// given only those sessions are revoked.
+func (a *AuthHandler) revokeSessions(ctx context.Context, userID int64, sessionIDs ...int64) (int64, error) {
+	now := a.app.Clock().Now()
+	q := a.app.DB().NewUpdate().Model((*db.Session)(nil)).
+		Set("revoked_at = ?", now).
+		Set("updated_at = ?", now).
+		Where("user_id = ?", userID).
+		Where("revoked_at IS NULL")
+	if len(sessionIDs) > 0 {
+		q = q.Where("id IN (?)", bun.In(sessionIDs))
+	}
+
+	res, err := q.Exec(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// revokeOtherSessions revokes the active sessions of a user except keepID.
+func (a *AuthHandler) revokeOtherSessions(ctx context.Context, userID, keepID int64) error {
+	now := a.app.Clock().Now()
+	_, err := a.app.DB().NewUpdate().Model((*db.Session)(nil)).
+		Set("revoked_at = ?", now).
+		Set("updated_at = ?", now).
+		Where("user_id = ?", userID).
+		Where("id <> ?", keepID).
+		Where("revoked_at IS NULL").
+		Exec(ctx)
+	return err
+}
+
+// Logout implements handlers.AuthHandlerService.
+// @Summary Logout
+// @Description Revoke the session of the current access token
+// @Tags Auth
+// @Produce json
+// @Success 200 {object} httpresponse.SingleResponse
+// @Failure 401 {object} httperror.ErrResponse
+// @Router /api/auth/logout [post]
+func (a *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	session, ok := currentSession(r)
+	if !ok {
+		render.Render(w, r, httperror.ErrUnAuthorized(errors.New("unauthorized")))
+		return
+	}
+
+	if _, err := a.revokeSessions(r.Context(), session.UserID, session.ID); err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+
+	render.Render(w, r, httpresponse.WriteResponse(w, http.StatusOK, "success", nil))
+}
+
+// LogoutAll implements handlers.AuthHandlerService.
+// @Summary Logout everywhere
+// @Description Revoke every session of the current user, including the current one
+// @Tags Auth
+// @Produce json
+// @Success 200 {object} httpresponse.SingleResponse
+// @Failure 401 {object} httperror.ErrResponse
+// @Router /api/auth/logout-all [post]
+func (a *AuthHandler) LogoutAll(w http.ResponseWriter, r *http.Request) {
+	claims, ok := currentUser(r)
+	if !ok {
+		render.Render(w, r, httperror.ErrUnAuthorized(errors.New("unauthorized")))
+		return
+	}
+
+	if _, err := a.revokeSessions(r.Context(), claims.Sub); err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+
+	render.Render(w, r, httpresponse.WriteResponse(w, http.StatusOK, "success", nil))
+}
+
+// GetSessions implements handlers.AuthHandlerService.
+// @Summary Get sessions
+// @Description Get the active sessions of the current user
+// @Tags Auth
+// @Produce json
+// @Success 200 {object} httpresponse.CollectionResponse{data=[]db.Session}
+// @Failure 401 {object} httperror.ErrResponse
+// @Router /api/auth/sessions [get]
+func (a *AuthHandler) GetSessions(w http.ResponseWriter, r *http.Request) {
+	session, ok := currentSession(r)
+	if !ok {
+		render.Render(w, r, httperror.ErrUnAuthorized(errors.New("unauthorized")))
+		return
+	}
+
+	sessions := make([]*db.Session, 0)
+	total, err := a.app.DB().NewSelect().Model(&sessions).
+		Where("s.user_id = ?", session.UserID).
+		Where("s.revoked_at IS NULL").
+		Where("s.expires_at IS NULL OR s.expires_at > ?", a.app.Clock().Now()).
+		Order("s.last_used_at DESC").
+		ScanAndCount(r.Context())
+	if err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+
+	for _, s := range sessions {
+		s.Current = s.ID == session.ID
+	}
+
+	render.Render(w, r, httpresponse.WriteCollectionResponse(w, http.StatusOK, "success", sessions, total))
+}
+
+// RevokeSession implements handlers.AuthHandlerService.
+// @Summary Revoke session
+// @Description Revoke one session of the current user
+// @Tags Auth
+// @Produce json
+// @Param id path int true "Session ID"
+// @Success 200 {object} httpresponse.SingleResponse
+// @Failure 401 {object} httperror.ErrResponse
+// @Failure 404 {object} httperror.ErrResponse
+// @Router /api/auth/sessions/{id} [delete]
+func (a *AuthHandler) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	claims, ok := currentUser(r)
+	if !ok {
+		render.Render(w, r, httperror.ErrUnAuthorized(errors.New("unauthorized")))
+		return
+	}
+
+	id, err := parseIDParam(r, "id")
+	if err != nil {
+		render.Render(w, r, httperror.ErrInvalidRequest(err))
+		return
+	}
+
+	n, err := a.revokeSessions(r.Context(), claims.Sub, id)
+	if err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+	if n == 0 {
+		render.Render(w, r, httperror.ErrNotFound())
+		return
+	}
+
+	render.Render(w, r, httpresponse.WriteResponse(w, http.StatusOK, "success", nil))
+}
+
+var errSessionRevoked = errors.New("session has been revoked")
+
+// findActiveSession returns the non revoked session the access token was
+// issued for. It fails with errSessionRevoked when there is none.
+func (a *AuthHandler) findActiveSession(ctx context.Context, accessToken string) (*db.Session, error) {
+	session := new(db.Session)
+	err := a.app.DB().NewSelect().Model(session).
+		Where("s.access_token = ?", accessToken).
+		Where("s.revoked_at IS NULL").
+		Scan(ctx)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errSessionRevoked
+		}
+		return nil, err
+	}
+	return session, nil
+}
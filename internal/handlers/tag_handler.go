@@ -0,0 +1,304 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"todo-app/httputil/httperror"
+	"todo-app/httputil/httpresponse"
+	"todo-app/internal/db"
+	"todo-app/internal/dtos"
+
+	"github.com/go-chi/render"
+)
+
+// CreateTag implements handlers.TodoHandlerService.
+// @Summary Create tag
+// @Description Create a tag in the active workspace, tags are shared by its members
+// @Tags Tag
+// @Accept json
+// @Produce json
+// @Param request body dtos.TagDTO true "Create tag request body"
+// @Success 201 {object} httpresponse.SingleResponse{data=db.Tag}
+// @Failure 400 {object} httperror.ErrResponse
+// @Router /api/tags [post]
+func (t *TodoHandler) CreateTag(w http.ResponseWriter, r *http.Request) {
+	claims, ok := currentUser(r)
+	if !ok {
+		render.Render(w, r, httperror.ErrUnAuthorized(errors.New("unauthorized")))
+		return
+	}
+
+	var req dtos.TagDTO
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		render.Render(w, r, httperror.ErrInvalidRequest(err))
+		return
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		render.Render(w, r, httperror.ErrInvalidRequest(errors.New("name is required")))
+		return
+	}
+
+	if !t.checkGuestQuota(w, r, claims, (*db.Tag)(nil), guestMaxTags, "tags") {
+		return
+	}
+
+	tag := &db.Tag{
+		Name:        req.Name,
+		UserID:      claims.Sub,
+		WorkspaceID: currentWorkspaceID(r),
+	}
+	_, err := t.app.DB().NewInsert().Model(tag).Returning("*").Exec(r.Context())
+	if err != nil {
+		if isUniqueViolation(err) {
+			render.Render(w, r, httperror.ErrBadRequest(errors.New("tag already exists")))
+			return
+		}
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+
+	render.Render(w, r, httpresponse.WriteResponse(w, http.StatusCreated, "success", tag))
+}
+
+// GetTags implements handlers.TodoHandlerService.
+// @Summary Get tags
+// @Description Get all tags of the active workspace
+// @Tags Tag
+// @Produce json
+// @Success 200 {object} httpresponse.CollectionResponse{data=[]db.Tag}
+// @Router /api/tags [get]
+func (t *TodoHandler) GetTags(w http.ResponseWriter, r *http.Request) {
+	if _, ok := currentUser(r); !ok {
+		render.Render(w, r, httperror.ErrUnAuthorized(errors.New("unauthorized")))
+		return
+	}
+
+	tags := make([]*db.Tag, 0)
+	total, err := t.app.DB().NewSelect().Model(&tags).
+		Where("t.workspace_id = ?", currentWorkspaceID(r)).
+		Order("t.name ASC").
+		ScanAndCount(r.Context())
+	if err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+
+	render.Render(w, r, httpresponse.WriteCollectionResponse(w, http.StatusOK, "success", tags, total))
+}
+
+// UpdateTag implements handlers.TodoHandlerService.
+// @Summary Rename tag
+// @Description Rename a tag. Only its creator and workspace admins can rename it
+// @Tags Tag
+// @Accept json
+// @Produce json
+// @Param id path int true "Tag ID"
+// @Param request body dtos.TagDTO true "Rename tag request body"
+// @Success 200 {object} httpresponse.SingleResponse{data=db.Tag}
+// @Failure 400 {object} httperror.ErrResponse
+// @Failure 403 {object} httperror.ErrResponse
+// @Failure 404 {object} httperror.ErrResponse
+// @Router /api/tags/{id} [put]
+func (t *TodoHandler) UpdateTag(w http.ResponseWriter, r *http.Request) {
+	tag, ok := t.findTag(w, r, "id")
+	if !ok {
+		return
+	}
+	if !canManageTag(w, r, tag) {
+		return
+	}
+
+	var req dtos.TagDTO
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		render.Render(w, r, httperror.ErrInvalidRequest(err))
+		return
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		render.Render(w, r, httperror.ErrInvalidRequest(errors.New("name is required")))
+		return
+	}
+
+	tag.Name = req.Name
+	tag.UpdatedAt = t.app.Clock().Now()
+	_, err := t.app.DB().NewUpdate().Model(tag).
+		Column("name", "updated_at").
+		WherePK().
+		Exec(r.Context())
+	if err != nil {
+		if isUniqueViolation(err) {
+			render.Render(w, r, httperror.ErrBadRequest(errors.New("tag already exists")))
+			return
+		}
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+
+	render.Render(w, r, httpresponse.WriteResponse(w, http.StatusOK, "success", tag))
+}
+
+// DeleteTag implements handlers.TodoHandlerService.
+// @Summary Delete tag
+// @Description Delete a tag and detach it from all todos. Only its creator and workspace admins can delete it
+// @Tags Tag
+// @Produce json
+// @Param id path int true "Tag ID"
+// @Success 200 {object} httpresponse.SingleResponse
+// @Failure 403 {object} httperror.ErrResponse
+// @Failure 404 {object} httperror.ErrResponse
+// @Router /api/tags/{id} [delete]
+func (t *TodoHandler) DeleteTag(w http.ResponseWriter, r *http.Request) {
+	tag, ok := t.findTag(w, r, "id")
+	if !ok {
+		return
+	}
+	if !canManageTag(w, r, tag) {
+		return
+	}
+
+	_, err := t.app.DB().NewDelete().Model(tag).WherePK().Exec(r.Context())
+	if err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+
+	render.Render(w, r, httpresponse.WriteResponse(w, http.StatusOK, "success", nil))
+}
+
+// AttachTag implements handlers.TodoHandlerService.
+// @Summary Attach tag
+// @Description Attach a tag to a todo item, both must belong to the active workspace
+// @Tags Todo
+// @Produce json
+// @Param id path int true "Todo ID"
+// @Param tagID path int true "Tag ID"
+// @Success 200 {object} httpresponse.SingleResponse{data=db.Todo}
+// @Failure 403 {object} httperror.ErrResponse
+// @Failure 404 {object} httperror.ErrResponse
+// @Router /api/todo/{id}/tags/{tagID} [put]
+func (t *TodoHandler) AttachTag(w http.ResponseWriter, r *http.Request) {
+	todo, ok := t.findTodo(w, r, db.ListRoleEditor)
+	if !ok {
+		return
+	}
+	tag, ok := t.findTag(w, r, "tagID")
+	if !ok {
+		return
+	}
+
+	_, err := t.app.DB().NewInsert().
+		Model(&db.TodoTag{TodoID: todo.ID, TagID: tag.ID}).
+		On("CONFLICT (todo_id, tag_id) DO NOTHING").
+		Exec(r.Context())
+	if err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+
+	if err := t.loadTags(r, todo); err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+
+	render.Render(w, r, httpresponse.WriteResponse(w, http.StatusOK, "success", todo))
+}
+
+// DetachTag implements handlers.TodoHandlerService.
+// @Summary Detach tag
+// @Description Detach a tag from a todo item
+// @Tags Todo
+// @Produce json
+// @Param id path int true "Todo ID"
+// @Param tagID path int true "Tag ID"
+// @Success 200 {object} httpresponse.SingleResponse{data=db.Todo}
+// @Failure 403 {object} httperror.ErrResponse
+// @Failure 404 {object} httperror.ErrResponse
+// @Router /api/todo/{id}/tags/{tagID} [delete]
+func (t *TodoHandler) DetachTag(w http.ResponseWriter, r *http.Request) {
+	todo, ok := t.findTodo(w, r, db.ListRoleEditor)
+	if !ok {
+		return
+	}
+	tag, ok := t.findTag(w, r, "tagID")
+	if !ok {
+		return
+	}
+
+	_, err := t.app.DB().NewDelete().
+		Model((*db.TodoTag)(nil)).
+		Where("todo_id = ?", todo.ID).
+		Where("tag_id = ?", tag.ID).
+		Exec(r.Context())
+	if err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+
+	if err := t.loadTags(r, todo); err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+
+	render.Render(w, r, httpresponse.WriteResponse(w, http.StatusOK, "success", todo))
+}
+
+// findTag loads the tag referenced by the given URL param from the active
+// workspace.
+func (t *TodoHandler) findTag(w http.ResponseWriter, r *http.Request, param string) (*db.Tag, bool) {
+	if _, ok := currentUser(r); !ok {
+		render.Render(w, r, httperror.ErrUnAuthorized(errors.New("unauthorized")))
+		return nil, false
+	}
+
+	id, err := parseIDParam(r, param)
+	if err != nil {
+		render.Render(w, r, httperror.ErrInvalidRequest(err))
+		return nil, false
+	}
+
+	tag := new(db.Tag)
+	err = t.app.DB().NewSelect().Model(tag).
+		Where("t.id = ?", id).
+		Where("t.workspace_id = ?", currentWorkspaceID(r)).
+		Scan(r.Context())
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			render.Render(w, r, httperror.ErrNotFound())
+			return nil, false
+		}
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return nil, false
+	}
+
+	return tag, true
+}
+
+// canManageTag renders 403 unless the current user created the tag or is an
+// admin of its workspace.
+func canManageTag(w http.ResponseWriter, r *http.Request, tag *db.Tag) bool {
+	claims, _ := currentUser(r)
+	if workspace, ok := currentWorkspace(r); ok && workspace.Role == db.WorkspaceRoleAdmin {
+		return true
+	}
+	if tag.UserID != claims.Sub {
+		render.Render(w, r, httperror.ErrForbidden(errors.New("only the creator of the tag or a workspace admin can change it")))
+		return false
+	}
+	return true
+}
+
+// loadTags fills todo.Tags through the m2m:todo_tags relation.
+func (t *TodoHandler) loadTags(r *http.Request, todo *db.Todo) error {
+	todo.Tags = nil
+	return t.app.DB().NewSelect().Model(todo).
+		Column("i.id").
+		Relation("Tags").
+		WherePK().
+		Scan(r.Context())
+}
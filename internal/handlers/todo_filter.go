@@ -0,0 +1,262 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"todo-app/internal/db"
+	"todo-app/internal/dtos"
+	"todo-app/pkg/utils"
+
+	"github.com/uptrace/bun"
+)
+
+const (
+	defaultTodoPageSize = 20
+	maxTodoPageSize     = 100
+)
+
+// todoSortColumns maps the public sort keys to their columns.
+var todoSortColumns = map[string]string{
+	"id":         "i.id",
+	"title":      "i.title",
+	"created_at": "i.created_at",
+	"updated_at": "i.updated_at",
+}
+
+func parseTodoFilter(r *http.Request) (*dtos.TodoFilterDTO, error) {
+	query := r.URL.Query()
+	f := &dtos.TodoFilterDTO{
+		Sort:  "created_at",
+		Desc:  true,
+		Limit: defaultTodoPageSize,
+	}
+
+	if v := query.Get("status"); v != "" {
+		for _, s := range strings.Split(v, ",") {
+			status := db.ToDoStatus(strings.TrimSpace(s))
+			if !status.IsValid() {
+				return nil, fmt.Errorf("invalid status %q", s)
+			}
+			f.Statuses = append(f.Statuses, status)
+		}
+	}
+
+	var err error
+	if f.ListID, err = parseInt64Query(query.Get("list_id"), "list_id"); err != nil {
+		return nil, err
+	}
+	if f.TagID, err = parseInt64Query(query.Get("tag_id"), "tag_id"); err != nil {
+		return nil, err
+	}
+	if v := query.Get("parent_id"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || id < 0 {
+			return nil, errors.New("invalid parent_id")
+		}
+		f.ParentID = &id
+	}
+	if f.CreatedAfter, err = parseTimeQuery(query.Get("created_after"), "created_after"); err != nil {
+		return nil, err
+	}
+	if f.CreatedBefore, err = parseTimeQuery(query.Get("created_before"), "created_before"); err != nil {
+		return nil, err
+	}
+	if f.UpdatedAfter, err = parseTimeQuery(query.Get("updated_after"), "updated_after"); err != nil {
+		return nil, err
+	}
+	if f.UpdatedBefore, err = parseTimeQuery(query.Get("updated_before"), "updated_before"); err != nil {
+		return nil, err
+	}
+	f.Query = strings.TrimSpace(query.Get("q"))
+	switch f.Due = query.Get("due"); f.Due {
+	case "", DueToday, DueOverdue, DueThisWeek:
+	default:
+		return nil, errors.New("due must be today, overdue or this_week")
+	}
+
+	if v := query.Get("sort"); v != "" {
+		if _, ok := todoSortColumns[v]; !ok {
+			return nil, fmt.Errorf("invalid sort %q", v)
+		}
+		f.Sort = v
+	}
+	switch strings.ToLower(query.Get("order")) {
+	case "", "desc":
+	case "asc":
+		f.Desc = false
+	default:
+		return nil, errors.New("order must be asc or desc")
+	}
+
+	if v := query.Get("limit"); v != "" {
+		f.Limit, err = strconv.Atoi(v)
+		if err != nil || f.Limit <= 0 {
+			return nil, errors.New("invalid limit")
+		}
+		f.Limit = min(f.Limit, maxTodoPageSize)
+	}
+	if v := query.Get("offset"); v != "" {
+		f.Offset, err = strconv.Atoi(v)
+		if err != nil || f.Offset < 0 {
+			return nil, errors.New("invalid offset")
+		}
+	}
+	f.Cursor = query.Get("cursor")
+	if f.Cursor != "" && f.Offset > 0 {
+		return nil, errors.New("offset and cursor can not be used together")
+	}
+
+	return f, nil
+}
+
+// applyTodoFilter adds the WHERE clauses of f to a query on db.Todo.
+// Sorting and pagination are applied separately so that the same filter can
+// be used to count the total.
+func applyTodoFilter(q *bun.SelectQuery, f *dtos.TodoFilterDTO) *bun.SelectQuery {
+	if len(f.Statuses) > 0 {
+		q = q.Where("i.status IN (?)", bun.In(f.Statuses))
+	}
+	if f.ListID != 0 {
+		q = q.Where("i.list_id = ?", f.ListID)
+	}
+	if f.ParentID != nil {
+		if *f.ParentID == 0 {
+			q = q.Where("i.parent_id IS NULL")
+		} else {
+			q = q.Where("i.parent_id = ?", *f.ParentID)
+		}
+	}
+	if f.TagID != 0 {
+		q = q.Where("EXISTS (SELECT 1 FROM todo_tags AS tt WHERE tt.todo_id = i.id AND tt.tag_id = ?)", f.TagID)
+	}
+	if !f.CreatedAfter.IsZero() {
+		q = q.Where("i.created_at >= ?", f.CreatedAfter)
+	}
+	if !f.CreatedBefore.IsZero() {
+		q = q.Where("i.created_at < ?", f.CreatedBefore)
+	}
+	if !f.UpdatedAfter.IsZero() {
+		q = q.Where("i.updated_at >= ?", f.UpdatedAfter)
+	}
+	if !f.UpdatedBefore.IsZero() {
+		q = q.Where("i.updated_at < ?", f.UpdatedBefore)
+	}
+	if f.Due != "" {
+		q = q.WhereGroup(" AND ", func(q *bun.SelectQuery) *bun.SelectQuery {
+			q = q.WhereGroup(" OR ", func(q *bun.SelectQuery) *bun.SelectQuery {
+				q = q.Where("i.due_at IS NOT NULL")
+				if !f.DueFrom.IsZero() {
+					q = q.Where("i.due_at >= ?", f.DueFrom)
+				}
+				return q.Where("i.due_at < ?", f.DueTo)
+			})
+			return q.WhereGroup(" OR ", func(q *bun.SelectQuery) *bun.SelectQuery {
+				q = q.Where("i.due_date IS NOT NULL")
+				if !f.DueFromDate.IsZero() {
+					q = q.Where("i.due_date >= ?", f.DueFromDate)
+				}
+				return q.Where("i.due_date < ?", f.DueToDate)
+			})
+		})
+		if f.Due == DueOverdue {
+			q = q.Where("i.status <> ?", db.DONE)
+		}
+	}
+	if f.Query != "" {
+		pattern := "%" + escapeLike(f.Query) + "%"
+		q = q.WhereGroup(" AND ", func(q *bun.SelectQuery) *bun.SelectQuery {
+			return q.Where("i.title ILIKE ?", pattern).WhereOr("i.description ILIKE ?", pattern)
+		})
+	}
+	return q
+}
+
+// applyTodoPage orders the query and applies either offset or keyset
+// pagination. One extra row is requested to know whether there is a next page.
+func applyTodoPage(q *bun.SelectQuery, f *dtos.TodoFilterDTO) (*bun.SelectQuery, error) {
+	column := todoSortColumns[f.Sort]
+	dir, cmp := "ASC", ">"
+	if f.Desc {
+		dir, cmp = "DESC", "<"
+	}
+
+	if f.Cursor != "" {
+		value, id, err := utils.DecodeCursor(f.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		cursorValue, err := parseTodoCursorValue(f.Sort, value)
+		if err != nil {
+			return nil, err
+		}
+		q = q.Where(fmt.Sprintf("(%s, i.id) %s (?, ?)", column, cmp), cursorValue, id)
+	} else if f.Offset > 0 {
+		q = q.Offset(f.Offset)
+	}
+
+	return q.OrderExpr(fmt.Sprintf("%s %s, i.id %s", column, dir, dir)).Limit(f.Limit + 1), nil
+}
+
+// todoCursor returns the cursor pointing after todo for the given sort key.
+func todoCursor(sort string, todo *db.Todo) string {
+	var value string
+	switch sort {
+	case "id":
+		value = strconv.FormatInt(todo.ID, 10)
+	case "title":
+		value = todo.Title
+	case "created_at":
+		value = todo.CreatedAt.Format(time.RFC3339Nano)
+	case "updated_at":
+		value = todo.UpdatedAt.Format(time.RFC3339Nano)
+	}
+	return utils.EncodeCursor(value, todo.ID)
+}
+
+func parseTodoCursorValue(sort, value string) (interface{}, error) {
+	switch sort {
+	case "id":
+		id, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, utils.ErrInvalidCursor
+		}
+		return id, nil
+	case "created_at", "updated_at":
+		t, err := time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			return nil, utils.ErrInvalidCursor
+		}
+		return t, nil
+	}
+	return value, nil
+}
+
+func parseInt64Query(v, name string) (int64, error) {
+	if v == "" {
+		return 0, nil
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, errors.New("invalid " + name)
+	}
+	return n, nil
+}
+
+func parseTimeQuery(v, name string) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid %s, expected RFC3339 timestamp", name)
+	}
+	return t, nil
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
@@ -1,42 +1,498 @@
 package handlers
 
 import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
 	"net/http"
+	"time"
 	"todo-app/bunapp"
+	"todo-app/httputil/httperror"
+	"todo-app/httputil/httpresponse"
+	"todo-app/internal/db"
+	"todo-app/internal/dtos"
 	handlers "todo-app/internal/services"
+
+	"github.com/go-chi/render"
+	"github.com/uptrace/bun"
 )
 
 type TodoHandler struct {
 	app *bunapp.App
 }
 
-// CreateList implements handlers.TodoHandlerService.
-func (t *TodoHandler) CreateList(w http.ResponseWriter, r *http.Request) {
-	panic("unimplemented")
-}
+// CreateTodo implements handlers.TodoHandlerService.
+// @Summary Create todo
+// @Description Create a todo item in a list. Requires the editor role in the list. All-day todos take due_date and start_date, other todos due_at and start_at. A recurrence (RRULE) makes the todo repeat from its due date, it is moved to the first occurrence of the rule. A parent_id makes the todo a subtask in the list of its parent, subtasks cannot recur
+// @Tags Todo
+// @Accept json
+// @Produce json
+// @Param request body dtos.CreateTodoDTO true "Create todo request body"
+// @Success 201 {object} httpresponse.SingleResponse{data=db.Todo}
+// @Failure 400 {object} httperror.ErrResponse
+// @Router /api/todo [post]
+func (t *TodoHandler) CreateTodo(w http.ResponseWriter, r *http.Request) {
+	claims, ok := currentUser(r)
+	if !ok {
+		render.Render(w, r, httperror.ErrUnAuthorized(errors.New("unauthorized")))
+		return
+	}
 
-// CreateTag implements handlers.TodoHandlerService.
-func (t *TodoHandler) CreateTag(w http.ResponseWriter, r *http.Request) {
-	panic("unimplemented")
+	var req dtos.CreateTodoDTO
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		render.Render(w, r, httperror.ErrInvalidRequest(err))
+		return
+	}
+
+	if req.Title == "" {
+		render.Render(w, r, httperror.ErrInvalidRequest(errors.New("title is required")))
+		return
+	}
+	if req.ListID == 0 && req.ParentID == 0 {
+		render.Render(w, r, httperror.ErrInvalidRequest(errors.New("list_id is required")))
+		return
+	}
+	if req.Status == "" {
+		req.Status = db.TODO
+	}
+	if !req.Status.IsValid() {
+		render.Render(w, r, httperror.ErrInvalidRequest(errors.New("invalid status")))
+		return
+	}
+	schedule, err := parseTodoSchedule(req.TodoScheduleDTO)
+	if err != nil {
+		render.Render(w, r, httperror.ErrInvalidRequest(err))
+		return
+	}
+	recurrence, err := parseTodoRecurrence(req.TodoRecurrenceDTO)
+	if err != nil {
+		render.Render(w, r, httperror.ErrInvalidRequest(err))
+		return
+	}
+	if req.ParentID != 0 {
+		parent, ok := t.findParent(w, r, req.ParentID)
+		if !ok {
+			return
+		}
+		if req.ListID != 0 && req.ListID != parent.ListID {
+			render.Render(w, r, httperror.ErrInvalidRequest(errors.New("list_id must be the list of the parent")))
+			return
+		}
+		req.ListID = parent.ListID
+	}
+	if !t.checkListAccess(w, r, claims.Sub, req.ListID, db.ListRoleEditor) {
+		return
+	}
+	if !t.checkGuestQuota(w, r, claims, (*db.Todo)(nil), guestMaxTodos, "todos") {
+		return
+	}
+
+	todo := &db.Todo{
+		Title:       req.Title,
+		Description: req.Description,
+		Status:      req.Status,
+		ListID:      req.ListID,
+		ParentID:    req.ParentID,
+		UserID:      claims.Sub,
+	}
+	if err := schedule.apply(todo, func() (*time.Location, error) {
+		return t.userLocation(r.Context(), claims.Sub)
+	}); err != nil {
+		render.Render(w, r, httperror.ErrInvalidRequest(err))
+		return
+	}
+	err = t.app.DB().RunInTx(r.Context(), nil, func(ctx context.Context, tx bun.Tx) error {
+		if err := t.updateRecurrence(ctx, tx, todo, recurrence, ScopeThis, false, false); err != nil {
+			return err
+		}
+		if todo.ParentID != 0 {
+			if err := t.checkSubtaskPlace(ctx, tx, todo, todo.ListID); err != nil {
+				return err
+			}
+		}
+		_, err := tx.NewInsert().Model(todo).Returning("*").Exec(ctx)
+		return err
+	})
+	if err != nil {
+		renderTodoError(w, r, err)
+		return
+	}
+
+	render.Render(w, r, httpresponse.WriteResponse(w, http.StatusCreated, "success", todo))
 }
 
-// CreateTodo implements handlers.TodoHandlerService.
-func (t *TodoHandler) CreateTodo(w http.ResponseWriter, r *http.Request) {
+// ListTodos implements handlers.TodoHandlerService.
+// @Summary List todos
+// @Description List todo items of every list of the active workspace the current user is a member of, with filtering, sorting and offset or cursor pagination
+// @Tags Todo
+// @Produce json
+// @Param status query string false "Comma separated statuses (todo, doing, done)"
+// @Param list_id query int false "List ID"
+// @Param tag_id query int false "Tag ID"
+// @Param parent_id query int false "Parent todo ID of subtasks, 0 for top-level todos"
+// @Param created_after query string false "RFC3339 timestamp"
+// @Param created_before query string false "RFC3339 timestamp"
+// @Param updated_after query string false "RFC3339 timestamp"
+// @Param updated_before query string false "RFC3339 timestamp"
+// @Param q query string false "Free text search in title and description"
+// @Param due query string false "today, overdue (not done and due before now) or this_week (Monday to Sunday), in the timezone of the user"
+// @Param sort query string false "Sort key (id, title, created_at, updated_at)"
+// @Param order query string false "asc or desc"
+// @Param limit query int false "Page size, at most 100"
+// @Param offset query int false "Offset pagination"
+// @Param cursor query string false "Cursor pagination, next_cursor of the previous page"
+// @Success 200 {object} httpresponse.CollectionResponse{data=[]db.Todo}
+// @Failure 400 {object} httperror.ErrResponse
+// @Router /api/todo [get]
+func (t *TodoHandler) ListTodos(w http.ResponseWriter, r *http.Request) {
+	claims, ok := currentUser(r)
+	if !ok {
+		render.Render(w, r, httperror.ErrUnAuthorized(errors.New("unauthorized")))
+		return
+	}
+
+	filter, err := parseTodoFilter(r)
+	if err != nil {
+		render.Render(w, r, httperror.ErrInvalidRequest(err))
+		return
+	}
+	if filter.Due != "" {
+		loc, err := t.userLocation(r.Context(), claims.Sub)
+		if err != nil {
+			render.Render(w, r, httperror.ErrInternalError(err))
+			return
+		}
+		ResolveDueFilter(filter, t.app.Clock().Now(), loc)
+	}
+
+	total, err := applyTodoFilter(t.app.DB().NewSelect().Model((*db.Todo)(nil)), filter).
+		Where("i.list_id IN (?)", t.memberListIDs(r, claims.Sub)).
+		Count(r.Context())
+	if err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+
+	todos := make([]*db.Todo, 0)
+	q := applyTodoFilter(t.app.DB().NewSelect().Model(&todos), filter).
+		Where("i.list_id IN (?)", t.memberListIDs(r, claims.Sub)).
+		Relation("Tags").
+		Relation("Series")
+	q, err = applyTodoPage(q, filter)
+	if err != nil {
+		render.Render(w, r, httperror.ErrInvalidRequest(err))
+		return
+	}
+	if err := q.Scan(r.Context()); err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+
+	var nextCursor string
+	if len(todos) > filter.Limit {
+		todos = todos[:filter.Limit]
+		nextCursor = todoCursor(filter.Sort, todos[len(todos)-1])
+	}
+	if err := t.loadDependencies(r.Context(), todos...); err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+
+	render.Render(w, r, httpresponse.WriteCursorCollectionResponse(w, http.StatusOK, "success", todos, total, nextCursor))
 }
 
 // DeleteTodo implements handlers.TodoHandlerService.
+// @Summary Delete todo
+// @Description Delete a todo item. Requires the editor role in its list. Its subtasks are deleted with it. Deleting the latest occurrence of a recurring todo ends the recurrence
+// @Tags Todo
+// @Produce json
+// @Param id path int true "Todo ID"
+// @Success 200 {object} httpresponse.SingleResponse
+// @Failure 403 {object} httperror.ErrResponse
+// @Failure 404 {object} httperror.ErrResponse
+// @Router /api/todo/{id} [delete]
 func (t *TodoHandler) DeleteTodo(w http.ResponseWriter, r *http.Request) {
-	panic("unimplemented")
+	todo, ok := t.findTodo(w, r, db.ListRoleEditor)
+	if !ok {
+		return
+	}
+
+	err := t.app.DB().RunInTx(r.Context(), nil, func(ctx context.Context, tx bun.Tx) error {
+		if _, err := tx.NewDelete().Model(todo).WherePK().Exec(ctx); err != nil {
+			return err
+		}
+		return t.endSeriesOf(ctx, tx, todo)
+	})
+	if err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+
+	render.Render(w, r, httpresponse.WriteResponse(w, http.StatusOK, "success", nil))
 }
 
 // GetTodo implements handlers.TodoHandlerService.
+// @Summary Get todo
+// @Description Get a todo item of a list the current user is a member of, with its checklist, the progress of its subtasks and checklist items and the todos that block it or that it blocks
+// @Tags Todo
+// @Produce json
+// @Param id path int true "Todo ID"
+// @Param expand query string false "subtasks to include the tree of subtasks with their checklists"
+// @Success 200 {object} httpresponse.SingleResponse{data=db.Todo}
+// @Failure 400 {object} httperror.ErrResponse
+// @Failure 403 {object} httperror.ErrResponse
+// @Failure 404 {object} httperror.ErrResponse
+// @Router /api/todo/{id} [get]
 func (t *TodoHandler) GetTodo(w http.ResponseWriter, r *http.Request) {
-	panic("unimplemented")
+	expand := r.URL.Query().Get("expand")
+	if expand != "" && expand != ExpandSubtasks {
+		render.Render(w, r, httperror.ErrInvalidRequest(errors.New("expand must be subtasks")))
+		return
+	}
+	todo, ok := t.findTodo(w, r, db.ListRoleViewer)
+	if !ok {
+		return
+	}
+
+	if err := t.loadTags(r, todo); err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+	if err := t.loadSeries(r.Context(), todo); err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+	if err := t.loadTodoTree(r.Context(), todo, expand == ExpandSubtasks); err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+	if err := t.loadDependencies(r.Context(), flattenTodoTree(todo)...); err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+
+	render.Render(w, r, httpresponse.WriteResponse(w, http.StatusOK, "success", todo))
 }
 
 // UpdateTodo implements handlers.TodoHandlerService.
+// @Summary Update todo
+// @Description Update the given fields of a todo item. Requires the editor role in its list, and in the new list when moving it. Making a timed todo all-day keeps the dates in the timezone of the user, the other way round due_at and start_at have to be given. Edits of a recurring todo apply to this occurrence or, with scope future, to the following ones as well. Setting the status to done creates the next occurrence. A parent_id moves the todo with its subtasks below another todo and into its list. Setting the status to done fails with 422 while subtasks or checklist items are open, unless cascade completes them as well, and while todos that block it are open, unless ignore_blockers is set. Moving a todo to another list removes its dependencies on todos of the old list
+// @Tags Todo
+// @Accept json
+// @Produce json
+// @Param id path int true "Todo ID"
+// @Param request body dtos.UpdateTodoDTO true "Update todo request body"
+// @Success 200 {object} httpresponse.SingleResponse{data=db.Todo}
+// @Failure 400 {object} httperror.ErrResponse
+// @Failure 403 {object} httperror.ErrResponse
+// @Failure 404 {object} httperror.ErrResponse
+// @Failure 422 {object} httperror.ErrResponse
+// @Router /api/todo/{id} [put]
 func (t *TodoHandler) UpdateTodo(w http.ResponseWriter, r *http.Request) {
-	panic("unimplemented")
+	todo, ok := t.findTodo(w, r, db.ListRoleEditor)
+	if !ok {
+		return
+	}
+
+	var req dtos.UpdateTodoDTO
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		render.Render(w, r, httperror.ErrInvalidRequest(err))
+		return
+	}
+	schedule, err := parseTodoSchedule(req.TodoScheduleDTO)
+	if err != nil {
+		render.Render(w, r, httperror.ErrInvalidRequest(err))
+		return
+	}
+	recurrence, err := parseTodoRecurrence(req.TodoRecurrenceDTO)
+	if err != nil {
+		render.Render(w, r, httperror.ErrInvalidRequest(err))
+		return
+	}
+	scope, err := parseEditScope(req.Scope)
+	if err != nil {
+		render.Render(w, r, httperror.ErrInvalidRequest(err))
+		return
+	}
+	wasDone := todo.Status == db.DONE
+	oldListID, oldParentID := todo.ListID, todo.ParentID
+
+	if req.Title != nil {
+		if *req.Title == "" {
+			render.Render(w, r, httperror.ErrInvalidRequest(errors.New("title must not be empty")))
+			return
+		}
+		todo.Title = *req.Title
+	}
+	if req.Description != nil {
+		todo.Description = *req.Description
+	}
+	if req.Status != nil {
+		if !req.Status.IsValid() {
+			render.Render(w, r, httperror.ErrInvalidRequest(errors.New("invalid status")))
+			return
+		}
+		todo.Status = *req.Status
+	}
+	claims, _ := currentUser(r)
+	if req.ListID != nil && *req.ListID != todo.ListID {
+		if !t.checkListAccess(w, r, claims.Sub, *req.ListID, db.ListRoleEditor) {
+			return
+		}
+		todo.ListID = *req.ListID
+	}
+	switch {
+	case req.ParentID != nil && *req.ParentID == 0:
+		todo.ParentID = 0
+	case req.ParentID != nil:
+		parent, ok := t.findParent(w, r, *req.ParentID)
+		if !ok {
+			return
+		}
+		if req.ListID != nil && *req.ListID != parent.ListID {
+			render.Render(w, r, httperror.ErrInvalidRequest(errors.New("list_id must be the list of the parent")))
+			return
+		}
+		if parent.ListID != todo.ListID && !t.checkListAccess(w, r, claims.Sub, parent.ListID, db.ListRoleEditor) {
+			return
+		}
+		todo.ListID, todo.ParentID = parent.ListID, parent.ID
+	case todo.ListID != oldListID:
+		// The parent stays in its list.
+		todo.ParentID = 0
+	}
+	if err := schedule.apply(todo, func() (*time.Location, error) {
+		return t.userLocation(r.Context(), claims.Sub)
+	}); err != nil {
+		render.Render(w, r, httperror.ErrInvalidRequest(err))
+		return
+	}
+	todo.UpdatedAt = t.app.Clock().Now()
+
+	err = t.app.DB().RunInTx(r.Context(), nil, func(ctx context.Context, tx bun.Tx) error {
+		completed := !wasDone && todo.Status == db.DONE
+		if completed {
+			if !req.IgnoreBlockers {
+				if err := checkBlockers(ctx, tx, todo, req.Cascade); err != nil {
+					return err
+				}
+			}
+			if err := t.completeSubtasks(ctx, tx, todo, req.Cascade); err != nil {
+				return err
+			}
+		}
+		if err := t.updateRecurrence(ctx, tx, todo, recurrence, scope, schedule.changed(), completed); err != nil {
+			return err
+		}
+		if todo.ListID != oldListID || todo.ParentID != oldParentID || todo.ParentID != 0 && recurrence.changed() {
+			if err := t.checkSubtaskPlace(ctx, tx, todo, oldListID, todo.ListID); err != nil {
+				return err
+			}
+		}
+		_, err := tx.NewUpdate().Model(todo).
+			Column("title", "description", "status", "list_id", "parent_id", "due_at", "due_date", "start_at", "start_date", "all_day", "series_id", "occurrence_at", "updated_at").
+			WherePK().
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+		if todo.ListID != oldListID {
+			if err := dropCrossListDependencies(ctx, tx, todo.ListID); err != nil {
+				return err
+			}
+		}
+		if schedule.changed() || recurrence.changed() {
+			return t.rescheduleReminders(ctx, tx, todo)
+		}
+		return nil
+	})
+	if err != nil {
+		renderTodoError(w, r, err)
+		return
+	}
+	if err := t.loadDependencies(r.Context(), todo); err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+
+	render.Render(w, r, httpresponse.WriteResponse(w, http.StatusOK, "success", todo))
+}
+
+// renderTodoError renders the error of a write of a todo, its series,
+// subtasks and dependencies.
+func renderTodoError(w http.ResponseWriter, r *http.Request, err error) {
+	var invalid errInvalidRecurrence
+	var invalidSubtask errInvalidSubtask
+	if errors.As(err, &invalid) || errors.As(err, &invalidSubtask) || isUniqueViolation(err) {
+		render.Render(w, r, httperror.ErrInvalidRequest(err))
+		return
+	}
+	if errors.Is(err, errOpenSubtasks) || errors.Is(err, errBlocked) {
+		render.Render(w, r, httperror.ErrUnprocessableEntity(err))
+		return
+	}
+	render.Render(w, r, httperror.ErrInternalError(err))
+}
+
+// findTodo loads the todo referenced by the {id} URL param and checks that
+// the current user has at least minRole in its list. It renders the error
+// response itself and returns false when the request should stop.
+func (t *TodoHandler) findTodo(w http.ResponseWriter, r *http.Request, minRole string) (*db.Todo, bool) {
+	claims, ok := currentUser(r)
+	if !ok {
+		render.Render(w, r, httperror.ErrUnAuthorized(errors.New("unauthorized")))
+		return nil, false
+	}
+
+	id, err := parseIDParam(r, "id")
+	if err != nil {
+		render.Render(w, r, httperror.ErrInvalidRequest(err))
+		return nil, false
+	}
+
+	todo := new(db.Todo)
+	err = t.app.DB().NewSelect().Model(todo).Where("i.id = ?", id).Scan(r.Context())
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			render.Render(w, r, httperror.ErrNotFound())
+			return nil, false
+		}
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return nil, false
+	}
+
+	list := new(db.List)
+	err = t.selectListWithRole(r, list, claims.Sub).Where("l.id = ?", todo.ListID).Scan(r.Context())
+	if err != nil {
+		// The todo belongs to another workspace.
+		if errors.Is(err, sql.ErrNoRows) {
+			render.Render(w, r, httperror.ErrNotFound())
+			return nil, false
+		}
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return nil, false
+	}
+	if list.Role == "" {
+		render.Render(w, r, httperror.ErrForbidden(errors.New("you do not have access to this todo")))
+		return nil, false
+	}
+	if !checkListRole(w, r, list.Role, minRole) {
+		return nil, false
+	}
+
+	return todo, true
+}
+
+// memberListIDs selects the ids of the lists of the active workspace userID
+// is an accepted member of.
+func (t *TodoHandler) memberListIDs(r *http.Request, userID int64) *bun.SelectQuery {
+	return t.app.DB().NewSelect().Model((*db.ListMember)(nil)).
+		Column("lm.list_id").
+		Join("JOIN lists AS l ON l.id = lm.list_id").
+		Where("lm.user_id = ?", userID).
+		Where("lm.status = ?", db.ListMemberAccepted).
+		Where("l.workspace_id = ?", currentWorkspaceID(r))
 }
 
 var _ handlers.TodoHandlerService = (*TodoHandler)(nil)
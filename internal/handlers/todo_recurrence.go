@@ -0,0 +1,360 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+	"todo-app/internal/db"
+	"todo-app/internal/dtos"
+	"todo-app/pkg/rrule"
+
+	"github.com/uptrace/bun"
+)
+
+const (
+	ScopeThis   = "this"
+	ScopeFuture = "future"
+)
+
+var errRecurrenceNeedsDue = errors.New("a recurring todo needs a due_at or due_date")
+
+// todoRecurrence is a parsed dtos.TodoRecurrenceDTO.
+type todoRecurrence struct {
+	rule       *rrule.Rule
+	stop       bool
+	repeatFrom string
+}
+
+// changed reports whether the request changes the recurrence.
+func (rc *todoRecurrence) changed() bool {
+	return rc.rule != nil || rc.stop || rc.repeatFrom != ""
+}
+
+func parseTodoRecurrence(req dtos.TodoRecurrenceDTO) (*todoRecurrence, error) {
+	rc := &todoRecurrence{}
+	if req.Recurrence != nil {
+		if *req.Recurrence == "" {
+			rc.stop = true
+		} else {
+			rule, err := rrule.Parse(*req.Recurrence)
+			if err != nil {
+				return nil, fmt.Errorf("invalid recurrence: %w", err)
+			}
+			rc.rule = rule
+		}
+	}
+	if req.RepeatFrom != nil {
+		switch *req.RepeatFrom {
+		case db.RepeatFromDue, db.RepeatFromCompletion:
+			rc.repeatFrom = *req.RepeatFrom
+		default:
+			return nil, errors.New("repeat_from must be due or completion")
+		}
+	}
+	return rc, nil
+}
+
+func parseEditScope(scope string) (string, error) {
+	switch scope {
+	case "":
+		return ScopeThis, nil
+	case ScopeThis, ScopeFuture:
+		return scope, nil
+	}
+	return "", errors.New("scope must be this or future")
+}
+
+// NewTodoSeries starts a series with rule at the due date of todo and moves
+// todo to the first occurrence. Timed todos repeat in the timezone loc.
+func NewTodoSeries(todo *db.Todo, rule *rrule.Rule, repeatFrom string, loc *time.Location) (*db.TodoSeries, error) {
+	if repeatFrom == "" {
+		repeatFrom = db.RepeatFromDue
+	}
+	series := &db.TodoSeries{
+		RepeatFrom:  repeatFrom,
+		Timezone:    loc.String(),
+		Title:       todo.Title,
+		Description: todo.Description,
+		ListID:      todo.ListID,
+		UserID:      todo.UserID,
+	}
+	if err := restartTodoSeries(series, todo, rule); err != nil {
+		return nil, err
+	}
+	return series, nil
+}
+
+// restartTodoSeries makes the schedule of todo the start of series with
+// rule, counting occurrences from there.
+func restartTodoSeries(series *db.TodoSeries, todo *db.Todo, rule *rrule.Rule) error {
+	series.Rule = rule.String()
+	series.AllDay = todo.AllDay
+	series.StartOffset = nil
+
+	if todo.AllDay {
+		if todo.DueDate.IsZero() {
+			return errRecurrenceNeedsDue
+		}
+		series.DTStart = todo.DueDate.In(time.UTC)
+		if !todo.StartDate.IsZero() {
+			offset := int64(todo.DueDate.Sub(todo.StartDate)) * 24 * 60 * 60
+			series.StartOffset = &offset
+		}
+	} else {
+		if todo.DueAt.IsZero() {
+			return errRecurrenceNeedsDue
+		}
+		series.DTStart = todo.DueAt.In(seriesLocation(series))
+		if !todo.StartAt.IsZero() {
+			offset := int64(todo.DueAt.Sub(todo.StartAt) / time.Second)
+			series.StartOffset = &offset
+		}
+	}
+
+	first, ok := rule.First(series.DTStart)
+	if !ok {
+		return errors.New("the recurrence has no occurrence")
+	}
+	setOccurrence(todo, series, first)
+	series.Occurrences = 1
+	return nil
+}
+
+// NextOccurrence returns the todo that follows todo in series when it is
+// completed at now, or nil when the series ended. Series that repeat from
+// the due date skip the occurrences that passed already.
+func NextOccurrence(series *db.TodoSeries, todo *db.Todo, now time.Time) (*db.Todo, error) {
+	rule, err := rrule.Parse(series.Rule)
+	if err != nil {
+		return nil, err
+	}
+	if rule.Count > 0 && series.Occurrences >= rule.Count {
+		return nil, nil
+	}
+	// The series counts its occurrences itself, edits of all future
+	// occurrences restart the rule.
+	rule.Count = 0
+
+	loc := seriesLocation(series)
+	dtstart := series.DTStart.In(loc)
+	local := now.In(seriesUserLocation(series))
+
+	var next time.Time
+	var ok bool
+	if series.RepeatFrom == db.RepeatFromCompletion {
+		restart := rrule.At(local.Year(), local.Month(), local.Day(), dtstart.Hour(), dtstart.Minute(), dtstart.Second(), loc)
+		next, ok = rule.Next(restart, restart)
+	} else {
+		after := todo.OccurrenceAt
+		if series.AllDay {
+			// Today is still to come for all-day todos.
+			now = rrule.At(local.Year(), local.Month(), local.Day()-1, 0, 0, 0, time.UTC)
+		}
+		if now.After(after) {
+			after = now
+		}
+		next, ok = rule.Next(dtstart, after)
+	}
+	if !ok {
+		return nil, nil
+	}
+
+	nextTodo := &db.Todo{
+		Title:       series.Title,
+		Description: series.Description,
+		Status:      db.TODO,
+		ListID:      series.ListID,
+		UserID:      todo.UserID,
+		SeriesID:    series.ID,
+	}
+	setOccurrence(nextTodo, series, next)
+	return nextTodo, nil
+}
+
+// setOccurrence schedules todo at the occurrence o of series.
+func setOccurrence(todo *db.Todo, series *db.TodoSeries, o time.Time) {
+	todo.OccurrenceAt = o
+	todo.AllDay = series.AllDay
+	todo.DueAt, todo.DueDate = time.Time{}, db.Date{}
+	todo.StartAt, todo.StartDate = time.Time{}, db.Date{}
+
+	if series.AllDay {
+		todo.DueDate = db.DateOf(o)
+		if series.StartOffset != nil {
+			todo.StartDate = todo.DueDate.AddDays(-int(*series.StartOffset / (24 * 60 * 60)))
+		}
+		return
+	}
+	todo.DueAt = o
+	if series.StartOffset != nil {
+		todo.StartAt = o.Add(-time.Duration(*series.StartOffset) * time.Second)
+	}
+}
+
+// seriesLocation returns the timezone the rule of series runs in. All-day
+// series run on dates, which are midnight UTC.
+func seriesLocation(series *db.TodoSeries) *time.Location {
+	if series.AllDay {
+		return time.UTC
+	}
+	return seriesUserLocation(series)
+}
+
+// seriesUserLocation returns the timezone of the user the series was
+// created for.
+func seriesUserLocation(series *db.TodoSeries) *time.Location {
+	loc, err := time.LoadLocation(series.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// updateRecurrence applies rc and the edit of todo with scope to its series
+// and creates the next occurrence when todo was completed. todo is saved by
+// the caller.
+func (t *TodoHandler) updateRecurrence(ctx context.Context, tx bun.Tx, todo *db.Todo, rc *todoRecurrence, scope string, rescheduled, completed bool) error {
+	if todo.SeriesID == 0 {
+		if rc.rule == nil {
+			if rc.repeatFrom != "" {
+				return errInvalidRecurrence{errors.New("repeat_from needs a recurrence")}
+			}
+			return nil
+		}
+		loc, err := t.userLocation(ctx, todo.UserID)
+		if err != nil {
+			return err
+		}
+		series, err := NewTodoSeries(todo, rc.rule, rc.repeatFrom, loc)
+		if err != nil {
+			return errInvalidRecurrence{err}
+		}
+		if _, err := tx.NewInsert().Model(series).Returning("*").Exec(ctx); err != nil {
+			return err
+		}
+		todo.SeriesID, todo.Series = series.ID, series
+		return nil
+	}
+
+	series := new(db.TodoSeries)
+	err := tx.NewSelect().Model(series).Where("ts.id = ?", todo.SeriesID).For("UPDATE").Scan(ctx)
+	if err != nil {
+		return err
+	}
+
+	if rc.stop {
+		todo.SeriesID, todo.OccurrenceAt = 0, time.Time{}
+		_, err := tx.NewDelete().Model(series).WherePK().Exec(ctx)
+		return err
+	}
+
+	if rc.changed() || scope == ScopeFuture {
+		series.Title = todo.Title
+		series.Description = todo.Description
+		series.ListID = todo.ListID
+		if rc.repeatFrom != "" {
+			series.RepeatFrom = rc.repeatFrom
+		}
+		if rc.rule != nil || rescheduled {
+			rule := rc.rule
+			if rule == nil {
+				if rule, err = rrule.Parse(series.Rule); err != nil {
+					return err
+				}
+			}
+			if err := restartTodoSeries(series, todo, rule); err != nil {
+				return errInvalidRecurrence{err}
+			}
+		}
+		series.UpdatedAt = t.app.Clock().Now()
+		_, err := tx.NewUpdate().Model(series).WherePK().Exec(ctx)
+		if err != nil {
+			return err
+		}
+	}
+	todo.Series = series
+
+	if completed {
+		return t.createNextOccurrence(ctx, tx, series, todo)
+	}
+	return nil
+}
+
+// createNextOccurrence creates the occurrence after the completed todo with
+// its tags and reminders before the due date. Only the latest occurrence
+// continues the series, so completing a todo again does not create another
+// one.
+func (t *TodoHandler) createNextOccurrence(ctx context.Context, tx bun.Tx, series *db.TodoSeries, todo *db.Todo) error {
+	later, err := tx.NewSelect().Model((*db.Todo)(nil)).
+		Where("i.series_id = ?", series.ID).
+		Where("i.occurrence_at > ?", todo.OccurrenceAt).
+		Exists(ctx)
+	if err != nil || later {
+		return err
+	}
+
+	next, err := NextOccurrence(series, todo, t.app.Clock().Now())
+	if err != nil || next == nil {
+		return err
+	}
+	if _, err := tx.NewInsert().Model(next).Returning("*").Exec(ctx); err != nil {
+		return err
+	}
+	_, err = tx.NewRaw(
+		"INSERT INTO todo_tags (todo_id, tag_id) SELECT ?, tag_id FROM todo_tags WHERE todo_id = ?",
+		next.ID, todo.ID,
+	).Exec(ctx)
+	if err != nil {
+		return err
+	}
+	if err := t.copyReminders(ctx, tx, todo, next); err != nil {
+		return err
+	}
+
+	series.Occurrences++
+	_, err = tx.NewUpdate().Model(series).Column("occurrences").WherePK().Exec(ctx)
+	return err
+}
+
+// endSeriesOf deletes the series of todo when todo is its latest occurrence,
+// nothing would create the next one once it is gone.
+func (t *TodoHandler) endSeriesOf(ctx context.Context, tx bun.Tx, todo *db.Todo) error {
+	if todo.SeriesID == 0 {
+		return nil
+	}
+	_, err := tx.NewDelete().Model((*db.TodoSeries)(nil)).
+		Where("ts.id = ?", todo.SeriesID).
+		Where("NOT EXISTS (SELECT 1 FROM todos AS i WHERE i.series_id = ts.id AND i.occurrence_at > ?)", todo.OccurrenceAt).
+		Exec(ctx)
+	return err
+}
+
+// loadSeries loads the series of a recurring todo.
+func (t *TodoHandler) loadSeries(ctx context.Context, todo *db.Todo) error {
+	if todo.SeriesID == 0 {
+		return nil
+	}
+	todo.Series = new(db.TodoSeries)
+	err := t.app.DB().NewSelect().Model(todo.Series).Where("ts.id = ?", todo.SeriesID).Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		todo.Series = nil
+		return nil
+	}
+	return err
+}
+
+// errInvalidRecurrence is a recurrence the request asked for that cannot be
+// scheduled.
+type errInvalidRecurrence struct {
+	err error
+}
+
+func (e errInvalidRecurrence) Error() string {
+	return e.err.Error()
+}
+
+func (e errInvalidRecurrence) Unwrap() error {
+	return e.err
+}
@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+	"todo-app/internal/db"
+	"todo-app/internal/dtos"
+)
+
+const (
+	DueToday    = "today"
+	DueOverdue  = "overdue"
+	DueThisWeek = "this_week"
+)
+
+// todoSchedule is a parsed dtos.TodoScheduleDTO. Nil fields are left
+// unchanged, zero values clear the field.
+type todoSchedule struct {
+	dueAt, startAt     *time.Time
+	dueDate, startDate *db.Date
+	allDay             *bool
+}
+
+func parseTodoSchedule(req dtos.TodoScheduleDTO) (*todoSchedule, error) {
+	s := &todoSchedule{allDay: req.AllDay}
+	var err error
+	if s.dueAt, err = parseScheduleTime(req.DueAt, "due_at"); err != nil {
+		return nil, err
+	}
+	if s.startAt, err = parseScheduleTime(req.StartAt, "start_at"); err != nil {
+		return nil, err
+	}
+	if s.dueDate, err = parseScheduleDate(req.DueDate, "due_date"); err != nil {
+		return nil, err
+	}
+	if s.startDate, err = parseScheduleDate(req.StartDate, "start_date"); err != nil {
+		return nil, err
+	}
+	if (s.dueAt != nil && !s.dueAt.IsZero() && s.dueDate != nil && !s.dueDate.IsZero()) ||
+		(s.startAt != nil && !s.startAt.IsZero() && s.startDate != nil && !s.startDate.IsZero()) {
+		return nil, errors.New("a todo is either all-day with dates or has timestamps, not both")
+	}
+	return s, nil
+}
+
+func parseScheduleTime(v *string, name string) (*time.Time, error) {
+	if v == nil {
+		return nil, nil
+	}
+	var t time.Time
+	if *v != "" {
+		var err error
+		if t, err = time.Parse(time.RFC3339, *v); err != nil {
+			return nil, fmt.Errorf("invalid %s, expected RFC3339 timestamp", name)
+		}
+	}
+	return &t, nil
+}
+
+func parseScheduleDate(v *string, name string) (*db.Date, error) {
+	if v == nil {
+		return nil, nil
+	}
+	var d db.Date
+	if *v != "" {
+		var err error
+		if d, err = db.ParseDate(*v); err != nil {
+			return nil, fmt.Errorf("invalid %s, expected YYYY-MM-DD", name)
+		}
+	}
+	return &d, nil
+}
+
+// changed reports whether the request changes the schedule.
+func (s *todoSchedule) changed() bool {
+	return s.dueAt != nil || s.startAt != nil || s.dueDate != nil || s.startDate != nil || s.allDay != nil
+}
+
+// apply sets the schedule of todo. Without an explicit all_day the request
+// decides by the kind of the fields it sets. loc is only called when
+// timestamps have to be turned into dates.
+func (s *todoSchedule) apply(todo *db.Todo, loc func() (*time.Location, error)) error {
+	if s.dueAt != nil {
+		todo.DueAt = *s.dueAt
+	}
+	if s.startAt != nil {
+		todo.StartAt = *s.startAt
+	}
+	if s.dueDate != nil {
+		todo.DueDate = *s.dueDate
+	}
+	if s.startDate != nil {
+		todo.StartDate = *s.startDate
+	}
+
+	allDay := todo.AllDay
+	switch {
+	case s.allDay != nil:
+		allDay = *s.allDay
+	case (s.dueDate != nil && !s.dueDate.IsZero()) || (s.startDate != nil && !s.startDate.IsZero()):
+		allDay = true
+	case (s.dueAt != nil && !s.dueAt.IsZero()) || (s.startAt != nil && !s.startAt.IsZero()):
+		allDay = false
+	}
+
+	if allDay {
+		if !todo.DueAt.IsZero() || !todo.StartAt.IsZero() {
+			l, err := loc()
+			if err != nil {
+				return err
+			}
+			if todo.DueDate.IsZero() && !todo.DueAt.IsZero() {
+				todo.DueDate = db.DateOf(todo.DueAt.In(l))
+			}
+			if todo.StartDate.IsZero() && !todo.StartAt.IsZero() {
+				todo.StartDate = db.DateOf(todo.StartAt.In(l))
+			}
+			todo.DueAt, todo.StartAt = time.Time{}, time.Time{}
+		}
+	} else {
+		// A date has no time to turn into, the request has to give one.
+		if !todo.DueDate.IsZero() {
+			if s.dueAt == nil {
+				return errors.New("due_at is required when the todo is not all-day")
+			}
+			todo.DueDate = db.Date{}
+		}
+		if !todo.StartDate.IsZero() {
+			if s.startAt == nil {
+				return errors.New("start_at is required when the todo is not all-day")
+			}
+			todo.StartDate = db.Date{}
+		}
+	}
+	todo.AllDay = allDay
+
+	if !todo.StartDate.IsZero() && !todo.DueDate.IsZero() && todo.StartDate.After(todo.DueDate) {
+		return errors.New("start_date must not be after due_date")
+	}
+	if !todo.StartAt.IsZero() && !todo.DueAt.IsZero() && todo.StartAt.After(todo.DueAt) {
+		return errors.New("start_at must not be after due_at")
+	}
+	return nil
+}
+
+// userLocation returns the timezone of the profile of the user.
+func (t *TodoHandler) userLocation(ctx context.Context, userID int64) (*time.Location, error) {
+	var timezone string
+	err := t.app.DB().NewSelect().Model((*db.User)(nil)).
+		Column("timezone").
+		Where("id = ?", userID).
+		Scan(ctx, &timezone)
+	if err != nil {
+		return nil, err
+	}
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		// The profile only accepts known zones, this one left the tz database.
+		return time.UTC, nil
+	}
+	return loc, nil
+}
+
+// ResolveDueFilter sets the bounds of the due filter of f for the current
+// time now in the timezone loc. Weeks start on Monday.
+func ResolveDueFilter(f *dtos.TodoFilterDTO, now time.Time, loc *time.Location) {
+	today := db.DateOf(now.In(loc))
+	switch f.Due {
+	case DueToday:
+		f.DueFromDate, f.DueToDate = today, today.AddDays(1)
+	case DueThisWeek:
+		monday := today.AddDays(-((int(today.Weekday()) + 6) % 7))
+		f.DueFromDate, f.DueToDate = monday, monday.AddDays(7)
+	case DueOverdue:
+		f.DueFrom, f.DueTo = time.Time{}, now
+		f.DueFromDate, f.DueToDate = db.Date{}, today
+		return
+	default:
+		return
+	}
+	f.DueFrom, f.DueTo = f.DueFromDate.In(loc), f.DueToDate.In(loc)
+}
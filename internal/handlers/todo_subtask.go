@@ -0,0 +1,316 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"todo-app/bunapp"
+	"todo-app/httputil/httperror"
+	"todo-app/internal/db"
+
+	"github.com/go-chi/render"
+	"github.com/uptrace/bun"
+)
+
+// ExpandSubtasks is the expand query param of GetTodo that includes the
+// tree of subtasks.
+const ExpandSubtasks = "subtasks"
+
+var errOpenSubtasks = errors.New("the todo has open subtasks or checklist items, complete them first or set cascade")
+
+// findParent loads the todo that is to become the parent of another one.
+// The caller checks the access to its list. It renders the error response
+// itself and returns false when the request should stop.
+func (t *TodoHandler) findParent(w http.ResponseWriter, r *http.Request, id int64) (*db.Todo, bool) {
+	if id < 0 {
+		render.Render(w, r, httperror.ErrInvalidRequest(errors.New("invalid parent_id")))
+		return nil, false
+	}
+	parent := new(db.Todo)
+	err := t.app.DB().NewSelect().Model(parent).Where("i.id = ?", id).Scan(r.Context())
+	if errors.Is(err, sql.ErrNoRows) {
+		render.Render(w, r, httperror.ErrBadRequest(errors.New("parent does not exist")))
+		return nil, false
+	}
+	if err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return nil, false
+	}
+	return parent, true
+}
+
+// subtaskIDs returns the ids of the subtasks at any depth below the todo.
+func subtaskIDs(ctx context.Context, idb bun.IDB, todoID int64) ([]int64, error) {
+	ids := make([]int64, 0)
+	err := idb.NewRaw(`WITH RECURSIVE subtasks AS (
+			SELECT id, 1 AS depth FROM todos WHERE parent_id = ?
+			UNION ALL
+			SELECT i.id, s.depth + 1 FROM todos AS i JOIN subtasks AS s ON i.parent_id = s.id WHERE s.depth < ?
+		)
+		SELECT id FROM subtasks`,
+		todoID, bunapp.SubtaskDepthLimit,
+	).Scan(ctx, &ids)
+	return ids, err
+}
+
+// loadSubtasks loads the subtasks at any depth below the todo, with their
+// tags and checklists when full is set.
+func loadSubtasks(ctx context.Context, idb bun.IDB, todoID int64, full bool) ([]*db.Todo, error) {
+	ids, err := subtaskIDs(ctx, idb, todoID)
+	if err != nil || len(ids) == 0 {
+		return nil, err
+	}
+	var subtasks []*db.Todo
+	q := idb.NewSelect().Model(&subtasks).Where("i.id IN (?)", bun.In(ids)).Order("i.id")
+	if full {
+		q = q.Relation("Tags").Relation("Checklist", orderChecklist)
+	}
+	return subtasks, q.Scan(ctx)
+}
+
+// todoDepth returns how many levels the todo is below a top-level todo.
+func todoDepth(ctx context.Context, idb bun.IDB, todoID int64) (int, error) {
+	var depth int
+	err := idb.NewRaw(`WITH RECURSIVE ancestors AS (
+			SELECT parent_id, 0 AS depth FROM todos WHERE id = ?
+			UNION ALL
+			SELECT i.parent_id, a.depth + 1 FROM todos AS i JOIN ancestors AS a ON i.id = a.parent_id WHERE a.depth < ?
+		)
+		SELECT COALESCE(MAX(depth), 0) FROM ancestors`,
+		todoID, bunapp.SubtaskDepthLimit,
+	).Scan(ctx, &depth)
+	return depth, err
+}
+
+// BuildTodoTree sets the Subtasks of root and of each of subtasks, the
+// subtasks at any depth below root. Siblings are ordered by id.
+func BuildTodoTree(root *db.Todo, subtasks []*db.Todo) {
+	children := make(map[int64][]*db.Todo, len(subtasks))
+	for _, todo := range subtasks {
+		children[todo.ParentID] = append(children[todo.ParentID], todo)
+	}
+	var link func(todo *db.Todo)
+	link = func(todo *db.Todo) {
+		todo.Subtasks = children[todo.ID]
+		sort.Slice(todo.Subtasks, func(i, j int) bool { return todo.Subtasks[i].ID < todo.Subtasks[j].ID })
+		for _, child := range todo.Subtasks {
+			link(child)
+		}
+	}
+	link(root)
+}
+
+// ComputeTodoProgress sets the Progress of todo and of its Subtasks at any
+// depth from their statuses and checklists.
+func ComputeTodoProgress(todo *db.Todo) *db.TodoProgress {
+	p := &db.TodoProgress{ChecklistItems: len(todo.Checklist)}
+	for _, item := range todo.Checklist {
+		if item.Done {
+			p.ChecklistDone++
+		}
+	}
+	for _, child := range todo.Subtasks {
+		cp := ComputeTodoProgress(child)
+		p.Subtasks += 1 + cp.Subtasks
+		p.SubtasksDone += cp.SubtasksDone
+		if child.Status == db.DONE {
+			p.SubtasksDone++
+		}
+	}
+
+	switch total := p.Subtasks + p.ChecklistItems; {
+	case total > 0:
+		p.Percent = (p.SubtasksDone + p.ChecklistDone) * 100 / total
+	case todo.Status == db.DONE:
+		p.Percent = 100
+	}
+	todo.Progress = p
+	return p
+}
+
+// flattenTodoTree returns todo and its Subtasks at any depth.
+func flattenTodoTree(todo *db.Todo) []*db.Todo {
+	todos := []*db.Todo{todo}
+	for _, child := range todo.Subtasks {
+		todos = append(todos, flattenTodoTree(child)...)
+	}
+	return todos
+}
+
+// treeHeight returns how many levels of subtasks are below the todo rootID.
+func treeHeight(rootID int64, subtasks []*db.Todo) int {
+	parents := make(map[int64]int64, len(subtasks))
+	for _, todo := range subtasks {
+		parents[todo.ID] = todo.ParentID
+	}
+	height := 0
+	for _, todo := range subtasks {
+		depth := 1
+		for id := todo.ParentID; id != rootID && depth <= len(subtasks); id = parents[id] {
+			depth++
+		}
+		height = max(height, depth)
+	}
+	return height
+}
+
+// loadTodoTree loads the checklist and the progress of todo and, when
+// expand is set, the tree of its subtasks.
+func (t *TodoHandler) loadTodoTree(ctx context.Context, todo *db.Todo, expand bool) error {
+	todo.Checklist = nil
+	err := t.app.DB().NewSelect().Model(todo).
+		Column("i.id").
+		Relation("Checklist", orderChecklist).
+		WherePK().
+		Scan(ctx)
+	if err != nil {
+		return err
+	}
+	subtasks, err := loadSubtasks(ctx, t.app.DB(), todo.ID, expand)
+	if err != nil {
+		return err
+	}
+
+	BuildTodoTree(todo, subtasks)
+	ComputeTodoProgress(todo)
+	if !expand {
+		todo.Subtasks = nil
+	}
+	return nil
+}
+
+// checkSubtaskPlace checks that todo can be a subtask of its parent after
+// it was created or moved. lists are the lists the todo moves between,
+// they are locked so that concurrent moves cannot build a cycle.
+func (t *TodoHandler) checkSubtaskPlace(ctx context.Context, tx bun.Tx, todo *db.Todo, lists ...int64) error {
+	err := lockLists(ctx, tx, lists...)
+	if err != nil || todo.ParentID == 0 {
+		return err
+	}
+	if todo.SeriesID != 0 {
+		return errInvalidSubtask{errors.New("recurring todos cannot be subtasks")}
+	}
+
+	parent := new(db.Todo)
+	err = tx.NewSelect().Model(parent).Where("i.id = ?", todo.ParentID).Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return errInvalidSubtask{errors.New("parent does not exist")}
+	}
+	if err != nil {
+		return err
+	}
+	if parent.ListID != todo.ListID {
+		return errInvalidSubtask{errors.New("list_id must be the list of the parent")}
+	}
+
+	if parent.ID == todo.ID {
+		return errInvalidSubtask{errors.New("a todo cannot be its own parent")}
+	}
+	height := 0
+	if todo.ID != 0 {
+		subtasks, err := loadSubtasks(ctx, tx, todo.ID, false)
+		if err != nil {
+			return err
+		}
+		for _, subtask := range subtasks {
+			if subtask.ID == parent.ID {
+				return errInvalidSubtask{errors.New("a todo cannot be moved below one of its subtasks")}
+			}
+		}
+		height = treeHeight(todo.ID, subtasks)
+	}
+	depth, err := todoDepth(ctx, tx, parent.ID)
+	if err != nil {
+		return err
+	}
+	if maxDepth := t.app.SubtaskMaxDepth(); depth+1+height > maxDepth {
+		return errInvalidSubtask{fmt.Errorf("subtasks nest at most %d levels deep", maxDepth)}
+	}
+	return nil
+}
+
+// completeSubtasks completes the open subtasks and checklist items of todo
+// when cascade is set and fails with errOpenSubtasks otherwise.
+func (t *TodoHandler) completeSubtasks(ctx context.Context, tx bun.Tx, todo *db.Todo, cascade bool) error {
+	ids, err := subtaskIDs(ctx, tx, todo.ID)
+	if err != nil {
+		return err
+	}
+
+	if !cascade {
+		open, err := tx.NewSelect().Model((*db.ChecklistItem)(nil)).
+			Where("ci.todo_id = ?", todo.ID).
+			Where("NOT ci.done").
+			Exists(ctx)
+		if err != nil {
+			return err
+		}
+		if !open && len(ids) > 0 {
+			open, err = tx.NewSelect().Model((*db.Todo)(nil)).
+				Where("i.id IN (?)", bun.In(ids)).
+				Where("i.status <> ?", db.DONE).
+				Exists(ctx)
+			if err != nil {
+				return err
+			}
+		}
+		if open {
+			return errOpenSubtasks
+		}
+		return nil
+	}
+
+	now := t.app.Clock().Now()
+	if len(ids) > 0 {
+		_, err := tx.NewUpdate().Model((*db.Todo)(nil)).
+			Set("status = ?", db.DONE).
+			Set("updated_at = ?", now).
+			Where("id IN (?)", bun.In(ids)).
+			Where("status <> ?", db.DONE).
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = tx.NewUpdate().Model((*db.ChecklistItem)(nil)).
+		Set("done = TRUE").
+		Set("updated_at = ?", now).
+		Where("todo_id IN (?)", bun.In(append(ids, todo.ID))).
+		Where("NOT done").
+		Exec(ctx)
+	return err
+}
+
+// lockLists serializes the changes of the graphs of subtasks and
+// dependencies in the lists until tx ends. Lists are locked in id order to
+// avoid deadlocks, todos can still be added to them.
+func lockLists(ctx context.Context, tx bun.Tx, lists ...int64) error {
+	var locked []int64
+	return tx.NewSelect().Model((*db.List)(nil)).
+		Column("l.id").
+		Where("l.id IN (?)", bun.In(lists)).
+		Order("l.id").
+		For("NO KEY UPDATE").
+		Scan(ctx, &locked)
+}
+
+func orderChecklist(q *bun.SelectQuery) *bun.SelectQuery {
+	return q.Order("ci.position", "ci.id")
+}
+
+// errInvalidSubtask is a place in the tree of subtasks the request asked
+// for that the todo cannot take.
+type errInvalidSubtask struct {
+	err error
+}
+
+func (e errInvalidSubtask) Error() string {
+	return e.err.Error()
+}
+
+func (e errInvalidSubtask) Unwrap() error {
+	return e.err
+}
@@ -0,0 +1,654 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"todo-app/httputil/httperror"
+	"todo-app/httputil/httpresponse"
+	"todo-app/internal/constants"
+	"todo-app/internal/db"
+	"todo-app/internal/dtos"
+
+	"github.com/go-chi/render"
+	"github.com/uptrace/bun"
+)
+
+// WorkspaceHeader selects the workspace of a request. Without it the
+// workspace of the token is used, and the personal workspace of the user
+// when the token has none.
+const WorkspaceHeader = "X-Workspace-ID"
+
+var (
+	errNotWorkspaceMember = errors.New("you are not a member of this workspace")
+	errLastWorkspaceAdmin = errors.New("a workspace needs at least one admin")
+	errOwnsWorkspaceLists = errors.New("the member still owns lists in this workspace, transfer or delete them first")
+)
+
+// Workspace resolves the active workspace of the request and checks that the
+// current user is a member of it. It has to run after the Authorization
+// middleware.
+func (t *TodoHandler) Workspace(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := currentUser(r)
+		if !ok {
+			render.Render(w, r, httperror.ErrUnAuthorized(errors.New("unauthorized")))
+			return
+		}
+
+		id := claims.WorkspaceID
+		if header := r.Header.Get(WorkspaceHeader); header != "" {
+			selected, err := strconv.ParseInt(header, 10, 64)
+			if err != nil || selected <= 0 {
+				render.Render(w, r, httperror.ErrInvalidRequest(errors.New("invalid "+WorkspaceHeader+" header")))
+				return
+			}
+			if id != 0 && selected != id {
+				render.Render(w, r, httperror.ErrForbidden(fmt.Errorf("the token is restricted to workspace %d", id)))
+				return
+			}
+			id = selected
+		}
+
+		var workspace *db.Workspace
+		var err error
+		if id == 0 {
+			workspace, err = personalWorkspace(r.Context(), t.app.DB(), claims.Sub, t.app.Clock().Now())
+		} else {
+			workspace, err = selectWorkspace(r.Context(), t.app.DB(), claims.Sub, id)
+		}
+		if errors.Is(err, sql.ErrNoRows) {
+			render.Render(w, r, httperror.ErrForbidden(errNotWorkspaceMember))
+			return
+		}
+		if err != nil {
+			render.Render(w, r, httperror.ErrInternalError(err))
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), constants.CurrentWorkspace, workspace)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// selectWorkspace loads a workspace together with the role of userID in it.
+// It returns sql.ErrNoRows when the user is not a member.
+func selectWorkspace(ctx context.Context, idb bun.IDB, userID, workspaceID int64) (*db.Workspace, error) {
+	workspace := new(db.Workspace)
+	err := idb.NewSelect().Model(workspace).
+		ColumnExpr("w.*").
+		ColumnExpr("wm.role").
+		Join("JOIN workspace_members AS wm ON wm.workspace_id = w.id").
+		Where("wm.user_id = ?", userID).
+		Where("w.id = ?", workspaceID).
+		Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return workspace, nil
+}
+
+// personalWorkspace returns the personal workspace of userID, creating it on
+// first use for accounts registered after the workspace migration.
+func personalWorkspace(ctx context.Context, idb bun.IDB, userID int64, now time.Time) (*db.Workspace, error) {
+	workspace := new(db.Workspace)
+	err := idb.NewSelect().Model(workspace).
+		Where("w.personal").
+		Where("w.created_by = ?", userID).
+		Scan(ctx)
+	if err == nil {
+		workspace.Role = db.WorkspaceRoleAdmin
+		return workspace, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	workspace = &db.Workspace{
+		Name:      db.PersonalWorkspaceName,
+		Personal:  true,
+		CreatedBy: userID,
+		CreatedAt: now,
+		UpdatedAt: now,
+		Role:      db.WorkspaceRoleAdmin,
+	}
+	err = idb.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		res, err := tx.NewInsert().Model(workspace).
+			On("CONFLICT (created_by) WHERE personal DO NOTHING").
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			// Created by a concurrent request.
+			return sql.ErrNoRows
+		}
+		_, err = tx.NewInsert().Model(&db.WorkspaceMember{
+			WorkspaceID: workspace.ID,
+			UserID:      userID,
+			Role:        db.WorkspaceRoleAdmin,
+			CreatedAt:   now,
+		}).Exec(ctx)
+		return err
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return personalWorkspace(ctx, idb, userID, now)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return workspace, nil
+}
+
+// CreateWorkspace implements handlers.TodoHandlerService.
+// @Summary Create workspace
+// @Description Create a workspace, the current user becomes its admin
+// @Tags Workspace
+// @Accept json
+// @Produce json
+// @Param request body dtos.WorkspaceDTO true "Create workspace request body"
+// @Success 201 {object} httpresponse.SingleResponse{data=db.Workspace}
+// @Failure 400 {object} httperror.ErrResponse
+// @Failure 403 {object} httperror.ErrResponse
+// @Router /api/workspaces [post]
+func (t *TodoHandler) CreateWorkspace(w http.ResponseWriter, r *http.Request) {
+	claims, ok := currentUser(r)
+	if !ok {
+		render.Render(w, r, httperror.ErrUnAuthorized(errors.New("unauthorized")))
+		return
+	}
+	if claims.IsAnonymous {
+		render.Render(w, r, httperror.ErrForbidden(errors.New("guests cannot create workspaces, register first")))
+		return
+	}
+
+	var req dtos.WorkspaceDTO
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		render.Render(w, r, httperror.ErrInvalidRequest(err))
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		render.Render(w, r, httperror.ErrInvalidRequest(errors.New("name is required")))
+		return
+	}
+
+	now := t.app.Clock().Now()
+	workspace := &db.Workspace{
+		Name:      req.Name,
+		CreatedBy: claims.Sub,
+		CreatedAt: now,
+		UpdatedAt: now,
+		Role:      db.WorkspaceRoleAdmin,
+	}
+	err := t.app.DB().RunInTx(r.Context(), nil, func(ctx context.Context, tx bun.Tx) error {
+		if _, err := tx.NewInsert().Model(workspace).Exec(ctx); err != nil {
+			return err
+		}
+		_, err := tx.NewInsert().Model(&db.WorkspaceMember{
+			WorkspaceID: workspace.ID,
+			UserID:      claims.Sub,
+			Role:        db.WorkspaceRoleAdmin,
+			CreatedAt:   now,
+		}).Exec(ctx)
+		return err
+	})
+	if err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+
+	render.Render(w, r, httpresponse.WriteResponse(w, http.StatusCreated, "success", workspace))
+}
+
+// GetWorkspaces implements handlers.TodoHandlerService.
+// @Summary Get workspaces
+// @Description Get the workspaces the current user is a member of, with the role of the user in each
+// @Tags Workspace
+// @Produce json
+// @Success 200 {object} httpresponse.CollectionResponse{data=[]db.Workspace}
+// @Router /api/workspaces [get]
+func (t *TodoHandler) GetWorkspaces(w http.ResponseWriter, r *http.Request) {
+	claims, ok := currentUser(r)
+	if !ok {
+		render.Render(w, r, httperror.ErrUnAuthorized(errors.New("unauthorized")))
+		return
+	}
+
+	// Make sure the personal workspace shows up for new accounts.
+	if _, err := personalWorkspace(r.Context(), t.app.DB(), claims.Sub, t.app.Clock().Now()); err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+
+	workspaces := make([]*db.Workspace, 0)
+	q := t.app.DB().NewSelect().Model(&workspaces).
+		ColumnExpr("w.*").
+		ColumnExpr("wm.role").
+		Join("JOIN workspace_members AS wm ON wm.workspace_id = w.id").
+		Where("wm.user_id = ?", claims.Sub).
+		Order("w.personal DESC", "w.id ASC")
+	if claims.WorkspaceID != 0 {
+		q = q.Where("w.id = ?", claims.WorkspaceID)
+	}
+	total, err := q.ScanAndCount(r.Context())
+	if err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+
+	render.Render(w, r, httpresponse.WriteCollectionResponse(w, http.StatusOK, "success", workspaces, total))
+}
+
+// GetWorkspace implements handlers.TodoHandlerService.
+// @Summary Get workspace
+// @Description Get a workspace the current user is a member of
+// @Tags Workspace
+// @Produce json
+// @Param id path int true "Workspace ID"
+// @Success 200 {object} httpresponse.SingleResponse{data=db.Workspace}
+// @Failure 404 {object} httperror.ErrResponse
+// @Router /api/workspaces/{id} [get]
+func (t *TodoHandler) GetWorkspace(w http.ResponseWriter, r *http.Request) {
+	workspace, ok := t.findWorkspace(w, r, db.WorkspaceRoleMember)
+	if !ok {
+		return
+	}
+
+	render.Render(w, r, httpresponse.WriteResponse(w, http.StatusOK, "success", workspace))
+}
+
+// UpdateWorkspace implements handlers.TodoHandlerService.
+// @Summary Rename workspace
+// @Description Rename a workspace. Only admins can rename it
+// @Tags Workspace
+// @Accept json
+// @Produce json
+// @Param id path int true "Workspace ID"
+// @Param request body dtos.WorkspaceDTO true "Rename workspace request body"
+// @Success 200 {object} httpresponse.SingleResponse{data=db.Workspace}
+// @Failure 400 {object} httperror.ErrResponse
+// @Failure 403 {object} httperror.ErrResponse
+// @Failure 404 {object} httperror.ErrResponse
+// @Router /api/workspaces/{id} [put]
+func (t *TodoHandler) UpdateWorkspace(w http.ResponseWriter, r *http.Request) {
+	workspace, ok := t.findWorkspace(w, r, db.WorkspaceRoleAdmin)
+	if !ok {
+		return
+	}
+
+	var req dtos.WorkspaceDTO
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		render.Render(w, r, httperror.ErrInvalidRequest(err))
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		render.Render(w, r, httperror.ErrInvalidRequest(errors.New("name is required")))
+		return
+	}
+
+	workspace.Name = req.Name
+	workspace.UpdatedAt = t.app.Clock().Now()
+	_, err := t.app.DB().NewUpdate().Model(workspace).
+		Column("name", "updated_at").
+		WherePK().
+		Exec(r.Context())
+	if err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+
+	render.Render(w, r, httpresponse.WriteResponse(w, http.StatusOK, "success", workspace))
+}
+
+// DeleteWorkspace implements handlers.TodoHandlerService.
+// @Summary Delete workspace
+// @Description Delete a workspace together with all of its lists, todos and tags. Only admins can delete it, personal workspaces cannot be deleted
+// @Tags Workspace
+// @Produce json
+// @Param id path int true "Workspace ID"
+// @Success 200 {object} httpresponse.SingleResponse
+// @Failure 400 {object} httperror.ErrResponse
+// @Failure 403 {object} httperror.ErrResponse
+// @Failure 404 {object} httperror.ErrResponse
+// @Router /api/workspaces/{id} [delete]
+func (t *TodoHandler) DeleteWorkspace(w http.ResponseWriter, r *http.Request) {
+	workspace, ok := t.findWorkspace(w, r, db.WorkspaceRoleAdmin)
+	if !ok {
+		return
+	}
+	if workspace.Personal {
+		render.Render(w, r, httperror.ErrBadRequest(errors.New("the personal workspace cannot be deleted")))
+		return
+	}
+
+	// lists, tags and workspace_members reference the workspace with ON
+	// DELETE CASCADE, and todos cascade from their lists.
+	_, err := t.app.DB().NewDelete().Model(workspace).WherePK().Exec(r.Context())
+	if err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+
+	render.Render(w, r, httpresponse.WriteResponse(w, http.StatusOK, "success", nil))
+}
+
+// GetWorkspaceMembers implements handlers.TodoHandlerService.
+// @Summary Get workspace members
+// @Description Get the members of a workspace. Any member can read them
+// @Tags Workspace
+// @Produce json
+// @Param id path int true "Workspace ID"
+// @Success 200 {object} httpresponse.CollectionResponse{data=[]db.WorkspaceMember}
+// @Failure 404 {object} httperror.ErrResponse
+// @Router /api/workspaces/{id}/members [get]
+func (t *TodoHandler) GetWorkspaceMembers(w http.ResponseWriter, r *http.Request) {
+	workspace, ok := t.findWorkspace(w, r, db.WorkspaceRoleMember)
+	if !ok {
+		return
+	}
+
+	members := make([]*db.WorkspaceMember, 0)
+	total, err := t.app.DB().NewSelect().Model(&members).
+		ColumnExpr("wm.*").
+		ColumnExpr("u.username").
+		Join("JOIN users AS u ON u.id = wm.user_id").
+		Where("wm.workspace_id = ?", workspace.ID).
+		Order("wm.id ASC").
+		ScanAndCount(r.Context())
+	if err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+
+	render.Render(w, r, httpresponse.WriteCollectionResponse(w, http.StatusOK, "success", members, total))
+}
+
+// AddWorkspaceMember implements handlers.TodoHandlerService.
+// @Summary Add workspace member
+// @Description Add a registered user by username as admin or member. Only admins can add members, personal workspaces have none
+// @Tags Workspace
+// @Accept json
+// @Produce json
+// @Param id path int true "Workspace ID"
+// @Param request body dtos.AddWorkspaceMemberDTO true "Username and role"
+// @Success 201 {object} httpresponse.SingleResponse{data=db.WorkspaceMember}
+// @Failure 400 {object} httperror.ErrResponse
+// @Failure 403 {object} httperror.ErrResponse
+// @Router /api/workspaces/{id}/members [post]
+func (t *TodoHandler) AddWorkspaceMember(w http.ResponseWriter, r *http.Request) {
+	workspace, ok := t.findWorkspace(w, r, db.WorkspaceRoleAdmin)
+	if !ok {
+		return
+	}
+	if workspace.Personal {
+		render.Render(w, r, httperror.ErrBadRequest(errors.New("personal workspaces cannot have members, create a workspace to share")))
+		return
+	}
+
+	var req dtos.AddWorkspaceMemberDTO
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		render.Render(w, r, httperror.ErrInvalidRequest(err))
+		return
+	}
+	req.Username = strings.TrimSpace(req.Username)
+	if req.Username == "" {
+		render.Render(w, r, httperror.ErrInvalidRequest(errors.New("username is required")))
+		return
+	}
+	if req.Role == "" {
+		req.Role = db.WorkspaceRoleMember
+	}
+	if req.Role != db.WorkspaceRoleAdmin && req.Role != db.WorkspaceRoleMember {
+		render.Render(w, r, httperror.ErrInvalidRequest(errors.New("role must be admin or member")))
+		return
+	}
+
+	user := new(db.User)
+	err := t.app.DB().NewSelect().Model(user).
+		Where("username = ?", req.Username).
+		Where("NOT is_anonymous").
+		Scan(r.Context())
+	if errors.Is(err, sql.ErrNoRows) {
+		render.Render(w, r, httperror.ErrBadRequest(errors.New("user does not exist")))
+		return
+	}
+	if err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+
+	member := &db.WorkspaceMember{
+		WorkspaceID: workspace.ID,
+		UserID:      user.ID,
+		Role:        req.Role,
+		CreatedAt:   t.app.Clock().Now(),
+		Username:    user.Username,
+	}
+	_, err = t.app.DB().NewInsert().Model(member).Exec(r.Context())
+	if isUniqueViolation(err) {
+		render.Render(w, r, httperror.ErrBadRequest(errors.New("user is already a member")))
+		return
+	}
+	if err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+
+	render.Render(w, r, httpresponse.WriteResponse(w, http.StatusCreated, "success", member))
+}
+
+// UpdateWorkspaceMember implements handlers.TodoHandlerService.
+// @Summary Change workspace member role
+// @Description Change the role of a member to admin or member. Only admins can change roles
+// @Tags Workspace
+// @Accept json
+// @Produce json
+// @Param id path int true "Workspace ID"
+// @Param userID path int true "User ID of the member"
+// @Param request body dtos.UpdateWorkspaceMemberDTO true "New role"
+// @Success 200 {object} httpresponse.SingleResponse
+// @Failure 400 {object} httperror.ErrResponse
+// @Failure 403 {object} httperror.ErrResponse
+// @Failure 404 {object} httperror.ErrResponse
+// @Router /api/workspaces/{id}/members/{userID} [put]
+func (t *TodoHandler) UpdateWorkspaceMember(w http.ResponseWriter, r *http.Request) {
+	workspace, ok := t.findWorkspace(w, r, db.WorkspaceRoleAdmin)
+	if !ok {
+		return
+	}
+	userID, err := parseIDParam(r, "userID")
+	if err != nil {
+		render.Render(w, r, httperror.ErrInvalidRequest(err))
+		return
+	}
+
+	var req dtos.UpdateWorkspaceMemberDTO
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		render.Render(w, r, httperror.ErrInvalidRequest(err))
+		return
+	}
+	if req.Role != db.WorkspaceRoleAdmin && req.Role != db.WorkspaceRoleMember {
+		render.Render(w, r, httperror.ErrInvalidRequest(errors.New("role must be admin or member")))
+		return
+	}
+
+	err = t.app.DB().RunInTx(r.Context(), nil, func(ctx context.Context, tx bun.Tx) error {
+		if req.Role != db.WorkspaceRoleAdmin {
+			if err := checkOtherAdmin(ctx, tx, workspace.ID, userID); err != nil {
+				return err
+			}
+		}
+		res, err := tx.NewUpdate().Model((*db.WorkspaceMember)(nil)).
+			Set("role = ?", req.Role).
+			Where("workspace_id = ?", workspace.ID).
+			Where("user_id = ?", userID).
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return sql.ErrNoRows
+		}
+		return nil
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		render.Render(w, r, httperror.ErrNotFound())
+		return
+	}
+	if errors.Is(err, errLastWorkspaceAdmin) {
+		render.Render(w, r, httperror.ErrBadRequest(err))
+		return
+	}
+	if err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+
+	render.Render(w, r, httpresponse.WriteResponse(w, http.StatusOK, "success", nil))
+}
+
+// RemoveWorkspaceMember implements handlers.TodoHandlerService.
+// @Summary Remove workspace member
+// @Description Remove a member from a workspace, which also removes them from its lists. Admins can remove anyone, members can only remove themselves to leave. Members that still own lists in the workspace have to transfer them first
+// @Tags Workspace
+// @Produce json
+// @Param id path int true "Workspace ID"
+// @Param userID path int true "User ID of the member"
+// @Success 200 {object} httpresponse.SingleResponse
+// @Failure 400 {object} httperror.ErrResponse
+// @Failure 403 {object} httperror.ErrResponse
+// @Failure 404 {object} httperror.ErrResponse
+// @Router /api/workspaces/{id}/members/{userID} [delete]
+func (t *TodoHandler) RemoveWorkspaceMember(w http.ResponseWriter, r *http.Request) {
+	workspace, ok := t.findWorkspace(w, r, db.WorkspaceRoleMember)
+	if !ok {
+		return
+	}
+	userID, err := parseIDParam(r, "userID")
+	if err != nil {
+		render.Render(w, r, httperror.ErrInvalidRequest(err))
+		return
+	}
+	claims, _ := currentUser(r)
+	if userID != claims.Sub && workspace.Role != db.WorkspaceRoleAdmin {
+		render.Render(w, r, httperror.ErrForbidden(errors.New("this requires the admin role in the workspace")))
+		return
+	}
+
+	err = t.app.DB().RunInTx(r.Context(), nil, func(ctx context.Context, tx bun.Tx) error {
+		if err := checkOtherAdmin(ctx, tx, workspace.ID, userID); err != nil {
+			return err
+		}
+		owns, err := tx.NewSelect().Model((*db.List)(nil)).
+			Where("workspace_id = ?", workspace.ID).
+			Where("user_id = ?", userID).
+			Exists(ctx)
+		if err != nil {
+			return err
+		}
+		if owns {
+			return errOwnsWorkspaceLists
+		}
+
+		res, err := tx.NewDelete().Model((*db.WorkspaceMember)(nil)).
+			Where("workspace_id = ?", workspace.ID).
+			Where("user_id = ?", userID).
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return sql.ErrNoRows
+		}
+
+		_, err = tx.NewDelete().Model((*db.ListMember)(nil)).
+			Where("user_id = ?", userID).
+			Where("list_id IN (?)", tx.NewSelect().Model((*db.List)(nil)).Column("l.id").Where("l.workspace_id = ?", workspace.ID)).
+			Exec(ctx)
+		return err
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		render.Render(w, r, httperror.ErrNotFound())
+		return
+	}
+	if errors.Is(err, errLastWorkspaceAdmin) || errors.Is(err, errOwnsWorkspaceLists) {
+		render.Render(w, r, httperror.ErrBadRequest(err))
+		return
+	}
+	if err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return
+	}
+
+	render.Render(w, r, httpresponse.WriteResponse(w, http.StatusOK, "success", nil))
+}
+
+// checkOtherAdmin returns errLastWorkspaceAdmin when userID is the only
+// admin of the workspace. The admin rows are locked until the end of tx so
+// that two admins cannot demote each other at the same time.
+func checkOtherAdmin(ctx context.Context, tx bun.Tx, workspaceID, userID int64) error {
+	var admins []int64
+	err := tx.NewSelect().Model((*db.WorkspaceMember)(nil)).
+		Column("user_id").
+		Where("workspace_id = ?", workspaceID).
+		Where("role = ?", db.WorkspaceRoleAdmin).
+		For("UPDATE").
+		Scan(ctx, &admins)
+	if err != nil {
+		return err
+	}
+	for _, id := range admins {
+		if id != userID {
+			return nil
+		}
+	}
+	if len(admins) == 0 {
+		return nil
+	}
+	return errLastWorkspaceAdmin
+}
+
+// findWorkspace loads the workspace referenced by the {id} URL param and
+// checks that the current user has at least minRole in it. Workspaces the
+// user is not a member of are reported as not found.
+func (t *TodoHandler) findWorkspace(w http.ResponseWriter, r *http.Request, minRole string) (*db.Workspace, bool) {
+	claims, ok := currentUser(r)
+	if !ok {
+		render.Render(w, r, httperror.ErrUnAuthorized(errors.New("unauthorized")))
+		return nil, false
+	}
+
+	id, err := parseIDParam(r, "id")
+	if err != nil {
+		render.Render(w, r, httperror.ErrInvalidRequest(err))
+		return nil, false
+	}
+	if claims.WorkspaceID != 0 && claims.WorkspaceID != id {
+		render.Render(w, r, httperror.ErrForbidden(fmt.Errorf("the token is restricted to workspace %d", claims.WorkspaceID)))
+		return nil, false
+	}
+
+	workspace, err := selectWorkspace(r.Context(), t.app.DB(), claims.Sub, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		render.Render(w, r, httperror.ErrNotFound())
+		return nil, false
+	}
+	if err != nil {
+		render.Render(w, r, httperror.ErrInternalError(err))
+		return nil, false
+	}
+
+	if minRole == db.WorkspaceRoleAdmin && workspace.Role != db.WorkspaceRoleAdmin {
+		render.Render(w, r, httperror.ErrForbidden(errors.New("this requires the admin role in the workspace")))
+		return nil, false
+	}
+	return workspace, true
+}
@@ -0,0 +1,265 @@
+// Package jobs runs the background work of the API server.
+package jobs
+
+import (
+	"context"
+	"sync"
+	"time"
+	"todo-app/bunapp"
+	"todo-app/internal/db"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/uptrace/bun"
+)
+
+// purgeBatchSize bounds the number of accounts purged per run, so one run
+// does not hold the database for long.
+const purgeBatchSize = 100
+
+// StartAccountPurge purges deleted accounts and stale guest accounts every
+// PurgeInterval until the app stops.
+func StartAccountPurge(app *bunapp.App) {
+	ctx, cancel := context.WithCancel(app.Context())
+	ticker := app.Clock().Ticker(app.PurgeInterval())
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer ticker.Stop()
+
+		for {
+			if n, err := PurgeDeletedUsers(ctx, app); err != nil {
+				log.WithError(err).Error("failed to purge deleted accounts")
+			} else if n > 0 {
+				log.WithField("count", n).Info("purged deleted accounts")
+			}
+			if n, err := PurgeStaleGuests(ctx, app); err != nil {
+				log.WithError(err).Error("failed to purge guest accounts")
+			} else if n > 0 {
+				log.WithField("count", n).Info("purged guest accounts")
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	app.OnStop("jobs.accountPurge", func(context.Context, *bunapp.App) error {
+		cancel()
+		wg.Wait()
+		return nil
+	})
+}
+
+// PurgeDeletedUsers removes the accounts that were deleted longer than the
+// grace period ago, together with their data. It returns the number of
+// purged accounts.
+func PurgeDeletedUsers(ctx context.Context, app *bunapp.App) (int, error) {
+	cutoff := app.Clock().Now().Add(-app.DeletionGracePeriod())
+
+	var purged int
+	for {
+		var ids []int64
+		err := app.DB().NewSelect().Model((*db.User)(nil)).
+			Column("id").
+			WhereDeleted().
+			Where("deleted_at < ?", cutoff).
+			Order("id").
+			Limit(purgeBatchSize).
+			Scan(ctx, &ids)
+		if err != nil {
+			return purged, err
+		}
+
+		n, err := purgeUsers(ctx, app, ids)
+		purged += n
+		if err != nil || len(ids) < purgeBatchSize {
+			return purged, err
+		}
+	}
+}
+
+// PurgeStaleGuests removes the guest accounts that were not used for
+// GuestTTL, together with their data. It returns the number of purged
+// accounts.
+func PurgeStaleGuests(ctx context.Context, app *bunapp.App) (int, error) {
+	cutoff := app.Clock().Now().Add(-app.GuestTTL())
+
+	var purged int
+	for {
+		var ids []int64
+		err := app.DB().NewSelect().Model((*db.User)(nil)).
+			Column("id").
+			Where("u.is_anonymous").
+			Where("u.created_at < ?", cutoff).
+			Where(`NOT EXISTS (
+				SELECT 1 FROM sessions AS s
+				WHERE s.user_id = u.id AND s.revoked_at IS NULL AND s.last_used_at >= ?
+			)`, cutoff).
+			Order("id").
+			Limit(purgeBatchSize).
+			Scan(ctx, &ids)
+		if err != nil {
+			return purged, err
+		}
+
+		n, err := purgeUsers(ctx, app, ids)
+		purged += n
+		if err != nil || len(ids) < purgeBatchSize {
+			return purged, err
+		}
+	}
+}
+
+func purgeUsers(ctx context.Context, app *bunapp.App, ids []int64) (int, error) {
+	for i, id := range ids {
+		if err := purgeUser(ctx, app, id); err != nil {
+			return i, err
+		}
+	}
+	return len(ids), nil
+}
+
+// purgeUser deletes a user for good. Data only the user could see goes with
+// the account, data shared with others is handed over: lists with members
+// to one of them, todos in lists of other users to the list owner, tags of
+// shared workspaces to another member.
+func purgeUser(ctx context.Context, app *bunapp.App, userID int64) error {
+	var exportKeys []string
+	err := app.DB().NewSelect().Model((*db.DataExport)(nil)).
+		Column("storage_key").
+		Where("user_id = ?", userID).
+		Where("storage_key IS NOT NULL").
+		Scan(ctx, &exportKeys)
+	if err != nil {
+		return err
+	}
+	for _, key := range exportKeys {
+		if err := app.ObjectStorage().Delete(ctx, key); err != nil {
+			return err
+		}
+	}
+
+	return app.DB().RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		// Members can be added during the grace period and guests are never
+		// asked to transfer their lists, so this is checked here again.
+		if err := handOverSharedLists(ctx, tx, userID, app.Clock().Now()); err != nil {
+			return err
+		}
+
+		_, err := tx.NewUpdate().Model((*db.Todo)(nil)).
+			Set("user_id = l.user_id").
+			TableExpr("lists AS l").
+			Where("l.id = i.list_id").
+			Where("i.user_id = ?", userID).
+			Where("l.user_id <> ?", userID).
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+
+		// Prefer an admin so the tags stay with someone who manages the
+		// workspace.
+		_, err = tx.NewUpdate().Model((*db.Tag)(nil)).
+			Set(`user_id = (
+				SELECT wm.user_id FROM workspace_members AS wm
+				WHERE wm.workspace_id = t.workspace_id AND wm.user_id <> ?
+				ORDER BY wm.role = ? DESC, wm.created_at
+				LIMIT 1
+			)`, userID, db.WorkspaceRoleAdmin).
+			Where("t.user_id = ?", userID).
+			Where("EXISTS (SELECT 1 FROM workspace_members AS wm WHERE wm.workspace_id = t.workspace_id AND wm.user_id <> ?)", userID).
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+
+		// Workspaces nobody else is a member of, the personal one included.
+		_, err = tx.NewDelete().Model((*db.Workspace)(nil)).
+			Where("EXISTS (SELECT 1 FROM workspace_members AS wm WHERE wm.workspace_id = w.id AND wm.user_id = ?)", userID).
+			Where("NOT EXISTS (SELECT 1 FROM workspace_members AS wm WHERE wm.workspace_id = w.id AND wm.user_id <> ?)", userID).
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+
+		// Lists left to the user have no other member. Sessions and todos do
+		// not cascade with the user.
+		_, err = tx.NewDelete().Model((*db.List)(nil)).
+			Where("user_id = ?", userID).
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+		_, err = tx.NewDelete().Model((*db.Todo)(nil)).
+			Where("user_id = ?", userID).
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+		_, err = tx.NewDelete().Model((*db.Session)(nil)).
+			Where("user_id = ?", userID).
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.NewDelete().Model((*db.User)(nil)).
+			WhereAllWithDeleted().
+			Where("id = ?", userID).
+			ForceDelete().
+			Exec(ctx)
+		return err
+	})
+}
+
+// handOverSharedLists makes an accepted member the owner of each list of
+// userID that has one. Editors are preferred over viewers, then whoever
+// joined first.
+func handOverSharedLists(ctx context.Context, tx bun.Tx, userID int64, now time.Time) error {
+	var heirs []*db.ListMember
+	err := tx.NewSelect().Model(&heirs).
+		DistinctOn("lm.list_id").
+		Column("lm.list_id", "lm.user_id").
+		Join("JOIN lists AS l ON l.id = lm.list_id").
+		Where("l.user_id = ?", userID).
+		Where("lm.user_id <> ?", userID).
+		Where("lm.status = ?", db.ListMemberAccepted).
+		OrderExpr("lm.list_id, lm.role = ? DESC, lm.accepted_at, lm.id", db.ListRoleEditor).
+		Scan(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, heir := range heirs {
+		// A list has a single owner.
+		_, err := tx.NewDelete().Model((*db.ListMember)(nil)).
+			Where("list_id = ?", heir.ListID).
+			Where("user_id = ?", userID).
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+		_, err = tx.NewUpdate().Model((*db.ListMember)(nil)).
+			Set("role = ?", db.ListRoleOwner).
+			Where("list_id = ?", heir.ListID).
+			Where("user_id = ?", heir.UserID).
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+		_, err = tx.NewUpdate().Model((*db.List)(nil)).
+			Set("user_id = ?", heir.UserID).
+			Set("updated_at = ?", now).
+			Where("id = ?", heir.ListID).
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
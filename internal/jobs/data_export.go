@@ -0,0 +1,589 @@
+package jobs
+
+import (
+	"archive/zip"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"todo-app/bunapp"
+	"todo-app/internal/db"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/twinj/uuid"
+	"github.com/uptrace/bun"
+)
+
+const (
+	exportPollInterval = 5 * time.Second
+	// exportTimeout is how long an export may run before another worker
+	// takes it over, for example after a crash.
+	exportTimeout     = 10 * time.Minute
+	maxExportAttempts = 3
+)
+
+// StartDataExports builds the requested data exports and removes the
+// expired ones until the app stops.
+func StartDataExports(app *bunapp.App) {
+	ctx, cancel := context.WithCancel(app.Context())
+	ticker := app.Clock().Ticker(exportPollInterval)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer ticker.Stop()
+
+		for {
+			for {
+				ok, err := RunNextExport(ctx, app)
+				if err != nil {
+					log.WithError(err).Error("failed to build data export")
+				}
+				if !ok || ctx.Err() != nil {
+					break
+				}
+			}
+			if err := ExpireExports(ctx, app); err != nil {
+				log.WithError(err).Error("failed to expire data exports")
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	app.OnStop("jobs.dataExports", func(context.Context, *bunapp.App) error {
+		cancel()
+		wg.Wait()
+		return nil
+	})
+}
+
+// RunNextExport builds the oldest pending export. It reports whether there
+// was one.
+func RunNextExport(ctx context.Context, app *bunapp.App) (bool, error) {
+	now := app.Clock().Now()
+
+	// Exports that ran too often are given up.
+	_, err := app.DB().NewUpdate().Model((*db.DataExport)(nil)).
+		Set("status = ?", db.ExportFailed).
+		Set("error = ?", "the export could not be built").
+		Set("completed_at = ?", now).
+		Where("status = ?", db.ExportRunning).
+		Where("started_at < ?", now.Add(-exportTimeout)).
+		Where("attempts >= ?", maxExportAttempts).
+		Exec(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	next := app.DB().NewSelect().Model((*db.DataExport)(nil)).
+		Column("id").
+		WhereGroup(" AND ", func(q *bun.SelectQuery) *bun.SelectQuery {
+			return q.Where("status = ?", db.ExportPending).
+				WhereGroup(" OR ", func(q *bun.SelectQuery) *bun.SelectQuery {
+					return q.Where("status = ?", db.ExportRunning).Where("started_at < ?", now.Add(-exportTimeout))
+				})
+		}).
+		Order("id").
+		Limit(1).
+		For("UPDATE SKIP LOCKED")
+
+	export := new(db.DataExport)
+	err = app.DB().NewUpdate().Model(export).
+		Set("status = ?", db.ExportRunning).
+		Set("started_at = ?", now).
+		Set("attempts = attempts + 1").
+		Where("id = (?)", next).
+		Returning("*").
+		Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	key, size, err := buildExport(ctx, app, export.UserID)
+	if err != nil {
+		_, updateErr := app.DB().NewUpdate().Model(export).
+			Set("status = ?", db.ExportFailed).
+			Set("error = ?", "the export could not be built").
+			Set("completed_at = ?", app.Clock().Now()).
+			WherePK().
+			Exec(ctx)
+		return true, errors.Join(err, updateErr)
+	}
+
+	now = app.Clock().Now()
+	_, err = app.DB().NewUpdate().Model(export).
+		Set("status = ?", db.ExportReady).
+		Set("storage_key = ?", key).
+		Set("size = ?", size).
+		Set("completed_at = ?", now).
+		Set("expires_at = ?", now.Add(app.ExportRetention())).
+		WherePK().
+		Exec(ctx)
+	return true, err
+}
+
+// ExpireExports removes the archives of the exports past their retention.
+func ExpireExports(ctx context.Context, app *bunapp.App) error {
+	var exports []*db.DataExport
+	err := app.DB().NewSelect().Model(&exports).
+		Where("status = ?", db.ExportReady).
+		Where("expires_at <= ?", app.Clock().Now()).
+		Scan(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, export := range exports {
+		if err := app.ObjectStorage().Delete(ctx, export.StorageKey); err != nil {
+			return err
+		}
+		_, err := app.DB().NewUpdate().Model(export).
+			Set("status = ?", db.ExportExpired).
+			Set("storage_key = NULL").
+			WherePK().
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// buildExport writes the archive of the data of a user to the object
+// storage. It returns the key and size of the archive.
+func buildExport(ctx context.Context, app *bunapp.App, userID int64) (string, int64, error) {
+	f, err := os.CreateTemp("", "export-*.zip")
+	if err != nil {
+		return "", 0, err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	if err := writeExport(ctx, app.DB(), userID, f); err != nil {
+		return "", 0, err
+	}
+	size, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return "", 0, err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", 0, err
+	}
+
+	key := fmt.Sprintf("exports/%d/%s.zip", userID, uuid.NewV4().String())
+	if err := app.ObjectStorage().Put(ctx, key, f, "application/zip"); err != nil {
+		return "", 0, err
+	}
+	return key, size, nil
+}
+
+type exportProfile struct {
+	ID            int64     `json:"id"`
+	Username      string    `json:"username"`
+	DisplayName   string    `json:"display_name,omitempty"`
+	Email         string    `json:"email,omitempty"`
+	EmailVerified time.Time `json:"email_verified_at"`
+	Timezone      string    `json:"timezone"`
+	Locale        string    `json:"locale"`
+	AvatarURL     string    `json:"avatar_url,omitempty"`
+	Role          string    `json:"role"`
+	IsAnonymous   bool      `json:"is_anonymous"`
+	MFAEnabledAt  time.Time `json:"mfa_enabled_at"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+type exportTodo struct {
+	ID          int64     `json:"id"`
+	ListID      int64     `json:"list_id"`
+	ParentID    int64     `json:"parent_id,omitempty"`
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	Status      string    `json:"status"`
+	DueAt       time.Time `json:"due_at"`
+	DueDate     db.Date   `json:"due_date"`
+	StartAt     time.Time `json:"start_at"`
+	StartDate   db.Date   `json:"start_date"`
+	AllDay      bool      `json:"all_day"`
+	CreatedBy   int64     `json:"created_by"`
+	Tags        []string  `json:"tags"`
+	// Checklist is only in the JSON archive.
+	Checklist []exportChecklistItem `json:"checklist"`
+	CreatedAt time.Time             `json:"created_at"`
+	UpdatedAt time.Time             `json:"updated_at"`
+}
+
+type exportChecklistItem struct {
+	Title string `json:"title"`
+	Done  bool   `json:"done"`
+}
+
+type exportSession struct {
+	ID            int64     `json:"id"`
+	Device        string    `json:"device"`
+	IPAddress     string    `json:"ip_address"`
+	UserAgent     string    `json:"user_agent"`
+	OAuthClientID int64     `json:"oauth_client_id,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+	LastUsedAt    time.Time `json:"last_used_at"`
+	ExpiresAt     time.Time `json:"expires_at"`
+	RevokedAt     time.Time `json:"revoked_at"`
+}
+
+type exportAccessToken struct {
+	ID          int64     `json:"id"`
+	Name        string    `json:"name"`
+	TokenPrefix string    `json:"token_prefix"`
+	Scopes      []string  `json:"scopes"`
+	WorkspaceID int64     `json:"workspace_id,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	LastUsedAt  time.Time `json:"last_used_at"`
+	ExpiresAt   time.Time `json:"expires_at"`
+	RevokedAt   time.Time `json:"revoked_at"`
+}
+
+// exportEvent is an entry of the account history. There is no separate
+// audit log, the events are taken from the timestamps of the records.
+type exportEvent struct {
+	At     time.Time `json:"at"`
+	Type   string    `json:"type"`
+	Detail string    `json:"detail,omitempty"`
+}
+
+// writeExport writes the ZIP archive of the data of a user to w.
+func writeExport(ctx context.Context, bunDB *bun.DB, userID int64, w io.Writer) error {
+	user := new(db.User)
+	if err := bunDB.NewSelect().Model(user).WhereAllWithDeleted().Where("id = ?", userID).Scan(ctx); err != nil {
+		return err
+	}
+
+	var lists []*db.List
+	err := bunDB.NewSelect().Model(&lists).
+		Where("l.user_id = ?", userID).
+		Order("l.id").
+		Scan(ctx)
+	if err != nil {
+		return err
+	}
+
+	var todos []*db.Todo
+	err = bunDB.NewSelect().Model(&todos).
+		Relation("Tags").
+		Relation("Checklist", func(q *bun.SelectQuery) *bun.SelectQuery {
+			return q.Order("ci.position", "ci.id")
+		}).
+		WhereGroup(" AND ", func(q *bun.SelectQuery) *bun.SelectQuery {
+			return q.Where("i.user_id = ?", userID).
+				WhereOr("i.list_id IN (SELECT id FROM lists WHERE user_id = ?)", userID)
+		}).
+		Order("i.id").
+		Scan(ctx)
+	if err != nil {
+		return err
+	}
+
+	var tags []*db.Tag
+	err = bunDB.NewSelect().Model(&tags).
+		Where("t.user_id = ?", userID).
+		Order("t.id").
+		Scan(ctx)
+	if err != nil {
+		return err
+	}
+
+	var workspaces []*db.Workspace
+	err = bunDB.NewSelect().Model(&workspaces).
+		ColumnExpr("w.*").
+		ColumnExpr("wm.role AS role").
+		Join("JOIN workspace_members AS wm ON wm.workspace_id = w.id").
+		Where("wm.user_id = ?", userID).
+		Order("w.id").
+		Scan(ctx)
+	if err != nil {
+		return err
+	}
+
+	var listMembers []*db.ListMember
+	err = bunDB.NewSelect().Model(&listMembers).
+		ColumnExpr("lm.*").
+		ColumnExpr("l.name AS list_name").
+		Join("JOIN lists AS l ON l.id = lm.list_id").
+		Where("lm.user_id = ?", userID).
+		Order("lm.id").
+		Scan(ctx)
+	if err != nil {
+		return err
+	}
+
+	var sessions []*db.Session
+	err = bunDB.NewSelect().Model(&sessions).
+		Where("s.user_id = ?", userID).
+		Order("s.id").
+		Scan(ctx)
+	if err != nil {
+		return err
+	}
+
+	var tokens []*db.PersonalAccessToken
+	err = bunDB.NewSelect().Model(&tokens).
+		Where("pat.user_id = ?", userID).
+		Order("pat.id").
+		Scan(ctx)
+	if err != nil {
+		return err
+	}
+
+	var identities []*db.UserIdentity
+	err = bunDB.NewSelect().Model(&identities).
+		Where("ui.user_id = ?", userID).
+		Order("ui.id").
+		Scan(ctx)
+	if err != nil {
+		return err
+	}
+
+	var consents []*db.OAuthConsent
+	err = bunDB.NewSelect().Model(&consents).
+		Where("ocs.user_id = ?", userID).
+		Order("ocs.id").
+		Scan(ctx)
+	if err != nil {
+		return err
+	}
+
+	profile := exportProfile{
+		ID:            user.ID,
+		Username:      user.Username,
+		DisplayName:   user.DisplayName,
+		Email:         user.Email,
+		EmailVerified: user.EmailVerifiedAt,
+		Timezone:      user.Timezone,
+		Locale:        user.Locale,
+		AvatarURL:     user.AvatarURL,
+		Role:          user.Role,
+		IsAnonymous:   user.IsAnonymous,
+		MFAEnabledAt:  user.TOTPEnabledAt,
+		CreatedAt:     user.CreatedAt,
+		UpdatedAt:     user.UpdatedAt,
+	}
+
+	exportTodos := make([]exportTodo, 0, len(todos))
+	for _, todo := range todos {
+		names := make([]string, 0, len(todo.Tags))
+		for _, tag := range todo.Tags {
+			names = append(names, tag.Name)
+		}
+		checklist := make([]exportChecklistItem, 0, len(todo.Checklist))
+		for _, item := range todo.Checklist {
+			checklist = append(checklist, exportChecklistItem{Title: item.Title, Done: item.Done})
+		}
+		exportTodos = append(exportTodos, exportTodo{
+			ID:          todo.ID,
+			ListID:      todo.ListID,
+			ParentID:    todo.ParentID,
+			Title:       todo.Title,
+			Description: todo.Description,
+			Status:      string(todo.Status),
+			DueAt:       todo.DueAt,
+			DueDate:     todo.DueDate,
+			StartAt:     todo.StartAt,
+			StartDate:   todo.StartDate,
+			AllDay:      todo.AllDay,
+			CreatedBy:   todo.UserID,
+			Tags:        names,
+			Checklist:   checklist,
+			CreatedAt:   todo.CreatedAt,
+			UpdatedAt:   todo.UpdatedAt,
+		})
+	}
+
+	exportSessions := make([]exportSession, 0, len(sessions))
+	for _, s := range sessions {
+		exportSessions = append(exportSessions, exportSession{
+			ID:            s.ID,
+			Device:        s.Device,
+			IPAddress:     s.IPAddress,
+			UserAgent:     s.UserAgent,
+			OAuthClientID: s.OAuthClientID,
+			CreatedAt:     s.CreatedAt,
+			LastUsedAt:    s.LastUsedAt,
+			ExpiresAt:     s.ExpiresAt,
+			RevokedAt:     s.RevokedAt,
+		})
+	}
+
+	exportTokens := make([]exportAccessToken, 0, len(tokens))
+	for _, t := range tokens {
+		exportTokens = append(exportTokens, exportAccessToken{
+			ID:          t.ID,
+			Name:        t.Name,
+			TokenPrefix: t.TokenPrefix,
+			Scopes:      t.Scopes,
+			WorkspaceID: t.WorkspaceID,
+			CreatedAt:   t.CreatedAt,
+			LastUsedAt:  t.LastUsedAt,
+			ExpiresAt:   t.ExpiresAt,
+			RevokedAt:   t.RevokedAt,
+		})
+	}
+
+	events := accountEvents(user, sessions, tokens, identities, consents)
+
+	zw := zip.NewWriter(w)
+	files := []struct {
+		name string
+		v    any
+	}{
+		{"profile.json", profile},
+		{"lists.json", lists},
+		{"todos.json", exportTodos},
+		{"tags.json", tags},
+		{"workspaces.json", workspaces},
+		{"list_memberships.json", listMembers},
+		{"sessions.json", exportSessions},
+		{"access_tokens.json", exportTokens},
+		{"identities.json", identities},
+		{"oauth_consents.json", consents},
+		{"events.json", events},
+	}
+	for _, file := range files {
+		if err := writeJSONFile(zw, file.name, file.v); err != nil {
+			return err
+		}
+	}
+
+	err = writeCSVFile(zw, "lists.csv", []string{"id", "name", "workspace_id", "created_at", "updated_at"}, len(lists), func(i int) []string {
+		l := lists[i]
+		return []string{formatID(l.ID), l.Name, formatID(l.WorkspaceID), timestamp(l.CreatedAt), timestamp(l.UpdatedAt)}
+	})
+	if err != nil {
+		return err
+	}
+	err = writeCSVFile(zw, "todos.csv", []string{"id", "list_id", "parent_id", "title", "description", "status", "due_at", "due_date", "start_at", "start_date", "all_day", "created_by", "tags", "created_at", "updated_at"}, len(exportTodos), func(i int) []string {
+		t := exportTodos[i]
+		return []string{formatID(t.ID), formatID(t.ListID), formatID(t.ParentID), t.Title, t.Description, t.Status, timestamp(t.DueAt), t.DueDate.String(), timestamp(t.StartAt), t.StartDate.String(), strconv.FormatBool(t.AllDay), formatID(t.CreatedBy), strings.Join(t.Tags, ";"), timestamp(t.CreatedAt), timestamp(t.UpdatedAt)}
+	})
+	if err != nil {
+		return err
+	}
+	err = writeCSVFile(zw, "tags.csv", []string{"id", "name", "workspace_id", "created_at", "updated_at"}, len(tags), func(i int) []string {
+		t := tags[i]
+		return []string{formatID(t.ID), t.Name, formatID(t.WorkspaceID), timestamp(t.CreatedAt), timestamp(t.UpdatedAt)}
+	})
+	if err != nil {
+		return err
+	}
+	err = writeCSVFile(zw, "sessions.csv", []string{"id", "device", "ip_address", "user_agent", "oauth_client_id", "created_at", "last_used_at", "expires_at", "revoked_at"}, len(exportSessions), func(i int) []string {
+		s := exportSessions[i]
+		return []string{formatID(s.ID), s.Device, s.IPAddress, s.UserAgent, formatID(s.OAuthClientID), timestamp(s.CreatedAt), timestamp(s.LastUsedAt), timestamp(s.ExpiresAt), timestamp(s.RevokedAt)}
+	})
+	if err != nil {
+		return err
+	}
+	err = writeCSVFile(zw, "events.csv", []string{"at", "type", "detail"}, len(events), func(i int) []string {
+		e := events[i]
+		return []string{timestamp(e.At), e.Type, e.Detail}
+	})
+	if err != nil {
+		return err
+	}
+
+	return zw.Close()
+}
+
+// accountEvents lists the account history from oldest to newest.
+func accountEvents(user *db.User, sessions []*db.Session, tokens []*db.PersonalAccessToken, identities []*db.UserIdentity, consents []*db.OAuthConsent) []exportEvent {
+	events := make([]exportEvent, 0)
+	add := func(at time.Time, typ, detail string) {
+		if !at.IsZero() {
+			events = append(events, exportEvent{At: at, Type: typ, Detail: detail})
+		}
+	}
+
+	add(user.CreatedAt, "account.created", user.Username)
+	add(user.EmailVerifiedAt, "email.verified", user.Email)
+	add(user.TOTPEnabledAt, "mfa.enabled", "")
+	for _, s := range sessions {
+		detail := s.Device + " " + s.IPAddress
+		if s.OAuthClientID != 0 {
+			detail = "oauth client " + formatID(s.OAuthClientID)
+		}
+		add(s.CreatedAt, "session.created", detail)
+		add(s.RevokedAt, "session.revoked", detail)
+	}
+	for _, t := range tokens {
+		add(t.CreatedAt, "access_token.created", t.Name)
+		add(t.RevokedAt, "access_token.revoked", t.Name)
+	}
+	for _, i := range identities {
+		add(i.CreatedAt, "identity.linked", i.Provider)
+	}
+	for _, c := range consents {
+		add(c.UpdatedAt, "oauth.consented", "oauth client "+formatID(c.ClientID)+": "+strings.Join(c.Scopes, " "))
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].At.Before(events[j].At)
+	})
+	return events
+}
+
+func writeJSONFile(zw *zip.Writer, name string, v any) error {
+	f, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func writeCSVFile(zw *zip.Writer, name string, header []string, n int, row func(i int) []string) error {
+	f, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	cw := csv.NewWriter(f)
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+	for i := 0; i < n; i++ {
+		if err := cw.Write(row(i)); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func formatID(v int64) string {
+	if v == 0 {
+		return ""
+	}
+	return strconv.FormatInt(v, 10)
+}
+
+func timestamp(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,314 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+	"todo-app/bunapp"
+	"todo-app/internal/db"
+	"todo-app/internal/notify"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/uptrace/bun"
+)
+
+const (
+	// reminderBatchSize bounds the number of reminders fired per
+	// transaction.
+	reminderBatchSize = 100
+	// deliveryLease is how long a delivery may take before another worker
+	// tries again, for example after a crash. Notifiers time out before.
+	deliveryLease   = 2 * time.Minute
+	deliveryTimeout = 30 * time.Second
+)
+
+// SetupReminders starts the reminder scheduler with the API server.
+func SetupReminders() {
+	bunapp.OnStart("jobs.reminders", func(ctx context.Context, app *bunapp.App) error {
+		if app.Config().Service != "api" {
+			return nil
+		}
+		NewReminders(app, DefaultNotifiers(app)).Start()
+		return nil
+	})
+}
+
+// DefaultNotifiers returns the notifiers of the channels configured for app.
+func DefaultNotifiers(app *bunapp.App) map[string]notify.Notifier {
+	notifiers := map[string]notify.Notifier{
+		db.ReminderChannelInbox: &notify.InboxNotifier{DB: app.DB()},
+		db.ReminderChannelEmail: &notify.EmailNotifier{Mailer: app.Mailer(), BaseURL: app.Config().BaseURL},
+	}
+	if cfg := app.Config().Reminders; cfg.WebhookURL != "" {
+		notifiers[db.ReminderChannelWebhook] = &notify.WebhookNotifier{
+			URL:    cfg.WebhookURL,
+			Secret: cfg.WebhookSecret,
+			Client: &http.Client{Timeout: deliveryTimeout},
+		}
+	}
+	return notifiers
+}
+
+// Reminders fires due reminders and delivers them through the notifier of
+// each channel. A reminder is fired and its deliveries are created in one
+// transaction, a delivery is pending until its notifier succeeded. Nothing
+// is lost when the server stops in between, deliveries interrupted by a
+// crash are tried again.
+type Reminders struct {
+	app       *bunapp.App
+	notifiers map[string]notify.Notifier
+}
+
+func NewReminders(app *bunapp.App, notifiers map[string]notify.Notifier) *Reminders {
+	return &Reminders{app: app, notifiers: notifiers}
+}
+
+// Start runs the scheduler every ReminderInterval until the app stops.
+func (s *Reminders) Start() {
+	ctx, cancel := context.WithCancel(s.app.Context())
+	ticker := s.app.Clock().Ticker(s.app.ReminderInterval())
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer ticker.Stop()
+
+		for {
+			if err := s.Run(ctx); err != nil && ctx.Err() == nil {
+				log.WithError(err).Error("failed to run reminders")
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	s.app.OnStop("jobs.reminders", func(context.Context, *bunapp.App) error {
+		cancel()
+		wg.Wait()
+		return nil
+	})
+}
+
+// Run fires the due reminders and delivers the pending deliveries.
+func (s *Reminders) Run(ctx context.Context) error {
+	for {
+		n, err := s.Fire(ctx)
+		if err != nil {
+			return err
+		}
+		if n < reminderBatchSize {
+			break
+		}
+	}
+	for ctx.Err() == nil {
+		ok, err := s.DeliverNext(ctx)
+		if err != nil {
+			log.WithError(err).Error("failed to deliver reminder")
+		}
+		if !ok {
+			break
+		}
+	}
+	return nil
+}
+
+// Fire fires a batch of due reminders. Reminders of todos that are done
+// fire without a delivery. It returns the number of fired reminders.
+func (s *Reminders) Fire(ctx context.Context) (int, error) {
+	var fired int
+	err := s.app.DB().RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		now := s.app.Clock().Now()
+
+		var reminders []*db.Reminder
+		err := tx.NewSelect().Model(&reminders).
+			Where("rm.fired_at IS NULL").
+			Where("rm.fire_at <= ?", now).
+			Order("rm.fire_at", "rm.id").
+			Limit(reminderBatchSize).
+			For("UPDATE SKIP LOCKED").
+			Scan(ctx)
+		if err != nil || len(reminders) == 0 {
+			return err
+		}
+		fired = len(reminders)
+
+		ids := make([]int64, len(reminders))
+		for i, rm := range reminders {
+			ids[i] = rm.ID
+		}
+		_, err = tx.NewUpdate().Model((*db.Reminder)(nil)).
+			Set("fired_at = ?", now).
+			Where("id IN (?)", bun.In(ids)).
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+
+		var open []int64
+		err = tx.NewSelect().Model((*db.Todo)(nil)).
+			Column("i.id").
+			Join("JOIN reminders AS rm ON rm.todo_id = i.id").
+			Where("rm.id IN (?)", bun.In(ids)).
+			Where("i.status <> ?", db.DONE).
+			Scan(ctx, &open)
+		if err != nil {
+			return err
+		}
+		isOpen := make(map[int64]bool, len(open))
+		for _, id := range open {
+			isOpen[id] = true
+		}
+
+		var deliveries []*db.ReminderDelivery
+		for _, rm := range reminders {
+			if !isOpen[rm.TodoID] {
+				continue
+			}
+			for _, channel := range rm.Channels {
+				deliveries = append(deliveries, &db.ReminderDelivery{
+					ReminderID:    rm.ID,
+					Channel:       channel,
+					Status:        db.DeliveryPending,
+					NextAttemptAt: now,
+				})
+			}
+		}
+		if len(deliveries) == 0 {
+			return nil
+		}
+		_, err = tx.NewInsert().Model(&deliveries).
+			On("CONFLICT (reminder_id, channel) DO NOTHING").
+			Exec(ctx)
+		return err
+	})
+	return fired, err
+}
+
+// DeliverNext sends the pending delivery that is due longest. It reports
+// whether there was one.
+func (s *Reminders) DeliverNext(ctx context.Context) (bool, error) {
+	now := s.app.Clock().Now()
+
+	next := s.app.DB().NewSelect().Model((*db.ReminderDelivery)(nil)).
+		Column("id").
+		Where("status = ?", db.DeliveryPending).
+		Where("next_attempt_at <= ?", now).
+		WhereGroup(" AND ", func(q *bun.SelectQuery) *bun.SelectQuery {
+			return q.Where("locked_until IS NULL").WhereOr("locked_until <= ?", now)
+		}).
+		Order("next_attempt_at", "id").
+		Limit(1).
+		For("UPDATE SKIP LOCKED")
+
+	delivery := new(db.ReminderDelivery)
+	err := s.app.DB().NewUpdate().Model(delivery).
+		Set("locked_until = ?", now.Add(deliveryLease)).
+		Set("attempts = attempts + 1").
+		Where("id = (?)", next).
+		Returning("*").
+		Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	sendErr := s.send(ctx, delivery)
+	if sendErr == nil {
+		_, err := s.app.DB().NewUpdate().Model(delivery).
+			Set("status = ?", db.DeliveryDelivered).
+			Set("delivered_at = ?", s.app.Clock().Now()).
+			Set("locked_until = NULL").
+			Set("error = NULL").
+			WherePK().
+			Exec(ctx)
+		return true, err
+	}
+
+	q := s.app.DB().NewUpdate().Model(delivery).
+		Set("locked_until = NULL").
+		Set("error = ?", sendErr.Error()).
+		WherePK()
+	if errors.Is(sendErr, notify.ErrPermanent) || delivery.Attempts >= s.app.ReminderMaxAttempts() {
+		q = q.Set("status = ?", db.DeliveryFailed)
+	} else {
+		q = q.Set("next_attempt_at = ?", s.app.Clock().Now().Add(DeliveryBackoff(delivery.Attempts)))
+	}
+	if _, err := q.Exec(ctx); err != nil {
+		return true, errors.Join(sendErr, err)
+	}
+	return true, sendErr
+}
+
+func (s *Reminders) send(ctx context.Context, delivery *db.ReminderDelivery) error {
+	notifier, ok := s.notifiers[delivery.Channel]
+	if !ok {
+		return fmt.Errorf("%w: the %s channel is not configured", notify.ErrPermanent, delivery.Channel)
+	}
+
+	reminder := new(db.Reminder)
+	err := s.app.DB().NewSelect().Model(reminder).Where("rm.id = ?", delivery.ReminderID).Scan(ctx)
+	if err != nil {
+		return err
+	}
+	todo := new(db.Todo)
+	err = s.app.DB().NewSelect().Model(todo).Where("i.id = ?", reminder.TodoID).Scan(ctx)
+	if err != nil {
+		return err
+	}
+	user := new(db.User)
+	err = s.app.DB().NewSelect().Model(user).Where("id = ?", reminder.UserID).Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%w: the account was deleted", notify.ErrPermanent)
+	}
+	if err != nil {
+		return err
+	}
+
+	loc, err := time.LoadLocation(user.Timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+	due := todo.Due(loc)
+	if !due.IsZero() {
+		due = due.In(loc)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, deliveryTimeout)
+	defer cancel()
+	return notifier.Notify(ctx, &notify.Notification{
+		ID:         fmt.Sprintf("reminder-delivery-%d", delivery.ID),
+		DeliveryID: delivery.ID,
+		UserID:     user.ID,
+		Username:   user.Username,
+		Email:      user.Email,
+		TodoID:     todo.ID,
+		Title:      todo.Title,
+		Due:        due,
+		AllDay:     todo.AllDay,
+		FireAt:     reminder.FireAt,
+	})
+}
+
+// DeliveryBackoff is the wait before the next try of a delivery that failed
+// attempts times: 30 seconds, doubling up to an hour.
+func DeliveryBackoff(attempts int) time.Duration {
+	d := 30 * time.Second
+	for i := 1; i < attempts && d < time.Hour; i++ {
+		d *= 2
+	}
+	if d > time.Hour {
+		d = time.Hour
+	}
+	return d
+}
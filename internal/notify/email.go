@@ -0,0 +1,32 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"todo-app/pkg/mailer"
+)
+
+// EmailNotifier sends reminders to the email address of the user.
+type EmailNotifier struct {
+	Mailer mailer.Mailer
+	// BaseURL of the web app, the email links to the todo when it is set.
+	BaseURL string
+}
+
+var _ Notifier = (*EmailNotifier)(nil)
+
+func (n *EmailNotifier) Notify(ctx context.Context, notification *Notification) error {
+	if notification.Email == "" {
+		return fmt.Errorf("%w: the user has no email address", ErrPermanent)
+	}
+
+	body := fmt.Sprintf("Hello %s,\n\n%s\n", notification.Username, Body(notification))
+	if n.BaseURL != "" {
+		body += fmt.Sprintf("\n%s/todos/%d\n", n.BaseURL, notification.TodoID)
+	}
+	return n.Mailer.Send(ctx, mailer.Message{
+		To:      notification.Email,
+		Subject: Subject(notification),
+		Body:    body,
+	})
+}
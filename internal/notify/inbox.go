@@ -0,0 +1,30 @@
+package notify
+
+import (
+	"context"
+	"todo-app/internal/db"
+
+	"github.com/uptrace/bun"
+)
+
+// InboxNotifier adds reminders to the in-app inbox of the user. Every
+// delivery adds one item, however often it is retried.
+type InboxNotifier struct {
+	DB bun.IDB
+}
+
+var _ Notifier = (*InboxNotifier)(nil)
+
+func (n *InboxNotifier) Notify(ctx context.Context, notification *Notification) error {
+	item := &db.InboxItem{
+		UserID:     notification.UserID,
+		DeliveryID: notification.DeliveryID,
+		TodoID:     notification.TodoID,
+		Title:      Subject(notification),
+		Body:       Body(notification),
+	}
+	_, err := n.DB.NewInsert().Model(item).
+		On("CONFLICT (delivery_id) DO NOTHING").
+		Exec(ctx)
+	return err
+}
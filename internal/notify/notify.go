@@ -0,0 +1,51 @@
+// Package notify delivers reminders through the channels users choose:
+// webhooks, email and the in-app inbox.
+package notify
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrPermanent marks failures that retrying does not fix.
+var ErrPermanent = errors.New("notify: permanent failure")
+
+// Notification is a reminder about a todo for one user.
+type Notification struct {
+	// ID is the same for every attempt of a delivery, receivers use it to
+	// drop duplicates.
+	ID         string
+	DeliveryID int64
+	UserID     int64
+	Username   string
+	Email      string
+	TodoID     int64
+	Title      string
+	// Due is when the todo is due, zero when it has no due date. All-day
+	// todos are due at the start of the day.
+	Due    time.Time
+	AllDay bool
+	FireAt time.Time
+}
+
+type Notifier interface {
+	Notify(ctx context.Context, n *Notification) error
+}
+
+// Subject is the title of the reminder n.
+func Subject(n *Notification) string {
+	return "Reminder: " + n.Title
+}
+
+// Body describes when the todo of n is due.
+func Body(n *Notification) string {
+	switch {
+	case n.Due.IsZero():
+		return n.Title
+	case n.AllDay:
+		return n.Title + " is due on " + n.Due.Format("Monday, January 2") + "."
+	default:
+		return n.Title + " is due at " + n.Due.Format("Monday, January 2 15:04 MST") + "."
+	}
+}
@@ -0,0 +1,81 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// WebhookNotifier posts reminders as JSON to URL. The body is signed with
+// HMAC-SHA256 of Secret in the X-Signature header.
+type WebhookNotifier struct {
+	URL    string
+	Secret string
+	Client *http.Client
+}
+
+var _ Notifier = (*WebhookNotifier)(nil)
+
+type webhookPayload struct {
+	ID     string    `json:"id"`
+	UserID int64     `json:"user_id"`
+	TodoID int64     `json:"todo_id"`
+	Title  string    `json:"title"`
+	Due    time.Time `json:"due"`
+	AllDay bool      `json:"all_day"`
+	FireAt time.Time `json:"fire_at"`
+}
+
+func (n *WebhookNotifier) Notify(ctx context.Context, notification *Notification) error {
+	body, err := json.Marshal(webhookPayload{
+		ID:     notification.ID,
+		UserID: notification.UserID,
+		TodoID: notification.TodoID,
+		Title:  notification.Title,
+		Due:    notification.Due,
+		AllDay: notification.AllDay,
+		FireAt: notification.FireAt,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrPermanent, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Idempotency-Key", notification.ID)
+	req.Header.Set("X-Signature", "sha256="+Sign(n.Secret, body))
+
+	client := n.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode >= 400 && resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusRequestTimeout:
+		return fmt.Errorf("%w: webhook answered %d", ErrPermanent, resp.StatusCode)
+	}
+	return fmt.Errorf("webhook answered %d", resp.StatusCode)
+}
+
+// Sign returns the hex HMAC-SHA256 of body with secret.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
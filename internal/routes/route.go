@@ -4,6 +4,8 @@ import (
 	"context"
 	"os"
 	"todo-app/bunapp"
+	"todo-app/internal/constants"
+	"todo-app/internal/db"
 	"todo-app/internal/handlers"
 
 	"github.com/go-chi/chi"
@@ -22,22 +24,158 @@ func SetupRoutes() {
 		serverHandler := handlers.NewServerHandler(app)
 		authHandler := handlers.NewAuthHandler(app)
 		todoHandler := handlers.NewTodoHandler(app)
+		app.DB().RegisterModel((*db.TodoTag)(nil))
 		router.Get("/docs/*", httpSwagger.WrapHandler)
+		router.Get("/.well-known/jwks.json", authHandler.JWKS)
+		canRead := handlers.RequireScope(constants.ScopeTodosRead)
+		canWrite := handlers.RequireScope(constants.ScopeTodosWrite)
 		router.Route("/api", func(r chi.Router) {
 			r.Get("/ping", serverHandler.ReplayAppCheck)
 			r.Route("/auth", func(r chi.Router) {
 				r.Post("/login", authHandler.Login)
+				r.Post("/login/mfa", authHandler.LoginMFA)
 				r.Post("/register", authHandler.Register)
+				r.Post("/guest", authHandler.Guest)
 				r.Post("/refresh-token", authHandler.RefreshToken)
 				r.With(authHandler.Authorization).Get("/check-token", authHandler.CheckToken)
+				r.Post("/forgot-password", authHandler.ForgotPassword)
+				r.Post("/reset-password", authHandler.ResetPassword)
+				r.Post("/verify-email", authHandler.VerifyEmail)
+				r.Get("/oidc/providers", authHandler.GetOIDCProviders)
+				r.Get("/oidc/{provider}/authorize", authHandler.OIDCAuthorize)
+				r.Get("/oidc/{provider}/callback", authHandler.OIDCCallback)
+
+				// Account management needs a login session, personal
+				// access tokens are refused there.
+				r.Group(func(r chi.Router) {
+					r.Use(authHandler.Authorization, authHandler.RequireSession)
+					r.Post("/upgrade", authHandler.Upgrade)
+					r.Post("/logout", authHandler.Logout)
+					r.Post("/logout-all", authHandler.LogoutAll)
+					r.Get("/sessions", authHandler.GetSessions)
+					r.Delete("/sessions/{id}", authHandler.RevokeSession)
+					r.Post("/verify-email/resend", authHandler.ResendVerification)
+					r.Post("/tokens", authHandler.CreateAccessToken)
+					r.Get("/tokens", authHandler.GetAccessTokens)
+					r.Delete("/tokens/{id}", authHandler.RevokeAccessToken)
+					r.Get("/identities", authHandler.GetIdentities)
+					r.Post("/identities/{provider}", authHandler.LinkIdentity)
+					r.Delete("/identities/{id}", authHandler.UnlinkIdentity)
+					r.Route("/mfa", func(r chi.Router) {
+						r.Post("/totp/enroll", authHandler.EnrollTOTP)
+						r.Post("/totp/confirm", authHandler.ConfirmTOTP)
+						r.Post("/totp/disable", authHandler.DisableTOTP)
+						r.Post("/recovery-codes", authHandler.RegenerateRecoveryCodes)
+					})
+				})
+			})
+
+			r.Route("/oauth", func(r chi.Router) {
+				// Clients authenticate themselves on these endpoints.
+				r.Post("/token", authHandler.OAuthToken)
+				r.Post("/introspect", authHandler.IntrospectToken)
+				r.Post("/revoke", authHandler.RevokeToken)
+
+				// The consent screen is answered by the logged in user.
+				r.Group(func(r chi.Router) {
+					r.Use(authHandler.Authorization, authHandler.RequireSession)
+					r.Get("/authorize", authHandler.GetOAuthConsent)
+					r.Post("/authorize", authHandler.OAuthAuthorize)
+				})
+			})
+
+			r.Route("/me", func(r chi.Router) {
+				r.Use(authHandler.Authorization)
+				r.With(canRead).Get("/", authHandler.GetMe)
+				r.With(canRead).Get("/inbox", authHandler.GetInbox)
+				r.With(canWrite).Post("/inbox/{id}/read", authHandler.ReadInboxItem)
+				r.Group(func(r chi.Router) {
+					r.Use(authHandler.RequireSession)
+					r.Patch("/", authHandler.UpdateMe)
+					r.Delete("/", authHandler.DeleteAccount)
+					r.Put("/password", authHandler.ChangePassword)
+					r.Put("/username", authHandler.ChangeUsername)
+					r.Post("/export", authHandler.RequestExport)
+					r.Get("/export", authHandler.GetExports)
+					r.Get("/export/{id}", authHandler.GetExport)
+				})
 			})
 
+			// The token of the download link authorizes the request.
+			r.Get("/exports/{id}/download", authHandler.DownloadExport)
+
 			r.Route("/todo", func(r chi.Router) {
+				r.Use(authHandler.Authorization, todoHandler.Workspace)
+				r.With(canWrite).Post("/", todoHandler.CreateTodo)
+				r.With(canRead).Get("/", todoHandler.ListTodos)
+				r.With(canRead).Get("/{id}", todoHandler.GetTodo)
+				r.With(canWrite).Put("/{id}", todoHandler.UpdateTodo)
+				r.With(canWrite).Delete("/{id}", todoHandler.DeleteTodo)
+				r.With(canWrite).Put("/{id}/tags/{tagID}", todoHandler.AttachTag)
+				r.With(canWrite).Delete("/{id}/tags/{tagID}", todoHandler.DetachTag)
+				r.With(canRead).Get("/{id}/reminders", todoHandler.GetReminders)
+				r.With(canWrite).Post("/{id}/reminders", todoHandler.CreateReminder)
+				r.With(canWrite).Delete("/{id}/reminders/{reminderID}", todoHandler.DeleteReminder)
+				r.With(canWrite).Post("/{id}/checklist", todoHandler.CreateChecklistItem)
+				r.With(canWrite).Put("/{id}/checklist/{itemID}", todoHandler.UpdateChecklistItem)
+				r.With(canWrite).Delete("/{id}/checklist/{itemID}", todoHandler.DeleteChecklistItem)
+				r.With(canWrite).Put("/{id}/dependencies/{blockerID}", todoHandler.AddDependency)
+				r.With(canWrite).Delete("/{id}/dependencies/{blockerID}", todoHandler.RemoveDependency)
+			})
+
+			r.Route("/lists", func(r chi.Router) {
+				r.Use(authHandler.Authorization, todoHandler.Workspace)
+				r.With(canWrite).Post("/", todoHandler.CreateList)
+				r.With(canRead).Get("/", todoHandler.GetLists)
+				r.With(canRead).Get("/{id}", todoHandler.GetList)
+				r.With(canWrite).Put("/{id}", todoHandler.UpdateList)
+				r.With(canWrite).Delete("/{id}", todoHandler.DeleteList)
+				r.With(canRead).Get("/{id}/order", todoHandler.GetListOrder)
+				r.With(canRead).Get("/{id}/members", todoHandler.GetListMembers)
+				r.With(canWrite).Post("/{id}/members", todoHandler.InviteListMember)
+				r.With(canWrite).Put("/{id}/members/{userID}", todoHandler.UpdateListMember)
+				r.With(canWrite).Delete("/{id}/members/{userID}", todoHandler.RemoveListMember)
+				r.With(canWrite).Post("/{id}/leave", todoHandler.LeaveList)
+				r.With(canWrite).Post("/{id}/transfer", todoHandler.TransferList)
+			})
+
+			r.Route("/invitations", func(r chi.Router) {
+				r.Use(authHandler.Authorization, todoHandler.Workspace)
+				r.With(canRead).Get("/", todoHandler.GetInvitations)
+				r.With(canWrite).Post("/{id}/accept", todoHandler.AcceptInvitation)
+				r.With(canWrite).Post("/{id}/decline", todoHandler.DeclineInvitation)
+			})
+
+			r.Route("/tags", func(r chi.Router) {
+				r.Use(authHandler.Authorization, todoHandler.Workspace)
+				r.With(canWrite).Post("/", todoHandler.CreateTag)
+				r.With(canRead).Get("/", todoHandler.GetTags)
+				r.With(canWrite).Put("/{id}", todoHandler.UpdateTag)
+				r.With(canWrite).Delete("/{id}", todoHandler.DeleteTag)
+			})
+
+			r.Route("/workspaces", func(r chi.Router) {
+				r.Use(authHandler.Authorization)
+				r.With(canWrite).Post("/", todoHandler.CreateWorkspace)
+				r.With(canRead).Get("/", todoHandler.GetWorkspaces)
+				r.With(canRead).Get("/{id}", todoHandler.GetWorkspace)
+				r.With(canWrite).Put("/{id}", todoHandler.UpdateWorkspace)
+				r.With(canWrite).Delete("/{id}", todoHandler.DeleteWorkspace)
+				r.With(canRead).Get("/{id}/members", todoHandler.GetWorkspaceMembers)
+				r.With(canWrite).Post("/{id}/members", todoHandler.AddWorkspaceMember)
+				r.With(canWrite).Put("/{id}/members/{userID}", todoHandler.UpdateWorkspaceMember)
+				r.With(canWrite).Delete("/{id}/members/{userID}", todoHandler.RemoveWorkspaceMember)
+			})
+
+			r.Route("/admin", func(r chi.Router) {
 				r.Use(authHandler.Authorization)
-				r.Post("/", todoHandler.CreateTodo)
-				r.Get("/{id}", todoHandler.GetTodo)
-				r.Put("/{id}", todoHandler.UpdateTodo)
-				r.Delete("/{id}", todoHandler.DeleteTodo)
+				r.Use(handlers.RequireRole(db.RoleAdmin), handlers.RequireScope(constants.ScopeAdmin))
+				r.Post("/users/{id}/unlock", authHandler.UnlockUser)
+				r.Put("/users/{id}/role", authHandler.SetUserRole)
+				r.Post("/users/{id}/restore", authHandler.RestoreUser)
+				r.Post("/oauth/clients", authHandler.CreateOAuthClient)
+				r.Get("/oauth/clients", authHandler.GetOAuthClients)
+				r.Delete("/oauth/clients/{id}", authHandler.RevokeOAuthClient)
 			})
 
 		})
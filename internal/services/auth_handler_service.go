@@ -4,7 +4,54 @@ import "net/http"
 
 type AuthHandlerService interface {
 	Register(w http.ResponseWriter, r *http.Request)
+	Guest(w http.ResponseWriter, r *http.Request)
+	Upgrade(w http.ResponseWriter, r *http.Request)
 	Login(w http.ResponseWriter, r *http.Request)
 	RefreshToken(w http.ResponseWriter, r *http.Request)
 	CheckToken(w http.ResponseWriter, r *http.Request)
+	Logout(w http.ResponseWriter, r *http.Request)
+	LogoutAll(w http.ResponseWriter, r *http.Request)
+	GetSessions(w http.ResponseWriter, r *http.Request)
+	RevokeSession(w http.ResponseWriter, r *http.Request)
+	JWKS(w http.ResponseWriter, r *http.Request)
+	LoginMFA(w http.ResponseWriter, r *http.Request)
+	EnrollTOTP(w http.ResponseWriter, r *http.Request)
+	ConfirmTOTP(w http.ResponseWriter, r *http.Request)
+	DisableTOTP(w http.ResponseWriter, r *http.Request)
+	RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request)
+	ForgotPassword(w http.ResponseWriter, r *http.Request)
+	ResetPassword(w http.ResponseWriter, r *http.Request)
+	VerifyEmail(w http.ResponseWriter, r *http.Request)
+	ResendVerification(w http.ResponseWriter, r *http.Request)
+	CreateAccessToken(w http.ResponseWriter, r *http.Request)
+	GetAccessTokens(w http.ResponseWriter, r *http.Request)
+	RevokeAccessToken(w http.ResponseWriter, r *http.Request)
+	UnlockUser(w http.ResponseWriter, r *http.Request)
+	SetUserRole(w http.ResponseWriter, r *http.Request)
+	GetOIDCProviders(w http.ResponseWriter, r *http.Request)
+	OIDCAuthorize(w http.ResponseWriter, r *http.Request)
+	OIDCCallback(w http.ResponseWriter, r *http.Request)
+	GetIdentities(w http.ResponseWriter, r *http.Request)
+	LinkIdentity(w http.ResponseWriter, r *http.Request)
+	UnlinkIdentity(w http.ResponseWriter, r *http.Request)
+	GetOAuthConsent(w http.ResponseWriter, r *http.Request)
+	OAuthAuthorize(w http.ResponseWriter, r *http.Request)
+	OAuthToken(w http.ResponseWriter, r *http.Request)
+	IntrospectToken(w http.ResponseWriter, r *http.Request)
+	RevokeToken(w http.ResponseWriter, r *http.Request)
+	CreateOAuthClient(w http.ResponseWriter, r *http.Request)
+	GetOAuthClients(w http.ResponseWriter, r *http.Request)
+	RevokeOAuthClient(w http.ResponseWriter, r *http.Request)
+	GetMe(w http.ResponseWriter, r *http.Request)
+	UpdateMe(w http.ResponseWriter, r *http.Request)
+	ChangePassword(w http.ResponseWriter, r *http.Request)
+	ChangeUsername(w http.ResponseWriter, r *http.Request)
+	DeleteAccount(w http.ResponseWriter, r *http.Request)
+	RestoreUser(w http.ResponseWriter, r *http.Request)
+	RequestExport(w http.ResponseWriter, r *http.Request)
+	GetExports(w http.ResponseWriter, r *http.Request)
+	GetExport(w http.ResponseWriter, r *http.Request)
+	DownloadExport(w http.ResponseWriter, r *http.Request)
+	GetInbox(w http.ResponseWriter, r *http.Request)
+	ReadInboxItem(w http.ResponseWriter, r *http.Request)
 }
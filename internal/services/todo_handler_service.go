@@ -4,9 +4,46 @@ import "net/http"
 
 type TodoHandlerService interface {
 	CreateTodo(w http.ResponseWriter, r *http.Request)
+	ListTodos(w http.ResponseWriter, r *http.Request)
 	CreateList(w http.ResponseWriter, r *http.Request)
+	GetLists(w http.ResponseWriter, r *http.Request)
+	GetList(w http.ResponseWriter, r *http.Request)
+	UpdateList(w http.ResponseWriter, r *http.Request)
+	DeleteList(w http.ResponseWriter, r *http.Request)
 	CreateTag(w http.ResponseWriter, r *http.Request)
+	GetTags(w http.ResponseWriter, r *http.Request)
+	UpdateTag(w http.ResponseWriter, r *http.Request)
+	DeleteTag(w http.ResponseWriter, r *http.Request)
+	AttachTag(w http.ResponseWriter, r *http.Request)
+	DetachTag(w http.ResponseWriter, r *http.Request)
 	UpdateTodo(w http.ResponseWriter, r *http.Request)
 	DeleteTodo(w http.ResponseWriter, r *http.Request)
 	GetTodo(w http.ResponseWriter, r *http.Request)
+	GetListMembers(w http.ResponseWriter, r *http.Request)
+	InviteListMember(w http.ResponseWriter, r *http.Request)
+	UpdateListMember(w http.ResponseWriter, r *http.Request)
+	RemoveListMember(w http.ResponseWriter, r *http.Request)
+	LeaveList(w http.ResponseWriter, r *http.Request)
+	TransferList(w http.ResponseWriter, r *http.Request)
+	GetInvitations(w http.ResponseWriter, r *http.Request)
+	AcceptInvitation(w http.ResponseWriter, r *http.Request)
+	DeclineInvitation(w http.ResponseWriter, r *http.Request)
+	CreateWorkspace(w http.ResponseWriter, r *http.Request)
+	GetWorkspaces(w http.ResponseWriter, r *http.Request)
+	GetWorkspace(w http.ResponseWriter, r *http.Request)
+	UpdateWorkspace(w http.ResponseWriter, r *http.Request)
+	DeleteWorkspace(w http.ResponseWriter, r *http.Request)
+	GetWorkspaceMembers(w http.ResponseWriter, r *http.Request)
+	AddWorkspaceMember(w http.ResponseWriter, r *http.Request)
+	UpdateWorkspaceMember(w http.ResponseWriter, r *http.Request)
+	RemoveWorkspaceMember(w http.ResponseWriter, r *http.Request)
+	CreateReminder(w http.ResponseWriter, r *http.Request)
+	GetReminders(w http.ResponseWriter, r *http.Request)
+	DeleteReminder(w http.ResponseWriter, r *http.Request)
+	CreateChecklistItem(w http.ResponseWriter, r *http.Request)
+	UpdateChecklistItem(w http.ResponseWriter, r *http.Request)
+	DeleteChecklistItem(w http.ResponseWriter, r *http.Request)
+	AddDependency(w http.ResponseWriter, r *http.Request)
+	RemoveDependency(w http.ResponseWriter, r *http.Request)
+	GetListOrder(w http.ResponseWriter, r *http.Request)
 }
@@ -0,0 +1,260 @@
+// Package jwks holds the asymmetric keys used to sign access tokens and
+// publishes their public halves as a JSON Web Key Set (RFC 7517).
+package jwks
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	RS256 = "RS256"
+	ES256 = "ES256"
+	EdDSA = "EdDSA"
+)
+
+type Key struct {
+	ID        string
+	Algorithm string
+	Method    jwt.SigningMethod
+	// Private is nil for keys that are only kept to verify tokens issued
+	// before a rotation.
+	Private crypto.PrivateKey
+	Public  crypto.PublicKey
+}
+
+// NewKey parses a key from its PEM encoded private and/or public key.
+// When the private key is given the public key is derived from it.
+func NewKey(id, algorithm string, privatePEM, publicPEM []byte) (*Key, error) {
+	if id == "" {
+		return nil, errors.New("jwks: key id is required")
+	}
+	if privatePEM == nil && publicPEM == nil {
+		return nil, fmt.Errorf("jwks: key %q has neither a private nor a public key", id)
+	}
+
+	key := &Key{ID: id, Algorithm: algorithm}
+	var err error
+	switch algorithm {
+	case RS256:
+		key.Method = jwt.SigningMethodRS256
+		if privatePEM != nil {
+			var priv *rsa.PrivateKey
+			if priv, err = jwt.ParseRSAPrivateKeyFromPEM(privatePEM); err == nil {
+				key.Private, key.Public = priv, &priv.PublicKey
+			}
+		} else {
+			key.Public, err = jwt.ParseRSAPublicKeyFromPEM(publicPEM)
+		}
+	case ES256:
+		key.Method = jwt.SigningMethodES256
+		if privatePEM != nil {
+			var priv *ecdsa.PrivateKey
+			if priv, err = jwt.ParseECPrivateKeyFromPEM(privatePEM); err == nil {
+				key.Private, key.Public = priv, &priv.PublicKey
+			}
+		} else {
+			key.Public, err = jwt.ParseECPublicKeyFromPEM(publicPEM)
+		}
+		if err == nil && key.Public.(*ecdsa.PublicKey).Curve != elliptic.P256() {
+			err = errors.New("ES256 requires a P-256 key")
+		}
+	case EdDSA:
+		key.Method = jwt.SigningMethodEdDSA
+		if privatePEM != nil {
+			var priv crypto.PrivateKey
+			if priv, err = jwt.ParseEdPrivateKeyFromPEM(privatePEM); err == nil {
+				key.Private, key.Public = priv, priv.(ed25519.PrivateKey).Public()
+			}
+		} else {
+			key.Public, err = jwt.ParseEdPublicKeyFromPEM(publicPEM)
+		}
+	default:
+		return nil, fmt.Errorf("jwks: key %q has unsupported algorithm %q", id, algorithm)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("jwks: key %q: %w", id, err)
+	}
+	return key, nil
+}
+
+// KeySet is the set of keys tokens are verified with, one of them is used to
+// sign new tokens.
+type KeySet struct {
+	signing *Key
+	keys    map[string]*Key
+}
+
+func NewKeySet(signingKeyID string, keys ...*Key) (*KeySet, error) {
+	ks := &KeySet{keys: make(map[string]*Key, len(keys))}
+	for _, key := range keys {
+		if _, ok := ks.keys[key.ID]; ok {
+			return nil, fmt.Errorf("jwks: duplicate key id %q", key.ID)
+		}
+		ks.keys[key.ID] = key
+	}
+
+	signing, ok := ks.keys[signingKeyID]
+	if !ok {
+		return nil, fmt.Errorf("jwks: signing key %q is not configured", signingKeyID)
+	}
+	if signing.Private == nil {
+		return nil, fmt.Errorf("jwks: signing key %q has no private key", signingKeyID)
+	}
+	ks.signing = signing
+	return ks, nil
+}
+
+func (ks *KeySet) SigningKey() *Key {
+	return ks.signing
+}
+
+func (ks *KeySet) Lookup(kid string) (*Key, bool) {
+	key, ok := ks.keys[kid]
+	return key, ok
+}
+
+// Sign signs claims with the signing key and sets the kid header.
+func (ks *KeySet) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(ks.signing.Method, claims)
+	token.Header["kid"] = ks.signing.ID
+	return token.SignedString(ks.signing.Private)
+}
+
+// Keyfunc resolves the verification key of a token from its kid header and
+// makes sure the token is signed with the algorithm of that key.
+func (ks *KeySet) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, ok := ks.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("invalid signing method")
+	}
+	return key.Public, nil
+}
+
+type JSONWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	Crv string `json:"crv,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+// JWKS returns the public keys of the set, sorted by kid.
+func (ks *KeySet) JWKS() JSONWebKeySet {
+	set := JSONWebKeySet{Keys: make([]JSONWebKey, 0, len(ks.keys))}
+	for _, key := range ks.keys {
+		jwk := JSONWebKey{Kid: key.ID, Alg: key.Algorithm, Use: "sig"}
+		switch pub := key.Public.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = encode(pub.N.Bytes())
+			jwk.E = encode(big.NewInt(int64(pub.E)).Bytes())
+		case *ecdsa.PublicKey:
+			size := (pub.Curve.Params().BitSize + 7) / 8
+			jwk.Kty = "EC"
+			jwk.Crv = pub.Curve.Params().Name
+			jwk.X = encode(pub.X.FillBytes(make([]byte, size)))
+			jwk.Y = encode(pub.Y.FillBytes(make([]byte, size)))
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = encode(pub)
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	sort.Slice(set.Keys, func(i, j int) bool { return set.Keys[i].Kid < set.Keys[j].Kid })
+	return set
+}
+
+func encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// PublicKey parses a key published in a JSON Web Key Set, for verifying
+// tokens signed by someone else.
+func (jwk JSONWebKey) PublicKey() (*Key, error) {
+	key := &Key{ID: jwk.Kid, Algorithm: jwk.Alg}
+	switch jwk.Kty {
+	case "RSA":
+		n, err := decode(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decode(jwk.E)
+		if err != nil {
+			return nil, err
+		}
+		key.Public = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		if key.Algorithm == "" {
+			key.Algorithm = RS256
+		}
+	case "EC":
+		if jwk.Crv != "P-256" {
+			return nil, fmt.Errorf("jwks: key %q has unsupported curve %q", jwk.Kid, jwk.Crv)
+		}
+		x, err := decode(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decode(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+		key.Public = &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if key.Algorithm == "" {
+			key.Algorithm = ES256
+		}
+	case "OKP":
+		x, err := decode(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		if jwk.Crv != "Ed25519" || len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("jwks: key %q is not a valid Ed25519 key", jwk.Kid)
+		}
+		key.Public = ed25519.PublicKey(x)
+		if key.Algorithm == "" {
+			key.Algorithm = EdDSA
+		}
+	default:
+		return nil, fmt.Errorf("jwks: key %q has unsupported type %q", jwk.Kid, jwk.Kty)
+	}
+
+	switch key.Algorithm {
+	case RS256:
+		key.Method = jwt.SigningMethodRS256
+	case ES256:
+		key.Method = jwt.SigningMethodES256
+	case EdDSA:
+		key.Method = jwt.SigningMethodEdDSA
+	default:
+		return nil, fmt.Errorf("jwks: key %q has unsupported algorithm %q", jwk.Kid, jwk.Alg)
+	}
+	return key, nil
+}
+
+func decode(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(s)
+}
@@ -0,0 +1,201 @@
+// Package lockout tracks failed login attempts per account and per client IP
+// and tells how long a key has to wait before it may try again.
+package lockout
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// Attempts is the failure state of one key.
+type Attempts struct {
+	Key           string
+	Failures      int
+	LastFailureAt time.Time
+	LockedUntil   time.Time
+}
+
+// Store persists Attempts.
+type Store interface {
+	// Get returns the attempts of key, or zero Attempts when there are none.
+	Get(ctx context.Context, key string) (Attempts, error)
+	// Fail records a failure of key at now. Failures older than the window
+	// of the policy are forgotten, and the key is locked for the delay the
+	// policy gives for the new failure count.
+	Fail(ctx context.Context, key string, now time.Time, policy Policy) (Attempts, error)
+	// Reset forgets all failures of key.
+	Reset(ctx context.Context, key string) error
+}
+
+// Policy describes how failures turn into waiting time. The first Free
+// failures cost nothing, then the delay starts at BaseDelay and doubles with
+// every failure up to MaxDelay. From LockAfter failures on the key is locked
+// out for LockDuration.
+type Policy struct {
+	Free         int
+	BaseDelay    time.Duration
+	MaxDelay     time.Duration
+	LockAfter    int
+	LockDuration time.Duration
+	// Window is how long failures are remembered after the last one.
+	Window time.Duration
+}
+
+// Delay returns how long a key has to wait after its nth failure.
+func (p Policy) Delay(failures int) time.Duration {
+	if p.LockAfter > 0 && failures >= p.LockAfter {
+		return p.LockDuration
+	}
+	if failures <= p.Free {
+		return 0
+	}
+
+	delay := p.BaseDelay
+	for i := p.Free + 1; i < failures && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	return delay
+}
+
+var (
+	DefaultAccountPolicy = Policy{
+		Free:         3,
+		BaseDelay:    time.Second,
+		MaxDelay:     time.Minute,
+		LockAfter:    10,
+		LockDuration: 15 * time.Minute,
+		Window:       time.Hour,
+	}
+	// A single address may front many users, so it gets more leeway.
+	DefaultIPPolicy = Policy{
+		Free:         20,
+		BaseDelay:    time.Second,
+		MaxDelay:     time.Minute,
+		LockAfter:    100,
+		LockDuration: time.Hour,
+		Window:       time.Hour,
+	}
+	// Guest accounts need no credentials, so the address that creates them
+	// is all there is to throttle.
+	DefaultGuestPolicy = Policy{
+		Free:         5,
+		BaseDelay:    time.Minute,
+		MaxDelay:     15 * time.Minute,
+		LockAfter:    20,
+		LockDuration: time.Hour,
+		Window:       time.Hour,
+	}
+)
+
+func AccountKey(username string) string {
+	return "user:" + strings.ToLower(username)
+}
+
+func IPKey(ip string) string {
+	return "ip:" + ip
+}
+
+// GuestKey is the key of the guest accounts created from ip.
+func GuestKey(ip string) string {
+	return "guest:" + ip
+}
+
+// Limiter applies the account and IP policies on top of a Store. The Guest
+// policy counts guest accounts per IP instead of failures.
+type Limiter struct {
+	Store   Store
+	Account Policy
+	IP      Policy
+	Guest   Policy
+}
+
+func NewLimiter(store Store) *Limiter {
+	return &Limiter{
+		Store:   store,
+		Account: DefaultAccountPolicy,
+		IP:      DefaultIPPolicy,
+		Guest:   DefaultGuestPolicy,
+	}
+}
+
+// Check returns how long the username or the ip still have to wait, zero
+// when a login may be attempted now.
+func (l *Limiter) Check(ctx context.Context, now time.Time, username, ip string) (time.Duration, error) {
+	var wait time.Duration
+	for _, key := range l.keys(username, ip) {
+		a, err := l.Store.Get(ctx, key)
+		if err != nil {
+			return 0, err
+		}
+		if d := a.LockedUntil.Sub(now); d > wait {
+			wait = d
+		}
+	}
+	return wait, nil
+}
+
+// Fail records a failed attempt for both the username and the ip.
+func (l *Limiter) Fail(ctx context.Context, now time.Time, username, ip string) error {
+	if username != "" {
+		if _, err := l.Store.Fail(ctx, AccountKey(username), now, l.Account); err != nil {
+			return err
+		}
+	}
+	if ip != "" {
+		if _, err := l.Store.Fail(ctx, IPKey(ip), now, l.IP); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Succeed forgets the failures of the account. The ip keeps its failures
+// so that one valid account does not clear the way to guess the others.
+func (l *Limiter) Succeed(ctx context.Context, username string) error {
+	return l.Store.Reset(ctx, AccountKey(username))
+}
+
+// Unlock lifts the lockout of an account.
+func (l *Limiter) Unlock(ctx context.Context, username string) error {
+	return l.Store.Reset(ctx, AccountKey(username))
+}
+
+// UnlockIP lifts the lockout of a client address, for logins and guest
+// accounts.
+func (l *Limiter) UnlockIP(ctx context.Context, ip string) error {
+	if err := l.Store.Reset(ctx, IPKey(ip)); err != nil {
+		return err
+	}
+	return l.Store.Reset(ctx, GuestKey(ip))
+}
+
+// CheckGuest returns how long ip still has to wait before it may create
+// another guest account, zero when it may create one now.
+func (l *Limiter) CheckGuest(ctx context.Context, now time.Time, ip string) (time.Duration, error) {
+	a, err := l.Store.Get(ctx, GuestKey(ip))
+	if err != nil {
+		return 0, err
+	}
+	return max(a.LockedUntil.Sub(now), 0), nil
+}
+
+// GuestCreated records a guest account created from ip.
+func (l *Limiter) GuestCreated(ctx context.Context, now time.Time, ip string) error {
+	_, err := l.Store.Fail(ctx, GuestKey(ip), now, l.Guest)
+	return err
+}
+
+func (l *Limiter) keys(username, ip string) []string {
+	keys := make([]string, 0, 2)
+	if username != "" {
+		keys = append(keys, AccountKey(username))
+	}
+	if ip != "" {
+		keys = append(keys, IPKey(ip))
+	}
+	return keys
+}
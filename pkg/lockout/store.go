@@ -0,0 +1,137 @@
+package lockout
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+// MemoryStore keeps attempts in process memory.
+type MemoryStore struct {
+	mu       sync.Mutex
+	attempts map[string]Attempts
+}
+
+var _ Store = (*MemoryStore)(nil)
+
+// memoryStoreSweep is the size from which expired keys are dropped.
+const memoryStoreSweep = 10000
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{attempts: make(map[string]Attempts)}
+}
+
+func (s *MemoryStore) Get(ctx context.Context, key string) (Attempts, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.attempts[key], nil
+}
+
+func (s *MemoryStore) Fail(ctx context.Context, key string, now time.Time, policy Policy) (Attempts, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.attempts) >= memoryStoreSweep {
+		for k, a := range s.attempts {
+			if now.Sub(a.LastFailureAt) > policy.Window && now.After(a.LockedUntil) {
+				delete(s.attempts, k)
+			}
+		}
+	}
+
+	a := s.attempts[key]
+	a.Key = key
+	if now.Sub(a.LastFailureAt) > policy.Window {
+		a.Failures = 0
+	}
+	a.Failures++
+	a.LastFailureAt = now
+	if d := policy.Delay(a.Failures); d > 0 {
+		a.LockedUntil = now.Add(d)
+	}
+	s.attempts[key] = a
+	return a, nil
+}
+
+func (s *MemoryStore) Reset(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.attempts, key)
+	return nil
+}
+
+// loginAttempt is the row of the login_attempts table.
+type loginAttempt struct {
+	bun.BaseModel `bun:"table:login_attempts,alias:la"`
+	Key           string    `bun:"key,pk"`
+	Failures      int       `bun:"failures,notnull"`
+	LastFailureAt time.Time `bun:"last_failure_at,notnull"`
+	LockedUntil   time.Time `bun:"locked_until,nullzero"`
+}
+
+// DBStore keeps attempts in Postgres so that every instance of the API
+// sees the same lockouts.
+type DBStore struct {
+	db bun.IDB
+}
+
+var _ Store = (*DBStore)(nil)
+
+func NewDBStore(db bun.IDB) *DBStore {
+	return &DBStore{db: db}
+}
+
+func (s *DBStore) Get(ctx context.Context, key string) (Attempts, error) {
+	row := new(loginAttempt)
+	err := s.db.NewSelect().Model(row).Where("key = ?", key).Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Attempts{}, nil
+	}
+	if err != nil {
+		return Attempts{}, err
+	}
+	return row.attempts(), nil
+}
+
+func (s *DBStore) Fail(ctx context.Context, key string, now time.Time, policy Policy) (Attempts, error) {
+	row := &loginAttempt{Key: key, Failures: 1, LastFailureAt: now}
+	_, err := s.db.NewInsert().Model(row).
+		On("CONFLICT (key) DO UPDATE").
+		Set("failures = CASE WHEN la.last_failure_at >= ? THEN la.failures + 1 ELSE 1 END", now.Add(-policy.Window)).
+		Set("last_failure_at = EXCLUDED.last_failure_at").
+		Returning("*").
+		Exec(ctx)
+	if err != nil {
+		return Attempts{}, err
+	}
+
+	if d := policy.Delay(row.Failures); d > 0 {
+		row.LockedUntil = now.Add(d)
+		_, err = s.db.NewUpdate().Model(row).
+			Column("locked_until").
+			WherePK().
+			Exec(ctx)
+		if err != nil {
+			return Attempts{}, err
+		}
+	}
+	return row.attempts(), nil
+}
+
+func (s *DBStore) Reset(ctx context.Context, key string) error {
+	_, err := s.db.NewDelete().Model((*loginAttempt)(nil)).Where("key = ?", key).Exec(ctx)
+	return err
+}
+
+func (row *loginAttempt) attempts() Attempts {
+	return Attempts{
+		Key:           row.Key,
+		Failures:      row.Failures,
+		LastFailureAt: row.LastFailureAt,
+		LockedUntil:   row.LockedUntil,
+	}
+}
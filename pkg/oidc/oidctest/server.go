@@ -0,0 +1,273 @@
+// Package oidctest runs a fake OpenID provider in process, so the login flow
+// can be exercised without network access. It approves every authorization
+// request for the identity set with SetIdentity.
+package oidctest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+	"todo-app/pkg/jwks"
+	"todo-app/pkg/oidc"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const codeDuration = time.Minute
+
+// Identity is the end user the fake provider logs in.
+type Identity struct {
+	Subject           string
+	Email             string
+	EmailVerified     bool
+	Name              string
+	PreferredUsername string
+}
+
+type authRequest struct {
+	clientID      string
+	redirectURI   string
+	nonce         string
+	codeChallenge string
+	identity      Identity
+	expiresAt     time.Time
+}
+
+type Server struct {
+	*httptest.Server
+	ClientID     string
+	ClientSecret string
+	// Now is the time of the provider, time.Now by default.
+	Now func() time.Time
+
+	keys *jwks.KeySet
+
+	mu       sync.Mutex
+	identity Identity
+	codes    map[string]*authRequest
+}
+
+// NewServer starts a provider that accepts the given client credentials.
+// Close it when done.
+func NewServer(clientID, clientSecret string) *Server {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	key := &jwks.Key{ID: "oidctest", Algorithm: jwks.ES256, Method: jwt.SigningMethodES256, Private: priv, Public: &priv.PublicKey}
+	keys, err := jwks.NewKeySet(key.ID, key)
+	if err != nil {
+		panic(err)
+	}
+
+	s := &Server{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		Now:          time.Now,
+		keys:         keys,
+		identity:     Identity{Subject: "oidctest-user", Email: "user@oidctest.local", EmailVerified: true, Name: "Test User", PreferredUsername: "testuser"},
+		codes:        make(map[string]*authRequest),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", s.handleDiscovery)
+	mux.HandleFunc("GET /authorize", s.handleAuthorize)
+	mux.HandleFunc("POST /token", s.handleToken)
+	mux.HandleFunc("GET /jwks", s.handleJWKS)
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+// Issuer is the issuer URL to configure the relying party with.
+func (s *Server) Issuer() string {
+	return s.URL
+}
+
+// SetIdentity changes who the next authorization requests log in as.
+func (s *Server) SetIdentity(identity Identity) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.identity = identity
+}
+
+// Authorize follows an authorization URL like a browser would and returns
+// the code and state the provider redirects back with.
+func (s *Server) Authorize(authCodeURL string) (code, state string, err error) {
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Get(authCodeURL)
+	if err != nil {
+		return "", "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		return "", "", fmt.Errorf("oidctest: authorize returned status %d", resp.StatusCode)
+	}
+
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		return "", "", err
+	}
+	q := location.Query()
+	if e := q.Get("error"); e != "" {
+		return "", "", fmt.Errorf("oidctest: %s", e)
+	}
+	return q.Get("code"), q.Get("state"), nil
+}
+
+func (s *Server) handleDiscovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, oidc.Discovery{
+		Issuer:                s.URL,
+		AuthorizationEndpoint: s.URL + "/authorize",
+		TokenEndpoint:         s.URL + "/token",
+		JWKSURI:               s.URL + "/jwks",
+	})
+}
+
+func (s *Server) handleJWKS(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.keys.JWKS())
+}
+
+func (s *Server) handleAuthorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	redirectURI, err := url.Parse(q.Get("redirect_uri"))
+	if err != nil || q.Get("redirect_uri") == "" {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+	if q.Get("client_id") != s.ClientID {
+		http.Error(w, "unknown client_id", http.StatusBadRequest)
+		return
+	}
+
+	back := redirectURI.Query()
+	back.Set("state", q.Get("state"))
+	switch {
+	case q.Get("response_type") != "code":
+		back.Set("error", "unsupported_response_type")
+	case q.Get("code_challenge") == "" || q.Get("code_challenge_method") != "S256":
+		back.Set("error", "invalid_request")
+	default:
+		code, err := oidc.RandomString(16)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		s.mu.Lock()
+		s.codes[code] = &authRequest{
+			clientID:      s.ClientID,
+			redirectURI:   q.Get("redirect_uri"),
+			nonce:         q.Get("nonce"),
+			codeChallenge: q.Get("code_challenge"),
+			identity:      s.identity,
+			expiresAt:     s.Now().Add(codeDuration),
+		}
+		s.mu.Unlock()
+		back.Set("code", code)
+	}
+	redirectURI.RawQuery = back.Encode()
+	http.Redirect(w, r, redirectURI.String(), http.StatusFound)
+}
+
+func (s *Server) handleToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		tokenError(w, "invalid_request", err)
+		return
+	}
+
+	clientID, clientSecret, ok := r.BasicAuth()
+	if ok {
+		clientID, _ = url.QueryUnescape(clientID)
+		clientSecret, _ = url.QueryUnescape(clientSecret)
+	} else {
+		clientID, clientSecret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+	if clientID != s.ClientID || subtle.ConstantTimeCompare([]byte(clientSecret), []byte(s.ClientSecret)) != 1 {
+		w.Header().Set("WWW-Authenticate", `Basic realm="oidctest"`)
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+	if r.PostForm.Get("grant_type") != "authorization_code" {
+		tokenError(w, "unsupported_grant_type", nil)
+		return
+	}
+
+	// Codes are single-use, even when the exchange fails.
+	code := r.PostForm.Get("code")
+	s.mu.Lock()
+	req, ok := s.codes[code]
+	delete(s.codes, code)
+	s.mu.Unlock()
+
+	now := s.Now()
+	switch {
+	case !ok || now.After(req.expiresAt):
+		tokenError(w, "invalid_grant", errors.New("unknown or expired code"))
+		return
+	case req.redirectURI != r.PostForm.Get("redirect_uri"):
+		tokenError(w, "invalid_grant", errors.New("redirect_uri does not match"))
+		return
+	case oidc.CodeChallengeS256(r.PostForm.Get("code_verifier")) != req.codeChallenge:
+		tokenError(w, "invalid_grant", errors.New("code_verifier does not match"))
+		return
+	}
+
+	idToken, err := s.keys.Sign(oidc.Claims{
+		Email:             req.identity.Email,
+		EmailVerified:     req.identity.EmailVerified,
+		Name:              req.identity.Name,
+		PreferredUsername: req.identity.PreferredUsername,
+		Nonce:             req.nonce,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    s.URL,
+			Subject:   req.identity.Subject,
+			Audience:  jwt.ClaimStrings{req.clientID},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(5 * time.Minute)),
+		},
+	})
+	if err != nil {
+		tokenError(w, "server_error", err)
+		return
+	}
+	accessToken, err := oidc.RandomString(32)
+	if err != nil {
+		tokenError(w, "server_error", err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, oidc.TokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		IDToken:     idToken,
+		ExpiresIn:   300,
+	})
+}
+
+func tokenError(w http.ResponseWriter, code string, err error) {
+	body := map[string]string{"error": code}
+	if err != nil {
+		body["error_description"] = err.Error()
+	}
+	status := http.StatusBadRequest
+	if code == "server_error" {
+		status = http.StatusInternalServerError
+	}
+	writeJSON(w, status, body)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,83 @@
+// Package password hashes and verifies user passwords and enforces the
+// password policy.
+package password
+
+import (
+	"errors"
+	"sync"
+)
+
+var ErrUnknownHash = errors.New("password: unknown hash format")
+
+// Hasher hashes passwords into self-describing strings.
+type Hasher interface {
+	Hash(password string) (string, error)
+	// Verify reports whether password matches encoded. A mismatch is not
+	// an error.
+	Verify(encoded, password string) (bool, error)
+	// Identify reports whether encoded was produced by this algorithm.
+	Identify(encoded string) bool
+	// NeedsRehash reports whether encoded was produced with other
+	// parameters than the current ones.
+	NeedsRehash(encoded string) bool
+}
+
+// Set hashes new passwords with Preferred and still verifies the hashes of
+// the other hashers, so that the algorithm can change without locking
+// anyone out.
+type Set struct {
+	Preferred Hasher
+	Others    []Hasher
+
+	dummyOnce sync.Once
+	dummy     string
+}
+
+var _ Hasher = (*Set)(nil)
+
+func NewSet(preferred Hasher, others ...Hasher) *Set {
+	return &Set{Preferred: preferred, Others: others}
+}
+
+func (s *Set) Hash(password string) (string, error) {
+	return s.Preferred.Hash(password)
+}
+
+func (s *Set) Verify(encoded, password string) (bool, error) {
+	h := s.find(encoded)
+	if h == nil {
+		return false, ErrUnknownHash
+	}
+	return h.Verify(encoded, password)
+}
+
+func (s *Set) Identify(encoded string) bool {
+	return s.find(encoded) != nil
+}
+
+// NeedsRehash reports whether encoded was not produced by the preferred
+// hasher with its current parameters.
+func (s *Set) NeedsRehash(encoded string) bool {
+	return !s.Preferred.Identify(encoded) || s.Preferred.NeedsRehash(encoded)
+}
+
+// Spend verifies password against a hash that matches nothing. It takes
+// as long as a real verification, for when there is no user to check.
+func (s *Set) Spend(password string) {
+	s.dummyOnce.Do(func() {
+		s.dummy, _ = s.Preferred.Hash("not the password of any user")
+	})
+	s.Preferred.Verify(s.dummy, password)
+}
+
+func (s *Set) find(encoded string) Hasher {
+	if s.Preferred.Identify(encoded) {
+		return s.Preferred
+	}
+	for _, h := range s.Others {
+		if h.Identify(encoded) {
+			return h
+		}
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package password
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	ErrTooShort         = errors.New("password is too short")
+	ErrTooLong          = errors.New("password is too long")
+	ErrBreached         = errors.New("password appears in a list of breached passwords")
+	ErrContainsUsername = errors.New("password must not contain the username")
+)
+
+// Policy is what a new password has to satisfy.
+type Policy struct {
+	MinLength int
+	MaxLength int
+	// Breached holds the upper case SHA-1 hex of known breached passwords.
+	Breached map[string]struct{}
+}
+
+const (
+	DefaultMinLength = 8
+	// Argon2id has no limit but bcrypt ignores everything after 72 bytes.
+	DefaultMaxLength = 72
+)
+
+func NewPolicy() *Policy {
+	return &Policy{MinLength: DefaultMinLength, MaxLength: DefaultMaxLength}
+}
+
+// Validate returns the first rule that password breaks.
+func (p *Policy) Validate(username, password string) error {
+	if utf8.RuneCountInString(password) < p.MinLength {
+		return fmt.Errorf("%w: at least %d characters", ErrTooShort, p.MinLength)
+	}
+	if p.MaxLength > 0 && len(password) > p.MaxLength {
+		return fmt.Errorf("%w: at most %d bytes", ErrTooLong, p.MaxLength)
+	}
+	if username != "" && strings.Contains(strings.ToLower(password), strings.ToLower(username)) {
+		return ErrContainsUsername
+	}
+	if _, ok := p.Breached[sha1Hex(password)]; ok {
+		return ErrBreached
+	}
+	return nil
+}
+
+// LoadBreached reads a breached password list with one entry per line,
+// either the password itself or its SHA-1 in hex as published by Have I
+// Been Pwned (an optional ":count" suffix is ignored).
+func (p *Policy) LoadBreached(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if p.Breached == nil {
+		p.Breached = make(map[string]struct{})
+	}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" {
+			continue
+		}
+		if hash, _, _ := strings.Cut(line, ":"); isSHA1Hex(hash) {
+			p.Breached[strings.ToUpper(hash)] = struct{}{}
+			continue
+		}
+		p.Breached[sha1Hex(line)] = struct{}{}
+	}
+	return scanner.Err()
+}
+
+func sha1Hex(s string) string {
+	sum := sha1.Sum([]byte(s))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+func isSHA1Hex(s string) bool {
+	if len(s) != sha1.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
@@ -0,0 +1,487 @@
+// Package rrule implements the subset of iCalendar recurrence rules
+// (RFC 5545 section 3.3.10) todos repeat with: FREQ DAILY, WEEKLY, MONTHLY
+// and YEARLY with INTERVAL, BYDAY, BYMONTHDAY, COUNT and UNTIL.
+//
+// Occurrences keep the wall clock time of the start of the series in its
+// location, so a todo due at 09:00 stays at 09:00 across DST changes.
+package rrule
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Frequency string
+
+const (
+	Daily   Frequency = "DAILY"
+	Weekly  Frequency = "WEEKLY"
+	Monthly Frequency = "MONTHLY"
+	Yearly  Frequency = "YEARLY"
+)
+
+// maxEmptyPeriods bounds the search for the next occurrence, rules like
+// BYMONTHDAY=31;INTERVAL=12 in a month with 30 days never match.
+const maxEmptyPeriods = 1000
+
+var ErrUnsupported = errors.New("rrule: unsupported rule")
+
+var weekdays = map[string]time.Weekday{
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+	"SU": time.Sunday,
+}
+
+// WeekdayNum is a BYDAY entry. N is the occurrence of the weekday in the
+// month, negative counts from the end, 0 means every such weekday.
+type WeekdayNum struct {
+	N   int
+	Day time.Weekday
+}
+
+func (w WeekdayNum) String() string {
+	s := strings.ToUpper(w.Day.String()[:2])
+	if w.N != 0 {
+		s = strconv.Itoa(w.N) + s
+	}
+	return s
+}
+
+type Rule struct {
+	Freq       Frequency
+	Interval   int
+	ByDay      []WeekdayNum
+	ByMonthDay []int
+	// Count limits the number of occurrences, 0 means no limit.
+	Count int
+	// Until is the last possible occurrence. When UntilLocal is set it is a
+	// wall clock time in the location of the series, stored in UTC.
+	Until      time.Time
+	UntilLocal bool
+}
+
+// Parse parses a recurrence rule like "FREQ=WEEKLY;BYDAY=MO,WE,FR". The
+// "RRULE:" prefix is optional.
+func Parse(s string) (*Rule, error) {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "RRULE:")
+	if s == "" {
+		return nil, errors.New("rrule: empty rule")
+	}
+
+	r := &Rule{Interval: 1}
+	seen := map[string]bool{}
+	for _, part := range strings.Split(s, ";") {
+		name, value, ok := strings.Cut(part, "=")
+		name = strings.ToUpper(name)
+		if !ok || value == "" {
+			return nil, fmt.Errorf("rrule: invalid part %q", part)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("rrule: %s given twice", name)
+		}
+		seen[name] = true
+
+		var err error
+		switch name {
+		case "FREQ":
+			r.Freq = Frequency(strings.ToUpper(value))
+			switch r.Freq {
+			case Daily, Weekly, Monthly, Yearly:
+			default:
+				return nil, fmt.Errorf("%w: FREQ=%s", ErrUnsupported, value)
+			}
+		case "INTERVAL":
+			if r.Interval, err = strconv.Atoi(value); err != nil || r.Interval < 1 {
+				return nil, fmt.Errorf("rrule: invalid INTERVAL %q", value)
+			}
+		case "COUNT":
+			if r.Count, err = strconv.Atoi(value); err != nil || r.Count < 1 {
+				return nil, fmt.Errorf("rrule: invalid COUNT %q", value)
+			}
+		case "UNTIL":
+			if err := r.parseUntil(value); err != nil {
+				return nil, err
+			}
+		case "BYDAY":
+			for _, v := range strings.Split(strings.ToUpper(value), ",") {
+				wd, err := parseWeekdayNum(v)
+				if err != nil {
+					return nil, err
+				}
+				r.ByDay = append(r.ByDay, wd)
+			}
+		case "BYMONTHDAY":
+			for _, v := range strings.Split(value, ",") {
+				d, err := strconv.Atoi(v)
+				if err != nil || d == 0 || d < -31 || d > 31 {
+					return nil, fmt.Errorf("rrule: invalid BYMONTHDAY %q", v)
+				}
+				r.ByMonthDay = append(r.ByMonthDay, d)
+			}
+		case "WKST":
+			// Weeks start on Monday, which is the default.
+			if strings.ToUpper(value) != "MO" {
+				return nil, fmt.Errorf("%w: WKST=%s", ErrUnsupported, value)
+			}
+		default:
+			return nil, fmt.Errorf("%w: %s", ErrUnsupported, name)
+		}
+	}
+
+	if r.Freq == "" {
+		return nil, errors.New("rrule: FREQ is required")
+	}
+	if r.Count > 0 && !r.Until.IsZero() {
+		return nil, errors.New("rrule: COUNT and UNTIL must not both be given")
+	}
+	for _, wd := range r.ByDay {
+		if wd.N != 0 && r.Freq != Monthly {
+			return nil, fmt.Errorf("%w: BYDAY=%s outside of MONTHLY", ErrUnsupported, wd)
+		}
+	}
+	if len(r.ByMonthDay) > 0 && r.Freq == Weekly {
+		return nil, errors.New("rrule: BYMONTHDAY must not be used with WEEKLY")
+	}
+	if r.Freq == Yearly && (len(r.ByDay) > 0 || len(r.ByMonthDay) > 0) {
+		return nil, fmt.Errorf("%w: BYDAY and BYMONTHDAY with YEARLY", ErrUnsupported)
+	}
+	return r, nil
+}
+
+func parseWeekdayNum(s string) (WeekdayNum, error) {
+	if len(s) < 2 {
+		return WeekdayNum{}, fmt.Errorf("rrule: invalid BYDAY %q", s)
+	}
+	day, ok := weekdays[s[len(s)-2:]]
+	if !ok {
+		return WeekdayNum{}, fmt.Errorf("rrule: invalid BYDAY %q", s)
+	}
+	wd := WeekdayNum{Day: day}
+	if n := s[:len(s)-2]; n != "" {
+		var err error
+		if wd.N, err = strconv.Atoi(n); err != nil || wd.N == 0 || wd.N < -5 || wd.N > 5 {
+			return WeekdayNum{}, fmt.Errorf("rrule: invalid BYDAY %q", s)
+		}
+	}
+	return wd, nil
+}
+
+func (r *Rule) parseUntil(value string) error {
+	var err error
+	switch {
+	case len(value) == 8:
+		// A date includes the whole day.
+		r.Until, err = time.Parse("20060102", value)
+		r.Until = r.Until.Add(24*time.Hour - time.Second)
+		r.UntilLocal = true
+	case strings.HasSuffix(value, "Z"):
+		r.Until, err = time.Parse("20060102T150405Z", value)
+	default:
+		r.Until, err = time.Parse("20060102T150405", value)
+		r.UntilLocal = true
+	}
+	if err != nil {
+		return fmt.Errorf("rrule: invalid UNTIL %q", value)
+	}
+	return nil
+}
+
+// String returns the rule in its canonical form, without the "RRULE:"
+// prefix.
+func (r *Rule) String() string {
+	parts := []string{"FREQ=" + string(r.Freq)}
+	if r.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(r.Interval))
+	}
+	if len(r.ByDay) > 0 {
+		days := make([]string, len(r.ByDay))
+		for i, wd := range r.ByDay {
+			days[i] = wd.String()
+		}
+		parts = append(parts, "BYDAY="+strings.Join(days, ","))
+	}
+	if len(r.ByMonthDay) > 0 {
+		days := make([]string, len(r.ByMonthDay))
+		for i, d := range r.ByMonthDay {
+			days[i] = strconv.Itoa(d)
+		}
+		parts = append(parts, "BYMONTHDAY="+strings.Join(days, ","))
+	}
+	if r.Count > 0 {
+		parts = append(parts, "COUNT="+strconv.Itoa(r.Count))
+	}
+	if !r.Until.IsZero() {
+		if r.UntilLocal {
+			parts = append(parts, "UNTIL="+r.Until.Format("20060102T150405"))
+		} else {
+			parts = append(parts, "UNTIL="+r.Until.UTC().Format("20060102T150405Z"))
+		}
+	}
+	return strings.Join(parts, ";")
+}
+
+// First returns the first occurrence of the series that starts at dtstart,
+// which is dtstart itself when it matches the rule. ok is false when the
+// rule has no occurrence.
+func (r *Rule) First(dtstart time.Time) (time.Time, bool) {
+	return r.next(dtstart, dtstart, true)
+}
+
+// Next returns the first occurrence of the series that starts at dtstart
+// after t. ok is false when the series ended before.
+func (r *Rule) Next(dtstart, t time.Time) (time.Time, bool) {
+	return r.next(dtstart, t, false)
+}
+
+func (r *Rule) next(dtstart, t time.Time, inclusive bool) (time.Time, bool) {
+	loc := dtstart.Location()
+	start := civil(dtstart)
+
+	// Without a COUNT the periods before t can be skipped, the one before
+	// the period of t is kept since its candidates may spill over.
+	period := 0
+	if r.Count == 0 && t.After(dtstart) {
+		period = r.periodOf(start, civil(t.In(loc)))/r.interval() - 1
+		if period < 0 {
+			period = 0
+		}
+	}
+
+	n := 0
+	for empty := 0; empty < maxEmptyPeriods; period++ {
+		found := false
+		for _, day := range r.candidates(start, period) {
+			o := At(day.Year(), day.Month(), day.Day(), dtstart.Hour(), dtstart.Minute(), dtstart.Second(), loc)
+			if o.Before(dtstart) {
+				continue
+			}
+			if r.afterUntil(o) {
+				return time.Time{}, false
+			}
+			n++
+			if r.Count > 0 && n > r.Count {
+				return time.Time{}, false
+			}
+			if o.After(t) || (inclusive && o.Equal(t)) {
+				return o, true
+			}
+			found = true
+		}
+		if found {
+			empty = 0
+		} else {
+			empty++
+		}
+	}
+	return time.Time{}, false
+}
+
+func (r *Rule) interval() int {
+	if r.Interval < 1 {
+		return 1
+	}
+	return r.Interval
+}
+
+func (r *Rule) afterUntil(o time.Time) bool {
+	if r.Until.IsZero() {
+		return false
+	}
+	if r.UntilLocal {
+		return civilTime(o).After(r.Until)
+	}
+	return o.After(r.Until)
+}
+
+// periodOf returns the number of days, weeks, months or years from start to
+// day, ignoring the interval.
+func (r *Rule) periodOf(start, day time.Time) int {
+	switch r.Freq {
+	case Daily:
+		return int(day.Sub(start).Hours() / 24)
+	case Weekly:
+		return int(monday(day).Sub(monday(start)).Hours() / (24 * 7))
+	case Monthly:
+		return (day.Year()-start.Year())*12 + int(day.Month()-start.Month())
+	default:
+		return day.Year() - start.Year()
+	}
+}
+
+// candidates returns the days of the period with the given index that
+// match the rule, in order. Days are midnight UTC.
+func (r *Rule) candidates(start time.Time, period int) []time.Time {
+	n := period * r.interval()
+	switch r.Freq {
+	case Daily:
+		day := start.AddDate(0, 0, n)
+		if r.matchesWeekday(day) && r.matchesMonthDay(day) {
+			return []time.Time{day}
+		}
+		return nil
+
+	case Weekly:
+		first := monday(start).AddDate(0, 0, 7*n)
+		if len(r.ByDay) == 0 {
+			return []time.Time{first.AddDate(0, 0, weekdayIndex(start.Weekday()))}
+		}
+		days := make([]time.Time, 0, len(r.ByDay))
+		for i := 0; i < 7; i++ {
+			if day := first.AddDate(0, 0, i); r.matchesWeekday(day) {
+				days = append(days, day)
+			}
+		}
+		return days
+
+	case Monthly:
+		first := time.Date(start.Year(), start.Month()+time.Month(n), 1, 0, 0, 0, 0, time.UTC)
+		return r.monthDays(start, first)
+
+	default:
+		day := time.Date(start.Year()+n, start.Month(), start.Day(), 0, 0, 0, 0, time.UTC)
+		// February 29 only exists in leap years.
+		if day.Day() != start.Day() {
+			return nil
+		}
+		return []time.Time{day}
+	}
+}
+
+func (r *Rule) monthDays(start, first time.Time) []time.Time {
+	length := first.AddDate(0, 1, -1).Day()
+	if len(r.ByDay) == 0 && len(r.ByMonthDay) == 0 {
+		if start.Day() > length {
+			return nil
+		}
+		return []time.Time{first.AddDate(0, 0, start.Day()-1)}
+	}
+
+	matches := map[int]bool{}
+	for _, d := range r.ByMonthDay {
+		if d < 0 {
+			d = length + d + 1
+		}
+		if d >= 1 && d <= length {
+			matches[d] = true
+		}
+	}
+	byDay := map[int]bool{}
+	for _, wd := range r.ByDay {
+		for _, d := range nthWeekdays(first, length, wd) {
+			byDay[d] = true
+		}
+	}
+
+	// BYDAY limits BYMONTHDAY when both are given.
+	if len(r.ByMonthDay) == 0 {
+		matches = byDay
+	} else if len(r.ByDay) > 0 {
+		for d := range matches {
+			if !byDay[d] {
+				delete(matches, d)
+			}
+		}
+	}
+
+	days := make([]time.Time, 0, len(matches))
+	for d := range matches {
+		days = append(days, first.AddDate(0, 0, d-1))
+	}
+	sort.Slice(days, func(i, j int) bool { return days[i].Before(days[j]) })
+	return days
+}
+
+// nthWeekdays returns the days of the month starting at first that match
+// wd.
+func nthWeekdays(first time.Time, length int, wd WeekdayNum) []int {
+	var days []int
+	for d := 1 + (int(wd.Day)-int(first.Weekday())+7)%7; d <= length; d += 7 {
+		days = append(days, d)
+	}
+	switch {
+	case wd.N == 0:
+		return days
+	case wd.N > 0 && wd.N <= len(days):
+		return days[wd.N-1 : wd.N]
+	case wd.N < 0 && -wd.N <= len(days):
+		return days[len(days)+wd.N : len(days)+wd.N+1]
+	}
+	return nil
+}
+
+func (r *Rule) matchesWeekday(day time.Time) bool {
+	if len(r.ByDay) == 0 {
+		return true
+	}
+	for _, wd := range r.ByDay {
+		if wd.Day == day.Weekday() {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Rule) matchesMonthDay(day time.Time) bool {
+	if len(r.ByMonthDay) == 0 {
+		return true
+	}
+	length := day.AddDate(0, 1, -day.Day()).Day()
+	for _, d := range r.ByMonthDay {
+		if d == day.Day() || length+d+1 == day.Day() {
+			return true
+		}
+	}
+	return false
+}
+
+// At returns the instant the wall clock shows the given time in loc.
+// Following RFC 5545, a time skipped by a DST change is moved forward by the
+// length of the gap and a time that happens twice is the first of both.
+func At(year int, month time.Month, day, hour, min, sec int, loc *time.Location) time.Time {
+	wall := time.Date(year, month, day, hour, min, sec, 0, time.UTC)
+
+	// Zone offsets change at most once a day, the offsets a day before and
+	// after are the candidates.
+	_, before := wall.Add(-24 * time.Hour).In(loc).Zone()
+	_, after := wall.Add(24 * time.Hour).In(loc).Zone()
+
+	var found time.Time
+	for _, offset := range []int{before, after} {
+		t := wall.Add(-time.Duration(offset) * time.Second).In(loc)
+		if civilTime(t).Equal(wall) && (found.IsZero() || t.Before(found)) {
+			found = t
+		}
+	}
+	if found.IsZero() {
+		// The wall clock skipped the time, use the offset before the change.
+		found = wall.Add(-time.Duration(before) * time.Second).In(loc)
+	}
+	return found
+}
+
+// civil returns the day of t as midnight UTC.
+func civil(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// civilTime returns the wall clock time of t in UTC.
+func civilTime(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.UTC)
+}
+
+func monday(day time.Time) time.Time {
+	return day.AddDate(0, 0, -weekdayIndex(day.Weekday()))
+}
+
+// weekdayIndex counts the days from Monday.
+func weekdayIndex(d time.Weekday) int {
+	return (int(d) + 6) % 7
+}
@@ -0,0 +1,194 @@
+// Package storage keeps the files the app generates, like data exports.
+// SupabaseStorage is used when Supabase is configured, LocalStorage writes
+// to a directory and MemoryStorage is for tests.
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	storage_go "github.com/supabase-community/storage-go"
+)
+
+var ErrNotFound = errors.New("storage: object not found")
+
+type Storage interface {
+	// Put stores the content of r under key, replacing an existing object.
+	Put(ctx context.Context, key string, r io.Reader, contentType string) error
+	// Get opens the object stored under key. It returns ErrNotFound when
+	// there is none.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes the object stored under key. Deleting a missing object
+	// is not an error.
+	Delete(ctx context.Context, key string) error
+}
+
+// cleanKey rejects keys that are empty or would leave the storage root.
+func cleanKey(key string) (string, error) {
+	cleaned := path.Clean("/" + key)[1:]
+	if cleaned == "" || cleaned != key {
+		return "", errors.New("storage: invalid key " + key)
+	}
+	return cleaned, nil
+}
+
+// LocalStorage keeps the objects as files below Dir.
+type LocalStorage struct {
+	Dir string
+}
+
+var _ Storage = (*LocalStorage)(nil)
+
+func (s *LocalStorage) path(key string) (string, error) {
+	key, err := cleanKey(key)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(s.Dir, filepath.FromSlash(key)), nil
+}
+
+func (s *LocalStorage) Put(ctx context.Context, key string, r io.Reader, contentType string) error {
+	name, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(name), 0o700); err != nil {
+		return err
+	}
+
+	// Write to a temporary file first, so readers never see half an object.
+	f, err := os.CreateTemp(filepath.Dir(name), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), name)
+}
+
+func (s *LocalStorage) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	name, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return f, err
+}
+
+func (s *LocalStorage) Delete(ctx context.Context, key string) error {
+	name, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(name); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// SupabaseStorage keeps the objects in a Supabase storage bucket.
+type SupabaseStorage struct {
+	Client *storage_go.Client
+	Bucket string
+}
+
+var _ Storage = (*SupabaseStorage)(nil)
+
+func (s *SupabaseStorage) Put(ctx context.Context, key string, r io.Reader, contentType string) error {
+	key, err := cleanKey(key)
+	if err != nil {
+		return err
+	}
+	upsert := true
+	_, err = s.Client.UploadFile(s.Bucket, key, r, storage_go.FileOptions{
+		ContentType: &contentType,
+		Upsert:      &upsert,
+	})
+	return err
+}
+
+func (s *SupabaseStorage) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	key, err := cleanKey(key)
+	if err != nil {
+		return nil, err
+	}
+	data, err := s.Client.DownloadFile(s.Bucket, key)
+	var storageErr *storage_go.StorageError
+	if errors.As(err, &storageErr) && (storageErr.Status == 404 || strings.Contains(strings.ToLower(storageErr.Message), "not found")) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (s *SupabaseStorage) Delete(ctx context.Context, key string) error {
+	key, err := cleanKey(key)
+	if err != nil {
+		return err
+	}
+	_, err = s.Client.RemoveFile(s.Bucket, []string{key})
+	return err
+}
+
+// MemoryStorage keeps the objects in memory.
+type MemoryStorage struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+var _ Storage = (*MemoryStorage)(nil)
+
+func (s *MemoryStorage) Put(ctx context.Context, key string, r io.Reader, contentType string) error {
+	key, err := cleanKey(key)
+	if err != nil {
+		return err
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.objects == nil {
+		s.objects = make(map[string][]byte)
+	}
+	s.objects[key] = data
+	return nil
+}
+
+func (s *MemoryStorage) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.objects[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (s *MemoryStorage) Delete(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.objects, key)
+	return nil
+}
@@ -0,0 +1,37 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// AccessTokenPrefix starts every personal access token so that secret
+// scanners can recognize leaked ones.
+const AccessTokenPrefix = "tdp_"
+
+// GenerateAccessToken returns a random personal access token.
+func GenerateAccessToken() (string, error) {
+	return randomToken(AccessTokenPrefix, 32)
+}
+
+func randomToken(prefix string, n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return prefix + hex.EncodeToString(b), nil
+}
+
+// IsAccessToken reports whether token looks like a personal access token.
+func IsAccessToken(token string) bool {
+	return strings.HasPrefix(token, AccessTokenPrefix)
+}
+
+// HashAccessToken hashes a personal access token for storage. The tokens
+// are random enough that a fast hash is sufficient.
+func HashAccessToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
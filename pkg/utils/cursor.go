@@ -0,0 +1,35 @@
+package utils
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+type cursor struct {
+	Value string `json:"v"`
+	ID    int64  `json:"id"`
+}
+
+// EncodeCursor builds an opaque keyset pagination cursor from the sort value
+// and the id of the last item of a page.
+func EncodeCursor(value string, id int64) string {
+	b, _ := json.Marshal(cursor{Value: value, ID: id})
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// DecodeCursor is the inverse of EncodeCursor.
+func DecodeCursor(s string) (value string, id int64, err error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return "", 0, ErrInvalidCursor
+	}
+
+	var c cursor
+	if err := json.Unmarshal(b, &c); err != nil || c.ID <= 0 {
+		return "", 0, ErrInvalidCursor
+	}
+	return c.Value, c.ID, nil
+}
@@ -0,0 +1,29 @@
+package utils
+
+// Prefixes of the OAuth client credentials, for the same reason as
+// AccessTokenPrefix.
+const (
+	OAuthClientIDPrefix     = "tdc_"
+	OAuthClientSecretPrefix = "tds_"
+)
+
+// GenerateOAuthClientID returns a random public client identifier.
+func GenerateOAuthClientID() (string, error) {
+	return randomToken(OAuthClientIDPrefix, 12)
+}
+
+// GenerateOAuthClientSecret returns a random client secret.
+func GenerateOAuthClientSecret() (string, error) {
+	return randomToken(OAuthClientSecretPrefix, 32)
+}
+
+// GenerateAuthorizationCode returns a random OAuth authorization code.
+func GenerateAuthorizationCode() (string, error) {
+	return randomToken("", 32)
+}
+
+// HashSecret hashes a client secret or an authorization code for storage.
+// Like access tokens they are random enough for a fast hash.
+func HashSecret(secret string) string {
+	return HashAccessToken(secret)
+}
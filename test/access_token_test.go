@@ -0,0 +1,34 @@
+package test
+
+import (
+	"strings"
+	"testing"
+	"todo-app/pkg/utils"
+)
+
+func TestGenerateAccessToken(t *testing.T) {
+	token, err := utils.GenerateAccessToken()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !strings.HasPrefix(token, "tdp_") || len(token) != len("tdp_")+64 {
+		t.Fatalf("Unexpected token %s", token)
+	}
+	if !utils.IsAccessToken(token) {
+		t.Fatalf("Expected token to be recognized")
+	}
+	if utils.IsAccessToken("eyJhbGciOiJIUzI1NiJ9.e30.sig") {
+		t.Fatalf("Expected jwt to not be recognized as access token")
+	}
+
+	other, _ := utils.GenerateAccessToken()
+	if other == token {
+		t.Fatalf("Expected tokens to be random")
+	}
+	if utils.HashAccessToken(token) == utils.HashAccessToken(other) {
+		t.Fatalf("Expected different hashes")
+	}
+	if utils.HashAccessToken(token) != utils.HashAccessToken(token) {
+		t.Fatalf("Expected hash to be stable")
+	}
+}
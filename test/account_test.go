@@ -0,0 +1,139 @@
+package test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"todo-app/internal/db"
+	"todo-app/internal/handlers"
+	"todo-app/internal/jobs"
+)
+
+func TestUpdateMeValidation(t *testing.T) {
+	app, _ := newMockApp()
+	auth := handlers.NewAuthHandler(app)
+
+	for _, body := range []string{
+		`{"timezone": "Mars/Olympus_Mons"}`,
+		`{"timezone": "Local"}`,
+		`{"timezone": ""}`,
+		`{"locale": "english please"}`,
+		`{"avatar_url": "javascript:alert(1)"}`,
+		`{"avatar_url": "/avatar.png"}`,
+		`{"display_name": "` + strings.Repeat("a", 101) + `"}`,
+	} {
+		w := httptest.NewRecorder()
+		auth.UpdateMe(w, httptest.NewRequest(http.MethodPatch, "/api/me", strings.NewReader(body)))
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("Expected 400 for %s, got %d", body, w.Code)
+		}
+	}
+}
+
+func TestChangeCredentialsValidation(t *testing.T) {
+	app, _ := newMockApp()
+	auth := handlers.NewAuthHandler(app)
+
+	w := httptest.NewRecorder()
+	auth.ChangePassword(w, httptest.NewRequest(http.MethodPut, "/api/me/password", strings.NewReader(`{"current_password": "secret"}`)))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected 400 without a new password, got %d", w.Code)
+	}
+
+	for _, username := range []string{"ab", "guest_1234", "with space", strings.Repeat("a", 33)} {
+		w := httptest.NewRecorder()
+		body := `{"username": "` + username + `", "password": "secret"}`
+		auth.ChangeUsername(w, httptest.NewRequest(http.MethodPut, "/api/me/username", strings.NewReader(body)))
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("Expected 400 for username %q, got %d", username, w.Code)
+		}
+	}
+}
+
+func TestDeletionGracePeriodDefault(t *testing.T) {
+	app, _ := newMockApp()
+	if d := app.DeletionGracePeriod(); d != 30*24*time.Hour {
+		t.Fatalf("Expected a 30 day grace period, got %s", d)
+	}
+
+	app.Config().Account.DeletionGracePeriod = time.Hour
+	if d := app.DeletionGracePeriod(); d != time.Hour {
+		t.Fatalf("Expected the configured grace period, got %s", d)
+	}
+}
+
+func TestGuestTTLDefault(t *testing.T) {
+	app, _ := newMockApp()
+	if d := app.GuestTTL(); d != 30*24*time.Hour {
+		t.Fatalf("Expected a 30 day guest TTL, got %s", d)
+	}
+}
+
+func TestPurgeStaleGuests(t *testing.T) {
+	app := newTestDB(t)
+	ctx := context.Background()
+
+	// The mock clock is at 2025-03-19, guests not used since 2025-02-17 go.
+	old := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	guests := []*db.User{
+		{Username: "guest-stale", IsAnonymous: true, CreatedAt: old},
+		{Username: "guest-active", IsAnonymous: true, CreatedAt: old},
+		{Username: "guest-new", IsAnonymous: true, CreatedAt: time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	if _, err := app.DB().NewInsert().Model(&guests).Exec(ctx); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	_, err := app.DB().NewInsert().Model(&db.Session{
+		AccessToken:  "access",
+		RefreshToken: "refresh",
+		FamilyID:     "family",
+		UserID:       guests[1].ID,
+		LastUsedAt:   time.Date(2025, 3, 10, 0, 0, 0, 0, time.UTC),
+	}).Exec(ctx)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	n, err := jobs.PurgeStaleGuests(ctx, app)
+	if err != nil || n != 1 {
+		t.Fatalf("Expected one guest to be purged, got %d, %v", n, err)
+	}
+	if left := queryInt64(t, app, "SELECT COUNT(*) FROM users WHERE username = 'guest-stale'"); left != 0 {
+		t.Fatal("Expected the stale guest to be purged")
+	}
+	if left := queryInt64(t, app, "SELECT COUNT(*) FROM users"); left != 6 {
+		t.Fatalf("Expected the other users to be kept, got %d", left)
+	}
+}
+
+func TestPurgeHandsOverSharedLists(t *testing.T) {
+	app := newTestDB(t)
+	ctx := context.Background()
+
+	// Alice deleted her account after sharing Groceries, Bob and Carol keep
+	// using it.
+	if _, err := app.DB().Exec("UPDATE users SET deleted_at = '2025-01-01' WHERE id = ?", alice); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	n, err := jobs.PurgeDeletedUsers(ctx, app)
+	if err != nil || n != 1 {
+		t.Fatalf("Expected alice to be purged, got %d, %v", n, err)
+	}
+
+	// The editor is preferred over the viewer.
+	if owner := queryInt64(t, app, "SELECT user_id FROM lists WHERE id = ?", groceries); owner != bob {
+		t.Fatalf("Expected bob to own the list, got %d", owner)
+	}
+	if n := queryInt64(t, app, "SELECT COUNT(*) FROM list_members WHERE list_id = ? AND user_id = ? AND role = 'owner'", groceries, bob); n != 1 {
+		t.Fatal("Expected bob to be the owner member of the list")
+	}
+	if n := queryInt64(t, app, "SELECT COUNT(*) FROM todos WHERE list_id = ? AND user_id = ?", groceries, bob); n != 2 {
+		t.Fatalf("Expected the todos of the list to be kept for bob, got %d", n)
+	}
+	if w := serveAs(app, carol, teamWorkspace, http.MethodGet, "/api/lists/1", ""); w.Code != http.StatusOK {
+		t.Fatalf("Expected the viewer to keep the list, got %d", w.Code)
+	}
+}
@@ -0,0 +1,41 @@
+package test
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"todo-app/bunapp"
+)
+
+// readmeConfig returns the sample config of the README.
+func readmeConfig(t *testing.T) []byte {
+	t.Helper()
+	b, err := os.ReadFile("../README.md")
+	if err != nil {
+		t.Fatalf("Expected the README, got %v", err)
+	}
+	_, sample, ok := strings.Cut(string(b), "```yaml\n")
+	if !ok {
+		t.Fatal("Expected a yaml block in the README")
+	}
+	sample, _, _ = strings.Cut(sample, "```")
+	return []byte(sample)
+}
+
+func TestReadmeConfig(t *testing.T) {
+	fsys := fstest.MapFS{"config/dev.yaml": {Data: readmeConfig(t)}}
+	cfg, err := bunapp.ReadConfig(fsys, "api", "dev")
+	if err != nil {
+		t.Fatalf("Expected the README config to load, got %v", err)
+	}
+	if cfg.Jwt.Secret != "secret" || cfg.Jwt.RefreshSecret != "refresh_secret" {
+		t.Fatalf("Expected both jwt secrets, got %q and %q", cfg.Jwt.Secret, cfg.Jwt.RefreshSecret)
+	}
+	if cfg.Supabase.StorageURI != "secret" || cfg.Supabase.ContractBucket != "otp_contract_dev" {
+		t.Fatalf("Expected the supabase settings, got %+v", cfg.Supabase)
+	}
+	if cfg.Subtasks.MaxDepth != 5 || cfg.Reminders.MaxAttempts != 8 {
+		t.Fatalf("Expected the subtask and reminder settings, got %+v %+v", cfg.Subtasks, cfg.Reminders)
+	}
+}
@@ -0,0 +1,26 @@
+package test
+
+import (
+	"testing"
+	"todo-app/pkg/utils"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	encoded := utils.EncodeCursor("2025-02-01T10:00:00Z", 42)
+
+	value, id, err := utils.DecodeCursor(encoded)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if value != "2025-02-01T10:00:00Z" || id != 42 {
+		t.Fatalf("Expected cursor to round trip, got %q %d", value, id)
+	}
+}
+
+func TestDecodeInvalidCursor(t *testing.T) {
+	for _, s := range []string{"", "not-base64!", utils.EncodeCursor("x", 0)} {
+		if _, _, err := utils.DecodeCursor(s); err != utils.ErrInvalidCursor {
+			t.Fatalf("Expected ErrInvalidCursor for %q, got %v", s, err)
+		}
+	}
+}
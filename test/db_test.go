@@ -0,0 +1,142 @@
+package test
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+	"todo-app/bunapp"
+	"todo-app/cmd/api-server/migrations"
+	"todo-app/internal/constants"
+	"todo-app/internal/db"
+	"todo-app/internal/handlers"
+
+	"github.com/go-chi/chi"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/driver/pgdriver"
+	"github.com/uptrace/bun/migrate"
+)
+
+// newTestDB returns a mock app connected to a new database with every
+// migration applied and init.sql loaded. The tests that need a database
+// are skipped unless TEST_DATABASE_URL points at a Postgres server, the
+// database is created there and dropped after the test.
+func newTestDB(t *testing.T) *bunapp.App {
+	app := newMigratedApp(t, "")
+	execSQLFile(t, app.DB(), "init.sql")
+	return app
+}
+
+// newMigratedApp returns a mock app connected to a new database with the
+// migrations older than before applied, all of them when before is empty.
+func newMigratedApp(t *testing.T, before string) *bunapp.App {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	u, err := url.Parse(dsn)
+	if err != nil {
+		t.Fatalf("Invalid TEST_DATABASE_URL: %v", err)
+	}
+
+	name := fmt.Sprintf("todo_test_%d", time.Now().UnixNano())
+	server := sql.OpenDB(pgdriver.NewConnector(pgdriver.WithDSN(dsn)))
+	if _, err := server.Exec("CREATE DATABASE " + name); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	t.Cleanup(func() {
+		if _, err := server.Exec("DROP DATABASE IF EXISTS " + name + " WITH (FORCE)"); err != nil {
+			t.Errorf("Failed to drop %s: %v", name, err)
+		}
+		server.Close()
+	})
+
+	u.Path = "/" + name
+	app, _ := newMockApp()
+	app.Config().DBURL = u.String()
+	app.DB().RegisterModel((*db.TodoTag)(nil))
+	t.Cleanup(func() { app.DB().Close() })
+
+	ms := migrations.Migrations
+	if before != "" {
+		ms = migrate.NewMigrations()
+		for _, m := range migrations.Migrations.Sorted() {
+			if m.Name < before {
+				ms.Add(m)
+			}
+		}
+	}
+	migrateTestDB(t, app.DB(), ms)
+	return app
+}
+
+// migrateTestDB applies the migrations of ms that did not run yet.
+func migrateTestDB(t *testing.T, bdb *bun.DB, ms *migrate.Migrations) {
+	t.Helper()
+	migrator := migrate.NewMigrator(bdb, ms)
+	if err := migrator.Init(context.Background()); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, err := migrator.Migrate(context.Background()); err != nil {
+		t.Fatalf("Failed to migrate: %v", err)
+	}
+}
+
+func execSQLFile(t *testing.T, bdb *bun.DB, path string) {
+	t.Helper()
+	query, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, err := bdb.ExecContext(context.Background(), string(query)); err != nil {
+		t.Fatalf("Failed to load %s: %v", path, err)
+	}
+}
+
+// serveAs serves the request with the list and todo routes as userID in
+// the workspace, the personal one when it is 0.
+func serveAs(app *bunapp.App, userID, workspaceID int64, method, target, body string) *httptest.ResponseRecorder {
+	h := handlers.NewTodoHandler(app)
+	router := chi.NewRouter()
+	router.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := context.WithValue(r.Context(), constants.CurrentUser, &handlers.JwtPayload{Sub: userID})
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	})
+	router.Use(h.Workspace)
+	router.Get("/api/lists", h.GetLists)
+	router.Get("/api/lists/{id}", h.GetList)
+	router.Put("/api/lists/{id}", h.UpdateList)
+	router.Delete("/api/lists/{id}", h.DeleteList)
+	router.Post("/api/lists/{id}/leave", h.LeaveList)
+	router.Post("/api/lists/{id}/transfer", h.TransferList)
+	router.Get("/api/todo/{id}", h.GetTodo)
+	router.Delete("/api/todo/{id}", h.DeleteTodo)
+
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	if workspaceID != 0 {
+		r.Header.Set(handlers.WorkspaceHeader, strconv.FormatInt(workspaceID, 10))
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	return w
+}
+
+// queryInt64 runs a query that selects a single number.
+func queryInt64(t *testing.T, app *bunapp.App, query string, args ...interface{}) int64 {
+	t.Helper()
+	var n int64
+	if err := app.DB().NewRaw(query, args...).Scan(context.Background(), &n); err != nil {
+		t.Fatalf("Failed to run %s: %v", query, err)
+	}
+	return n
+}
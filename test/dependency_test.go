@@ -0,0 +1,89 @@
+package test
+
+import (
+	"testing"
+	"todo-app/internal/db"
+	"todo-app/internal/handlers"
+)
+
+func todoIDs(todos []*db.Todo) []int64 {
+	ids := make([]int64, len(todos))
+	for i, todo := range todos {
+		ids[i] = todo.ID
+	}
+	return ids
+}
+
+func TestTopologicalOrder(t *testing.T) {
+	todos := []*db.Todo{{ID: 1}, {ID: 2}, {ID: 3}, {ID: 4}, {ID: 5}}
+	deps := []*db.TodoDependency{
+		{TodoID: 1, BlockerID: 4},
+		{TodoID: 2, BlockerID: 1},
+		{TodoID: 2, BlockerID: 5},
+		// Blockers outside of the todos are ignored.
+		{TodoID: 3, BlockerID: 9},
+	}
+	ordered, err := handlers.TopologicalOrder(todos, deps)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	want := []int64{3, 4, 1, 5, 2}
+	got := todoIDs(ordered)
+	if len(got) != len(want) {
+		t.Fatalf("Expected %v, got %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("Expected %v, got %v", want, got)
+		}
+	}
+
+	deps = append(deps, &db.TodoDependency{TodoID: 4, BlockerID: 2})
+	if _, err := handlers.TopologicalOrder(todos, deps); err == nil {
+		t.Fatal("Expected an error for a cycle")
+	}
+}
+
+func TestTopologicalOrderLargeList(t *testing.T) {
+	// A chain in reverse id order, every todo is blocked by the next one.
+	const n = 5000
+	todos := make([]*db.Todo, n)
+	deps := make([]*db.TodoDependency, 0, n)
+	for i := range todos {
+		todos[i] = &db.Todo{ID: int64(i + 1)}
+		if i+1 < n {
+			deps = append(deps, &db.TodoDependency{TodoID: int64(i + 1), BlockerID: int64(i + 2)})
+		}
+	}
+	ordered, err := handlers.TopologicalOrder(todos, deps)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(ordered) != n || ordered[0].ID != n || ordered[n-1].ID != 1 {
+		t.Fatalf("Expected the chain from %d down to 1, got %d todos", n, len(ordered))
+	}
+}
+
+func TestSetDependencies(t *testing.T) {
+	todos := []*db.Todo{
+		{ID: 1, Status: db.DONE},
+		{ID: 2, Status: db.TODO},
+		{ID: 3, Status: db.TODO},
+		{ID: 4, Status: db.TODO},
+	}
+	handlers.SetDependencies(todos, []*db.TodoDependency{
+		{TodoID: 3, BlockerID: 1},
+		{TodoID: 3, BlockerID: 2},
+		{TodoID: 4, BlockerID: 1},
+	})
+
+	if three := todos[2]; !three.Blocked || len(three.BlockedBy) != 2 {
+		t.Fatalf("Expected 3 to be blocked by 1 and 2, got %+v", three)
+	}
+	if four := todos[3]; four.Blocked || len(four.BlockedBy) != 1 {
+		t.Fatalf("Expected 4 not to be blocked by the done todo 1, got %+v", four)
+	}
+	if one := todos[0]; len(one.Blocking) != 2 || one.Blocked {
+		t.Fatalf("Expected 1 to block 3 and 4, got %+v", one)
+	}
+}
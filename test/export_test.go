@@ -0,0 +1,82 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+	"todo-app/internal/handlers"
+	"todo-app/pkg/storage"
+)
+
+func TestLocalStorage(t *testing.T) {
+	ctx := context.Background()
+	s := &storage.LocalStorage{Dir: t.TempDir()}
+
+	if err := s.Put(ctx, "exports/1/a.zip", strings.NewReader("archive"), "application/zip"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	f, err := s.Get(ctx, "exports/1/a.zip")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	data, _ := io.ReadAll(f)
+	f.Close()
+	if string(data) != "archive" {
+		t.Fatalf("Expected the stored content, got %q", data)
+	}
+
+	if err := s.Delete(ctx, "exports/1/a.zip"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, err := s.Get(ctx, "exports/1/a.zip"); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("Expected ErrNotFound after delete, got %v", err)
+	}
+	if err := s.Delete(ctx, "exports/1/a.zip"); err != nil {
+		t.Fatalf("Expected deleting a missing object to succeed, got %v", err)
+	}
+
+	for _, key := range []string{"", "../outside", "exports/../../outside", "/absolute"} {
+		if err := s.Put(ctx, key, strings.NewReader("x"), "text/plain"); err == nil {
+			t.Fatalf("Expected key %q to be rejected", key)
+		}
+	}
+}
+
+func TestExportToken(t *testing.T) {
+	j, mock := newTestJWT(t)
+
+	token, expiresAt, err := j.GenerateExportToken(1, 42, 15*time.Minute)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !expiresAt.Equal(mock.Now().Add(15 * time.Minute)) {
+		t.Fatalf("Expected the link to expire in 15 minutes, got %s", expiresAt)
+	}
+
+	claims, err := j.VerifyExportToken(token)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if claims.Sub != 1 || claims.ExportID != 42 {
+		t.Fatalf("Expected user 1 and export 42, got %d and %d", claims.Sub, claims.ExportID)
+	}
+
+	if _, err := j.VerifyRefreshToken(token); err == nil {
+		t.Fatalf("Expected an export token to be refused as refresh token")
+	}
+	pair, err := j.GenerateTokenPair(handlers.TokenSubject{Username: "alice", UserID: 1}, "")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, err := j.VerifyExportToken(pair.RefreshToken); err == nil {
+		t.Fatalf("Expected a refresh token to be refused as export token")
+	}
+
+	mock.Add(16 * time.Minute)
+	if _, err := j.VerifyExportToken(token); err == nil {
+		t.Fatalf("Expected the expired link to be refused")
+	}
+}
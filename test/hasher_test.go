@@ -0,0 +1,102 @@
+package test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"todo-app/pkg/password"
+)
+
+// Small parameters, the defaults are slow on purpose.
+var testArgon2id = password.Argon2id{Memory: 64, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+
+func TestArgon2idHash(t *testing.T) {
+	h := testArgon2id
+	encoded, err := h.Hash("correct horse")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !strings.HasPrefix(encoded, "$argon2id$v=19$m=64,t=1,p=1$") {
+		t.Fatalf("Expected PHC string, got %s", encoded)
+	}
+
+	if ok, err := h.Verify(encoded, "correct horse"); err != nil || !ok {
+		t.Fatalf("Expected password to match, got %v %v", ok, err)
+	}
+	if ok, err := h.Verify(encoded, "wrong horse"); err != nil || ok {
+		t.Fatalf("Expected password to not match, got %v %v", ok, err)
+	}
+	if _, err := h.Verify("$argon2id$v=19$garbage", "correct horse"); err == nil {
+		t.Fatalf("Expected malformed hash to be rejected")
+	}
+
+	if h.NeedsRehash(encoded) {
+		t.Fatalf("Expected no rehash with the same parameters")
+	}
+	h.Iterations = 2
+	if !h.NeedsRehash(encoded) {
+		t.Fatalf("Expected rehash after the parameters changed")
+	}
+}
+
+func TestPasswordSetMigratesBcrypt(t *testing.T) {
+	bcrypt := &password.Bcrypt{Cost: 4}
+	old, err := bcrypt.Hash("correct horse")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	argon := testArgon2id
+	set := password.NewSet(&argon, bcrypt)
+	if ok, err := set.Verify(old, "correct horse"); err != nil || !ok {
+		t.Fatalf("Expected bcrypt hash to verify, got %v %v", ok, err)
+	}
+	if !set.NeedsRehash(old) {
+		t.Fatalf("Expected bcrypt hash to need a rehash")
+	}
+
+	encoded, err := set.Hash("correct horse")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if set.NeedsRehash(encoded) {
+		t.Fatalf("Expected new hash to be current")
+	}
+	if _, err := set.Verify("plain", "plain"); !errors.Is(err, password.ErrUnknownHash) {
+		t.Fatalf("Expected ErrUnknownHash, got %v", err)
+	}
+}
+
+func TestPasswordPolicy(t *testing.T) {
+	list := filepath.Join(t.TempDir(), "breached.txt")
+	// "password1" in clear and "letmein123" as SHA-1 with a count.
+	content := "password1\nE286977B13F1A89E20D0459207545D15FE1EBA08:12\n"
+	if err := os.WriteFile(list, []byte(content), 0o644); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	p := password.NewPolicy()
+	if err := p.LoadBreached(list); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	tests := []struct {
+		password string
+		err      error
+	}{
+		{"short", password.ErrTooShort},
+		{strings.Repeat("a", 73), password.ErrTooLong},
+		{"my-alice-password", password.ErrContainsUsername},
+		{"MyALICEpassword", password.ErrContainsUsername},
+		{"password1", password.ErrBreached},
+		{"letmein123", password.ErrBreached},
+		{"a long and unusual passphrase", nil},
+	}
+	for _, tt := range tests {
+		if err := p.Validate("alice", tt.password); !errors.Is(err, tt.err) {
+			t.Fatalf("Expected %v for %q, got %v", tt.err, tt.password, err)
+		}
+	}
+}
@@ -1,8 +1,44 @@
-CREATE TABLE TEST {
-    ID BIGINT PRIMARY KEY AUTO_INCREMENT,
-    NAME VARCHAR(100) NOT NULL
-}
+-- Fixture of the tests that run against a database, loaded after every
+-- migration. Alice shares the list Groceries of the workspace Team with Bob
+-- as editor and Carol as viewer, Dave is still invited.
+-- Bun reads the zero time as not deleted.
+INSERT INTO public.users (id, username, password, deleted_at) VALUES
+    (1, 'alice', '', '0001-01-01 00:00:00+00'),
+    (2, 'bob', '', '0001-01-01 00:00:00+00'),
+    (3, 'carol', '', '0001-01-01 00:00:00+00'),
+    (4, 'dave', '', '0001-01-01 00:00:00+00');
 
-INSERT INTO TEST (NAME) VALUES ('test')
-INSERT INTO TEST (NAME) VALUES ('test2')
+INSERT INTO public.workspaces (id, name, personal, created_by) VALUES
+    (1, 'Personal', true, 1),
+    (2, 'Personal', true, 2),
+    (3, 'Personal', true, 3),
+    (4, 'Personal', true, 4),
+    (5, 'Team', false, 1);
 
+INSERT INTO public.workspace_members (workspace_id, user_id, role) VALUES
+    (1, 1, 'admin'),
+    (2, 2, 'admin'),
+    (3, 3, 'admin'),
+    (4, 4, 'admin'),
+    (5, 1, 'admin'),
+    (5, 2, 'member'),
+    (5, 3, 'member'),
+    (5, 4, 'member');
+
+INSERT INTO public.lists (id, name, user_id, workspace_id) VALUES
+    (1, 'Groceries', 1, 5);
+
+INSERT INTO public.list_members (list_id, user_id, role, status, invited_by, accepted_at) VALUES
+    (1, 1, 'owner', 'accepted', NULL, now()),
+    (1, 2, 'editor', 'accepted', 1, now()),
+    (1, 3, 'viewer', 'accepted', 1, now()),
+    (1, 4, 'editor', 'pending', 1, NULL);
+
+INSERT INTO public.todos (id, title, description, list_id, user_id) VALUES
+    (1, 'Milk', '', 1, 1),
+    (2, 'Bread', '', 1, 2);
+
+SELECT setval(pg_get_serial_sequence('public.users', 'id'), 4);
+SELECT setval(pg_get_serial_sequence('public.workspaces', 'id'), 5);
+SELECT setval(pg_get_serial_sequence('public.lists', 'id'), 1);
+SELECT setval(pg_get_serial_sequence('public.todos', 'id'), 2);
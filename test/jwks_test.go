@@ -0,0 +1,136 @@
+package test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"todo-app/bunapp"
+	"todo-app/internal/handlers"
+)
+
+func writePEM(t *testing.T, dir, name, blockType string, der []byte) string {
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	return path
+}
+
+// writeKeys writes an ES256 and an EdDSA key pair and returns their configs.
+func writeKeys(t *testing.T) (es, ed bunapp.JwtKeyConfig) {
+	dir := t.TempDir()
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	der, _ := x509.MarshalPKCS8PrivateKey(ecKey)
+	pubDer, _ := x509.MarshalPKIXPublicKey(&ecKey.PublicKey)
+	es = bunapp.JwtKeyConfig{
+		ID:             "es-2025-01",
+		Algorithm:      "ES256",
+		PrivateKeyFile: writePEM(t, dir, "es.pem", "PRIVATE KEY", der),
+		PublicKeyFile:  writePEM(t, dir, "es.pub.pem", "PUBLIC KEY", pubDer),
+	}
+
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	der, _ = x509.MarshalPKCS8PrivateKey(edKey)
+	ed = bunapp.JwtKeyConfig{
+		ID:             "ed-2025-02",
+		Algorithm:      "EdDSA",
+		PrivateKeyFile: writePEM(t, dir, "ed.pem", "PRIVATE KEY", der),
+	}
+	return es, ed
+}
+
+func newKeyedJWT(t *testing.T, signingKey string, keys ...bunapp.JwtKeyConfig) *handlers.JWT {
+	cfg := &bunapp.AppConfig{}
+	cfg.Jwt.RefreshSecret = "refresh-secret"
+	cfg.Jwt.SigningKey = signingKey
+	cfg.Jwt.Keys = keys
+
+	_, app, err := bunapp.StartConfig(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	return handlers.NewAuthHandler(app).NewJWT()
+}
+
+func TestKeyRotation(t *testing.T) {
+	es, ed := writeKeys(t)
+
+	j := newKeyedJWT(t, es.ID, es)
+	pair, err := j.GenerateTokenPair(handlers.TokenSubject{Username: "alice", UserID: 1}, "")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	// Rotate: the EdDSA key signs, the old key is kept with its public half.
+	retiring := es
+	retiring.PrivateKeyFile = ""
+	j = newKeyedJWT(t, ed.ID, ed, retiring)
+	if _, err := j.VerifyAccessToken(pair.AccessToken); err != nil {
+		t.Fatalf("Expected token of the previous key to verify, got %v", err)
+	}
+	rotated, err := j.GenerateTokenPair(handlers.TokenSubject{Username: "alice", UserID: 1}, "")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, err := j.VerifyAccessToken(rotated.AccessToken); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	// Retire the old key.
+	j = newKeyedJWT(t, ed.ID, ed)
+	if _, err := j.VerifyAccessToken(pair.AccessToken); err == nil {
+		t.Fatalf("Expected token of a retired key to be rejected")
+	}
+}
+
+func TestSigningKeyWithoutPrivateKey(t *testing.T) {
+	es, _ := writeKeys(t)
+	es.PrivateKeyFile = ""
+
+	cfg := &bunapp.AppConfig{}
+	cfg.Jwt.RefreshSecret = "refresh-secret"
+	cfg.Jwt.SigningKey = es.ID
+	cfg.Jwt.Keys = []bunapp.JwtKeyConfig{es}
+	if _, _, err := bunapp.StartConfig(context.Background(), cfg); err == nil {
+		t.Fatalf("Expected error for a signing key without private key")
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	es, ed := writeKeys(t)
+
+	cfg := &bunapp.AppConfig{}
+	cfg.Jwt.RefreshSecret = "refresh-secret"
+	cfg.Jwt.SigningKey = ed.ID
+	cfg.Jwt.Keys = []bunapp.JwtKeyConfig{es, ed}
+	_, app, err := bunapp.StartConfig(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	keys, _ := app.KeySet()
+
+	set := keys.JWKS()
+	if len(set.Keys) != 2 {
+		t.Fatalf("Expected 2 keys, got %d", len(set.Keys))
+	}
+	if k := set.Keys[1]; k.Kid != es.ID || k.Kty != "EC" || k.Crv != "P-256" || len(k.X) != 43 || len(k.Y) != 43 {
+		t.Fatalf("Unexpected EC key %+v", k)
+	}
+	if k := set.Keys[0]; k.Kid != ed.ID || k.Kty != "OKP" || k.Crv != "Ed25519" || k.X == "" {
+		t.Fatalf("Unexpected OKP key %+v", k)
+	}
+}
@@ -0,0 +1,94 @@
+package test
+
+import (
+	"net/http"
+	"testing"
+)
+
+// The users and the list Groceries of the workspace Team of init.sql.
+const (
+	alice = 1
+	bob   = 2
+	carol = 3
+	dave  = 4
+
+	teamWorkspace = 5
+	groceries     = 1
+)
+
+func TestListRoleRefusesWrites(t *testing.T) {
+	app := newTestDB(t)
+
+	if w := serveAs(app, carol, teamWorkspace, http.MethodDelete, "/api/todo/1", ""); w.Code != http.StatusForbidden {
+		t.Fatalf("Expected a viewer not to delete todos, got %d", w.Code)
+	}
+	if w := serveAs(app, carol, teamWorkspace, http.MethodPut, "/api/lists/1", `{"name": "Mine"}`); w.Code != http.StatusForbidden {
+		t.Fatalf("Expected a viewer not to rename the list, got %d", w.Code)
+	}
+	if w := serveAs(app, bob, teamWorkspace, http.MethodDelete, "/api/lists/1", ""); w.Code != http.StatusForbidden {
+		t.Fatalf("Expected an editor not to delete the list, got %d", w.Code)
+	}
+	if w := serveAs(app, dave, teamWorkspace, http.MethodGet, "/api/lists/1", ""); w.Code != http.StatusForbidden {
+		t.Fatalf("Expected an invited user not to read the list before accepting, got %d", w.Code)
+	}
+	if n := queryInt64(t, app, "SELECT COUNT(*) FROM todos WHERE list_id = ?", groceries); n != 2 {
+		t.Fatalf("Expected the todos to be kept, got %d", n)
+	}
+
+	if w := serveAs(app, carol, teamWorkspace, http.MethodGet, "/api/todo/1", ""); w.Code != http.StatusOK {
+		t.Fatalf("Expected a viewer to read todos, got %d", w.Code)
+	}
+	if w := serveAs(app, bob, teamWorkspace, http.MethodPut, "/api/lists/1", `{"name": "Mine"}`); w.Code != http.StatusOK {
+		t.Fatalf("Expected an editor to rename the list, got %d", w.Code)
+	}
+	if w := serveAs(app, bob, teamWorkspace, http.MethodDelete, "/api/todo/1", ""); w.Code != http.StatusOK {
+		t.Fatalf("Expected an editor to delete todos, got %d", w.Code)
+	}
+	if n := queryInt64(t, app, "SELECT COUNT(*) FROM todos WHERE list_id = ?", groceries); n != 1 {
+		t.Fatalf("Expected one todo left, got %d", n)
+	}
+}
+
+func TestOwnerCannotLeaveList(t *testing.T) {
+	app := newTestDB(t)
+
+	if w := serveAs(app, alice, teamWorkspace, http.MethodPost, "/api/lists/1/leave", ""); w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected the owner not to leave, got %d", w.Code)
+	}
+	if w := serveAs(app, bob, teamWorkspace, http.MethodPost, "/api/lists/1/leave", ""); w.Code != http.StatusOK {
+		t.Fatalf("Expected an editor to leave, got %d", w.Code)
+	}
+	if n := queryInt64(t, app, "SELECT COUNT(*) FROM list_members WHERE list_id = ? AND user_id IN (?, ?)", groceries, alice, bob); n != 1 {
+		t.Fatalf("Expected only the owner to stay, got %d members", n)
+	}
+	if w := serveAs(app, bob, teamWorkspace, http.MethodGet, "/api/lists/1", ""); w.Code != http.StatusForbidden {
+		t.Fatalf("Expected no access after leaving, got %d", w.Code)
+	}
+}
+
+func TestTransferList(t *testing.T) {
+	app := newTestDB(t)
+
+	for _, body := range []string{`{"user_id": 1}`, `{"user_id": 4}`} {
+		if w := serveAs(app, alice, teamWorkspace, http.MethodPost, "/api/lists/1/transfer", body); w.Code != http.StatusBadRequest {
+			t.Fatalf("Expected 400 for %s, got %d", body, w.Code)
+		}
+	}
+	// The demotion of the owner was rolled back with the failed transfer.
+	if n := queryInt64(t, app, "SELECT COUNT(*) FROM list_members WHERE list_id = ? AND user_id = ? AND role = 'owner'", groceries, alice); n != 1 {
+		t.Fatal("Expected alice to still own the list")
+	}
+
+	if w := serveAs(app, bob, teamWorkspace, http.MethodPost, "/api/lists/1/transfer", `{"user_id": 3}`); w.Code != http.StatusForbidden {
+		t.Fatalf("Expected an editor not to transfer the list, got %d", w.Code)
+	}
+	if w := serveAs(app, alice, teamWorkspace, http.MethodPost, "/api/lists/1/transfer", `{"user_id": 2}`); w.Code != http.StatusOK {
+		t.Fatalf("Expected the transfer to an editor, got %d", w.Code)
+	}
+	if owner := queryInt64(t, app, "SELECT user_id FROM lists WHERE id = ?", groceries); owner != bob {
+		t.Fatalf("Expected bob to own the list, got %d", owner)
+	}
+	if w := serveAs(app, alice, teamWorkspace, http.MethodPut, "/api/lists/1", `{"name": "Ours"}`); w.Code != http.StatusOK {
+		t.Fatalf("Expected the previous owner to stay editor, got %d", w.Code)
+	}
+}
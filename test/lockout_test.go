@@ -0,0 +1,240 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+	"todo-app/internal/handlers"
+	"todo-app/pkg/clientip"
+	"todo-app/pkg/lockout"
+)
+
+func TestLockoutPolicyDelay(t *testing.T) {
+	p := lockout.Policy{
+		Free:         2,
+		BaseDelay:    time.Second,
+		MaxDelay:     8 * time.Second,
+		LockAfter:    10,
+		LockDuration: time.Hour,
+	}
+	tests := []struct {
+		failures int
+		delay    time.Duration
+	}{
+		{1, 0},
+		{2, 0},
+		{3, time.Second},
+		{4, 2 * time.Second},
+		{5, 4 * time.Second},
+		{6, 8 * time.Second},
+		{9, 8 * time.Second},
+		{10, time.Hour},
+	}
+
+	for _, tt := range tests {
+		if got := p.Delay(tt.failures); got != tt.delay {
+			t.Fatalf("Expected %s after %d failures, got %s", tt.delay, tt.failures, got)
+		}
+	}
+}
+
+func TestLimiterLocksAccount(t *testing.T) {
+	ctx := context.Background()
+	_, mock := newMockApp()
+	l := lockout.NewLimiter(lockout.NewMemoryStore())
+
+	for i := 0; i < l.Account.Free; i++ {
+		if err := l.Fail(ctx, mock.Now(), "alice", "10.0.0.1"); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+	if wait, _ := l.Check(ctx, mock.Now(), "alice", "10.0.0.1"); wait != 0 {
+		t.Fatalf("Expected no wait within the free attempts, got %s", wait)
+	}
+
+	l.Fail(ctx, mock.Now(), "alice", "10.0.0.1")
+	wait, err := l.Check(ctx, mock.Now(), "Alice", "10.0.0.2")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if wait != l.Account.BaseDelay {
+		t.Fatalf("Expected %s, got %s", l.Account.BaseDelay, wait)
+	}
+	if wait, _ := l.Check(ctx, mock.Now(), "bob", "10.0.0.1"); wait != 0 {
+		t.Fatalf("Expected other accounts to be unaffected, got %s", wait)
+	}
+
+	mock.Add(wait)
+	if wait, _ := l.Check(ctx, mock.Now(), "alice", "10.0.0.1"); wait != 0 {
+		t.Fatalf("Expected the backoff to be over, got %s", wait)
+	}
+
+	for i := l.Account.Free + 1; i < l.Account.LockAfter; i++ {
+		l.Fail(ctx, mock.Now(), "alice", "10.0.0.1")
+	}
+	if wait, _ := l.Check(ctx, mock.Now(), "alice", ""); wait != l.Account.LockDuration {
+		t.Fatalf("Expected lockout of %s, got %s", l.Account.LockDuration, wait)
+	}
+
+	if err := l.Unlock(ctx, "alice"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if wait, _ := l.Check(ctx, mock.Now(), "alice", ""); wait != 0 {
+		t.Fatalf("Expected unlocked account, got %s", wait)
+	}
+}
+
+func TestLimiterForgetsOldFailures(t *testing.T) {
+	ctx := context.Background()
+	_, mock := newMockApp()
+	store := lockout.NewMemoryStore()
+	l := lockout.NewLimiter(store)
+
+	l.Fail(ctx, mock.Now(), "alice", "")
+	l.Fail(ctx, mock.Now(), "alice", "")
+	mock.Add(l.Account.Window + time.Second)
+	l.Fail(ctx, mock.Now(), "alice", "")
+
+	a, _ := store.Get(ctx, lockout.AccountKey("alice"))
+	if a.Failures != 1 {
+		t.Fatalf("Expected 1 failure, got %d", a.Failures)
+	}
+}
+
+func TestLimiterLocksIP(t *testing.T) {
+	ctx := context.Background()
+	_, mock := newMockApp()
+	l := lockout.NewLimiter(lockout.NewMemoryStore())
+
+	// Spraying one password over many accounts trips the address limit.
+	for i := 0; i <= l.IP.Free; i++ {
+		l.Fail(ctx, mock.Now(), fmt.Sprintf("user%d", i), "10.0.0.1")
+	}
+	if wait, _ := l.Check(ctx, mock.Now(), "carol", "10.0.0.1"); wait == 0 {
+		t.Fatalf("Expected the address to back off")
+	}
+	if err := l.UnlockIP(ctx, "10.0.0.1"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if wait, _ := l.Check(ctx, mock.Now(), "carol", "10.0.0.1"); wait != 0 {
+		t.Fatalf("Expected unlocked address, got %s", wait)
+	}
+}
+
+func TestLoginIgnoresSpoofedClientIP(t *testing.T) {
+	ctx := context.Background()
+	app, mock := newMockApp()
+	l := lockout.NewLimiter(lockout.NewMemoryStore())
+	app.SetLoginLimiter(l)
+	auth := handlers.NewAuthHandler(app)
+
+	// httptest requests come from 192.0.2.1, which is not a trusted proxy.
+	for i := 0; i < l.IP.LockAfter; i++ {
+		l.Fail(ctx, mock.Now(), fmt.Sprintf("user%d", i), "192.0.2.1")
+	}
+	for i := 0; i < 3; i++ {
+		r := httptest.NewRequest(http.MethodPost, "/api/auth/login", strings.NewReader(`{"username": "mallory", "password": "guess"}`))
+		r.Header.Set("X-Forwarded-For", fmt.Sprintf("203.0.113.%d", i))
+		r.Header.Set("X-Real-IP", fmt.Sprintf("198.51.100.%d", i))
+		w := httptest.NewRecorder()
+		auth.Login(w, r)
+		if w.Code != http.StatusTooManyRequests {
+			t.Fatalf("Expected a spoofed address to stay locked out, got %d", w.Code)
+		}
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	trusted, err := clientip.ParseTrusted([]string{"10.0.0.0/8", "192.0.2.1"})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	res := clientip.Resolver{Trusted: trusted}
+
+	for _, tt := range []struct {
+		remote, xff, realIP, want string
+	}{
+		// Headers of untrusted peers are ignored.
+		{"203.0.113.5:1234", "198.51.100.1", "198.51.100.2", "203.0.113.5"},
+		{"192.0.2.1:1234", "", "", "192.0.2.1"},
+		{"192.0.2.1:1234", "", "198.51.100.2", "198.51.100.2"},
+		// The client may prepend anything, the last untrusted hop counts.
+		{"192.0.2.1:1234", "1.2.3.4, 198.51.100.1, 10.1.2.3", "", "198.51.100.1"},
+		{"192.0.2.1:1234", "10.1.2.3", "", "10.1.2.3"},
+		{"192.0.2.1:1234", "bogus", "", "192.0.2.1"},
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = tt.remote
+		if tt.xff != "" {
+			r.Header.Set("X-Forwarded-For", tt.xff)
+		}
+		if tt.realIP != "" {
+			r.Header.Set("X-Real-IP", tt.realIP)
+		}
+		if got := res.IP(r); got != tt.want {
+			t.Fatalf("Expected %s for %+v, got %s", tt.want, tt, got)
+		}
+	}
+
+	if _, err := clientip.ParseTrusted([]string{"10.0.0.0/33"}); err == nil {
+		t.Fatal("Expected an error for an invalid range")
+	}
+	if got, _ := clientip.ParseTrusted([]string{"::ffff:10.0.0.1"}); len(got) != 1 || got[0] != netip.MustParsePrefix("10.0.0.1/32") {
+		t.Fatalf("Expected a mapped address to be unmapped, got %v", got)
+	}
+}
+
+func TestLimiterThrottlesGuests(t *testing.T) {
+	ctx := context.Background()
+	_, mock := newMockApp()
+	l := lockout.NewLimiter(lockout.NewMemoryStore())
+
+	for i := 0; i < l.Guest.Free; i++ {
+		if wait, _ := l.CheckGuest(ctx, mock.Now(), "10.0.0.1"); wait != 0 {
+			t.Fatalf("Expected guest %d to be allowed, got %s", i+1, wait)
+		}
+		l.GuestCreated(ctx, mock.Now(), "10.0.0.1")
+	}
+	l.GuestCreated(ctx, mock.Now(), "10.0.0.1")
+	if wait, _ := l.CheckGuest(ctx, mock.Now(), "10.0.0.1"); wait != l.Guest.BaseDelay {
+		t.Fatalf("Expected %s, got %s", l.Guest.BaseDelay, wait)
+	}
+	if wait, _ := l.CheckGuest(ctx, mock.Now(), "10.0.0.2"); wait != 0 {
+		t.Fatalf("Expected other addresses to be unaffected, got %s", wait)
+	}
+	// Guests do not count as failed logins.
+	if wait, _ := l.Check(ctx, mock.Now(), "alice", "10.0.0.1"); wait != 0 {
+		t.Fatalf("Expected logins from the address to be allowed, got %s", wait)
+	}
+
+	if err := l.UnlockIP(ctx, "10.0.0.1"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if wait, _ := l.CheckGuest(ctx, mock.Now(), "10.0.0.1"); wait != 0 {
+		t.Fatalf("Expected unlocked address, got %s", wait)
+	}
+}
+
+func TestGuestSignupThrottled(t *testing.T) {
+	ctx := context.Background()
+	app, mock := newMockApp()
+	l := lockout.NewLimiter(lockout.NewMemoryStore())
+	app.SetLoginLimiter(l)
+	auth := handlers.NewAuthHandler(app)
+
+	for i := 0; i < l.Guest.LockAfter; i++ {
+		l.GuestCreated(ctx, mock.Now(), "192.0.2.1")
+	}
+	r := httptest.NewRequest(http.MethodPost, "/api/auth/guest", nil)
+	r.Header.Set("X-Forwarded-For", "203.0.113.1")
+	w := httptest.NewRecorder()
+	auth.Guest(w, r)
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+		t.Fatalf("Expected 429 with Retry-After, got %d", w.Code)
+	}
+}
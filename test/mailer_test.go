@@ -0,0 +1,75 @@
+package test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"todo-app/internal/handlers"
+	"todo-app/pkg/mailer"
+)
+
+func TestMemoryMailer(t *testing.T) {
+	m := &mailer.MemoryMailer{}
+	msg := mailer.Message{To: "alice@example.com", Subject: "Hello", Body: "Hi"}
+	if err := m.Send(context.Background(), msg); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	messages := m.Messages()
+	if len(messages) != 1 || messages[0] != msg {
+		t.Fatalf("Expected the sent message, got %v", messages)
+	}
+}
+
+func TestFileMailer(t *testing.T) {
+	dir := t.TempDir()
+	m := &mailer.FileMailer{Dir: dir, From: "noreply@example.com"}
+	err := m.Send(context.Background(), mailer.Message{To: "alice@example.com", Subject: "Reset", Body: "link"})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if len(files) != 1 {
+		t.Fatalf("Expected 1 file, got %d", len(files))
+	}
+	data, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !strings.Contains(string(data), "To: alice@example.com") || !strings.Contains(string(data), "Subject: Reset") {
+		t.Fatalf("Unexpected message %s", data)
+	}
+}
+
+func TestEmailTokenExpires(t *testing.T) {
+	app, mock := newMockApp()
+	j := handlers.NewAuthHandler(app).NewJWT()
+
+	token, claims, err := j.GenerateEmailToken(handlers.TokenTypeResetPassword, 1, "alice@example.com", time.Hour)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if claims.ID == "" {
+		t.Fatalf("Expected token to have a jti")
+	}
+	if _, err := j.VerifyEmailToken(token, handlers.TokenTypeVerifyEmail); err == nil {
+		t.Fatalf("Expected reset token to be rejected as verification token")
+	}
+
+	got, err := j.VerifyEmailToken(token, handlers.TokenTypeResetPassword)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if got.Email != "alice@example.com" || got.Sub != 1 {
+		t.Fatalf("Unexpected claims %v", got)
+	}
+
+	mock.Add(61 * time.Minute)
+	if _, err := j.VerifyEmailToken(token, handlers.TokenTypeResetPassword); err == nil {
+		t.Fatalf("Expected expired reset token to be rejected")
+	}
+}
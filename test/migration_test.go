@@ -0,0 +1,77 @@
+package test
+
+import (
+	"net/http"
+	"testing"
+	"todo-app/cmd/api-server/migrations"
+)
+
+func TestWorkspacesKeepSharedLists(t *testing.T) {
+	// Before workspaces Alice shares Groceries with Bob as editor and Carol
+	// as viewer and invited Dave, Diary is hers alone. Bob tagged his todo
+	// with a tag of his own.
+	app := newMigratedApp(t, "20250430100512")
+	_, err := app.DB().Exec(`
+		INSERT INTO public.users (id, username, password, deleted_at) VALUES
+			(1, 'alice', '', '0001-01-01 00:00:00+00'),
+			(2, 'bob', '', '0001-01-01 00:00:00+00'),
+			(3, 'carol', '', '0001-01-01 00:00:00+00'),
+			(4, 'dave', '', '0001-01-01 00:00:00+00');
+		INSERT INTO public.lists (id, name, user_id) VALUES (1, 'Groceries', 1), (2, 'Diary', 1);
+		INSERT INTO public.list_members (list_id, user_id, role, status, accepted_at) VALUES
+			(1, 1, 'owner', 'accepted', now()),
+			(1, 2, 'editor', 'accepted', now()),
+			(1, 3, 'viewer', 'accepted', now()),
+			(1, 4, 'editor', 'pending', NULL),
+			(2, 1, 'owner', 'accepted', now());
+		INSERT INTO public.todos (id, title, description, list_id, user_id) VALUES
+			(1, 'Milk', '', 1, 1),
+			(2, 'Bread', '', 1, 2),
+			(3, 'Dream', '', 2, 1);
+		INSERT INTO public.tags (id, name, user_id) VALUES (1, 'urgent', 1), (2, 'urgent', 2);
+		INSERT INTO public.todo_tags (todo_id, tag_id) VALUES (1, 1), (2, 2), (3, 1);
+		SELECT setval(pg_get_serial_sequence('public.users', 'id'), 4);
+		SELECT setval(pg_get_serial_sequence('public.lists', 'id'), 2);
+		SELECT setval(pg_get_serial_sequence('public.todos', 'id'), 3);
+		SELECT setval(pg_get_serial_sequence('public.tags', 'id'), 2);
+	`)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	migrateTestDB(t, app.DB(), migrations.Migrations)
+
+	shared := queryInt64(t, app, "SELECT workspace_id FROM lists WHERE id = 1")
+	if personal := queryInt64(t, app, "SELECT COUNT(*) FROM workspaces WHERE id = ? AND personal", shared); personal != 0 {
+		t.Fatal("Expected the shared list to leave the personal workspace of its owner")
+	}
+	if w := serveAs(app, bob, shared, http.MethodPut, "/api/lists/1", `{"name": "Weekly groceries"}`); w.Code != http.StatusOK {
+		t.Fatalf("Expected the editor to still edit the list, got %d", w.Code)
+	}
+	if w := serveAs(app, carol, shared, http.MethodGet, "/api/todo/2", ""); w.Code != http.StatusOK {
+		t.Fatalf("Expected the viewer to still read the list, got %d", w.Code)
+	}
+	if w := serveAs(app, carol, shared, http.MethodPut, "/api/lists/1", `{"name": "Mine"}`); w.Code != http.StatusForbidden {
+		t.Fatalf("Expected the viewer to still be refused writes, got %d", w.Code)
+	}
+	if n := queryInt64(t, app, "SELECT COUNT(*) FROM workspace_members WHERE workspace_id = ? AND user_id = ?", shared, dave); n != 1 {
+		t.Fatal("Expected the invited user to be able to accept the invitation in the shared workspace")
+	}
+
+	if w := serveAs(app, alice, 0, http.MethodGet, "/api/lists/2", ""); w.Code != http.StatusOK {
+		t.Fatalf("Expected the private list to stay in the personal workspace, got %d", w.Code)
+	}
+	if w := serveAs(app, bob, shared, http.MethodGet, "/api/lists/2", ""); w.Code != http.StatusNotFound {
+		t.Fatalf("Expected the private list to stay private, got %d", w.Code)
+	}
+
+	// Both todos of the shared list now carry the tag of the shared workspace.
+	if n := queryInt64(t, app, `SELECT COUNT(*) FROM todo_tags AS tt
+		JOIN todos AS t ON t.id = tt.todo_id
+		JOIN tags AS tg ON tg.id = tt.tag_id
+		WHERE t.list_id = 1 AND tg.workspace_id = ? AND tg.name = 'urgent'`, shared); n != 2 {
+		t.Fatalf("Expected both todos to be tagged in the shared workspace, got %d", n)
+	}
+	if n := queryInt64(t, app, "SELECT COUNT(*) FROM todo_tags WHERE todo_id = 3 AND tag_id = 1"); n != 1 {
+		t.Fatal("Expected the private todo to keep its tag")
+	}
+}
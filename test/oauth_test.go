@@ -0,0 +1,111 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"todo-app/internal/constants"
+	"todo-app/internal/db"
+	"todo-app/internal/handlers"
+	"todo-app/pkg/utils"
+)
+
+func TestTokenPairCarriesClientID(t *testing.T) {
+	j, _ := newTestJWT(t)
+
+	sub := handlers.NewTokenSubject(&db.User{ID: 1, Username: "alice"})
+	sub.Scopes = []string{constants.ScopeTodosRead}
+	sub.ClientID = "tdc_partner"
+	pair, err := j.GenerateTokenPair(sub, "")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	access, err := j.VerifyAccessToken(pair.AccessToken)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if access.ClientID != "tdc_partner" {
+		t.Fatalf("Expected client tdc_partner, got %q", access.ClientID)
+	}
+	if access.HasScope(constants.ScopeTodosWrite) {
+		t.Fatalf("Expected only the granted scopes, got %v", access.Scopes)
+	}
+
+	refresh, err := j.VerifyRefreshToken(pair.RefreshToken)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if refresh.ClientID != "tdc_partner" {
+		t.Fatalf("Expected client tdc_partner on the refresh token, got %q", refresh.ClientID)
+	}
+}
+
+func TestRequireSessionRejectsOAuthTokens(t *testing.T) {
+	app, _ := newMockApp()
+	auth := handlers.NewAuthHandler(app)
+
+	serve := func(claims *handlers.JwtPayload, session *db.Session) int {
+		next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		})
+		ctx := context.WithValue(context.Background(), constants.CurrentUser, claims)
+		ctx = context.WithValue(ctx, constants.CurrentSession, session)
+		w := httptest.NewRecorder()
+		auth.RequireSession(next).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx))
+		return w.Code
+	}
+
+	if code := serve(&handlers.JwtPayload{Sub: 1}, &db.Session{ID: 1, UserID: 1}); code != http.StatusNoContent {
+		t.Fatalf("Expected 204 for a login session, got %d", code)
+	}
+	if code := serve(&handlers.JwtPayload{Sub: 1, ClientID: "tdc_partner"}, &db.Session{ID: 2, UserID: 1, OAuthClientID: 7}); code != http.StatusForbidden {
+		t.Fatalf("Expected 403 for an OAuth session, got %d", code)
+	}
+}
+
+func TestOAuthTokenUnsupportedGrant(t *testing.T) {
+	app, _ := newMockApp()
+	auth := handlers.NewAuthHandler(app)
+
+	form := url.Values{"grant_type": {"password"}, "username": {"alice"}, "password": {"secret"}}
+	r := httptest.NewRequest(http.MethodPost, "/api/oauth/token", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	auth.OAuthToken(w, r)
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected 400, got %d", w.Code)
+	}
+	if cc := w.Header().Get("Cache-Control"); cc != "no-store" {
+		t.Fatalf("Expected Cache-Control no-store, got %q", cc)
+	}
+	var resp handlers.OAuthError
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if resp.Error != "unsupported_grant_type" {
+		t.Fatalf("Expected unsupported_grant_type, got %q", resp.Error)
+	}
+}
+
+func TestOAuthClientCredentials(t *testing.T) {
+	id, err := utils.GenerateOAuthClientID()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	secret, err := utils.GenerateOAuthClientSecret()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !strings.HasPrefix(id, utils.OAuthClientIDPrefix) || !strings.HasPrefix(secret, utils.OAuthClientSecretPrefix) {
+		t.Fatalf("Expected prefixed credentials, got %q and %q", id, secret)
+	}
+	if utils.HashSecret(secret) != utils.HashSecret(secret) || utils.HashSecret(secret) == secret {
+		t.Fatalf("Expected a stable hash that differs from the secret")
+	}
+}
@@ -0,0 +1,190 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"todo-app/bunapp"
+	"todo-app/internal/constants"
+	"todo-app/internal/handlers"
+	"todo-app/pkg/oidc"
+	"todo-app/pkg/oidc/oidctest"
+
+	"github.com/benbjohnson/clock"
+	"github.com/go-chi/chi"
+)
+
+func newTestProvider(t *testing.T) (*oidctest.Server, *oidc.Provider) {
+	server := oidctest.NewServer("todo-app", "client-secret")
+	t.Cleanup(server.Close)
+
+	provider := oidc.NewProvider(oidc.Config{
+		Issuer:       server.Issuer(),
+		ClientID:     "todo-app",
+		ClientSecret: "client-secret",
+		RedirectURL:  "http://localhost:8000/api/auth/oidc/test/callback",
+	}, nil)
+	return server, provider
+}
+
+// authorize runs the browser part of the flow and returns the code.
+func authorize(t *testing.T, server *oidctest.Server, provider *oidc.Provider, state, nonce, verifier string) string {
+	authURL, err := provider.AuthCodeURL(context.Background(), state, nonce, oidc.CodeChallengeS256(verifier))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	code, gotState, err := server.Authorize(authURL)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if gotState != state {
+		t.Fatalf("Expected state %s, got %s", state, gotState)
+	}
+	return code
+}
+
+func TestOIDCAuthorizationCodeFlow(t *testing.T) {
+	server, provider := newTestProvider(t)
+	server.SetIdentity(oidctest.Identity{Subject: "42", Email: "alice@example.com", EmailVerified: true, PreferredUsername: "alice"})
+
+	verifier, _ := oidc.NewCodeVerifier()
+	code := authorize(t, server, provider, "state-1", "nonce-1", verifier)
+
+	tokens, err := provider.Exchange(context.Background(), code, verifier)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	claims, err := provider.VerifyIDToken(context.Background(), tokens.IDToken, "nonce-1", time.Now())
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if claims.Subject != "42" || claims.Email != "alice@example.com" || !claims.EmailVerified || claims.PreferredUsername != "alice" {
+		t.Fatalf("Unexpected claims %+v", claims)
+	}
+
+	// The code is single-use.
+	if _, err := provider.Exchange(context.Background(), code, verifier); err == nil {
+		t.Fatalf("Expected the code to be rejected the second time")
+	}
+}
+
+func TestOIDCRejectsWrongVerifier(t *testing.T) {
+	server, provider := newTestProvider(t)
+
+	verifier, _ := oidc.NewCodeVerifier()
+	code := authorize(t, server, provider, "state", "nonce", verifier)
+
+	other, _ := oidc.NewCodeVerifier()
+	if _, err := provider.Exchange(context.Background(), code, other); err == nil {
+		t.Fatalf("Expected an error for a wrong code verifier")
+	}
+}
+
+func TestOIDCVerifyIDToken(t *testing.T) {
+	server, provider := newTestProvider(t)
+
+	verifier, _ := oidc.NewCodeVerifier()
+	code := authorize(t, server, provider, "state", "nonce", verifier)
+	tokens, err := provider.Exchange(context.Background(), code, verifier)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if _, err := provider.VerifyIDToken(context.Background(), tokens.IDToken, "other", time.Now()); !errors.Is(err, oidc.ErrNonceMismatch) {
+		t.Fatalf("Expected ErrNonceMismatch, got %v", err)
+	}
+	if _, err := provider.VerifyIDToken(context.Background(), tokens.IDToken, "nonce", time.Now().Add(time.Hour)); !errors.Is(err, oidc.ErrInvalidIDToken) {
+		t.Fatalf("Expected an expired token to be invalid, got %v", err)
+	}
+
+	// A token for another client must not be accepted.
+	otherClient := oidc.NewProvider(oidc.Config{Issuer: server.Issuer(), ClientID: "other-app"}, nil)
+	if _, err := otherClient.VerifyIDToken(context.Background(), tokens.IDToken, "nonce", time.Now()); !errors.Is(err, oidc.ErrInvalidIDToken) {
+		t.Fatalf("Expected ErrInvalidIDToken, got %v", err)
+	}
+}
+
+func TestOIDCCodeChallenge(t *testing.T) {
+	// RFC 7636 appendix B.
+	got := oidc.CodeChallengeS256("dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk")
+	if got != "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM" {
+		t.Fatalf("Expected E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM, got %s", got)
+	}
+}
+
+func TestOIDCLinkBoundToBrowser(t *testing.T) {
+	app := newTestDB(t)
+	server := oidctest.NewServer("todo-app", "client-secret")
+	t.Cleanup(server.Close)
+	server.SetIdentity(oidctest.Identity{Subject: "42", Email: "alice@example.com", EmailVerified: true})
+	app.Config().OIDC.Providers = []bunapp.OIDCProviderConfig{{
+		Name:         "test",
+		Issuer:       server.Issuer(),
+		ClientID:     "todo-app",
+		ClientSecret: "client-secret",
+		RedirectURL:  "http://localhost:8000/api/auth/oidc/test/callback",
+	}}
+	// The provider issues its ID tokens at the real time.
+	app.SetClock(clock.New())
+
+	auth := handlers.NewAuthHandler(app)
+	router := chi.NewRouter()
+	router.With(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := context.WithValue(r.Context(), constants.CurrentUser, &handlers.JwtPayload{Sub: alice})
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}).Post("/api/auth/identities/{provider}", auth.LinkIdentity)
+	router.Get("/api/auth/oidc/{provider}/callback", auth.OIDCCallback)
+
+	// startLink starts a link flow as alice and follows it at the provider.
+	startLink := func() (*http.Cookie, string) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/auth/identities/test", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d", w.Code)
+		}
+		var body struct {
+			Data handlers.OIDCAuthorizationResponse `json:"data"`
+		}
+		if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		code, state, err := server.Authorize(body.Data.AuthorizationURL)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		cookies := w.Result().Cookies()
+		if len(cookies) != 1 || cookies[0].Value != state {
+			t.Fatalf("Expected the link cookie to hold the state, got %v", cookies)
+		}
+		return cookies[0], "/api/auth/oidc/test/callback?code=" + code + "&state=" + state
+	}
+
+	// A victim lured to the callback of someone else's flow has no cookie.
+	_, callback := startLink()
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, callback, nil))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected a callback without the cookie to be refused, got %d", w.Code)
+	}
+	if n := queryInt64(t, app, "SELECT COUNT(*) FROM user_identities"); n != 0 {
+		t.Fatalf("Expected no identity to be linked, got %d", n)
+	}
+
+	cookie, callback := startLink()
+	r := httptest.NewRequest(http.MethodGet, callback, nil)
+	r.AddCookie(cookie)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected the identity to be linked, got %d: %s", w.Code, w.Body)
+	}
+	if n := queryInt64(t, app, "SELECT COUNT(*) FROM user_identities WHERE user_id = ? AND subject = '42'", alice); n != 1 {
+		t.Fatal("Expected the identity to be linked to alice")
+	}
+}
@@ -1,51 +1,54 @@
 package test
 
 import (
-	"fmt"
 	"testing"
-	"todo-app/pkg/utils"
+	"todo-app/pkg/password"
 )
 
 func TestHashPassword(t *testing.T) {
+	app, _ := newMockApp()
+	hasher := app.PasswordHasher()
+
 	// Test với mật khẩu hợp lệ
-	password := "secretPassword"
-	hashedPassword, err := utils. HashPassword(password)
-	fmt.Println(hashedPassword)
+	hashedPassword, err := hasher.Hash("secretPassword")
 	if err != nil {
 		t.Fatalf("Expected no error, got %v", err)
 	}
 
-	// Kiểm tra nếu mật khẩu đã băm không rỗng
-	if hashedPassword == "" {
-		t.Fatalf("Expected hashed password to be non-empty")
+	// Kiểm tra nếu mật khẩu đã băm không rỗng và dùng thuật toán mặc định
+	if hashedPassword == "" || hasher.NeedsRehash(hashedPassword) {
+		t.Fatalf("Expected a hash of the preferred algorithm, got %q", hashedPassword)
 	}
 }
 
 func TestComparePassword(t *testing.T) {
-	// Test với mật khẩu hợp lệ
-	password := "secretPassword"
-	hashedPassword, err := utils.HashPassword(password)
+	app, _ := newMockApp()
+	hasher := app.PasswordHasher()
+
+	hashedPassword, err := hasher.Hash("secretPassword")
 	if err != nil {
 		t.Fatalf("Expected no error, got %v", err)
 	}
 
 	// Kiểm tra nếu mật khẩu khớp
-	match, err := utils.ComparePassword(hashedPassword, password)
-	fmt.Println(match)
-	if err != nil {
-		t.Fatalf("Expected no error, got %v", err)
-	}
-	if !match {
-		t.Fatalf("Expected password to match")
+	if match, err := hasher.Verify(hashedPassword, "secretPassword"); err != nil || !match {
+		t.Fatalf("Expected password to match, got %v %v", match, err)
 	}
 
 	// Kiểm tra nếu mật khẩu không khớp
-	wrongPassword := "wrongPassword"
-	match, err = utils.ComparePassword(hashedPassword, wrongPassword)
-	if err == nil {
-		t.Fatalf("Expected error, got nil")
+	if match, err := hasher.Verify(hashedPassword, "wrongPassword"); err != nil || match {
+		t.Fatalf("Expected password to not match, got %v %v", match, err)
+	}
+
+	// Mật khẩu băm bằng bcrypt trước đây vẫn dùng được
+	legacy, err := (&password.Bcrypt{}).Hash("secretPassword")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if match, err := hasher.Verify(legacy, "secretPassword"); err != nil || !match {
+		t.Fatalf("Expected a bcrypt hash to match, got %v %v", match, err)
 	}
-	if match {
-		t.Fatalf("Expected password to not match")
+	if !hasher.NeedsRehash(legacy) {
+		t.Fatalf("Expected a bcrypt hash to be upgraded")
 	}
 }
@@ -0,0 +1,107 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"todo-app/httputil/httperror"
+	"todo-app/internal/constants"
+	"todo-app/internal/db"
+	"todo-app/internal/handlers"
+)
+
+func serveWithClaims(mw func(http.Handler) http.Handler, claims *handlers.JwtPayload) *httptest.ResponseRecorder {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	if claims != nil {
+		r = r.WithContext(context.WithValue(r.Context(), constants.CurrentUser, claims))
+	}
+	w := httptest.NewRecorder()
+	mw(next).ServeHTTP(w, r)
+	return w
+}
+
+func appCode(t *testing.T, w *httptest.ResponseRecorder) int64 {
+	var resp httperror.ErrResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	return resp.AppCode
+}
+
+func TestRequireScope(t *testing.T) {
+	user := &handlers.JwtPayload{Role: db.RoleUser, Scopes: handlers.ScopesForRole(db.RoleUser)}
+	readOnly := &handlers.JwtPayload{Role: db.RoleUser, Scopes: []string{constants.ScopeTodosRead}}
+
+	if w := serveWithClaims(handlers.RequireScope(constants.ScopeTodosWrite), user); w.Code != http.StatusNoContent {
+		t.Fatalf("Expected 204, got %d", w.Code)
+	}
+	if w := serveWithClaims(handlers.RequireScope(constants.ScopeTodosRead), user); w.Code != http.StatusNoContent {
+		t.Fatalf("Expected 204, got %d", w.Code)
+	}
+
+	w := serveWithClaims(handlers.RequireScope(constants.ScopeTodosWrite), readOnly)
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("Expected 403, got %d", w.Code)
+	}
+	if code := appCode(t, w); code != httperror.CodeInsufficientScope {
+		t.Fatalf("Expected code %d, got %d", httperror.CodeInsufficientScope, code)
+	}
+
+	if w := serveWithClaims(handlers.RequireScope(constants.ScopeTodosRead), nil); w.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected 401, got %d", w.Code)
+	}
+}
+
+func TestRequireRole(t *testing.T) {
+	user := &handlers.JwtPayload{Role: db.RoleUser}
+	admin := &handlers.JwtPayload{Role: db.RoleAdmin}
+
+	w := serveWithClaims(handlers.RequireRole(db.RoleAdmin), user)
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("Expected 403, got %d", w.Code)
+	}
+	if code := appCode(t, w); code != httperror.CodeInsufficientRole {
+		t.Fatalf("Expected code %d, got %d", httperror.CodeInsufficientRole, code)
+	}
+
+	if w := serveWithClaims(handlers.RequireRole(db.RoleAdmin), admin); w.Code != http.StatusNoContent {
+		t.Fatalf("Expected 204, got %d", w.Code)
+	}
+	if w := serveWithClaims(handlers.RequireRole(db.RoleUser), admin); w.Code != http.StatusNoContent {
+		t.Fatalf("Expected admins to have the user role, got %d", w.Code)
+	}
+}
+
+func TestAccessTokenCarriesScopes(t *testing.T) {
+	j, _ := newTestJWT(t)
+
+	sub := handlers.NewTokenSubject(&db.User{ID: 1, Username: "root", Role: db.RoleAdmin})
+	pair, err := j.GenerateTokenPair(sub, "")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	claims, err := j.VerifyAccessToken(pair.AccessToken)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if claims.Role != db.RoleAdmin || !claims.HasScope(constants.ScopeAdmin) || !claims.HasScope(constants.ScopeTodosRead) {
+		t.Fatalf("Unexpected claims %+v", claims)
+	}
+
+	user := handlers.NewTokenSubject(&db.User{ID: 2, Username: "alice"})
+	if user.Role != db.RoleUser {
+		t.Fatalf("Expected default role user, got %s", user.Role)
+	}
+	for _, scope := range user.Scopes {
+		if scope == constants.ScopeAdmin {
+			t.Fatalf("Expected users to not get the admin scope")
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"todo-app/internal/db"
+	"todo-app/internal/handlers"
+	"todo-app/internal/jobs"
+	"todo-app/internal/notify"
+	"todo-app/pkg/mailer"
+)
+
+func TestWebhookNotifier(t *testing.T) {
+	status := http.StatusNoContent
+	var header http.Header
+	var body []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header
+		body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	n := &notify.WebhookNotifier{URL: srv.URL, Secret: "webhook-secret", Client: srv.Client()}
+	notification := &notify.Notification{ID: "reminder-delivery-7", UserID: 1, TodoID: 3, Title: "Pay rent"}
+	if err := n.Notify(context.Background(), notification); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if got := header.Get("Idempotency-Key"); got != "reminder-delivery-7" {
+		t.Fatalf("Expected the delivery as idempotency key, got %q", got)
+	}
+	if got := header.Get("X-Signature"); got != "sha256="+notify.Sign("webhook-secret", body) {
+		t.Fatalf("Expected the body to be signed, got %q", got)
+	}
+	var payload map[string]interface{}
+	if err := json.Unmarshal(body, &payload); err != nil || payload["title"] != "Pay rent" {
+		t.Fatalf("Expected the todo in the payload, got %s", body)
+	}
+
+	for _, tc := range []struct {
+		status    int
+		permanent bool
+	}{
+		{http.StatusBadRequest, true},
+		{http.StatusGone, true},
+		{http.StatusTooManyRequests, false},
+		{http.StatusRequestTimeout, false},
+		{http.StatusBadGateway, false},
+	} {
+		status = tc.status
+		err := n.Notify(context.Background(), notification)
+		if err == nil || errors.Is(err, notify.ErrPermanent) != tc.permanent {
+			t.Fatalf("Expected permanent=%v for %d, got %v", tc.permanent, tc.status, err)
+		}
+	}
+}
+
+func TestEmailNotifier(t *testing.T) {
+	m := &mailer.MemoryMailer{}
+	n := &notify.EmailNotifier{Mailer: m, BaseURL: "https://todo.example.com"}
+
+	berlin := mustLoadLocation(t, "Europe/Berlin")
+	err := n.Notify(context.Background(), &notify.Notification{
+		Username: "alice",
+		Email:    "alice@example.com",
+		TodoID:   3,
+		Title:    "Pay rent",
+		Due:      time.Date(2025, 3, 20, 9, 0, 0, 0, berlin),
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	messages := m.Messages()
+	if len(messages) != 1 || messages[0].To != "alice@example.com" || messages[0].Subject != "Reminder: Pay rent" {
+		t.Fatalf("Expected the reminder email, got %v", messages)
+	}
+	if !strings.Contains(messages[0].Body, "09:00 CET") || !strings.Contains(messages[0].Body, "https://todo.example.com/todos/3") {
+		t.Fatalf("Expected the due time and a link, got %q", messages[0].Body)
+	}
+
+	err = n.Notify(context.Background(), &notify.Notification{Username: "bob", Title: "Pay rent"})
+	if !errors.Is(err, notify.ErrPermanent) {
+		t.Fatalf("Expected a permanent error without an email address, got %v", err)
+	}
+}
+
+func TestDeliveryBackoff(t *testing.T) {
+	for attempts, want := range map[int]time.Duration{
+		1:  30 * time.Second,
+		2:  time.Minute,
+		3:  2 * time.Minute,
+		8:  time.Hour,
+		20: time.Hour,
+	} {
+		if got := jobs.DeliveryBackoff(attempts); got != want {
+			t.Fatalf("Expected %s after %d attempts, got %s", want, attempts, got)
+		}
+	}
+}
+
+func TestReminderFireAt(t *testing.T) {
+	berlin := mustLoadLocation(t, "Europe/Berlin")
+	offset := int64(30 * 60)
+
+	timed := &db.Todo{DueAt: time.Date(2025, 3, 20, 9, 0, 0, 0, berlin)}
+	if got := handlers.ReminderFireAt(timed, &db.Reminder{OffsetSeconds: &offset}, berlin); !got.Equal(time.Date(2025, 3, 20, 8, 30, 0, 0, berlin)) {
+		t.Fatalf("Expected 30 minutes before due, got %s", got)
+	}
+
+	// All-day todos are due at the start of the day of the user.
+	allDay := &db.Todo{AllDay: true, DueDate: db.NewDate(2025, 3, 30)}
+	if got := handlers.ReminderFireAt(allDay, &db.Reminder{OffsetSeconds: &offset}, berlin); !got.Equal(time.Date(2025, 3, 29, 23, 30, 0, 0, berlin)) {
+		t.Fatalf("Expected 30 minutes before midnight in Berlin, got %s", got)
+	}
+
+	if got := handlers.ReminderFireAt(&db.Todo{}, &db.Reminder{OffsetSeconds: &offset}, berlin); !got.IsZero() {
+		t.Fatalf("Expected no fire time without a due date, got %s", got)
+	}
+
+	at := time.Date(2025, 3, 21, 7, 0, 0, 0, time.UTC)
+	if got := handlers.ReminderFireAt(timed, &db.Reminder{RemindAt: at}, berlin); !got.Equal(at) {
+		t.Fatalf("Expected the absolute time, got %s", got)
+	}
+}
+
+func TestReminderDefaults(t *testing.T) {
+	app, _ := newMockApp()
+	if d := app.ReminderInterval(); d != 15*time.Second {
+		t.Fatalf("Expected a 15 second interval, got %s", d)
+	}
+	if n := app.ReminderMaxAttempts(); n != 8 {
+		t.Fatalf("Expected 8 attempts, got %d", n)
+	}
+}
+
+func TestReminderValidation(t *testing.T) {
+	app, _ := newMockApp()
+	todos := handlers.NewTodoHandler(app)
+
+	for _, body := range []string{
+		`{}`,
+		`{"remind_at": "2025-03-20T09:00:00Z", "minutes_before": 10}`,
+		`{"remind_at": "tomorrow"}`,
+		`{"remind_at": "2025-03-19T12:59:00Z"}`,
+		`{"minutes_before": -5}`,
+		`{"minutes_before": 20000}`,
+		`{"minutes_before": 10, "channels": ["sms"]}`,
+		`{"minutes_before": 10, "channels": ["email", "email"]}`,
+		`{"minutes_before": 10, "channels": ["webhook"]}`,
+	} {
+		if w := serveTodo(todos.CreateReminder, http.MethodPost, "/api/todo/1/reminders", body); w.Code != http.StatusBadRequest {
+			t.Fatalf("Expected 400 for %s, got %d", body, w.Code)
+		}
+	}
+}
@@ -0,0 +1,440 @@
+package test
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+	"todo-app/internal/db"
+	"todo-app/internal/handlers"
+	"todo-app/pkg/rrule"
+
+	"github.com/benbjohnson/clock"
+)
+
+const occurrenceLayout = "2006-01-02 15:04 MST"
+
+func TestRRuleParse(t *testing.T) {
+	for _, tt := range []struct{ in, out string }{
+		{"FREQ=DAILY", "FREQ=DAILY"},
+		{"RRULE:FREQ=DAILY;INTERVAL=3", "FREQ=DAILY;INTERVAL=3"},
+		{"freq=weekly;byday=mo,tu,we,th,fr", "FREQ=WEEKLY;BYDAY=MO,TU,WE,TH,FR"},
+		{"FREQ=MONTHLY;BYDAY=-1FR;COUNT=6", "FREQ=MONTHLY;BYDAY=-1FR;COUNT=6"},
+		{"FREQ=MONTHLY;BYMONTHDAY=1,-1;INTERVAL=1", "FREQ=MONTHLY;BYMONTHDAY=1,-1"},
+		{"FREQ=WEEKLY;UNTIL=20250401T120000Z", "FREQ=WEEKLY;UNTIL=20250401T120000Z"},
+		{"FREQ=WEEKLY;UNTIL=20250401", "FREQ=WEEKLY;UNTIL=20250401T235959"},
+	} {
+		rule, err := rrule.Parse(tt.in)
+		if err != nil {
+			t.Fatalf("Expected %s to parse, got %v", tt.in, err)
+		}
+		if rule.String() != tt.out {
+			t.Fatalf("Expected %s, got %s", tt.out, rule)
+		}
+	}
+
+	for _, in := range []string{
+		"",
+		"INTERVAL=2",
+		"FREQ=HOURLY",
+		"FREQ=DAILY;INTERVAL=0",
+		"FREQ=DAILY;FREQ=WEEKLY",
+		"FREQ=DAILY;COUNT=3;UNTIL=20250401",
+		"FREQ=WEEKLY;BYDAY=1MO",
+		"FREQ=WEEKLY;BYMONTHDAY=1",
+		"FREQ=MONTHLY;BYMONTHDAY=32",
+		"FREQ=MONTHLY;BYDAY=XX",
+		"FREQ=MONTHLY;BYSETPOS=1",
+	} {
+		if _, err := rrule.Parse(in); err == nil {
+			t.Fatalf("Expected %q to be refused", in)
+		}
+	}
+	if _, err := rrule.Parse("FREQ=SECONDLY"); !errors.Is(err, rrule.ErrUnsupported) {
+		t.Fatalf("Expected ErrUnsupported, got %v", err)
+	}
+}
+
+func TestRRuleOccurrences(t *testing.T) {
+	berlin := mustLoadLocation(t, "Europe/Berlin")
+	newYork := mustLoadLocation(t, "America/New_York")
+
+	tests := []struct {
+		name    string
+		rule    string
+		dtstart time.Time
+		want    []string
+	}{
+		{
+			name:    "daily keeps the wall clock when Berlin springs forward",
+			rule:    "FREQ=DAILY",
+			dtstart: time.Date(2025, 3, 29, 9, 0, 0, 0, berlin),
+			want:    []string{"2025-03-29 09:00 CET", "2025-03-30 09:00 CEST", "2025-03-31 09:00 CEST"},
+		},
+		{
+			name:    "daily keeps the wall clock when New York falls back",
+			rule:    "FREQ=DAILY",
+			dtstart: time.Date(2025, 11, 1, 9, 0, 0, 0, newYork),
+			want:    []string{"2025-11-01 09:00 EDT", "2025-11-02 09:00 EST", "2025-11-03 09:00 EST"},
+		},
+		{
+			name:    "a time skipped in Berlin moves forward by the gap",
+			rule:    "FREQ=DAILY",
+			dtstart: time.Date(2025, 3, 29, 2, 30, 0, 0, berlin),
+			want:    []string{"2025-03-29 02:30 CET", "2025-03-30 03:30 CEST", "2025-03-31 02:30 CEST"},
+		},
+		{
+			name:    "a time skipped in New York moves forward by the gap",
+			rule:    "FREQ=DAILY",
+			dtstart: time.Date(2025, 3, 8, 2, 30, 0, 0, newYork),
+			want:    []string{"2025-03-08 02:30 EST", "2025-03-09 03:30 EDT", "2025-03-10 02:30 EDT"},
+		},
+		{
+			name:    "a time that happens twice in New York is the first one",
+			rule:    "FREQ=DAILY",
+			dtstart: time.Date(2025, 11, 1, 1, 30, 0, 0, newYork),
+			want:    []string{"2025-11-01 01:30 EDT", "2025-11-02 01:30 EDT", "2025-11-03 01:30 EST"},
+		},
+		{
+			name:    "a time that happens twice in Berlin is the first one",
+			rule:    "FREQ=DAILY",
+			dtstart: time.Date(2025, 10, 25, 2, 30, 0, 0, berlin),
+			want:    []string{"2025-10-25 02:30 CEST", "2025-10-26 02:30 CEST", "2025-10-27 02:30 CET"},
+		},
+		{
+			name:    "every 3 days across the DST change",
+			rule:    "FREQ=DAILY;INTERVAL=3",
+			dtstart: time.Date(2025, 3, 28, 20, 0, 0, 0, berlin),
+			want:    []string{"2025-03-28 20:00 CET", "2025-03-31 20:00 CEST", "2025-04-03 20:00 CEST"},
+		},
+		{
+			name:    "weekdays skip the weekend of the DST change",
+			rule:    "FREQ=WEEKLY;BYDAY=MO,TU,WE,TH,FR",
+			dtstart: time.Date(2025, 3, 28, 9, 0, 0, 0, berlin),
+			want:    []string{"2025-03-28 09:00 CET", "2025-03-31 09:00 CEST", "2025-04-01 09:00 CEST"},
+		},
+		{
+			name:    "weekly starts at the first matching day",
+			rule:    "FREQ=WEEKLY;BYDAY=MO",
+			dtstart: time.Date(2025, 3, 19, 9, 0, 0, 0, time.UTC),
+			want:    []string{"2025-03-24 09:00 UTC", "2025-03-31 09:00 UTC", "2025-04-07 09:00 UTC"},
+		},
+		{
+			name:    "every other week on Monday and Thursday",
+			rule:    "FREQ=WEEKLY;INTERVAL=2;BYDAY=TH,MO",
+			dtstart: time.Date(2025, 3, 17, 9, 0, 0, 0, time.UTC),
+			want:    []string{"2025-03-17 09:00 UTC", "2025-03-20 09:00 UTC", "2025-03-31 09:00 UTC", "2025-04-03 09:00 UTC"},
+		},
+		{
+			name:    "daily on weekdays",
+			rule:    "FREQ=DAILY;BYDAY=MO,TU,WE,TH,FR",
+			dtstart: time.Date(2025, 3, 21, 9, 0, 0, 0, time.UTC),
+			want:    []string{"2025-03-21 09:00 UTC", "2025-03-24 09:00 UTC", "2025-03-25 09:00 UTC"},
+		},
+		{
+			name:    "monthly on the 31st skips shorter months",
+			rule:    "FREQ=MONTHLY;BYMONTHDAY=31",
+			dtstart: time.Date(2025, 1, 31, 9, 0, 0, 0, berlin),
+			want:    []string{"2025-01-31 09:00 CET", "2025-03-31 09:00 CEST", "2025-05-31 09:00 CEST"},
+		},
+		{
+			name:    "monthly on the last day",
+			rule:    "FREQ=MONTHLY;BYMONTHDAY=-1",
+			dtstart: time.Date(2025, 1, 31, 9, 0, 0, 0, time.UTC),
+			want:    []string{"2025-01-31 09:00 UTC", "2025-02-28 09:00 UTC", "2025-03-31 09:00 UTC"},
+		},
+		{
+			name:    "monthly on the last Friday",
+			rule:    "FREQ=MONTHLY;BYDAY=-1FR",
+			dtstart: time.Date(2025, 1, 1, 9, 0, 0, 0, time.UTC),
+			want:    []string{"2025-01-31 09:00 UTC", "2025-02-28 09:00 UTC", "2025-03-28 09:00 UTC"},
+		},
+		{
+			name:    "monthly on the second Tuesday across the DST change",
+			rule:    "FREQ=MONTHLY;BYDAY=2TU",
+			dtstart: time.Date(2025, 2, 11, 18, 0, 0, 0, newYork),
+			want:    []string{"2025-02-11 18:00 EST", "2025-03-11 18:00 EDT", "2025-04-08 18:00 EDT"},
+		},
+		{
+			name:    "monthly without BYDAY repeats the day of the start",
+			rule:    "FREQ=MONTHLY;INTERVAL=2",
+			dtstart: time.Date(2025, 1, 15, 9, 0, 0, 0, time.UTC),
+			want:    []string{"2025-01-15 09:00 UTC", "2025-03-15 09:00 UTC", "2025-05-15 09:00 UTC"},
+		},
+		{
+			name:    "yearly on February 29 waits for leap years",
+			rule:    "FREQ=YEARLY",
+			dtstart: time.Date(2024, 2, 29, 9, 0, 0, 0, time.UTC),
+			want:    []string{"2024-02-29 09:00 UTC", "2028-02-29 09:00 UTC", "2032-02-29 09:00 UTC"},
+		},
+		{
+			name:    "count ends the series",
+			rule:    "FREQ=DAILY;COUNT=2",
+			dtstart: time.Date(2025, 3, 29, 9, 0, 0, 0, berlin),
+			want:    []string{"2025-03-29 09:00 CET", "2025-03-30 09:00 CEST"},
+		},
+		{
+			name:    "until a date includes the whole day",
+			rule:    "FREQ=DAILY;UNTIL=20250330",
+			dtstart: time.Date(2025, 3, 29, 23, 0, 0, 0, berlin),
+			want:    []string{"2025-03-29 23:00 CET", "2025-03-30 23:00 CEST"},
+		},
+		{
+			name:    "until a UTC time is an instant",
+			rule:    "FREQ=DAILY;UNTIL=20250330T070000Z",
+			dtstart: time.Date(2025, 3, 29, 9, 0, 0, 0, berlin),
+			want:    []string{"2025-03-29 09:00 CET", "2025-03-30 09:00 CEST"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, err := rrule.Parse(tt.rule)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+
+			var got []string
+			o, ok := rule.First(tt.dtstart)
+			for ok && len(got) < len(tt.want)+1 {
+				got = append(got, o.Format(occurrenceLayout))
+				o, ok = rule.Next(tt.dtstart, o)
+			}
+			if len(got) > len(tt.want) && rule.Count == 0 && rule.Until.IsZero() {
+				got = got[:len(tt.want)]
+			}
+
+			if len(got) != len(tt.want) {
+				t.Fatalf("Expected %v, got %v", tt.want, got)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("Expected %v, got %v", tt.want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestRRuleNextFarAhead(t *testing.T) {
+	berlin := mustLoadLocation(t, "Europe/Berlin")
+	dtstart := time.Date(2020, 1, 6, 9, 0, 0, 0, berlin)
+
+	for _, tt := range []struct {
+		rule string
+		want string
+	}{
+		{"FREQ=DAILY;INTERVAL=3", "2025-03-31 09:00 CEST"},
+		{"FREQ=WEEKLY;INTERVAL=2;BYDAY=MO", "2025-04-07 09:00 CEST"},
+		{"FREQ=MONTHLY;BYDAY=1MO", "2025-04-07 09:00 CEST"},
+	} {
+		rule, _ := rrule.Parse(tt.rule)
+		o, ok := rule.Next(dtstart, time.Date(2025, 3, 29, 12, 0, 0, 0, berlin))
+		if !ok || o.Format(occurrenceLayout) != tt.want {
+			t.Fatalf("Expected %s for %s, got %s", tt.want, tt.rule, o.Format(occurrenceLayout))
+		}
+	}
+}
+
+func TestNextOccurrence(t *testing.T) {
+	berlin := mustLoadLocation(t, "Europe/Berlin")
+	newYork := mustLoadLocation(t, "America/New_York")
+
+	timed := func(rule, repeatFrom string, due time.Time, start time.Duration) (*db.TodoSeries, *db.Todo) {
+		todo := &db.Todo{Title: "Water the plants", UserID: 1, ListID: 1, DueAt: due}
+		if start > 0 {
+			todo.StartAt = due.Add(-start)
+		}
+		r, err := rrule.Parse(rule)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		series, err := handlers.NewTodoSeries(todo, r, repeatFrom, due.Location())
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		return series, todo
+	}
+	allDay := func(rule string, due db.Date, loc *time.Location) (*db.TodoSeries, *db.Todo) {
+		todo := &db.Todo{Title: "Take out the trash", UserID: 1, ListID: 1, AllDay: true, DueDate: due}
+		r, _ := rrule.Parse(rule)
+		series, err := handlers.NewTodoSeries(todo, r, "", loc)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		return series, todo
+	}
+
+	tests := []struct {
+		name  string
+		setup func() (*db.TodoSeries, *db.Todo)
+		now   time.Time
+		want  string
+		start string
+	}{
+		{
+			name: "the next day is already summer time",
+			setup: func() (*db.TodoSeries, *db.Todo) {
+				return timed("FREQ=DAILY", "", time.Date(2025, 3, 29, 9, 0, 0, 0, berlin), time.Hour)
+			},
+			now:   time.Date(2025, 3, 29, 10, 0, 0, 0, time.UTC),
+			want:  "2025-03-30 09:00 CEST",
+			start: "2025-03-30 08:00 CEST",
+		},
+		{
+			name: "completing early does not repeat the occurrence",
+			setup: func() (*db.TodoSeries, *db.Todo) {
+				return timed("FREQ=DAILY", "", time.Date(2025, 3, 30, 9, 0, 0, 0, berlin), 0)
+			},
+			now:  time.Date(2025, 3, 29, 20, 0, 0, 0, time.UTC),
+			want: "2025-03-31 09:00 CEST",
+		},
+		{
+			name: "completing late skips the missed occurrences",
+			setup: func() (*db.TodoSeries, *db.Todo) {
+				return timed("FREQ=DAILY", "", time.Date(2025, 3, 29, 9, 0, 0, 0, berlin), 0)
+			},
+			now:  time.Date(2025, 4, 2, 12, 0, 0, 0, time.UTC),
+			want: "2025-04-03 09:00 CEST",
+		},
+		{
+			name: "an occurrence later today is still to come",
+			setup: func() (*db.TodoSeries, *db.Todo) {
+				return timed("FREQ=DAILY", "", time.Date(2025, 11, 1, 18, 0, 0, 0, newYork), 0)
+			},
+			now:  time.Date(2025, 11, 2, 15, 0, 0, 0, time.UTC),
+			want: "2025-11-02 18:00 EST",
+		},
+		{
+			name: "every 3 days after completion",
+			setup: func() (*db.TodoSeries, *db.Todo) {
+				return timed("FREQ=DAILY;INTERVAL=3", db.RepeatFromCompletion, time.Date(2025, 3, 20, 9, 0, 0, 0, berlin), 0)
+			},
+			now:  time.Date(2025, 3, 28, 22, 30, 0, 0, time.UTC),
+			want: "2025-03-31 09:00 CEST",
+		},
+		{
+			name: "completion after midnight in the timezone of the user",
+			setup: func() (*db.TodoSeries, *db.Todo) {
+				return timed("FREQ=DAILY;INTERVAL=3", db.RepeatFromCompletion, time.Date(2025, 3, 20, 9, 0, 0, 0, berlin), 0)
+			},
+			now:  time.Date(2025, 3, 28, 23, 30, 0, 0, time.UTC),
+			want: "2025-04-01 09:00 CEST",
+		},
+		{
+			name: "a completion time skipped by DST",
+			setup: func() (*db.TodoSeries, *db.Todo) {
+				return timed("FREQ=DAILY;INTERVAL=2", db.RepeatFromCompletion, time.Date(2025, 3, 1, 2, 30, 0, 0, newYork), 0)
+			},
+			now:  time.Date(2025, 3, 7, 12, 0, 0, 0, time.UTC),
+			want: "2025-03-09 03:30 EDT",
+		},
+		{
+			name: "all-day weekly on Monday",
+			setup: func() (*db.TodoSeries, *db.Todo) {
+				return allDay("FREQ=WEEKLY;BYDAY=MO", db.NewDate(2025, 3, 17), berlin)
+			},
+			now:  time.Date(2025, 3, 19, 13, 0, 0, 0, time.UTC),
+			want: "2025-03-24 00:00 UTC",
+		},
+		{
+			name: "all-day overdue moves to today of the user",
+			setup: func() (*db.TodoSeries, *db.Todo) {
+				return allDay("FREQ=DAILY", db.NewDate(2025, 3, 15), newYork)
+			},
+			now:  time.Date(2025, 3, 20, 2, 0, 0, 0, time.UTC),
+			want: "2025-03-19 00:00 UTC",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := clock.NewMock()
+			mock.Set(tt.now)
+			series, todo := tt.setup()
+
+			next, err := handlers.NextOccurrence(series, todo, mock.Now())
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if next == nil {
+				t.Fatalf("Expected a next occurrence")
+			}
+			got := next.OccurrenceAt.In(next.OccurrenceAt.Location()).Format(occurrenceLayout)
+			if got != tt.want {
+				t.Fatalf("Expected %s, got %s", tt.want, got)
+			}
+			if next.Status != db.TODO || next.Title != todo.Title {
+				t.Fatalf("Expected an open copy of the series, got %+v", next)
+			}
+			if series.AllDay {
+				if next.DueDate != db.DateOf(next.OccurrenceAt) || !next.DueAt.IsZero() {
+					t.Fatalf("Expected due date %s, got %s", db.DateOf(next.OccurrenceAt), next.DueDate)
+				}
+			} else if !next.DueAt.Equal(next.OccurrenceAt) {
+				t.Fatalf("Expected due at %s, got %s", next.OccurrenceAt, next.DueAt)
+			}
+			if tt.start != "" && next.StartAt.Format(occurrenceLayout) != tt.start {
+				t.Fatalf("Expected start at %s, got %s", tt.start, next.StartAt.Format(occurrenceLayout))
+			}
+		})
+	}
+}
+
+func TestNextOccurrenceEnds(t *testing.T) {
+	mock := clock.NewMock()
+	mock.Set(time.Date(2025, 3, 19, 13, 0, 0, 0, time.UTC))
+
+	rule, _ := rrule.Parse("FREQ=DAILY;COUNT=2")
+	todo := &db.Todo{Title: "Take the pills", DueAt: time.Date(2025, 3, 19, 9, 0, 0, 0, time.UTC)}
+	series, err := handlers.NewTodoSeries(todo, rule, "", time.UTC)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	next, err := handlers.NextOccurrence(series, todo, mock.Now())
+	if err != nil || next == nil {
+		t.Fatalf("Expected the second occurrence, got %v", err)
+	}
+	series.Occurrences++
+
+	mock.Add(24 * time.Hour)
+	if last, err := handlers.NextOccurrence(series, next, mock.Now()); err != nil || last != nil {
+		t.Fatalf("Expected the series to end after 2 occurrences, got %+v", last)
+	}
+}
+
+func TestNewTodoSeries(t *testing.T) {
+	rule, _ := rrule.Parse("FREQ=WEEKLY;BYDAY=MO")
+
+	todo := &db.Todo{Title: "Plan the week", DueAt: time.Date(2025, 3, 19, 9, 0, 0, 0, time.UTC)}
+	series, err := handlers.NewTodoSeries(todo, rule, "", time.UTC)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !todo.DueAt.Equal(time.Date(2025, 3, 24, 9, 0, 0, 0, time.UTC)) || !todo.OccurrenceAt.Equal(todo.DueAt) {
+		t.Fatalf("Expected the todo to move to the first Monday, got %s", todo.DueAt)
+	}
+	if series.RepeatFrom != db.RepeatFromDue || series.Occurrences != 1 {
+		t.Fatalf("Expected a series repeating from the due date, got %+v", series)
+	}
+
+	if _, err := handlers.NewTodoSeries(&db.Todo{Title: "No due date"}, rule, "", time.UTC); err == nil {
+		t.Fatalf("Expected a todo without due date to be refused")
+	}
+}
+
+func TestTodoRecurrenceValidation(t *testing.T) {
+	app, _ := newMockApp()
+	todos := handlers.NewTodoHandler(app)
+
+	for _, body := range []string{
+		`{"title": "a", "list_id": 1, "recurrence": "FREQ=HOURLY"}`,
+		`{"title": "a", "list_id": 1, "recurrence": "FREQ=DAILY;COUNT=0"}`,
+		`{"title": "a", "list_id": 1, "recurrence": "FREQ=DAILY", "repeat_from": "start"}`,
+	} {
+		if w := serveTodo(todos.CreateTodo, http.MethodPost, "/api/todo", body); w.Code != http.StatusBadRequest {
+			t.Fatalf("Expected 400 for %s, got %d", body, w.Code)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package test
+
+import (
+	"net/http"
+	"testing"
+	"todo-app/internal/db"
+	"todo-app/internal/handlers"
+)
+
+func TestBuildTodoTree(t *testing.T) {
+	root := &db.Todo{ID: 1, Status: db.TODO}
+	subtasks := []*db.Todo{
+		{ID: 4, ParentID: 2, Status: db.DONE},
+		{ID: 3, ParentID: 1, Status: db.TODO},
+		{ID: 2, ParentID: 1, Status: db.DOING},
+		{ID: 5, ParentID: 4, Status: db.DONE},
+	}
+	handlers.BuildTodoTree(root, subtasks)
+
+	if len(root.Subtasks) != 2 || root.Subtasks[0].ID != 2 || root.Subtasks[1].ID != 3 {
+		t.Fatalf("Expected subtasks 2 and 3 ordered by id, got %v", root.Subtasks)
+	}
+	two := root.Subtasks[0]
+	if len(two.Subtasks) != 1 || two.Subtasks[0].ID != 4 || len(two.Subtasks[0].Subtasks) != 1 || two.Subtasks[0].Subtasks[0].ID != 5 {
+		t.Fatalf("Expected 4 below 2 and 5 below 4, got %v", two.Subtasks)
+	}
+	if len(root.Subtasks[1].Subtasks) != 0 {
+		t.Fatalf("Expected no subtasks below 3, got %v", root.Subtasks[1].Subtasks)
+	}
+}
+
+func TestComputeTodoProgress(t *testing.T) {
+	root := &db.Todo{
+		ID:     1,
+		Status: db.TODO,
+		Checklist: []*db.ChecklistItem{
+			{ID: 1, Done: true},
+			{ID: 2},
+		},
+	}
+	handlers.BuildTodoTree(root, []*db.Todo{
+		{ID: 2, ParentID: 1, Status: db.DONE},
+		{ID: 3, ParentID: 1, Status: db.TODO},
+		{ID: 4, ParentID: 3, Status: db.DONE},
+		{ID: 5, ParentID: 3, Status: db.DOING},
+	})
+
+	p := handlers.ComputeTodoProgress(root)
+	want := db.TodoProgress{Subtasks: 4, SubtasksDone: 2, ChecklistItems: 2, ChecklistDone: 1, Percent: 50}
+	if *p != want || root.Progress != p {
+		t.Fatalf("Expected %+v, got %+v", want, *p)
+	}
+	if got := root.Subtasks[1].Progress; got.Subtasks != 2 || got.SubtasksDone != 1 || got.Percent != 50 {
+		t.Fatalf("Expected half of the subtasks of 3 done, got %+v", got)
+	}
+
+	// Todos without subtasks or checklist items are complete when done.
+	if got := root.Subtasks[0].Progress.Percent; got != 100 {
+		t.Fatalf("Expected a done leaf to be 100 percent complete, got %d", got)
+	}
+	if got := root.Subtasks[1].Subtasks[1].Progress.Percent; got != 0 {
+		t.Fatalf("Expected an open leaf to be 0 percent complete, got %d", got)
+	}
+}
+
+func TestSubtaskMaxDepthDefault(t *testing.T) {
+	app, _ := newMockApp()
+	if n := app.SubtaskMaxDepth(); n != 5 {
+		t.Fatalf("Expected a max depth of 5, got %d", n)
+	}
+
+	app.Config().Subtasks.MaxDepth = 2
+	if n := app.SubtaskMaxDepth(); n != 2 {
+		t.Fatalf("Expected the configured max depth, got %d", n)
+	}
+}
+
+func TestSubtaskValidation(t *testing.T) {
+	app, _ := newMockApp()
+	todos := handlers.NewTodoHandler(app)
+
+	if w := serveTodo(todos.CreateTodo, http.MethodPost, "/api/todo", `{"title": "a"}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected 400 without list_id or parent_id, got %d", w.Code)
+	}
+	if w := serveTodo(todos.CreateTodo, http.MethodPost, "/api/todo", `{"title": "a", "parent_id": -1}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected 400 for a negative parent_id, got %d", w.Code)
+	}
+	if w := serveTodo(todos.ListTodos, http.MethodGet, "/api/todo?parent_id=-1", ""); w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected 400 for a negative parent_id filter, got %d", w.Code)
+	}
+	if w := serveTodo(todos.GetTodo, http.MethodGet, "/api/todo/1?expand=everything", ""); w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected 400 for an unknown expand, got %d", w.Code)
+	}
+
+	if w := serveTodo(todos.CreateChecklistItem, http.MethodPost, "/api/todo/1/checklist", `{"title": ""}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected 400 for an empty checklist item, got %d", w.Code)
+	}
+	for _, body := range []string{`{"title": ""}`, `{"position": -1}`} {
+		if w := serveTodo(todos.UpdateChecklistItem, http.MethodPut, "/api/todo/1/checklist/1", body); w.Code != http.StatusBadRequest {
+			t.Fatalf("Expected 400 for %s, got %d", body, w.Code)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"todo-app/internal/constants"
+	"todo-app/internal/db"
+	"todo-app/internal/dtos"
+	"todo-app/internal/handlers"
+)
+
+func mustLoadLocation(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	return loc
+}
+
+func TestResolveDueFilter(t *testing.T) {
+	berlin := mustLoadLocation(t, "Europe/Berlin")
+	newYork := mustLoadLocation(t, "America/New_York")
+
+	tests := []struct {
+		name             string
+		due              string
+		now              time.Time
+		loc              *time.Location
+		fromDate, toDate string
+		from, to         time.Time
+	}{
+		{
+			name:     "today in UTC",
+			due:      handlers.DueToday,
+			now:      time.Date(2025, 3, 19, 13, 0, 0, 0, time.UTC),
+			loc:      time.UTC,
+			fromDate: "2025-03-19", toDate: "2025-03-20",
+			from: time.Date(2025, 3, 19, 0, 0, 0, 0, time.UTC),
+			to:   time.Date(2025, 3, 20, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "today is already tomorrow in Berlin",
+			due:      handlers.DueToday,
+			now:      time.Date(2025, 3, 19, 23, 30, 0, 0, time.UTC),
+			loc:      berlin,
+			fromDate: "2025-03-20", toDate: "2025-03-21",
+			from: time.Date(2025, 3, 19, 23, 0, 0, 0, time.UTC),
+			to:   time.Date(2025, 3, 20, 23, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "today is still yesterday in New York",
+			due:      handlers.DueToday,
+			now:      time.Date(2025, 3, 20, 2, 0, 0, 0, time.UTC),
+			loc:      newYork,
+			fromDate: "2025-03-19", toDate: "2025-03-20",
+			from: time.Date(2025, 3, 19, 4, 0, 0, 0, time.UTC),
+			to:   time.Date(2025, 3, 20, 4, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "the day clocks go forward in Berlin has 23 hours",
+			due:      handlers.DueToday,
+			now:      time.Date(2025, 3, 30, 12, 0, 0, 0, time.UTC),
+			loc:      berlin,
+			fromDate: "2025-03-30", toDate: "2025-03-31",
+			from: time.Date(2025, 3, 29, 23, 0, 0, 0, time.UTC),
+			to:   time.Date(2025, 3, 30, 22, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "the day clocks go back in New York has 25 hours",
+			due:      handlers.DueToday,
+			now:      time.Date(2025, 11, 2, 12, 0, 0, 0, time.UTC),
+			loc:      newYork,
+			fromDate: "2025-11-02", toDate: "2025-11-03",
+			from: time.Date(2025, 11, 2, 4, 0, 0, 0, time.UTC),
+			to:   time.Date(2025, 11, 3, 5, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "this week starts on Monday",
+			due:      handlers.DueThisWeek,
+			now:      time.Date(2025, 3, 19, 13, 0, 0, 0, time.UTC),
+			loc:      time.UTC,
+			fromDate: "2025-03-17", toDate: "2025-03-24",
+			from: time.Date(2025, 3, 17, 0, 0, 0, 0, time.UTC),
+			to:   time.Date(2025, 3, 24, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "Sunday belongs to the week before",
+			due:      handlers.DueThisWeek,
+			now:      time.Date(2025, 3, 23, 20, 0, 0, 0, time.UTC),
+			loc:      time.UTC,
+			fromDate: "2025-03-17", toDate: "2025-03-24",
+			from: time.Date(2025, 3, 17, 0, 0, 0, 0, time.UTC),
+			to:   time.Date(2025, 3, 24, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "week across the DST change in Berlin",
+			due:      handlers.DueThisWeek,
+			now:      time.Date(2025, 3, 27, 9, 0, 0, 0, time.UTC),
+			loc:      berlin,
+			fromDate: "2025-03-24", toDate: "2025-03-31",
+			from: time.Date(2025, 3, 23, 23, 0, 0, 0, time.UTC),
+			to:   time.Date(2025, 3, 30, 22, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "overdue is everything before now and before today",
+			due:      handlers.DueOverdue,
+			now:      time.Date(2025, 3, 19, 23, 30, 0, 0, time.UTC),
+			loc:      berlin,
+			fromDate: "", toDate: "2025-03-20",
+			to: time.Date(2025, 3, 19, 23, 30, 0, 0, time.UTC),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &dtos.TodoFilterDTO{Due: tt.due}
+			handlers.ResolveDueFilter(f, tt.now, tt.loc)
+
+			if f.DueFromDate.String() != tt.fromDate || f.DueToDate.String() != tt.toDate {
+				t.Fatalf("Expected dates [%s, %s), got [%s, %s)", tt.fromDate, tt.toDate, f.DueFromDate, f.DueToDate)
+			}
+			if !f.DueFrom.Equal(tt.from) || !f.DueTo.Equal(tt.to) {
+				t.Fatalf("Expected timestamps [%s, %s), got [%s, %s)", tt.from, tt.to, f.DueFrom.UTC(), f.DueTo.UTC())
+			}
+		})
+	}
+}
+
+func TestDate(t *testing.T) {
+	d, err := db.ParseDate("2025-03-30")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, err := db.ParseDate("30.03.2025"); err == nil {
+		t.Fatalf("Expected an invalid date to be refused")
+	}
+
+	b, _ := json.Marshal(struct {
+		Due  db.Date `json:"due"`
+		None db.Date `json:"none"`
+	}{Due: d})
+	if string(b) != `{"due":"2025-03-30","none":null}` {
+		t.Fatalf("Expected a date and null, got %s", b)
+	}
+
+	var back db.Date
+	if err := json.Unmarshal([]byte(`"2025-03-30"`), &back); err != nil || back != d {
+		t.Fatalf("Expected the date to round-trip, got %s (%v)", back, err)
+	}
+
+	if next := d.AddDays(2); next.String() != "2025-04-01" || next.Sub(d) != 2 {
+		t.Fatalf("Expected 2025-04-01 two days later, got %s", next)
+	}
+
+	// Midnight does not exist in Santiago when DST starts.
+	santiago := mustLoadLocation(t, "America/Santiago")
+	start := db.NewDate(2025, 9, 7).In(santiago)
+	if db.DateOf(start) != db.NewDate(2025, 9, 7) || start.Hour() != 1 {
+		t.Fatalf("Expected the day to start at 01:00, got %s", start)
+	}
+}
+
+func serveTodo(h func(http.ResponseWriter, *http.Request), method, target, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	r = r.WithContext(context.WithValue(r.Context(), constants.CurrentUser, &handlers.JwtPayload{Sub: 1}))
+	w := httptest.NewRecorder()
+	h(w, r)
+	return w
+}
+
+func TestTodoScheduleValidation(t *testing.T) {
+	app, _ := newMockApp()
+	todos := handlers.NewTodoHandler(app)
+
+	for _, body := range []string{
+		`{"title": "a", "list_id": 1, "due_at": "tomorrow"}`,
+		`{"title": "a", "list_id": 1, "due_date": "2025-02-30"}`,
+		`{"title": "a", "list_id": 1, "start_date": "2025-03-19T10:00:00Z"}`,
+		`{"title": "a", "list_id": 1, "due_at": "2025-03-19T10:00:00Z", "due_date": "2025-03-19"}`,
+	} {
+		if w := serveTodo(todos.CreateTodo, http.MethodPost, "/api/todo", body); w.Code != http.StatusBadRequest {
+			t.Fatalf("Expected 400 for %s, got %d", body, w.Code)
+		}
+	}
+
+	if w := serveTodo(todos.ListTodos, http.MethodGet, "/api/todo?due=tomorrow", ""); w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected 400 for an unknown due filter, got %d", w.Code)
+	}
+}
@@ -0,0 +1,174 @@
+package test
+
+import (
+	"context"
+	"encoding/base32"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"todo-app/bunapp"
+	"todo-app/internal/constants"
+	"todo-app/internal/handlers"
+	"todo-app/pkg/lockout"
+	"todo-app/pkg/totp"
+	"todo-app/pkg/utils"
+
+	"github.com/benbjohnson/clock"
+)
+
+// RFC 6238 appendix B, SHA-1 with 8 digits.
+func TestHOTPVectors(t *testing.T) {
+	key := []byte("12345678901234567890")
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+		{20000000000, "65353130"},
+	}
+
+	for _, tt := range tests {
+		step := totp.Step(time.Unix(tt.unix, 0))
+		if got := totp.HOTP(key, uint64(step), 8); got != tt.code {
+			t.Fatalf("Expected %s at %d, got %s", tt.code, tt.unix, got)
+		}
+	}
+}
+
+func newMockApp() (*bunapp.App, *clock.Mock) {
+	cfg := &bunapp.AppConfig{}
+	cfg.Jwt.Secret = "access-secret"
+	cfg.Jwt.RefreshSecret = "refresh-secret"
+
+	app := bunapp.New(context.Background(), cfg)
+	mock := clock.NewMock()
+	mock.Set(time.Date(2025, 3, 19, 13, 0, 0, 0, time.UTC))
+	app.SetClock(mock)
+	return app, mock
+}
+
+func TestTOTPValidate(t *testing.T) {
+	app, mock := newMockApp()
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+	code, err := totp.Code(secret, app.Clock().Now())
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	step, ok := totp.Validate(secret, code, app.Clock().Now(), 0)
+	if !ok || step != totp.Step(app.Clock().Now()) {
+		t.Fatalf("Expected current code to be valid")
+	}
+
+	// The code can not be replayed once its step has been used.
+	if _, ok := totp.Validate(secret, code, app.Clock().Now(), step); ok {
+		t.Fatalf("Expected used code to be rejected")
+	}
+
+	// One period of clock drift is tolerated, two are not.
+	mock.Add(totp.Period)
+	if _, ok := totp.Validate(secret, code, app.Clock().Now(), 0); !ok {
+		t.Fatalf("Expected previous code to be accepted within the skew")
+	}
+	mock.Add(totp.Period)
+	if _, ok := totp.Validate(secret, code, app.Clock().Now(), 0); ok {
+		t.Fatalf("Expected code to be rejected outside the skew")
+	}
+}
+
+func TestProvisioningURI(t *testing.T) {
+	uri := totp.ProvisioningURI("Todo App", "alice", "JBSWY3DPEHPK3PXP")
+	if !strings.HasPrefix(uri, "otpauth://totp/Todo%20App:alice?") || !strings.Contains(uri, "secret=JBSWY3DPEHPK3PXP") {
+		t.Fatalf("Unexpected provisioning uri %s", uri)
+	}
+}
+
+func TestMFATokenExpires(t *testing.T) {
+	app, mock := newMockApp()
+	j := handlers.NewAuthHandler(app).NewJWT()
+
+	token, err := j.GenerateMFAToken("alice", 1)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, err := j.VerifyMFAToken(token); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, err := j.VerifyRefreshToken(token); err == nil {
+		t.Fatalf("Expected mfa token to be rejected as refresh token")
+	}
+
+	mock.Add(6 * time.Minute)
+	if _, err := j.VerifyMFAToken(token); err == nil {
+		t.Fatalf("Expected expired mfa token to be rejected")
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := utils.GenerateRecoveryCodes(10)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	seen := map[string]bool{}
+	for _, code := range codes {
+		if len(code) != 11 || code[5] != '-' || seen[code] {
+			t.Fatalf("Unexpected recovery code %q", code)
+		}
+		seen[code] = true
+	}
+
+	if utils.HashRecoveryCode(codes[0]) != utils.HashRecoveryCode(strings.ToUpper(strings.Replace(codes[0], "-", " ", 1))) {
+		t.Fatalf("Expected hash to ignore case and separators")
+	}
+}
+
+func TestMFAManagementLimited(t *testing.T) {
+	app := newTestDB(t)
+	auth := handlers.NewAuthHandler(app)
+
+	// Alice has two-factor authentication enabled, Bob has yet to confirm.
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+	_, err := app.DB().Exec(`UPDATE users SET totp_secret = ?, totp_enabled_at = CASE WHEN id = ? THEN now() END WHERE id IN (?, ?)`,
+		secret, alice, alice, bob)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	wrong := "000000"
+	if code, _ := totp.Code(secret, app.Clock().Now()); code == wrong {
+		wrong = "111111"
+	}
+
+	tests := []struct {
+		name    string
+		userID  int64
+		handler http.HandlerFunc
+		body    string
+	}{
+		{"confirm", bob, auth.ConfirmTOTP, `{"code": "` + wrong + `"}`},
+		{"disable", alice, auth.DisableTOTP, `{"password": "guess", "code": "` + wrong + `"}`},
+		{"recovery codes", alice, auth.RegenerateRecoveryCodes, `{"code": "` + wrong + `"}`},
+	}
+	for _, tt := range tests {
+		l := lockout.NewLimiter(lockout.NewMemoryStore())
+		app.SetLoginLimiter(l)
+
+		var w *httptest.ResponseRecorder
+		for i := 0; i <= l.Account.Free+1; i++ {
+			r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body))
+			r = r.WithContext(context.WithValue(r.Context(), constants.CurrentUser, &handlers.JwtPayload{Sub: tt.userID}))
+			w = httptest.NewRecorder()
+			tt.handler(w, r)
+		}
+		if w.Code != http.StatusTooManyRequests {
+			t.Fatalf("Expected %s to back off after failed attempts, got %d", tt.name, w.Code)
+		}
+	}
+}
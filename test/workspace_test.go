@@ -0,0 +1,69 @@
+package test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"todo-app/internal/constants"
+	"todo-app/internal/db"
+	"todo-app/internal/handlers"
+)
+
+func serveWorkspace(claims *handlers.JwtPayload, header string) *httptest.ResponseRecorder {
+	app, _ := newMockApp()
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	if claims != nil {
+		r = r.WithContext(context.WithValue(r.Context(), constants.CurrentUser, claims))
+	}
+	if header != "" {
+		r.Header.Set(handlers.WorkspaceHeader, header)
+	}
+	w := httptest.NewRecorder()
+	handlers.NewTodoHandler(app).Workspace(next).ServeHTTP(w, r)
+	return w
+}
+
+func TestWorkspaceHeader(t *testing.T) {
+	claims := &handlers.JwtPayload{Sub: 1}
+
+	if w := serveWorkspace(nil, "1"); w.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected 401, got %d", w.Code)
+	}
+	for _, header := range []string{"abc", "0", "-3"} {
+		if w := serveWorkspace(claims, header); w.Code != http.StatusBadRequest {
+			t.Fatalf("Expected 400 for %q, got %d", header, w.Code)
+		}
+	}
+}
+
+func TestWorkspaceRestrictedToken(t *testing.T) {
+	pinned := &handlers.JwtPayload{Sub: 1, WorkspaceID: 7}
+
+	if w := serveWorkspace(pinned, "8"); w.Code != http.StatusForbidden {
+		t.Fatalf("Expected 403, got %d", w.Code)
+	}
+}
+
+func TestAccessTokenCarriesWorkspace(t *testing.T) {
+	j, _ := newTestJWT(t)
+
+	sub := handlers.NewTokenSubject(&db.User{ID: 1, Username: "alice"})
+	sub.WorkspaceID = 42
+	pair, err := j.GenerateTokenPair(sub, "")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	claims, err := j.VerifyAccessToken(pair.AccessToken)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if claims.WorkspaceID != 42 {
+		t.Fatalf("Expected workspace 42, got %d", claims.WorkspaceID)
+	}
+}